@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"strings"
 
 	"github.com/apparentlymart/go-hcl-overlay/hcloverlay"
 	"github.com/hashicorp/hcl/v2"
@@ -17,19 +16,18 @@ func main() {
 	var config Config
 	rootSchema, _ := gohcl.ImpliedBodySchema(&config)
 
-	// First we extract the arguments that correspond with items in the
-	// configuration schema, like --io_mode=foo or
-	// --service.foo.bar.listen_addr=blah .
-	overlays, args, diags := hcloverlay.ExtractCLIOptions(os.Args[1:], rootSchema)
-
-	// "args" is what's left of the arguments after removing the CLI argument
-	// options. We can now use pflag to extract other options that are not
-	// related to the configuration schema.
+	// The options for overriding configuration settings are derived from
+	// the same schema that we decode the configuration with, and are
+	// registered alongside our other options, like --json, so that pflag
+	// can handle all of them together. For example, --io_mode=foo or
+	// --service=foo.bar.listen_addr=blah .
 	flags := flag.NewFlagSet("cliargs", flag.ExitOnError)
-	flags.Usage = showUsage
+	flags.Usage = showUsage(flags)
 	printJSON := flags.BoolP("json", "j", false, "Produce JSON instead of a human-oriented format")
-	flags.Parse(args)
-	args = flags.Args()
+	collectOverlays := hcloverlay.BindOverlayFlags(flags, rootSchema)
+	flags.Parse(os.Args[1:])
+	args := flags.Args()
+	overlays, diags := collectOverlays()
 
 	// Now "args" contains only the non-option arguments. There should be one
 	// left, which is the configuration file.
@@ -42,9 +40,7 @@ func main() {
 	parser := hclparse.NewParser()
 	file, moreDiags := parser.ParseHCLFile(filename)
 	diags = append(diags, moreDiags...)
-	body := hcloverlay.ApplyOverlays(file.Body, overlays...)
-
-	moreDiags = gohcl.DecodeBody(body, nil, &config)
+	moreDiags = hcloverlay.DecodeBodyWithOverlays(file.Body, nil, &config, overlays...)
 	diags = append(diags, moreDiags...)
 
 	pr := hcl.NewDiagnosticTextWriter(os.Stderr, parser.Files(), 80, true)
@@ -79,20 +75,11 @@ func printConfig(config *Config) {
 	}
 }
 
-func showUsage() {
-	fmt.Fprintln(os.Stderr, strings.TrimSpace(`
-go run . [options] <config-file>
-
-Options:
-  --json, -j
-      Produce JSON output instead of human-oriented output.
-
-  --io_mode=MODE
-      Override the io_mode configuration argument.
-
-  --service.TYPE.NAME.listen_addr=ADDR
-	  Override the listen address for the service with the given TYPE and NAME.
-`))
+func showUsage(flags *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintln(os.Stderr, "go run . [options] <config-file>\n\nOptions:")
+		fmt.Fprint(os.Stderr, flags.FlagUsages())
+	}
 }
 
 type ServiceConfig struct {
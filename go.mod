@@ -1,10 +1,11 @@
 module github.com/apparentlymart/go-hcl-overlay
 
-go 1.14
+go 1.16
 
 require (
 	github.com/google/go-cmp v0.3.1
 	github.com/hashicorp/hcl/v2 v2.5.1
 	github.com/hashicorp/hcl2 v0.0.0-20191002203319-fb75b3253c80
+	github.com/spf13/pflag v1.0.2
 	github.com/zclconf/go-cty v1.2.0
 )
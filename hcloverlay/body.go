@@ -0,0 +1,141 @@
+package hcloverlay
+
+import (
+	"github.com/hashicorp/hcl/v2"
+)
+
+// NewBodyOverlay returns an overlay that merges the content of the given
+// body into the content of the body it is applied to, which can be used to
+// layer the content of one configuration file over another.
+//
+// When applied, the overlay body is decoded using the same schema as the
+// body being overlaid, and so it must conform to that schema in the same
+// way as the main body would, except that required arguments may be
+// omitted. Its content is then merged as follows:
+//
+//     - Any argument in the overlay body replaces any argument of the same
+//       name in the main body, or is added if no such argument exists.
+//
+//     - Any block in the overlay body whose type and labels match a block
+//       in the main body is merged into the first such block, by
+//       recursively applying this same process with the overlay block's
+//       body as an overlay on the main block's body.
+//
+//     - Any block in the overlay body that does not match any existing
+//       block is appended to the blocks of the main body. Blocks are
+//       matched only against the blocks of the main body, and so if the
+//       overlay body has several blocks with the same type and labels that
+//       don't match any existing block then they are all appended.
+//
+// Unlike overlays created from CLI arguments, attributes and blocks in the
+// overlay body retain their original source location information.
+//
+// Use NewBodyOverlayWithMode to choose a different treatment of blocks.
+func NewBodyOverlay(body hcl.Body) Overlay {
+	return NewBodyOverlayWithMode(body, MergeBlocks)
+}
+
+// NewBodyOverlayWithMode is a variant of NewBodyOverlay that uses the given
+// mode to decide how blocks in the overlay body interact with blocks in the
+// body being overlaid. Arguments are treated as for NewBodyOverlay
+// regardless of the mode.
+//
+// The mode also applies when merging the bodies of nested blocks.
+func NewBodyOverlayWithMode(body hcl.Body, mode BlockMergeMode) Overlay {
+	return &bodyOverlay{
+		body: body,
+		mode: mode,
+	}
+}
+
+// BlockMergeMode decides how NewBodyOverlayWithMode treats a block in the
+// overlay body whose type and labels match a block in the body being
+// overlaid.
+type BlockMergeMode int
+
+const (
+	// MergeBlocks merges the body of the overlay block into the body of the
+	// first matching block, so that individual arguments are overridden
+	// while others are retained. Blocks that don't match any existing
+	// block are appended. This is the behavior of NewBodyOverlay.
+	MergeBlocks BlockMergeMode = iota
+
+	// AppendBlocks appends all of the blocks in the overlay body, regardless
+	// of whether they match existing blocks.
+	AppendBlocks
+
+	// ReplaceBlocks replaces the first matching block with the overlay
+	// block, discarding all of the content of the original block. Blocks
+	// that don't match any existing block are appended.
+	ReplaceBlocks
+)
+
+type bodyOverlay struct {
+	body hcl.Body
+	mode BlockMergeMode
+}
+
+func (o *bodyOverlay) String() string {
+	if filename := o.body.MissingItemRange().Filename; filename != "" {
+		return "merge content from " + filename
+	}
+	return "merge content from a body"
+}
+
+func (o *bodyOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	overContent, diags := o.body.Content(schema)
+	return o.merge(content, overContent), diags
+}
+
+func (o *bodyOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	overContent, remain, diags := o.body.PartialContent(schema)
+	return o.merge(content, overContent), NewBodyOverlayWithMode(remain, o.mode), diags
+}
+
+func (o *bodyOverlay) ApplyJustAttributes(attrs hcl.Attributes) (hcl.Attributes, hcl.Diagnostics) {
+	overAttrs, diags := o.body.JustAttributes()
+	if attrs == nil {
+		attrs = make(hcl.Attributes)
+	}
+	for name, attr := range overAttrs {
+		attrs[name] = attr
+	}
+	return attrs, diags
+}
+
+func (o *bodyOverlay) merge(content, overContent *hcl.BodyContent) *hcl.BodyContent {
+	content = ensureContent(content)
+	if overContent == nil {
+		return content
+	}
+
+	for name, attr := range overContent.Attributes {
+		content.Attributes[name] = attr
+	}
+
+	// We'll match only against the blocks that were already present, so
+	// that repeated blocks appended from the overlay body don't merge with
+	// one another.
+	existing := len(content.Blocks)
+Blocks:
+	for _, overBlock := range overContent.Blocks {
+		if o.mode == AppendBlocks {
+			content.Blocks = append(content.Blocks, overBlock)
+			continue
+		}
+		for i, block := range content.Blocks[:existing] {
+			if block.Type != overBlock.Type || !labelsMatch(block.Labels, overBlock.Labels) {
+				continue
+			}
+			if o.mode == ReplaceBlocks {
+				content.Blocks[i] = overBlock
+			} else {
+				block.Body = ApplyOverlays(block.Body, NewBodyOverlayWithMode(overBlock.Body, o.mode))
+			}
+			continue Blocks
+		}
+		content.Blocks = append(content.Blocks, overBlock)
+	}
+
+	return content
+}
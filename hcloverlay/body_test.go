@@ -0,0 +1,268 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestNewBodyOverlay(t *testing.T) {
+	type Listener struct {
+		Port int `hcl:"port"`
+	}
+	type Service struct {
+		Type       string     `hcl:"type,label"`
+		Name       string     `hcl:"name,label"`
+		ListenAddr string     `hcl:"listen_addr"`
+		LogLevel   string     `hcl:"log_level,optional"`
+		Listeners  []Listener `hcl:"listener,block"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	base := `
+io_mode = "sync"
+
+service "http" "web" {
+  listen_addr = "127.0.0.1:8080"
+  listener {
+    port = 1
+  }
+}
+
+service "http" "api" {
+  listen_addr = "127.0.0.1:8081"
+}
+`
+	override := `
+io_mode = "async"
+
+service "http" "web" {
+  log_level = "debug"
+  listener {
+    port = 2
+  }
+}
+
+service "http" "admin" {
+  listen_addr = "127.0.0.1:8082"
+}
+`
+
+	baseF, diags := hclsyntax.ParseConfig([]byte(base), "base.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("base config has problems: %s", diags.Error())
+	}
+	overrideF, diags := hclsyntax.ParseConfig([]byte(override), "override.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("override config has problems: %s", diags.Error())
+	}
+
+	body := ApplyOverlays(baseF.Body, NewBodyOverlay(overrideF.Body))
+
+	var got Config
+	diags = gohcl.DecodeBody(body, nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		IOMode: "async",
+		Services: []Service{
+			{
+				Type:       "http",
+				Name:       "web",
+				ListenAddr: "127.0.0.1:8080",
+				LogLevel:   "debug",
+				Listeners: []Listener{
+					// The nested blocks have no labels, so the override's
+					// block matches and replaces the base block's port.
+					{Port: 2},
+				},
+			},
+			{
+				Type:       "http",
+				Name:       "api",
+				ListenAddr: "127.0.0.1:8081",
+			},
+			{
+				Type:       "http",
+				Name:       "admin",
+				ListenAddr: "127.0.0.1:8082",
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+
+	// Arguments from the override body should retain their source ranges.
+	content, diags := body.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "io_mode"}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "service", LabelNames: []string{"type", "name"}}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := content.Attributes["io_mode"].Range.Filename, "override.hcl"; got != want {
+		t.Errorf("wrong filename for io_mode %q; want %q", got, want)
+	}
+}
+
+func TestNewBodyOverlayRepeatedBlocks(t *testing.T) {
+	type Listener struct {
+		Port int `hcl:"port"`
+	}
+	type Config struct {
+		Listeners []Listener `hcl:"listener,block"`
+	}
+
+	overrideF, diags := hclsyntax.ParseConfig([]byte(`
+listener {
+  port = 1
+}
+listener {
+  port = 2
+}
+`), "override.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("override config has problems: %s", diags.Error())
+	}
+
+	var got Config
+	diags = gohcl.DecodeBody(ApplyOverlays(hcl.EmptyBody(), NewBodyOverlay(overrideF.Body)), nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		Listeners: []Listener{{Port: 1}, {Port: 2}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+}
+
+func TestNewBodyOverlayUnexpected(t *testing.T) {
+	baseF, diags := hclsyntax.ParseConfig([]byte(`foo = "a"`), "base.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("base config has problems: %s", diags.Error())
+	}
+	overrideF, diags := hclsyntax.ParseConfig([]byte(`bar = "b"`), "override.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("override config has problems: %s", diags.Error())
+	}
+
+	body := ApplyOverlays(baseF.Body, NewBodyOverlay(overrideF.Body))
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "foo"}},
+	}
+
+	_, diags = body.Content(schema)
+	if !diags.HasErrors() {
+		t.Fatalf("unexpected success")
+	}
+	if got, want := diags[0].Subject.Filename, "override.hcl"; got != want {
+		t.Errorf("wrong filename in error %q; want %q", got, want)
+	}
+
+	// PartialContent should instead leave the unexpected argument in the
+	// remaining body.
+	_, remain, diags := body.PartialContent(schema)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	attrs, diags := remain.JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if _, exists := attrs["bar"]; !exists {
+		t.Errorf("bar is not in the remaining body")
+	}
+	if _, exists := attrs["foo"]; exists {
+		t.Errorf("foo is in the remaining body")
+	}
+}
+
+func TestNewBodyOverlayWithMode(t *testing.T) {
+	type Service struct {
+		Name       string  `hcl:"name,label"`
+		ListenAddr *string `hcl:"listen_addr"`
+		LogLevel   *string `hcl:"log_level"`
+	}
+	type Config struct {
+		Services []Service `hcl:"service,block"`
+	}
+	strPtr := func(s string) *string {
+		return &s
+	}
+
+	base := `
+service "web" {
+  listen_addr = "127.0.0.1:8080"
+}
+`
+	override := `
+service "web" {
+  log_level = "debug"
+}
+service "api" {
+  log_level = "info"
+}
+`
+
+	tests := map[string]struct {
+		Mode BlockMergeMode
+		Want []Service
+	}{
+		"merge": {
+			MergeBlocks,
+			[]Service{
+				{Name: "web", ListenAddr: strPtr("127.0.0.1:8080"), LogLevel: strPtr("debug")},
+				{Name: "api", LogLevel: strPtr("info")},
+			},
+		},
+		"append": {
+			AppendBlocks,
+			[]Service{
+				{Name: "web", ListenAddr: strPtr("127.0.0.1:8080")},
+				{Name: "web", LogLevel: strPtr("debug")},
+				{Name: "api", LogLevel: strPtr("info")},
+			},
+		},
+		"replace": {
+			ReplaceBlocks,
+			[]Service{
+				{Name: "web", LogLevel: strPtr("debug")},
+				{Name: "api", LogLevel: strPtr("info")},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			baseF, diags := hclsyntax.ParseConfig([]byte(base), "base.hcl", hcl.Pos{Line: 1, Column: 1})
+			if diags.HasErrors() {
+				t.Fatalf("base config has problems: %s", diags.Error())
+			}
+			overrideF, diags := hclsyntax.ParseConfig([]byte(override), "override.hcl", hcl.Pos{Line: 1, Column: 1})
+			if diags.HasErrors() {
+				t.Fatalf("override config has problems: %s", diags.Error())
+			}
+
+			body := ApplyOverlays(baseF.Body, NewBodyOverlayWithMode(overrideF.Body, test.Mode))
+
+			var got Config
+			diags = gohcl.DecodeBody(body, nil, &got)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, got.Services); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
@@ -2,10 +2,16 @@ package hcloverlay
 
 import (
 	"fmt"
-	"reflect"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/zclconf/go-cty/cty"
 )
@@ -18,36 +24,422 @@ import (
 // through the configuration to an argument to set or override. The part
 // after the equals sign is a string value to set the argument to.
 //
+// If the equals sign is immediately preceded by a colon, as in
+// "replicas:=3", then the part after the ":=" operator is instead parsed as
+// an HCL native syntax expression, which allows setting values of types
+// other than string, such as numbers, bools, or collections. In particular,
+// "tags:=[]" and "labels:={}" set an argument to an empty collection, which
+// decodes into an empty Go slice or map rather than a nil one, and so can
+// be distinguished from the argument not being set at all.
+//
+// If the equals sign is instead immediately preceded by a plus sign, as in
+// "tags+=prod", then the string value is appended as a new element to the
+// existing sequence value of the argument, or becomes the only element of a
+// new sequence if the argument isn't already set. The existing value is
+// evaluated only when the resulting argument is evaluated, and so it may
+// be any expression that produces a list, set, or tuple value.
+//
 // The result is an overlay that replaces the value of the indicated argument
-// with the given string value.
+// with the given string value or expression, or appends the value to it.
+//
+// Precisely, the argument is split at its first equals sign that is not
+// inside a quoted path component, and so a value may itself contain equals
+// signs, as in "query=a=b", while an equals sign can appear in the path only
+// inside a quoted block label, as in service."a=b".listen_addr=... If the
+// character immediately before that equals sign is a colon or a plus sign
+// then it belongs to the operator rather than to the path.
+//
+// Everything after the operator is the value. A string value given with the
+// "=" or "+=" operator is used verbatim, except that if it begins with a
+// backslash then that backslash is removed and the remainder is used
+// literally, without interpreting any prefix it might have, such as the "@"
+// prefix accepted by ParseCLIArgumentFiles. For example, "greeting=\@hello"
+// sets the argument to "@hello" in all cases, and a value that must begin
+// with a literal backslash is written with two, as in "path=\\server".
+// Expression values given with the ":=" operator use the native syntax
+// escaping rules instead, and are never subject to prefix interpretation.
+//
+// A value may span several lines. Any newlines in a string value, such as
+// those a shell passes through from a quoted argument, are preserved along
+// with all other whitespace, including at the start and end of the value,
+// and a value containing newlines is never inferred to be a number or bool.
+// Multi-line text can also be written inline using the heredoc syntax of
+// the ":=" operator, as in "motd:=<<EOT" followed by the lines of text and
+// then a line containing only "EOT", with or without a final newline.
 //
 // This overlay is intended to be used with HCL-based configuration languages
 // that have the following constraints in addition to those of the HCL infoset:
 //
-//     - All blocks must be uniquely identified by their block type and labels.
+//     - Blocks should be uniquely identified by their block type and labels.
 //       If multiple blocks appear in the same body with the same header,
 //       an override for that header will apply only to the first such block
-//       in the source configuration.
+//       in the source configuration, unless the last label (or the block
+//       type, for a block type with no labels) is followed by a zero-based
+//       index in square brackets, as in service.web[2].listen_addr=...
+//       An index never causes a new block to be created: it is an error
+//       to give an index that is not less than the number of matching blocks.
+//       The index [*] instead applies the override to all of the matching
+//       blocks, as in service.web[*].log_level=...
+//
+//     - A path through a block must give exactly as many labels as the
+//       schema declares for its block type, because the step after the
+//       labels is interpreted as an argument or block type inside the block.
+//       To select blocks by only some of their labels, give a wildcard or
+//       placeholder for each of the others, as described below. A path that
+//       ends before all of the labels are given is an error that reports
+//       how many labels the block type requires, and it is also an error if
+//       a block in the content being overridden has a different number of
+//       labels than the schema declares, which can happen only if the
+//       content was decoded using a different schema.
 //
-//     - All argument names, block types, and block labels must be valid HCL
-//       identifiers, as decided by hclsyntax.ValidIdentifier .
+//     - An unquoted asterisk in place of a block label matches blocks with
+//       any value for that label, and applies the override to all of the
+//       matching blocks, as in service.web.*.log_level=... Because the
+//       labels of a new block can't be decided from a wildcard, no new
+//       block is created if there are no matching blocks.
 //
-//     - All arguments that may be overridden must accept strings, either
-//       directly or as the input to a type conversion.
+//     - An unquoted underscore in place of a block label also matches blocks
+//       with any value for that label, as in service._.web.listen_addr=...
+//       to match service blocks whose second label is "web" regardless of
+//       the first, but it is an error if there are no matching blocks where
+//       the overlay would otherwise create one. A block label that is
+//       literally an underscore must therefore be quoted, as in "_".
+//
+//     - All argument names and block types must be valid HCL identifiers, as
+//       decided by hclsyntax.ValidIdentifier , unless a different rule is
+//       selected using ParseOptions.ValidSegment. Block labels that are not
+//       valid identifiers, such as those containing dots, can be given
+//       as quoted strings, as in service."web.prod".listen_addr=...
+//
+//     - All arguments that may be overridden using the "=" form must accept
+//       strings, either directly or as the input to a type conversion.
 //
 // If the given string traverses through a block whose type is derived by the
 // schema but that does not exist in the configuration being overridden then
 // the overlay will create a new block with the appropriate labels that
-// contains only the specified argument.
+// contains only the specified argument. ParseCLIArgumentWithOpts can instead
+// produce an overlay that reports an error in that case, using the NoCreate
+// option.
+//
+// If the path continues after reaching an argument, as in labels.env=prod
+// where labels is an argument rather than a block type, then the remaining
+// steps are taken as a key to set inside the map or object value of that
+// argument, leaving any other keys unchanged. More than one remaining step,
+// as in database.primary.host=b, sets a key inside a nested map or object,
+// leaving the siblings at each level unchanged. Because the schema does not
+// describe the internal structure of an argument, the existing value is
+// merged with the new key only when the resulting argument is evaluated.
+// If the argument isn't already set then the result is an object containing
+// only the given key, nested inside further objects as needed to reach it,
+// and the same is true for any intermediate key that isn't already set.
+//
+// A schema constructed directly, rather than derived from a Go struct or
+// a decoder spec, may have an argument and a block type of the same name.
+// In that case a path with further steps after that name refers to the
+// block type, as in service.http.web.listen_addr=..., while a path of
+// only the name itself refers to the argument, as in service=web.
+//
+// String values given to CLI argument overlays have no source location
+// information, so an application using overlays returned from this method
+// must be prepared to accept zero-value hcl.Range values and treat them as
+// the absence of a range if accessing the ranges of the expressions, and of
+// any new attributes and blocks, in resulting content. Use
+// ParseCLIArgumentWithOpts with a synthetic filename to produce ranges for
+// string values instead.
 //
-// Argument values overridden by CLI argument overlays will have no source
-// location information, so an application using overlays returned from this
-// method must be prepared to accept zero-value hcl.Range values and treat
-// them as the absense of a range if accessing the ranges associated with
-// attributes and blocks in resulting content.
+// Expressions given with the ":=" operator always have ranges describing
+// the position of the expression within the argument, so that errors from
+// evaluating them, such as a failed type conversion, can refer to it. Their
+// filename is the one given in ParseOptions, or a synthetic filename that
+// describes the argument if none is given.
+//
+// When an overlay replaces an argument that was already set, the resulting
+// attribute retains the Range and NameRange of the original declaration,
+// so that diagnostics about the argument as a whole can still refer to the
+// configuration, and only its expression, with the range described above,
+// is replaced.
 func ParseCLIArgument(raw string) (Overlay, hcl.Diagnostics) {
+	return ParseCLIArgumentWithOpts(raw, nil)
+}
+
+// ParseCLIArguments parses each of the given strings in the same way as
+// ParseCLIArgument and returns a single overlay, produced by MergeOverlays,
+// that applies all of the valid arguments in the given order.
+//
+// Invalid arguments contribute error diagnostics but do not prevent the
+// remaining arguments from being parsed, so that all of the problems can be
+// reported together. The returned overlay is never nil, but callers should
+// typically not use it if the diagnostics contain errors.
+func ParseCLIArguments(raws []string) (Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	overlays := make([]Overlay, 0, len(raws))
+	for _, raw := range raws {
+		o, moreDiags := ParseCLIArgument(raw)
+		diags = append(diags, moreDiags...)
+		if o != nil {
+			overlays = append(overlays, o)
+		}
+	}
+	return MergeOverlays(overlays...), diags
+}
+
+// NewCLIArgumentOverlay is like ParseCLIArgument except that it takes the
+// path and the value separately, with the path already split into steps,
+// rather than parsing both from a single string. This is useful for
+// applications that have already separated the path from the value, because
+// the value can then contain any characters, including equals signs.
+//
+// Each element of path is used literally as a single step, and so block
+// labels may contain dots or any other characters without quoting. The
+// syntax for indices, wildcards, and operators is therefore not available,
+// and the result always sets the indicated argument to the given string.
+func NewCLIArgumentOverlay(path []string, value string) (Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if len(path) == 0 {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   "Invalid argument: the path must have at least one step.",
+		})
+		return nil, diags
+	}
+
+	steps := namedSteps(path)
+	return &cliArgOverlay{
+		fullPath: formatCLIPath(steps),
+		steps:    steps,
+		op:       cliArgSet,
+		expr:     hcl.StaticExpr(cty.StringVal(value), hcl.Range{}),
+	}, diags
+}
+
+// ParseOptions represents optional settings for ParseCLIArgumentWithOpts.
+// The zero value of ParseOptions selects the same behavior as
+// ParseCLIArgument.
+type ParseOptions struct {
+	// Filename, if set, is a synthetic filename such as "<command-line>"
+	// to use in the source ranges of string values given in arguments. The
+	// byte offsets, lines, and columns of those ranges then refer to the
+	// position of the value within the argument string itself, so that
+	// diagnostics about the resulting argument can report that it came
+	// from the command line and highlight the value.
+	//
+	// If Filename is empty then string values have zero-value source ranges,
+	// while expressions given with the ":=" operator have ranges with a
+	// synthetic filename describing the argument.
+	Filename string
+
+	// Source, if set, describes where the argument came from, such as
+	// "environment variable APP_IO_MODE", and is included in the messages
+	// of diagnostics about the resulting overlay so that users can tell
+	// which of several sources of overlays a problem relates to.
+	Source string
+
+	// InferTypes, if set, causes values given with the "=" and "+="
+	// operators to become numbers or bools instead of strings when they
+	// look like them, so that arguments like "port=8080" can be used with
+	// languages that don't convert strings to the types they expect.
+	//
+	// A value is a bool if it is exactly "true" or "false", in lowercase.
+	// A value is a number if it matches the syntax of a JSON number: an
+	// optional minus sign, an integer part with no leading zeros unless it
+	// is exactly "0", an optional fractional part of a period followed by
+	// at least one digit, and an optional exponent, as in "8080", "-1",
+	// "1.0", "0.5", or "1e3". Values that don't match, such as "08", "+1",
+	// ".5", "1.", "0x10", or "Inf", remain strings, and so a value with
+	// leading zeros such as a postal code keeps its exact spelling. There is
+	// no distinction between integers and other numbers, so "1.0" and "1"
+	// produce the same value.
+	//
+	// A value given with the "=" operator that is exactly "[]" or "{}"
+	// becomes an empty tuple or an empty object respectively, as if given
+	// with the ":=" operator, so that "tags=[]" clears a list argument and
+	// "labels={}" clears a map argument. With the "+=" operator those
+	// values remain strings, because an empty collection is not a useful
+	// element to append.
+	//
+	// Values escaped with a leading backslash, as in "port=\8080", values
+	// read from files, and quoted values accepted because of UnquoteValues
+	// are always strings.
+	InferTypes bool
+
+	// UnquoteValues, if set, causes a value given with the "=" or "+="
+	// operators that begins with a double quote to be interpreted as a
+	// quoted string, as in greeting="  hello  ", using the same escape
+	// sequences as Go string literals, so that "a\"b" becomes a"b. This
+	// allows preserving leading and trailing whitespace in values that
+	// come from files, where there is no shell to remove quotes and so a
+	// quote would otherwise be part of the value. Spaces and tabs after the
+	// closing quote are ignored, and any other text after it is an error.
+	//
+	// Arguments from a command line should not use this option, because
+	// the shell has already removed any quotes the user intended as
+	// quoting, and so any that remain are meant literally. A value that
+	// begins with a backslash escape, as in greeting=\"hi", is also used
+	// literally even with this option.
+	UnquoteValues bool
+
+	// Transform, if set, is called for each string value given with the "="
+	// or "+=" operators, after removing any escape or quotes and reading any
+	// file but before inferring a type, and its result is used in place of
+	// the value as given. This allows applications to normalize certain
+	// values, such as by making a filesystem path absolute, before they
+	// are used.
+	//
+	// path is the full path of the argument, split into steps, so that the
+	// function can decide which values to transform. That includes any
+	// block types and labels the path traverses through, even if the
+	// overlay will create the blocks, and any unquoted wildcard or
+	// placeholder label appears as "*" or "_" respectively. Indices in
+	// square brackets are not included.
+	//
+	// Any diagnostics the function returns are included in the result of
+	// parsing the argument, and if they include errors then no overlay is
+	// returned. Values given as expressions using the ":=" operator are not
+	// passed to Transform.
+	Transform func(path []string, raw string) (string, hcl.Diagnostics)
+
+	// NoCreate, if set, prevents the resulting overlay from creating a new
+	// block when its path selects a block that doesn't exist, as it would
+	// by default. Instead, applying the overlay produces an error, so that
+	// a mistyped block label is reported rather than silently creating an
+	// unintended block.
+	NoCreate bool
+
+	// ValidSegment, if set, is used instead of hclsyntax.ValidIdentifier to
+	// decide which unquoted steps of the path are acceptable, for languages
+	// whose argument names and block types use a different identifier
+	// syntax, such as allowing a leading digit. It is called with each step
+	// after splitting the path at dots and square brackets, and so a step
+	// that contains those characters or double quotes must still be quoted
+	// regardless of what the function accepts. Quoted steps, and the
+	// wildcard "*" and placeholder "_", are always acceptable.
+	ValidSegment func(string) bool
+}
+
+// ParseCLIArgumentWithOpts is a variant of ParseCLIArgument that accepts
+// some additional options that customize its behavior.
+//
+// Passing nil options is equivalent to passing a pointer to the zero value
+// of ParseOptions, and thus to calling ParseCLIArgument.
+func ParseCLIArgumentWithOpts(raw string, opts *ParseOptions) (Overlay, hcl.Diagnostics) {
+	return parseCLIArgument(raw, nil, opts, hcl.InitialPos)
+}
+
+// ParseCLIArgumentJSON is a variant of ParseCLIArgument for use with
+// configuration written in the JSON variant of HCL, where the names of
+// arguments, block types, and object keys are JSON property names that are
+// not required to be valid HCL identifiers.
+//
+// Each unquoted step of the path may be any non-empty sequence of characters
+// other than dots, square brackets, and double quotes, and so names like
+// "2fa", "@type", or "text/plain" can be given without quoting, as in
+// "2fa=true". Names that contain those characters can be
+// given as quoted strings, as with block labels in ParseCLIArgument. An
+// unquoted asterisk is still a wildcard.
+//
+// Because a name can contain the characters of the ":=" and "+=" operators,
+// a path that ends with one of those characters is always interpreted as
+// being followed by the operator. To set an argument whose name ends with
+// a colon or plus sign, quote its name, as in "\"a+\"=b".
+//
+// The resulting overlay sets the argument under exactly the given name.
+func ParseCLIArgumentJSON(raw string) (Overlay, hcl.Diagnostics) {
+	return parseCLIArgument(raw, nil, &ParseOptions{ValidSegment: validJSONName}, hcl.InitialPos)
+}
+
+// validJSONName returns true if the given unquoted path step is acceptable
+// for ParseCLIArgumentJSON.
+func validJSONName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `.[]"`)
+}
+
+// ParseCLIArgumentFiles is a variant of ParseCLIArgument that additionally
+// allows the value of a string argument to be loaded from a file, by
+// writing an "@" followed by the filename after the equals sign, as in
+// "tls.cert=@server.pem". The entire contents of the file then become the
+// string value of the argument.
+//
+// To set an argument to a literal string that begins with "@", double the
+// leading "@", as in "greeting=@@hello", or use the backslash escape
+// described for ParseCLIArgument, as in "greeting=\@hello". Only the first
+// "@" or backslash is removed.
+//
+// The "@" prefix is significant only for the string form of argument. Values
+// given using the ":=" operator are always interpreted as expressions.
+//
+// If fsys is nil then filenames are interpreted as paths on the host
+// filesystem, relative to the current working directory. Otherwise, they
+// are interpreted as paths within the given filesystem.
+//
+// The special filename "-", as in "token=@-", reads the value from the
+// process's standard input instead. Standard input can be read only once,
+// so applications that parse more than one argument should use a single
+// FileArgumentParser for all of them, which reports an error if more than
+// one argument requests standard input.
+func ParseCLIArgumentFiles(raw string, fsys fs.FS) (Overlay, hcl.Diagnostics) {
+	p := &FileArgumentParser{FS: fsys}
+	return p.Parse(raw)
+}
+
+// FileArgumentParser parses a sequence of arguments using the same syntax
+// as ParseCLIArgumentFiles, while tracking which of them requested a value
+// from standard input.
+//
+// Values are read as each argument is parsed, rather than when the
+// resulting overlays are applied, so any problems reading them are
+// reported by Parse.
+type FileArgumentParser struct {
+	// FS is the filesystem that filenames are interpreted within. If it is
+	// nil then filenames are paths on the host filesystem, relative to the
+	// current working directory.
+	FS fs.FS
+
+	// Stdin is the reader that a value is read from for an argument using
+	// the special filename "-". If it is nil then os.Stdin is used.
+	//
+	// Stdin is read to its end by the first argument that requests it, and
+	// it is an error for any subsequent argument to request it.
+	Stdin io.Reader
+
+	stdinPath string // path of the argument that read Stdin, if any
+}
+
+// Parse parses a single argument as described for ParseCLIArgumentFiles.
+func (p *FileArgumentParser) Parse(raw string) (Overlay, hcl.Diagnostics) {
+	readFile := func(filename string) ([]byte, error) {
+		if filename != "-" {
+			if p.FS == nil {
+				return os.ReadFile(filename)
+			}
+			return fs.ReadFile(p.FS, filename)
+		}
+
+		if p.stdinPath != "" {
+			return nil, fmt.Errorf("it was already read for argument %q", p.stdinPath)
+		}
+		// We're only called for arguments that have a valid equals sign,
+		// which may be preceded by the "+" operator.
+		p.stdinPath = strings.TrimSuffix(raw[:indexUnquoted(raw, '=')], "+")
+		stdin := p.Stdin
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+		return io.ReadAll(stdin)
+	}
+	return parseCLIArgument(raw, readFile, nil, hcl.InitialPos)
+}
+
+// parseCLIArgument is the common implementation of the various functions
+// that parse CLI arguments. If source ranges are requested in opts then
+// start is the position of the start of the argument within its source.
+func parseCLIArgument(raw string, readFile func(filename string) ([]byte, error), opts *ParseOptions, start hcl.Pos) (Overlay, hcl.Diagnostics) {
+	if opts == nil {
+		opts = &ParseOptions{}
+	}
+
 	var diags hcl.Diagnostics
-	eq := strings.IndexByte(raw, '=')
+	eq := indexUnquoted(raw, '=')
 	if eq < 1 { // if the equals is missing or if it's at the start of the string
 		diags = diags.Append(&hcl.Diagnostic{
 			Severity: hcl.DiagError,
@@ -57,17 +449,152 @@ func ParseCLIArgument(raw string) (Overlay, hcl.Diagnostics) {
 		return nil, diags
 	}
 	path, val := raw[:eq], raw[eq+1:]
+	op := cliArgSet
+	isExpr := false
+	switch {
+	case strings.HasSuffix(path, ":"):
+		path = path[:len(path)-1]
+		isExpr = true
+	case strings.HasSuffix(path, "+"):
+		path = path[:len(path)-1]
+		op = cliArgAppend
+	}
 
-	steps := strings.Split(path, ".")
-	for _, step := range steps {
-		if !hclsyntax.ValidIdentifier(step) {
+	steps, diags := parseCLIPathNames(path, opts.ValidSegment)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var expr hcl.Expression
+	var exprText string
+	if isExpr {
+		exprText = val
+		var exprDiags hcl.Diagnostics
+		// The expression's ranges refer to the position of the value within
+		// the argument, so that diagnostics from evaluating it can point at
+		// the text the user wrote. A heredoc's closing marker must be
+		// followed by a newline, which shells typically strip from the end
+		// of an argument, so we add one.
+		filename := opts.Filename
+		if filename == "" {
+			filename = "overlay " + argDesc(path, opts.Source)
+		}
+		expr, exprDiags = hclsyntax.ParseExpression([]byte(val+"\n"), filename, argPos(raw, start, eq+1))
+		for _, exprDiag := range exprDiags {
 			diags = diags.Append(&hcl.Diagnostic{
-				Severity: hcl.DiagError,
+				Severity: exprDiag.Severity,
 				Summary:  "Invalid argument",
-				Detail:   fmt.Sprintf("Invalid component %q in argument %q: dot-separated parts must be a letter followed by zero or more letters, digits, or underscores.", step, path),
+				Detail:   fmt.Sprintf("Invalid expression for argument %q: %s", path, exprDiag.Detail),
+				Subject:  exprDiag.Subject,
 			})
 		}
+		if diags.HasErrors() {
+			return nil, diags
+		}
+	} else {
+		infer := opts.InferTypes
+		if strings.HasPrefix(val, `\`) {
+			val = val[1:] // the remainder is literal, even if it starts with a prefix
+			infer = false
+		} else if opts.UnquoteValues && strings.HasPrefix(val, `"`) {
+			unquoted, err := strconv.Unquote(strings.TrimRight(val, " \t"))
+			if err != nil {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid argument",
+					Detail:   fmt.Sprintf("Invalid quoted value for argument %q: must be a single string in double quotes, with any quotes or backslashes inside it escaped with a backslash.", path),
+				})
+				return nil, diags
+			}
+			val = unquoted
+			infer = false
+		} else if readFile != nil && strings.HasPrefix(val, "@") {
+			if strings.HasPrefix(val, "@@") {
+				val = val[1:]
+			} else {
+				infer = false
+				filename := val[1:]
+				source := filename
+				if filename == "-" {
+					source = "standard input"
+				}
+				src, err := readFile(filename)
+				if err != nil {
+					diags = diags.Append(&hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "Invalid argument",
+						Detail:   fmt.Sprintf("Failed to read value for argument %q from %s: %s.", path, source, err),
+					})
+					return nil, diags
+				}
+				val = string(src)
+			}
+		}
+		var rng hcl.Range
+		if opts.Filename != "" {
+			rng = argRange(opts.Filename, raw, start, eq+1, len(raw))
+		}
+		if opts.Transform != nil {
+			var moreDiags hcl.Diagnostics
+			val, moreDiags = opts.Transform(stepNames(steps), val)
+			diags = append(diags, moreDiags...)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+		}
+		v := cty.StringVal(val)
+		if infer {
+			v = inferValue(val, op)
+		}
+		expr = hcl.StaticExpr(v, rng)
+	}
+
+	return &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       op,
+		expr:     expr,
+		exprText: exprText,
+		source:   opts.Source,
+		noCreate: opts.NoCreate,
+	}, diags
+}
+
+// inferredNumber matches the values that ParseOptions.InferTypes treats
+// as numbers, which is the JSON number syntax.
+var inferredNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// inferValue returns the value that ParseOptions.InferTypes selects for
+// the given string and operator.
+func inferValue(val string, op cliArgOp) cty.Value {
+	switch {
+	case val == "[]" && op == cliArgSet:
+		return cty.EmptyTupleVal
+	case val == "{}" && op == cliArgSet:
+		return cty.EmptyObjectVal
+	case val == "true":
+		return cty.True
+	case val == "false":
+		return cty.False
+	case inferredNumber.MatchString(val):
+		if v, err := cty.ParseNumberVal(val); err == nil {
+			return v
+		}
 	}
+	return cty.StringVal(val)
+}
+
+// ParseCLIArgumentNull is a variant of ParseCLIArgument that takes only
+// the dot-separated path part of an argument, and returns an overlay that
+// sets the indicated argument to an explicit null value.
+//
+// This is equivalent to passing a string like "foo:=null" to
+// ParseCLIArgument, but is more convenient for applications that want to
+// offer a dedicated way to unset an argument that might otherwise be set in
+// the configuration. For languages that distinguish between an argument
+// being omitted and being explicitly set to null, the result is the latter.
+func ParseCLIArgumentNull(path string) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
 	if diags.HasErrors() {
 		return nil, diags
 	}
@@ -75,8 +602,9 @@ func ParseCLIArgument(raw string) (Overlay, hcl.Diagnostics) {
 	return &cliArgOverlay{
 		fullPath: path,
 		steps:    steps,
-		val:      val,
-	}, nil
+		op:       cliArgSet,
+		expr:     hcl.StaticExpr(cty.NullVal(cty.DynamicPseudoType), hcl.Range{}),
+	}, diags
 }
 
 // ExtractCLIOptions interprets the given slice as a sequence of command
@@ -85,64 +613,491 @@ func ParseCLIArgument(raw string) (Overlay, hcl.Diagnostics) {
 // attributes or block types in the given schema and attempts to produce an
 // overlay for each one using the behaviors described for ParseCLIArgument.
 //
+// The value for such an option may either be given in the same argument
+// after an equals sign, as in "--io_mode=async", or as a separate argument
+// immediately following the option, as in "--io_mode async". The latter is
+// possible only if the following argument does not itself start with "--".
+//
+// To tolerate a stray space before the equals sign, as in "--io_mode =async",
+// a following argument that begins with an equals sign is combined with the
+// option as if they had been written together, and so the equals sign is
+// not part of the value. This applies only when the option names an
+// argument or block type in the schema and doesn't have its own equals
+// sign. To give a separate value that begins with an equals sign, escape
+// it with a backslash, as in "--query \=x".
+//
 // Additionally, if one of the arguments is literally "--" then
 // ExtractCLIOptions will not interpret any subsequent arguments as overlays.
+// That first "--" is itself discarded, but all of the arguments after it,
+// including any further "--" arguments, are retained verbatim.
+//
+// An option whose path ends immediately after the labels of a block type in
+// the schema, as in "--service.web.main", takes no value and instead
+// creates an empty block with that type and labels if there isn't one
+// already, as for NewCreateBlockOverlay. The same path with a "no-" prefix,
+// as in "--no-service.web.main", removes that block, as for
+// NewRemoveOverlay. These options are recognized only for block types in
+// the given schema, and not for block types nested inside them, because
+// the schema doesn't describe the labels of nested block types.
+//
+// If the schema has an argument and a block type of the same name then an
+// option with that name is interpreted as described for ParseCLIArgument:
+// it refers to the block type if the name is followed by further path
+// steps, and to the argument otherwise.
 //
 // ExtractCLIOptions returns a sequence of overlays and a new slice of strings
 // that contains all of the arguments from the given slice that were not
 // interpreted as overlays, so that they might be used for further command
 // line processing.
 func ExtractCLIOptions(args []string, schema *hcl.BodySchema) ([]Overlay, []string, hcl.Diagnostics) {
+	return ExtractCLIOptionsWithOpts(args, schema, nil)
+}
+
+// ExtractOptions represents optional settings that customize the behavior
+// of ExtractCLIOptionsWithOpts.
+type ExtractOptions struct {
+	// UnknownOption, if set, is called for each argument that has the "--"
+	// prefix but whose leading name does not correspond to any attribute or
+	// block type in the schema. arg is the full argument as given, while
+	// name is the portion of it after the "--" prefix and before the first
+	// dot or operator, which is what was compared with the schema.
+	//
+	// If UnknownOption returns true then the argument is retained in the
+	// remaining arguments, as is the default behavior when UnknownOption is
+	// not set. If it returns false then the argument is discarded, in which
+	// case the function is responsible for reporting any problem with the
+	// argument itself.
+	UnknownOption func(arg, name string) (keep bool)
+
+	// Aliases maps additional option names, such as "-L", to the paths
+	// they are shorthand for, such as "service.web.main.listen_addr". The
+	// names must be given exactly as they will appear in the arguments,
+	// including any leading dashes.
+	//
+	// An alias takes a value in the same ways as other options, either
+	// after an equals sign or as a separate following argument. The value
+	// is then interpreted as if it had been given as the value for the
+	// aliased path. A path can end with one of the operator prefixes ":" or
+	// "+" to make the alias use the corresponding operator.
+	//
+	// It is an error for an alias name to be the same as the name of an
+	// attribute or block type in the schema, ignoring leading dashes.
+	Aliases map[string]string
+
+	// BoolAttrs is a set of paths, such as "verbose" or
+	// "service.web.main.enabled", that refer to boolean-typed arguments.
+	//
+	// An option naming one of these paths may be given without any value,
+	// as in "--verbose", to set the argument to true, or with a "no-"
+	// prefix, as in "--no-verbose", to set the argument to false. These
+	// options never consume the following argument as a value. The usual
+	// "--verbose=false" form remains available too, and if both forms are
+	// used for the same path then the form with an explicit value takes
+	// precedence, regardless of the order of the arguments.
+	BoolAttrs map[string]bool
+
+	// IncludeParser, if set, enables the special option "--@include", which
+	// takes the name of a configuration file as its value, as in
+	// "--@include=overrides.hcl", and produces an overlay that layers the
+	// content of that file over the configuration, as for NewBodyOverlay.
+	// This allows users to apply a reusable set of overrides from the
+	// command line. The value may also be given as a separate following
+	// argument, as for other options.
+	//
+	// Each included file is parsed using IncludeParser, as JSON if its name
+	// ends with ".json" or as native syntax otherwise, and so problems in
+	// the file are reported with source ranges within the file itself and
+	// the application can use the parser's Files method to show the
+	// relevant source code in diagnostic messages. ExtractCLIOptionsWithOpts
+	// returns an overlay only for files that parse without errors.
+	IncludeParser *hclparse.Parser
+
+	// IncludeFS is the filesystem that the filenames given to "--@include"
+	// are interpreted within. If it is nil then filenames are paths on the
+	// host filesystem, relative to the current working directory.
+	//
+	// IncludeFS is ignored unless IncludeParser is also set.
+	IncludeFS fs.FS
+}
+
+// includeOption is the name of the special option that ExtractOptions
+// IncludeParser enables.
+const includeOption = "--@include"
+
+// ExtractCLIOptionsWithOpts is a variant of ExtractCLIOptions that accepts
+// some additional options to customize its behavior. If opts is nil then
+// the behavior is identical to ExtractCLIOptions.
+func ExtractCLIOptionsWithOpts(args []string, schema *hcl.BodySchema, opts *ExtractOptions) ([]Overlay, []string, hcl.Diagnostics) {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+
+	// We'll look up names in the schema for every argument, so we'll
+	// index them first to avoid scanning the whole schema each time.
+	names := schemaNames(schema)
+
 	var remain []string
 	var overlays []Overlay
+	var boolOverlays []Overlay // kept separately so explicit values take precedence
 	var diags hcl.Diagnostics
 
-	for i, arg := range args {
+	aliasNames := make([]string, 0, len(opts.Aliases))
+	for name := range opts.Aliases {
+		aliasNames = append(aliasNames, name)
+	}
+	sort.Strings(aliasNames)
+	for _, name := range aliasNames {
+		trimmed := strings.TrimLeft(name, "-")
+		for _, attrS := range schema.Attributes {
+			if attrS.Name == trimmed {
+				diags = diags.Append(aliasCollisionError(name, "an argument"))
+			}
+		}
+		for _, blockS := range schema.Blocks {
+			if blockS.Type == trimmed {
+				diags = diags.Append(aliasCollisionError(name, "a block type"))
+			}
+		}
+	}
+	if diags.HasErrors() {
+		return nil, args, diags
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
 		if arg == "--" {
 			remain = append(remain, args[i+1:]...)
 			break
 		}
+		name, val, hasVal := splitOptionValue(arg)
+		source := "command line option " + name
+		if name == includeOption && opts.IncludeParser != nil {
+			if !hasVal {
+				if i+1 >= len(args) || strings.HasPrefix(args[i+1], "--") {
+					diags = diags.Append(missingOptionValueError(arg))
+					continue
+				}
+				i++
+				val = args[i]
+			}
+			o, moreDiags := includeOverlay(val, opts)
+			diags = append(diags, moreDiags...)
+			if o != nil {
+				overlays = append(overlays, o)
+			}
+			continue
+		}
+		if path, isAlias := opts.Aliases[name]; isAlias {
+			if !hasVal {
+				if i+1 >= len(args) || strings.HasPrefix(args[i+1], "--") {
+					diags = diags.Append(missingOptionValueError(arg))
+					continue
+				}
+				i++
+				val = args[i]
+			}
+			var o Overlay
+			var moreDiags hcl.Diagnostics
+			if strings.HasSuffix(path, ":") || strings.HasSuffix(path, "+") {
+				o, moreDiags = ParseCLIArgument(path + "=" + val)
+			} else {
+				o, moreDiags = newCLIArgStringOverlay(path, val)
+			}
+			diags = append(diags, moreDiags...)
+			if o != nil {
+				overlays = append(overlays, WithSource(o, source))
+			}
+			continue
+		}
 		if !strings.HasPrefix(arg, "--") {
 			remain = append(remain, arg)
 			continue
 		}
 		raw := arg[2:] // trim "--"" prefix
+		if opts.BoolAttrs[raw] {
+			o, moreDiags := newBoolCLIArgOverlay(raw, true)
+			diags = append(diags, moreDiags...)
+			if o != nil {
+				boolOverlays = append(boolOverlays, WithSource(o, source))
+			}
+			continue
+		}
+		if path := strings.TrimPrefix(raw, "no-"); path != raw && opts.BoolAttrs[path] {
+			o, moreDiags := newBoolCLIArgOverlay(path, false)
+			diags = append(diags, moreDiags...)
+			if o != nil {
+				boolOverlays = append(boolOverlays, WithSource(o, source))
+			}
+			continue
+		}
+		if blockTogglePath(raw, schema) {
+			o, moreDiags := NewCreateBlockOverlay(raw)
+			diags = append(diags, moreDiags...)
+			if o != nil {
+				overlays = append(overlays, WithSource(o, source))
+			}
+			continue
+		}
+		if path := strings.TrimPrefix(raw, "no-"); path != raw && blockTogglePath(path, schema) {
+			o, moreDiags := NewRemoveOverlay(path)
+			diags = append(diags, moreDiags...)
+			if o != nil {
+				overlays = append(overlays, WithSource(o, source))
+			}
+			continue
+		}
 		match := raw
-		sep := strings.IndexAny(match, ".=")
+		sep := strings.IndexAny(match, ".[:+=")
 		if sep != -1 {
 			match = match[:sep]
 		}
-		matched := false
-		for _, attrS := range schema.Attributes {
-			if attrS.Name == match {
-				matched = true
-				break
-			}
+		if match == "" {
+			// Something like "--=value" or "--.foo=value" can't be a
+			// valid option for any schema, so we'll report it rather than
+			// leaving it for later processing that might misinterpret it.
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid argument",
+				Detail:   fmt.Sprintf("Invalid argument %q: an option name is required immediately after the \"--\" prefix.", arg),
+			})
+			continue
 		}
-		for _, blockS := range schema.Blocks {
-			if blockS.Type == match {
-				matched = true
-				break
+		if _, ok := names[match]; !ok {
+			if opts.UnknownOption == nil || opts.UnknownOption(arg, match) {
+				remain = append(remain, arg)
 			}
-		}
-		if !matched {
-			remain = append(remain, arg)
 			continue
 		}
+		if indexUnquoted(raw, '=') < 0 {
+			// The value must be in the following argument, then.
+			if i+1 >= len(args) || strings.HasPrefix(args[i+1], "--") {
+				diags = diags.Append(missingOptionValueError(arg))
+				continue
+			}
+			i++
+			switch {
+			case strings.HasPrefix(args[i], "="):
+				// The user probably wrote a space before the equals sign
+				// by mistake, so we'll treat the two as a single argument.
+				raw = raw + args[i]
+			case !strings.HasSuffix(raw, ":") && !strings.HasSuffix(raw, "+"):
+				// With no operator, we can use the value as given rather
+				// than combining it with the path into a single argument.
+				o, moreDiags := newCLIArgStringOverlay(raw, args[i])
+				diags = append(diags, moreDiags...)
+				if o != nil {
+					overlays = append(overlays, WithSource(o, source))
+				}
+				continue
+			default:
+				raw = raw + "=" + args[i]
+			}
+		}
 		o, moreDiags := ParseCLIArgument(raw)
 		diags = append(diags, moreDiags...)
 		if o != nil {
-			overlays = append(overlays, o)
+			overlays = append(overlays, WithSource(o, source))
 		}
 	}
 
+	if len(boolOverlays) != 0 {
+		overlays = append(boolOverlays, overlays...)
+	}
+
 	return overlays, remain, diags
 }
 
+// blockTogglePath returns true if the given option path, without any value
+// or operator, ends immediately after the labels of a block type in the
+// given schema, and so can create or remove a block of that type.
+func blockTogglePath(path string, schema *hcl.BodySchema) bool {
+	if indexUnquoted(path, '=') >= 0 || strings.HasSuffix(path, ":") || strings.HasSuffix(path, "+") {
+		return false
+	}
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return false
+	}
+	name := steps[0].name
+	for _, attrS := range schema.Attributes {
+		if attrS.Name == name && len(steps) == 1 {
+			return false // an argument takes precedence, as in ParseCLIArgument
+		}
+	}
+	for _, blockS := range schema.Blocks {
+		if blockS.Type == name {
+			return len(steps) == 1+len(blockS.LabelNames)
+		}
+	}
+	return false
+}
+
+// includeOverlay returns a body overlay for the content of the given file,
+// which is read and parsed as described for ExtractOptions.IncludeParser.
+func includeOverlay(filename string, opts *ExtractOptions) (Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var src []byte
+	var err error
+	if opts.IncludeFS == nil {
+		src, err = os.ReadFile(filename)
+	} else {
+		src, err = fs.ReadFile(opts.IncludeFS, filename)
+	}
+	if err != nil {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   fmt.Sprintf("Failed to read included file %q: %s.", filename, err),
+		})
+		return nil, diags
+	}
+
+	var f *hcl.File
+	if strings.HasSuffix(filename, ".json") {
+		f, diags = opts.IncludeParser.ParseJSON(src, filename)
+	} else {
+		f, diags = opts.IncludeParser.ParseHCL(src, filename)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return NewBodyOverlay(f.Body), diags
+}
+
+// newCLIArgStringOverlay returns an overlay that sets the argument at the
+// given unparsed path to the given string value, which is subject to the
+// same escaping as values in arguments to ParseCLIArgument.
+func newCLIArgStringOverlay(path string, val string) (*cliArgOverlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	val = strings.TrimPrefix(val, `\`)
+
+	return &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgSet,
+		expr:     hcl.StaticExpr(cty.StringVal(val), hcl.Range{}),
+	}, diags
+}
+
+func newBoolCLIArgOverlay(path string, val bool) (*cliArgOverlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgSet,
+		expr:     hcl.StaticExpr(cty.BoolVal(val), hcl.Range{}),
+	}, diags
+}
+
+func aliasCollisionError(name, what string) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid option alias",
+		Detail:   fmt.Sprintf("The option alias %q conflicts with %s of the same name.", name, what),
+	}
+}
+
+// splitOptionValue splits an option argument at its first equals sign, if
+// any, returning the part before it and the part after it.
+func splitOptionValue(arg string) (name, val string, hasVal bool) {
+	eq := strings.IndexByte(arg, '=')
+	if eq < 0 {
+		return arg, "", false
+	}
+	return arg[:eq], arg[eq+1:], true
+}
+
+func missingOptionValueError(arg string) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Missing value for argument",
+		Detail:   fmt.Sprintf("The argument %s requires a value; write %s=VALUE.", arg, arg),
+	}
+}
+
 type cliArgOverlay struct {
 	fullPath string // full path as originally given, for use in error messages
-	steps    []string
-	val      string
+	steps    []pathStep
+	op       cliArgOp
+	expr     hcl.Expression
+
+	// exprText is the source code of expr, if it was parsed from native
+	// syntax given as a string, so that OverlaysToJSON can serialize it.
+	exprText string
+
+	// source optionally describes where the overlay came from, such as
+	// "environment variable APP_IO_MODE", for use in error messages.
+	source string
+
+	// noCreate is set if the overlay should report an error rather than
+	// creating a block that doesn't exist, as for ParseOptions.NoCreate.
+	noCreate bool
+
+	// original is the attributes of the body being overlaid as they were
+	// before any overlays were applied, for use with cliArgReset. It is
+	// populated by withOriginal just before the overlay is applied.
+	original hcl.Attributes
+}
+
+// cliArgOp represents the operator used in a CLI argument, which decides how
+// the given value interacts with any existing value for the same argument.
+type cliArgOp rune
+
+const (
+	cliArgSet     cliArgOp = '='
+	cliArgAppend  cliArgOp = '+'
+	cliArgRemove  cliArgOp = '-'
+	cliArgDefault cliArgOp = '?'
+
+	// cliArgRemoveType removes all of the blocks of the type given in the
+	// final step, rather than a single argument or block.
+	cliArgRemoveType cliArgOp = '!'
+
+	// cliArgReset restores the argument to its definition in the original
+	// body, as given in the overlay's original field.
+	cliArgReset cliArgOp = '~'
+
+	// cliArgCreate creates an empty block with the type and labels given
+	// in the path, unless there is already a matching block.
+	cliArgCreate cliArgOp = '^'
+)
+
+// String returns the overlay in the syntax accepted by ParseCLIArgument, such
+// as "io_mode=async" or "replicas:=3", using the path as originally given
+// even for the overlays derived from it while traversing nested blocks.
+// Overlays that the syntax can't express, such as those that remove an
+// argument, are instead described as for SummarizeOverlays.
+func (o *cliArgOverlay) String() string {
+	if o.op != cliArgSet && o.op != cliArgAppend {
+		return o.describe()
+	}
+	op := "="
+	if o.op == cliArgAppend {
+		op = "+="
+	}
+	if o.op == cliArgSet && o.exprText != "" {
+		return o.fullPath + ":=" + o.exprText
+	}
+	v := knownValue(o.expr)
+	switch {
+	case v != cty.NilVal && v.Type() == cty.String && !v.IsNull():
+		s := v.AsString()
+		if strings.HasPrefix(s, `\`) || strings.HasPrefix(s, "@") {
+			s = `\` + s
+		}
+		return o.fullPath + op + s
+	case v != cty.NilVal && o.op == cliArgSet:
+		return o.fullPath + ":=" + formatValue(v)
+	default:
+		return o.describe()
+	}
 }
 
 func (o *cliArgOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
@@ -150,33 +1105,34 @@ func (o *cliArgOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodyS
 	if remain != nil {
 		// If we have a "remain" then our path wasn't accepted by the
 		// schema, which means the argument was invalid.
-		diags = diags.Append(o.invalidArgError())
+		diags = diags.Append(o.unexpectedArgError(schema))
 	}
 	return ret, diags
 }
 
 func (o *cliArgOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
 	var diags hcl.Diagnostics
+	content = ensureContent(content)
 
 	// There should be either an attribute or block type in the given
 	// schema that matches our first step. That'll tell us how to interpret
 	// the remainder of the steps (if any).
-	name := o.steps[0]
+	name := o.steps[0].name
 
 	for _, attrS := range schema.Attributes {
 		if attrS.Name != name {
 			continue
 		}
-		if len(o.steps) != 1 {
+		if o.prefersBlockType() && schemaHasBlockType(schema, name) {
+			break
+		}
+		if !o.attributeStepsValid() {
 			diags = diags.Append(o.invalidArgError())
 			return content, nil, diags
 		}
 
 		// If we get here then we're overriding the attribute described by attrS
-		content.Attributes[name] = &hcl.Attribute{
-			Name: o.steps[0],
-			Expr: hcl.StaticExpr(cty.StringVal(o.val), hcl.Range{}),
-		}
+		o.applyAttribute(content.Attributes)
 		return content, nil, diags
 	}
 
@@ -184,41 +1140,117 @@ func (o *cliArgOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hc
 		if blockS.Type != name {
 			continue
 		}
-		// We must have at least enough subsequent steps for all of the
-		// labels this block type expects and at least one additional to
-		// continue traversing inside the selected block.
-		needStepCount := 1 + 1 + len(blockS.LabelNames)
-		if len(o.steps) < needStepCount {
-			diags = diags.Append(o.invalidArgError())
+		if !o.blockStepsValid(blockS) {
+			diags = diags.Append(o.invalidBlockStepsError(blockS))
 			return content, nil, diags
 		}
+		if o.op == cliArgRemoveType && len(o.steps) == 1 {
+			// We're removing all of the blocks of this type.
+			remain := make(hcl.Blocks, 0, len(content.Blocks))
+			for _, block := range content.Blocks {
+				if block.Type != blockS.Type {
+					remain = append(remain, block)
+				}
+			}
+			content.Blocks = remain
+			return content, nil, diags
+		}
+		headerLen := 1 + len(blockS.LabelNames)
+		labelSteps := o.steps[1:headerLen]
+		lastStep := o.steps[headerLen-1]
+		wildcard, placeholder := false, false
+		for _, step := range labelSteps {
+			wildcard = wildcard || step.wildcard || step.placeholder
+			placeholder = placeholder || step.placeholder
+		}
 
 		// If we get here then we need to hunt in content.Blocks for the
-		// first block that has the selected type and labels, and we'll
-		// then apply the remaining steps in our path as an overlay on its
-		// body.
-		wantLabels := o.steps[1 : len(blockS.LabelNames)+1]
-		remainingSteps := o.steps[len(wantLabels)+1:]
-		subOverlay := o.subOverlay(remainingSteps)
-		for _, block := range content.Blocks {
+		// blocks that have the selected type and labels. We'll select
+		// only the first of them unless we have an index or a wildcard.
+		var matches []int
+		for i, block := range content.Blocks {
 			if block.Type != blockS.Type {
 				continue
 			}
-			if !o.labelsMatch(block.Labels, wantLabels) {
-				continue
+			if len(block.Labels) != len(blockS.LabelNames) {
+				diags = diags.Append(labelArityError("argument "+argDesc(o.fullPath, o.source), block, blockS))
+				return content, nil, diags
 			}
-			// We've found it!
-			block.Body = ApplyOverlays(block.Body, subOverlay)
+			if labelStepsMatch(block.Labels, labelSteps) {
+				matches = append(matches, i)
+			}
+		}
+		var targets []int
+		switch {
+		case lastStep.hasIndex && lastStep.index == allIndex:
+			targets = matches
+		case lastStep.hasIndex:
+			if lastStep.index >= len(matches) {
+				diags = diags.Append(o.indexOutOfRangeError(blockS.Type, lastStep.index, len(matches)))
+				return content, nil, diags
+			}
+			targets = matches[lastStep.index : lastStep.index+1]
+		case wildcard:
+			targets = matches
+		case len(matches) > 0:
+			targets = matches[:1]
+		}
+
+		if len(o.steps) == headerLen && o.op != cliArgCreate {
+			// We're removing the selected blocks themselves. We work
+			// backwards so that the earlier indices remain valid.
+			for i := len(targets) - 1; i >= 0; i-- {
+				target := targets[i]
+				content.Blocks = append(content.Blocks[:target:target], content.Blocks[target+1:]...)
+			}
+			return content, nil, diags
+		}
+
+		// We'll apply the remaining steps in our path as an overlay on the
+		// body of each selected block, unless we're only making sure that
+		// the selected block exists.
+		var subOverlay *cliArgOverlay
+		if o.op != cliArgCreate {
+			subOverlay = o.subOverlay(o.steps[headerLen:])
+			for _, target := range targets {
+				block := content.Blocks[target]
+				block.Body = ApplyOverlays(block.Body, subOverlay)
+			}
+		}
+		if len(targets) > 0 {
 			return content, nil, diags
 		}
 
-		// If we get here then we didn't find a suitable block to override,
-		// and so we'll construct ourselves a new one. Its body will
-		// essentially be just the effect of our overlay, which we'll achieve
-		// by applying it to an empty body.
+		// If we get here then we didn't find a suitable block to override.
+		// There's nothing to remove from a block that doesn't exist, and we
+		// can't decide the labels for a new block if any of them were given
+		// as wildcards, but otherwise we'll construct ourselves a new one.
+		// Its body will essentially be just the effect of our overlay, which
+		// we'll achieve by applying it to an empty body that describes our
+		// overlay as its location, so that diagnostics about anything
+		// missing from the new block can indicate where it came from.
+		if o.op == cliArgRemove || o.op == cliArgRemoveType || o.op == cliArgReset {
+			return content, nil, diags
+		}
+		if placeholder {
+			diags = diags.Append(o.placeholderCreateError(blockS.Type))
+			return content, nil, diags
+		}
+		if wildcard {
+			return content, nil, diags
+		}
+		wantLabels := stepNames(labelSteps)
+		if o.noCreate {
+			diags = diags.Append(o.noBlockError(blockS.Type, wantLabels))
+			return content, nil, diags
+		}
+		body := newCreatedBody(o.createdRange())
+		if subOverlay != nil {
+			body = ApplyOverlays(body, subOverlay)
+		}
 		block := &hcl.Block{
 			Type:        blockS.Type,
-			Body:        ApplyOverlays(hcl.EmptyBody(), subOverlay),
+			Body:        body,
 			Labels:      wantLabels,
 			LabelRanges: make([]hcl.Range, len(wantLabels)), // must have same length as Labels even though it's all zero values
 		}
@@ -233,41 +1265,281 @@ func (o *cliArgOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hc
 }
 
 func (o *cliArgOverlay) ApplyJustAttributes(attrs hcl.Attributes) (hcl.Attributes, hcl.Diagnostics) {
-	if len(o.steps) != 1 {
-		// In "just attributes" mode, we must have only a single step because
-		// there can be no blocks for us to traverse through.
+	if !o.attributeStepsValid() {
+		// In "just attributes" mode, our first step must be an attribute
+		// because there can be no blocks for us to traverse through.
 		var diags hcl.Diagnostics
 		diags = diags.Append(o.invalidArgError())
 		return attrs, diags
 	}
 
-	attrs[o.steps[0]] = &hcl.Attribute{
-		Name: o.steps[0],
-		Expr: hcl.StaticExpr(cty.StringVal(o.val), hcl.Range{}),
+	if attrs == nil {
+		attrs = make(hcl.Attributes)
 	}
+	o.applyAttribute(attrs)
 
 	return attrs, nil
 }
 
-func (o *cliArgOverlay) subOverlay(remainingSteps []string) *cliArgOverlay {
+// prefersBlockType returns true if the overlay should be interpreted as
+// relating to a block type rather than to an argument when a schema has
+// both an argument and a block type named by the overlay's first step.
+//
+// A path with more than one step is taken as traversing into a block, even
+// though it could also describe a nested key in the argument's value, while
+// a single step is taken as the argument unless the overlay removes all
+// blocks of a type, which is meaningful only for a block type.
+func (o *cliArgOverlay) prefersBlockType() bool {
+	return len(o.steps) > 1 || o.op == cliArgRemoveType || o.op == cliArgCreate
+}
+
+// attributeStepsValid returns true if the overlay's remaining steps are
+// acceptable when the first step refers to an attribute: either just the
+// attribute name alone, or the attribute name followed by one or more
+// nested keys to set inside a map or object value.
+func (o *cliArgOverlay) attributeStepsValid() bool {
+	if o.op == cliArgRemoveType || o.op == cliArgCreate {
+		return false // an attribute is not a block type
+	}
+	for _, step := range o.steps {
+		if step.hasIndex || step.wildcard {
+			return false
+		}
+	}
+	return len(o.steps) == 1 || o.op == cliArgSet
+}
+
+// blockStepsValid returns true if the overlay's remaining steps are
+// acceptable when the first step refers to the given block type.
+//
+// We must have at least enough subsequent steps for all of the labels the
+// block type expects and at least one additional to continue traversing
+// inside the selected block, unless we're removing or creating the selected
+// block itself, in which case we must have exactly the header steps. Only
+// the last of the header steps may have an index, selecting
+// between blocks that have the same labels.
+func (o *cliArgOverlay) blockStepsValid(blockS hcl.BlockHeaderSchema) bool {
+	if o.op == cliArgRemoveType && len(o.steps) == 1 {
+		return true // the block type alone selects all of its blocks
+	}
+	headerLen := 1 + len(blockS.LabelNames)
+	if len(o.steps) < headerLen || (len(o.steps) == headerLen && o.op != cliArgRemove && o.op != cliArgCreate) {
+		return false
+	}
+	if o.op == cliArgCreate && len(o.steps) != headerLen {
+		return false
+	}
+	for _, step := range o.steps[:headerLen-1] {
+		if step.hasIndex {
+			return false
+		}
+	}
+	return true
+}
+
+// applyAttribute applies the overlay's operator to the attribute named by
+// the overlay's first remaining step in the given attributes map.
+func (o *cliArgOverlay) applyAttribute(attrs hcl.Attributes) {
+	name := o.steps[0].name
+	switch o.op {
+	case cliArgRemove:
+		delete(attrs, name)
+		return
+	case cliArgReset:
+		if orig, exists := o.original[name]; exists {
+			attrs[name] = orig
+		} else {
+			delete(attrs, name)
+		}
+		return
+	case cliArgDefault:
+		if _, exists := attrs[name]; exists {
+			return
+		}
+	}
+	attrs[name] = o.attribute(attrs[name])
+}
+
+// attribute returns the attribute that should replace the given prior
+// attribute, which is nil if the attribute is not already set.
+func (o *cliArgOverlay) attribute(prior *hcl.Attribute) *hcl.Attribute {
+	expr := o.expr
+	if o.op == cliArgAppend {
+		appendExpr := &appendExpr{
+			fullPath: o.fullPath,
+			source:   o.source,
+			elem:     o.expr,
+		}
+		if prior != nil {
+			appendExpr.prior = prior.Expr
+		}
+		expr = appendExpr
+	}
+	if len(o.steps) > 1 {
+		// The remaining steps are nested keys to set inside the attribute's
+		// value, which we can only do at evaluation time because the schema
+		// doesn't describe the attribute's internal structure.
+		setKeyExpr := &setKeyExpr{
+			fullPath: o.fullPath,
+			source:   o.source,
+			keys:     stepNames(o.steps[1:]),
+			val:      o.expr,
+		}
+		if prior != nil {
+			setKeyExpr.prior = prior.Expr
+		}
+		expr = setKeyExpr
+	}
+
+	if prior != nil {
+		// When replacing an existing attribute we retain its declaration
+		// ranges, so that diagnostics about the attribute as a whole can
+		// still refer to where it was declared in the configuration.
+		return &hcl.Attribute{
+			Name:      prior.Name,
+			Expr:      expr,
+			Range:     prior.Range,
+			NameRange: prior.NameRange,
+		}
+	}
+	return &hcl.Attribute{
+		Name:  o.steps[0].name,
+		Expr:  expr,
+		Range: expr.Range(),
+	}
+}
+
+// createdRange returns the range to use as the MissingItemRange of a block
+// created by the overlay. That is the range of the overlay's value if it
+// has one, or otherwise a synthetic range whose filename describes the
+// overlay.
+func (o *cliArgOverlay) createdRange() hcl.Range {
+	if o.expr != nil {
+		if rng := o.expr.Range(); rng.Filename != "" {
+			return rng
+		}
+	}
+	return hcl.Range{
+		Filename: "overlay " + argDesc(o.fullPath, o.source),
+		Start:    hcl.InitialPos,
+		End:      hcl.InitialPos,
+	}
+}
+
+func (o *cliArgOverlay) subOverlay(remainingSteps []pathStep) *cliArgOverlay {
 	return &cliArgOverlay{
 		fullPath: o.fullPath,
-		val:      o.val,
+		op:       o.op,
+		expr:     o.expr,
 		steps:    remainingSteps,
+		source:   o.source,
+		noCreate: o.noCreate,
 	}
 }
 
-func (o *cliArgOverlay) labelsMatch(a, b []string) bool {
-	if len(a) == 0 && len(b) == 0 {
-		return true
+// argDesc returns a description of the argument with the given path for use
+// in error messages, including its source if known.
+func argDesc(path, source string) string {
+	if source == "" {
+		return strconv.Quote(path)
 	}
-	return reflect.DeepEqual(a, b)
+	return fmt.Sprintf("%q (from %s)", path, source)
 }
 
 func (o *cliArgOverlay) invalidArgError() *hcl.Diagnostic {
 	return &hcl.Diagnostic{
 		Severity: hcl.DiagError,
 		Summary:  "Invalid argument",
-		Detail:   fmt.Sprintf("Unexpected argument %q.", o.fullPath),
+		Detail:   fmt.Sprintf("Unexpected argument %s.", argDesc(o.fullPath, o.source)),
+	}
+}
+
+// invalidBlockStepsError returns a diagnostic for when blockStepsValid
+// returns false for the given block type, which explains how many labels
+// the block type requires if the path doesn't provide enough of them.
+func (o *cliArgOverlay) invalidBlockStepsError(blockS hcl.BlockHeaderSchema) *hcl.Diagnostic {
+	// Unless we're removing or creating a block, the final step must be the
+	// name of an argument or nested block type, and so it isn't a label.
+	provided := len(o.steps) - 2
+	if o.op == cliArgRemove || o.op == cliArgCreate {
+		provided = len(o.steps) - 1
+	}
+	required := len(blockS.LabelNames)
+	if provided < 0 || provided >= required {
+		return o.invalidArgError()
+	}
+
+	labels := "labels"
+	if required == 1 {
+		labels = "label"
+	}
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid argument",
+		Detail:   fmt.Sprintf("Unexpected argument %s: block type %q requires %d %s, but the path provides %d.", argDesc(o.fullPath, o.source), blockS.Type, required, labels, provided),
+	}
+}
+
+// noBlockError returns a diagnostic for when the overlay would create a
+// block with the given type and labels but its noCreate flag is set.
+func (o *cliArgOverlay) noBlockError(blockType string, labels []string) *hcl.Diagnostic {
+	header := blockType
+	for _, label := range labels {
+		header += " " + strconv.Quote(label)
+	}
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid argument",
+		Detail:   fmt.Sprintf("Invalid argument %s: no block %s exists to override.", argDesc(o.fullPath, o.source), header),
+	}
+}
+
+func (o *cliArgOverlay) placeholderCreateError(blockType string) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid argument",
+		Detail:   fmt.Sprintf("Invalid argument %s: there is no matching %q block, and a new block can't be created because the path has a \"_\" placeholder instead of a label.", argDesc(o.fullPath, o.source), blockType),
+	}
+}
+
+// unexpectedArgError is like invalidArgError but also suggests a similar
+// name from the given schema, for when the first remaining step is not
+// defined in that schema.
+func (o *cliArgOverlay) unexpectedArgError(schema *hcl.BodySchema) *hcl.Diagnostic {
+	diag := o.invalidArgError()
+	if suggestion := schemaNameSuggestion(o.steps[0].name, schema); suggestion != "" {
+		diag.Detail += fmt.Sprintf(" Did you mean %q?", suggestion)
+	}
+	return diag
+}
+
+func (o *cliArgOverlay) indexOutOfRangeError(blockType string, index, count int) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid argument",
+		Detail:   fmt.Sprintf("Cannot apply argument %s: there is no matching %q block at index %d, because there are only %d.", argDesc(o.fullPath, o.source), blockType, index, count),
+	}
+}
+
+// labelArityError returns an error about a block in the content an overlay
+// is applied to whose number of labels doesn't match the schema. That can
+// happen only if the content was produced using a different schema, such as
+// by another overlay, but we report it because otherwise an overlay for the
+// block would silently create a new block instead. what describes the
+// overlay, such as `argument "foo"`.
+func labelArityError(what string, block *hcl.Block, blockS hcl.BlockHeaderSchema) *hcl.Diagnostic {
+	header := block.Type
+	for _, label := range block.Labels {
+		header += " " + strconv.Quote(label)
+	}
+	labels := "labels"
+	if len(blockS.LabelNames) == 1 {
+		labels = "label"
+	}
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid argument",
+		Detail:   fmt.Sprintf("Cannot apply %s: block %s has %d labels, but block type %q requires %d %s, so the block might not have been decoded with the same schema.", what, header, len(block.Labels), blockS.Type, len(blockS.LabelNames), labels),
+		Subject:  block.DefRange.Ptr(),
 	}
 }
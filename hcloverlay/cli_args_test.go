@@ -1,14 +1,19 @@
 package hcloverlay
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/json"
+	"github.com/zclconf/go-cty/cty"
 )
 
 func TestParseCLIArgument(t *testing.T) {
@@ -69,6 +74,68 @@ func TestParseCLIArgument(t *testing.T) {
 			},
 			`Unexpected argument "bar".`,
 		},
+		"unwanted root attribute with suggestion": {
+			`
+			foo = "a"
+			`,
+			`fob=b`,
+			&struct {
+				Foo string `hcl:"foo"`
+			}{
+				Foo: "a",
+			},
+			`Unexpected argument "fob". Did you mean "foo"?`,
+		},
+		"override root attribute with number expression": {
+			`
+			count = 1
+			`,
+			`count:=3`,
+			&struct {
+				Count int `hcl:"count"`
+			}{
+				Count: 3,
+			},
+			``,
+		},
+		"new root attribute with bool expression": {
+			`
+			foo = "a"
+			`,
+			`enabled:=true`,
+			&struct {
+				Foo     string `hcl:"foo"`
+				Enabled bool   `hcl:"enabled"`
+			}{
+				Foo:     "a",
+				Enabled: true,
+			},
+			``,
+		},
+		"override root attribute with list expression": {
+			`
+			tags = ["a"]
+			`,
+			`tags:=["b", "c"]`,
+			&struct {
+				Tags []string `hcl:"tags"`
+			}{
+				Tags: []string{"b", "c"},
+			},
+			``,
+		},
+		"literal string that looks like an expression": {
+			`
+			foo = "a"
+			`,
+			`foo=true`,
+			&struct {
+				Foo string `hcl:"foo"`
+			}{
+				Foo: "true",
+			},
+			``,
+		},
 		"override attribute in existing unlabelled block": {
 			`
 			block { foo = "a" }
@@ -159,6 +226,312 @@ func TestParseCLIArgument(t *testing.T) {
 			},
 			``,
 		},
+		"create new block with expression": {
+			`
+			block "foo" "a" { count = 1 }
+			`,
+			`block.foo.b.count:=2`,
+			&struct {
+				Block []struct {
+					Type  string `hcl:"type,label"`
+					Name  string `hcl:"name,label"`
+					Count int    `hcl:"count"`
+				} `hcl:"block,block"`
+			}{
+				Block: []struct {
+					Type  string `hcl:"type,label"`
+					Name  string `hcl:"name,label"`
+					Count int    `hcl:"count"`
+				}{
+					{Type: "foo", Name: "a", Count: 1},
+					{Type: "foo", Name: "b", Count: 2},
+				},
+			},
+			``,
+		},
+		"override attribute in existing block with quoted label": {
+			`
+			block "foo" "web.prod" { foo = "a" }
+			block "foo" "web" { foo = "b" }
+			`,
+			`block.foo."web.prod".foo=c`,
+			&struct {
+				Block []BlockTwoLabels `hcl:"block,block"`
+			}{
+				Block: []BlockTwoLabels{
+					{Type: "foo", Name: "web.prod", Foo: "c"},
+					{Type: "foo", Name: "web", Foo: "b"},
+				},
+			},
+			``,
+		},
+		"create new block with quoted label containing equals": {
+			`
+			block "a" { foo = "a" }
+			`,
+			`block."b=c".foo=d=e`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: "a"},
+					{Name: "b=c", Foo: "d=e"},
+				},
+			},
+			``,
+		},
+		"create new block with quoted label containing escapes": {
+			``,
+			`block."a\"b".foo=c`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: `a"b`, Foo: "c"},
+				},
+			},
+			``,
+		},
+		"override attribute in block selected by index": {
+			`
+			block "a" { foo = "a" }
+			block "b" { foo = "b" }
+			block "a" { foo = "c" }
+			`,
+			`block.a[1].foo=d`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: "a"},
+					{Name: "b", Foo: "b"},
+					{Name: "a", Foo: "d"},
+				},
+			},
+			``,
+		},
+		"override attribute in unlabelled block selected by index": {
+			`
+			block { foo = "a" }
+			block { foo = "b" }
+			`,
+			`block[1].foo=c`,
+			&struct {
+				Block []BlockNoLabels `hcl:"block,block"`
+			}{
+				Block: []BlockNoLabels{
+					{Foo: "a"},
+					{Foo: "c"},
+				},
+			},
+			``,
+		},
+		"override attribute in block with quoted label selected by index": {
+			`
+			block "a.b" { foo = "a" }
+			block "a.b" { foo = "b" }
+			`,
+			`block."a.b"[0].foo=c`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a.b", Foo: "c"},
+					{Name: "a.b", Foo: "b"},
+				},
+			},
+			``,
+		},
+		"block index out of range": {
+			`
+			block "a" { foo = "a" }
+			block "a" { foo = "b" }
+			`,
+			`block.a[2].foo=c`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{},
+			`Cannot apply argument "block.a[2].foo": there is no matching "block" block at index 2, because there are only 2.`,
+		},
+		"block index does not create new block": {
+			``,
+			`block.a[0].foo=c`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{},
+			`there is no matching "block" block at index 0, because there are only 0.`,
+		},
+		"index on block label that isn't last": {
+			`
+			block "foo" "a" { foo = "a" }
+			`,
+			`block.foo[0].a.foo=b`,
+			&struct {
+				Block []BlockTwoLabels `hcl:"block,block"`
+			}{},
+			`Unexpected argument "block.foo[0].a.foo".`,
+		},
+		"index on attribute": {
+			`
+			foo = "a"
+			`,
+			`foo[0]=b`,
+			&struct {
+				Foo string `hcl:"foo"`
+			}{},
+			`Unexpected argument "foo[0]".`,
+		},
+		"override attribute in all blocks with same labels": {
+			`
+			block "a" { foo = "a" }
+			block "b" { foo = "b" }
+			block "a" { foo = "c" }
+			`,
+			`block.a[*].foo=d`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: "d"},
+					{Name: "b", Foo: "b"},
+					{Name: "a", Foo: "d"},
+				},
+			},
+			``,
+		},
+		"all blocks with same labels creates new block": {
+			`
+			block "a" { foo = "a" }
+			`,
+			`block.b[*].foo=b`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: "a"},
+					{Name: "b", Foo: "b"},
+				},
+			},
+			``,
+		},
+		"override attribute in blocks with wildcard label": {
+			`
+			block "foo" "a" { foo = "a" }
+			block "bar" "b" { foo = "b" }
+			block "foo" "c" { foo = "c" }
+			`,
+			`block.foo.*.foo=d`,
+			&struct {
+				Block []BlockTwoLabels `hcl:"block,block"`
+			}{
+				Block: []BlockTwoLabels{
+					{Type: "foo", Name: "a", Foo: "d"},
+					{Type: "bar", Name: "b", Foo: "b"},
+					{Type: "foo", Name: "c", Foo: "d"},
+				},
+			},
+			``,
+		},
+		"override attribute in blocks with all wildcard labels": {
+			`
+			block "foo" "a" { foo = "a" }
+			block "bar" "b" { foo = "b" }
+			`,
+			`block.*.*.foo=c`,
+			&struct {
+				Block []BlockTwoLabels `hcl:"block,block"`
+			}{
+				Block: []BlockTwoLabels{
+					{Type: "foo", Name: "a", Foo: "c"},
+					{Type: "bar", Name: "b", Foo: "c"},
+				},
+			},
+			``,
+		},
+		"wildcard label with no matches": {
+			`
+			block "bar" "b" { foo = "b" }
+			`,
+			`block.foo.*.foo=c`,
+			&struct {
+				Block []BlockTwoLabels `hcl:"block,block"`
+			}{
+				Block: []BlockTwoLabels{
+					{Type: "bar", Name: "b", Foo: "b"},
+				},
+			},
+			``,
+		},
+		"quoted asterisk label is literal": {
+			`
+			block "a" { foo = "a" }
+			`,
+			`block."*".foo=b`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: "a"},
+					{Name: "*", Foo: "b"},
+				},
+			},
+			``,
+		},
+		"override attribute in blocks with placeholder label": {
+			`
+			block "http" "web" { foo = "a" }
+			block "grpc" "api" { foo = "b" }
+			block "grpc" "web" { foo = "c" }
+			`,
+			`block._.web.foo=d`,
+			&struct {
+				Block []BlockTwoLabels `hcl:"block,block"`
+			}{
+				Block: []BlockTwoLabels{
+					{Type: "http", Name: "web", Foo: "d"},
+					{Type: "grpc", Name: "api", Foo: "b"},
+					{Type: "grpc", Name: "web", Foo: "d"},
+				},
+			},
+			``,
+		},
+		"placeholder label with no matches": {
+			`
+			block "grpc" "api" { foo = "b" }
+			`,
+			`block._.web.foo=d`,
+			&struct {
+				Block []BlockTwoLabels `hcl:"block,block"`
+			}{},
+			`Invalid argument "block._.web.foo": there is no matching "block" block, and a new block can't be created because the path has a "_" placeholder instead of a label.`,
+		},
+		"quoted underscore label is literal": {
+			`
+			block "a" { foo = "a" }
+			`,
+			`block."_".foo=b`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: "a"},
+					{Name: "_", Foo: "b"},
+				},
+			},
+			``,
+		},
+		"labelled block used without labels": {
+			`
+			block "a" { foo = "a" }
+			`,
+			`block.foo=b`,
+			&struct {
+				Block *BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: &BlockOneLabel{Name: "a", Foo: "a"},
+			},
+			`Unexpected argument "block.foo": block type "block" requires 1 label, but the path provides 0.`,
+		},
 		"create new block with not enough labels": {
 			`
 			block "foo" "a" { foo = "a" }
@@ -171,7 +544,21 @@ func TestParseCLIArgument(t *testing.T) {
 					{Type: "foo", Name: "a", Foo: "a"},
 				},
 			},
-			`Unexpected argument "block.foo".`,
+			`Unexpected argument "block.foo": block type "block" requires 2 labels, but the path provides 0.`,
+		},
+		"unexpected nested argument with suggestion": {
+			`
+			block "foo" "a" { foo = "a" }
+			`,
+			`block.foo.a.fo=b`,
+			&struct {
+				Block []BlockTwoLabels `hcl:"block,block"`
+			}{
+				Block: []BlockTwoLabels{
+					{Type: "foo", Name: "a", Foo: "a"},
+				},
+			},
+			`Unexpected argument "block.foo.a.fo". Did you mean "foo"?`,
 		},
 		"create new block with unexpected nested argument": {
 			`
@@ -222,3 +609,2773 @@ func TestParseCLIArgument(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCLIArgumentNewBlockType(t *testing.T) {
+	type Logging struct {
+		Level string `hcl:"level"`
+	}
+	type Service struct {
+		Type       string `hcl:"type,label"`
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+	}
+	type Config struct {
+		IOMode   *string   `hcl:"io_mode"`
+		Logging  *Logging  `hcl:"logging,block"`
+		Services []Service `hcl:"service,block"`
+	}
+	schema, _ := gohcl.ImpliedBodySchema(&Config{})
+
+	tests := map[string]struct {
+		Args []string
+		Want Config
+	}{
+		"no labels": {
+			[]string{"logging.level=debug"},
+			Config{
+				Logging: &Logging{Level: "debug"},
+			},
+		},
+		"two labels": {
+			[]string{"service.http.web.listen_addr=:80"},
+			Config{
+				Services: []Service{{Type: "http", Name: "web", ListenAddr: ":80"}},
+			},
+		},
+		"several new blocks": {
+			[]string{"service.http.web.listen_addr=:80", "service.http.api.listen_addr=:81", "logging.level=debug"},
+			Config{
+				Logging: &Logging{Level: "debug"},
+				Services: []Service{
+					{Type: "http", Name: "web", ListenAddr: ":80"},
+					{Type: "http", Name: "api", ListenAddr: ":81"},
+				},
+			},
+		},
+	}
+
+	// The base content has no blocks at all, and its Blocks field is nil.
+	// We test with both a parsed body and a body that returns that content
+	// directly, since the latter also has nil Attributes.
+	f, diags := hclsyntax.ParseConfig(nil, "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	bases := map[string]hcl.Body{
+		"parsed":      f.Body,
+		"nil content": sharedContentBody{&hcl.BodyContent{}},
+	}
+
+	for baseName, base := range bases {
+		for name, test := range tests {
+			t.Run(baseName+"/"+name, func(t *testing.T) {
+				content, diags := base.Content(schema)
+				if diags.HasErrors() {
+					t.Fatalf("config has problems: %s", diags.Error())
+				}
+				if content.Blocks != nil {
+					t.Fatalf("base content has non-nil Blocks")
+				}
+
+				var overlays []Overlay
+				for _, arg := range test.Args {
+					o, diags := ParseCLIArgument(arg)
+					if diags.HasErrors() {
+						t.Fatalf("arg has problems: %s", diags.Error())
+					}
+					overlays = append(overlays, o)
+				}
+
+				var got Config
+				diags = gohcl.DecodeBody(ApplyOverlays(base, overlays...), nil, &got)
+				if diags.HasErrors() {
+					t.Fatalf("unexpected problems: %s", diags.Error())
+				}
+				if diff := cmp.Diff(test.Want, got); diff != "" {
+					t.Fatalf("incorrect result\n%s", diff)
+				}
+			})
+		}
+	}
+}
+
+func TestParseCLIArgumentInvalid(t *testing.T) {
+	tests := map[string]struct {
+		Arg     string
+		WantErr string
+	}{
+		"no equals": {
+			`foo`,
+			`must be a configuration setting, followed by an equals sign`,
+		},
+		"invalid identifier": {
+			`foo.0bar=baz`,
+			`Invalid component "0bar"`,
+		},
+		"unterminated quoted component": {
+			`foo."bar=baz`,
+			`must be a configuration setting, followed by an equals sign`,
+		},
+		"characters after quoted component": {
+			`foo."bar"baz=boop`,
+			`a quoted component must be followed either by a dot or by the end of the path`,
+		},
+		"non-numeric index": {
+			`foo.bar[x].baz=boop`,
+			`an index must be a non-negative integer in square brackets`,
+		},
+		"negative index": {
+			`foo.bar[-1].baz=boop`,
+			`an index must be a non-negative integer in square brackets`,
+		},
+		"unterminated index": {
+			`foo.bar[1.baz=boop`,
+			`an index must be a non-negative integer in square brackets`,
+		},
+		"characters after index": {
+			`foo.bar[1]baz=boop`,
+			`an index must be followed either by a dot or by the end of the path`,
+		},
+		"empty leading component": {
+			`.foo=bar`,
+			`Invalid component ""`,
+		},
+		"empty leading component with operator": {
+			`.foo+=bar`,
+			`Invalid component ""`,
+		},
+		"empty leading index": {
+			`[0].foo=bar`,
+			`Invalid component ""`,
+		},
+		"invalid expression": {
+			`foo:=[`,
+			`Invalid expression for argument "foo"`,
+		},
+		"trailing tokens in expression": {
+			`foo:=1 2`,
+			`Invalid expression for argument "foo"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, diags := ParseCLIArgument(test.Arg)
+			if !diags.HasErrors() {
+				t.Fatalf("unexpected success\ngot: %#v", o)
+			}
+			if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+				t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+			}
+		})
+	}
+}
+
+func TestParseCLIArguments(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "io_mode"}, {Name: "count"}},
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		o, diags := ParseCLIArguments([]string{"io_mode=sync", "count:=2", "io_mode=async"})
+		if diags.HasErrors() {
+			t.Fatalf("args have problems: %s", diags.Error())
+		}
+
+		content, diags := o.ApplyOverlay(&hcl.BodyContent{}, schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		want := map[string]cty.Value{
+			"io_mode": cty.StringVal("async"),
+			"count":   cty.NumberIntVal(2),
+		}
+		if got, want := len(content.Attributes), len(want); got != want {
+			t.Fatalf("wrong number of attributes %d; want %d", got, want)
+		}
+		for name, wantVal := range want {
+			got, _ := content.Attributes[name].Expr.Value(nil)
+			if !got.RawEquals(wantVal) {
+				t.Errorf("wrong value for %s\ngot:  %#v\nwant: %#v", name, got, wantVal)
+			}
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		o, diags := ParseCLIArguments([]string{"io_mode", "io_mode=async", "count:=[", "count=2"})
+		if got, want := len(diags), 2; got != want {
+			t.Fatalf("wrong number of diagnostics %d; want %d\n%s", got, want, diags.Error())
+		}
+		if got, want := diags[0].Detail, `Invalid argument "io_mode"`; !strings.Contains(got, want) {
+			t.Errorf("wrong first error\ngot:  %s\nwant: %s", got, want)
+		}
+		if got, want := diags[1].Detail, `Invalid expression for argument "count"`; !strings.Contains(got, want) {
+			t.Errorf("wrong second error\ngot:  %s\nwant: %s", got, want)
+		}
+
+		// The valid arguments are still parsed.
+		content, diags := o.ApplyOverlay(&hcl.BodyContent{}, schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if got, want := len(content.Attributes), 2; got != want {
+			t.Errorf("wrong number of attributes %d; want %d", got, want)
+		}
+	})
+	t.Run("empty", func(t *testing.T) {
+		o, diags := ParseCLIArguments(nil)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		content, diags := o.ApplyOverlay(&hcl.BodyContent{}, schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if got := len(content.Attributes); got != 0 {
+			t.Errorf("unexpected attributes %#v", content.Attributes)
+		}
+	})
+}
+
+func TestParseCLIArgumentNameCollision(t *testing.T) {
+	// This schema is unusual, but HCL does permit an argument and a block
+	// type to share a name when a schema is constructed directly.
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "service"}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "service", LabelNames: []string{"name"}}},
+	}
+	innerSchema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "listen_addr"}},
+	}
+
+	tests := map[string]struct {
+		Args       []string
+		Remove     string    // path to remove after applying Args, if any
+		WantAttr   cty.Value // cty.NilVal if the argument should not be set
+		WantBlocks []string  // the listen_addr of each block
+	}{
+		"argument": {
+			[]string{"service=web"},
+			"",
+			cty.StringVal("web"),
+			nil,
+		},
+		"block": {
+			[]string{"service.web.listen_addr=:80"},
+			"",
+			cty.NilVal,
+			[]string{":80"},
+		},
+		"both": {
+			[]string{"service=web", "service.web.listen_addr=:80"},
+			"",
+			cty.StringVal("web"),
+			[]string{":80"},
+		},
+		"remove argument": {
+			[]string{"service=web", "service.web.listen_addr=:80"},
+			"service",
+			cty.NilVal,
+			[]string{":80"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				o, diags := ParseCLIArgument(arg)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+			if test.Remove != "" {
+				o, diags := NewRemoveOverlay(test.Remove)
+				if diags.HasErrors() {
+					t.Fatalf("path has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+			if diags := ValidateOverlays(schema, overlays...); diags.HasErrors() {
+				t.Fatalf("overlays are not valid: %s", diags.Error())
+			}
+
+			content, diags := ApplyOverlays(hcl.EmptyBody(), overlays...).Content(schema)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+
+			attr, hasAttr := content.Attributes["service"]
+			switch {
+			case test.WantAttr == cty.NilVal && hasAttr:
+				t.Errorf("unexpected service argument")
+			case test.WantAttr != cty.NilVal && !hasAttr:
+				t.Errorf("missing service argument")
+			case hasAttr:
+				got, _ := attr.Expr.Value(nil)
+				if !got.RawEquals(test.WantAttr) {
+					t.Errorf("wrong argument value\ngot:  %#v\nwant: %#v", got, test.WantAttr)
+				}
+			}
+
+			var gotBlocks []string
+			for _, block := range content.Blocks {
+				inner, diags := block.Body.Content(innerSchema)
+				if diags.HasErrors() {
+					t.Fatalf("unexpected problems in block: %s", diags.Error())
+				}
+				v, _ := inner.Attributes["listen_addr"].Expr.Value(nil)
+				gotBlocks = append(gotBlocks, v.AsString())
+			}
+			if diff := cmp.Diff(test.WantBlocks, gotBlocks); diff != "" {
+				t.Errorf("wrong blocks\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("ExtractCLIOptions", func(t *testing.T) {
+		args := []string{"--service", "web", "--service.web.listen_addr=:80"}
+		overlays, remain, diags := ExtractCLIOptions(args, schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if len(remain) != 0 {
+			t.Errorf("unexpected remaining arguments %#v", remain)
+		}
+
+		content, diags := ApplyOverlays(hcl.EmptyBody(), overlays...).Content(schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if got, want := len(content.Attributes), 1; got != want {
+			t.Errorf("wrong number of arguments %d; want %d", got, want)
+		}
+		if got, want := len(content.Blocks), 1; got != want {
+			t.Errorf("wrong number of blocks %d; want %d", got, want)
+		}
+	})
+}
+
+func TestParseCLIArgumentJSON(t *testing.T) {
+	f, diags := json.Parse([]byte(`{
+  "content-type": "text/plain",
+  "2fa": false,
+  "headers": {"x-request-id": "abc"}
+}`), "config.json")
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "content-type"},
+			{Name: "2fa"},
+			{Name: "headers"},
+			{Name: "a.b"},
+		},
+	}
+
+	tests := map[string]struct {
+		Arg     string
+		Name    string
+		Want    cty.Value
+		WantErr string
+	}{
+		"hyphen": {
+			`content-type=application/json`,
+			"content-type",
+			cty.StringVal("application/json"),
+			``,
+		},
+		"slash": {
+			`headers.content/type=a`,
+			"headers",
+			cty.ObjectVal(map[string]cty.Value{
+				"x-request-id": cty.StringVal("abc"),
+				"content/type": cty.StringVal("a"),
+			}),
+			``,
+		},
+		"leading digit": {
+			`2fa:=true`,
+			"2fa",
+			cty.True,
+			``,
+		},
+		"key with hyphen": {
+			`headers.x-trace=on`,
+			"headers",
+			cty.ObjectVal(map[string]cty.Value{
+				"x-request-id": cty.StringVal("abc"),
+				"x-trace":      cty.StringVal("on"),
+			}),
+			``,
+		},
+		"quoted": {
+			`"a.b"=c`,
+			"a.b",
+			cty.StringVal("c"),
+			``,
+		},
+		"empty step": {
+			`headers..x=y`,
+			"",
+			cty.NilVal,
+			`Invalid component "" in argument "headers..x"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, diags := ParseCLIArgumentJSON(test.Arg)
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success")
+				}
+				if got := diags.Error(); !strings.Contains(got, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", got, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("arg has problems: %s", diags.Error())
+			}
+
+			content, diags := ApplyOverlays(f.Body, o).Content(schema)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			attr, ok := content.Attributes[test.Name]
+			if !ok {
+				t.Fatalf("missing argument %q", test.Name)
+			}
+			got, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				t.Fatalf("value has problems: %s", diags.Error())
+			}
+			if !got.RawEquals(test.Want) {
+				t.Errorf("wrong value\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+
+	t.Run("identifiers required by ParseCLIArgument", func(t *testing.T) {
+		_, diags := ParseCLIArgument(`2fa=true`)
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+	})
+}
+
+func TestParseCLIArgumentWithOpts(t *testing.T) {
+	t.Run("Filename", func(t *testing.T) {
+		tests := map[string]struct {
+			Arg       string
+			WantRange hcl.Range
+		}{
+			"simple": {
+				`foo=bar`,
+				hcl.Range{
+					Filename: "<command-line>",
+					Start:    hcl.Pos{Line: 1, Column: 5, Byte: 4},
+					End:      hcl.Pos{Line: 1, Column: 8, Byte: 7},
+				},
+			},
+			"multi-byte characters": {
+				`foo."é".foo=hé`,
+				hcl.Range{
+					Filename: "<command-line>",
+					Start:    hcl.Pos{Line: 1, Column: 13, Byte: 13},
+					End:      hcl.Pos{Line: 1, Column: 15, Byte: 16},
+				},
+			},
+			"empty value": {
+				`foo=`,
+				hcl.Range{
+					Filename: "<command-line>",
+					Start:    hcl.Pos{Line: 1, Column: 5, Byte: 4},
+					End:      hcl.Pos{Line: 1, Column: 5, Byte: 4},
+				},
+			},
+			"expression": {
+				`foo:=[1, 2]`,
+				hcl.Range{
+					Filename: "<command-line>",
+					Start:    hcl.Pos{Line: 1, Column: 6, Byte: 5},
+					End:      hcl.Pos{Line: 1, Column: 12, Byte: 11},
+				},
+			},
+		}
+
+		for name, test := range tests {
+			t.Run(name, func(t *testing.T) {
+				o, diags := ParseCLIArgumentWithOpts(test.Arg, &ParseOptions{
+					Filename: "<command-line>",
+				})
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+
+				got := o.(*cliArgOverlay).expr.Range()
+				if diff := cmp.Diff(test.WantRange, got); diff != "" {
+					t.Fatalf("wrong range\n%s", diff)
+				}
+			})
+		}
+	})
+	t.Run("Filename in diagnostics", func(t *testing.T) {
+		o, diags := ParseCLIArgumentWithOpts(`count=many`, &ParseOptions{
+			Filename: "<command-line>",
+		})
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+
+		body := ApplyOverlays(hcl.EmptyBody(), o)
+		var got struct {
+			Count int `hcl:"count"`
+		}
+		diags = gohcl.DecodeBody(body, nil, &got)
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+		want := "<command-line>:1,7-11"
+		if got := diags[0].Subject.String(); got != want {
+			t.Fatalf("wrong subject\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("expression diagnostics without Filename", func(t *testing.T) {
+		o, diags := ParseCLIArgumentWithOpts(`port:="abc"`, &ParseOptions{
+			Source: "environment variable APP_PORT",
+		})
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+
+		body := ApplyOverlays(hcl.EmptyBody(), o)
+		var got struct {
+			Port int `hcl:"port"`
+		}
+		diags = gohcl.DecodeBody(body, nil, &got)
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+		want := `overlay "port" (from environment variable APP_PORT):1,8-11`
+		if got := diags[0].Subject.String(); got != want {
+			t.Fatalf("wrong subject\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("expression syntax error", func(t *testing.T) {
+		_, diags := ParseCLIArgumentWithOpts(`tags:=[1,`, &ParseOptions{
+			Filename: "<command-line>",
+		})
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+		if diags[0].Subject == nil {
+			t.Fatalf("diagnostic has no subject")
+		}
+		if got, want := diags[0].Subject.Filename, "<command-line>"; got != want {
+			t.Fatalf("wrong subject filename %q; want %q", got, want)
+		}
+	})
+	t.Run("NoCreate", func(t *testing.T) {
+		type Service struct {
+			Type       string `hcl:"type,label"`
+			Name       string `hcl:"name,label"`
+			ListenAddr string `hcl:"listen_addr"`
+		}
+		type Config struct {
+			Services []Service `hcl:"service,block"`
+		}
+		f, diags := hclsyntax.ParseConfig([]byte(`
+service "http" "web" {
+  listen_addr = ":80"
+}
+`), "config.hcl", hcl.InitialPos)
+		if diags.HasErrors() {
+			t.Fatalf("config has problems: %s", diags.Error())
+		}
+
+		existing, diags := ParseCLIArgumentWithOpts(`service.http.web.listen_addr=:8080`, &ParseOptions{NoCreate: true})
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		var got Config
+		diags = gohcl.DecodeBody(ApplyOverlays(f.Body, existing), nil, &got)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		want := Config{
+			Services: []Service{{Type: "http", Name: "web", ListenAddr: ":8080"}},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("incorrect result\n%s", diff)
+		}
+
+		typo, diags := ParseCLIArgumentWithOpts(`service.http.wbe.listen_addr=:8080`, &ParseOptions{NoCreate: true})
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		diags = gohcl.DecodeBody(ApplyOverlays(f.Body, typo), nil, &got)
+		wantErr := `Invalid argument "service.http.wbe.listen_addr": no block service "http" "wbe" exists to override.`
+		if errStr := diags.Error(); !strings.Contains(errStr, wantErr) {
+			t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, wantErr)
+		}
+	})
+	t.Run("no Filename", func(t *testing.T) {
+		o, diags := ParseCLIArgumentWithOpts(`foo=bar`, nil)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+
+		got := o.(*cliArgOverlay).expr.Range()
+		if diff := cmp.Diff(hcl.Range{}, got); diff != "" {
+			t.Fatalf("wrong range\n%s", diff)
+		}
+	})
+	t.Run("ValidSegment", func(t *testing.T) {
+		// This validator also allows names that begin with a digit.
+		validDigits := func(s string) bool {
+			return hclsyntax.ValidIdentifier("_" + s)
+		}
+		opts := &ParseOptions{ValidSegment: validDigits}
+
+		o, diags := ParseCLIArgumentWithOpts(`2fa=totp`, opts)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		content, diags := o.ApplyOverlay(&hcl.BodyContent{}, &hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "2fa"}},
+		})
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if got, want := attrStringValue(t, content.Attributes["2fa"]), "totp"; got != want {
+			t.Errorf("wrong 2fa %q; want %q", got, want)
+		}
+
+		// Steps the validator rejects are still acceptable when quoted,
+		// and the wildcard is always acceptable.
+		if _, diags := ParseCLIArgumentWithOpts(`"two factor"=debug`, opts); diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		if _, diags := ParseCLIArgumentWithOpts(`service.*.2fa=debug`, opts); diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+
+		_, diags = ParseCLIArgumentWithOpts(`two factor=debug`, opts)
+		wantErr := `Invalid component "two factor" in argument "two factor".`
+		if errStr := diags.Error(); !strings.Contains(errStr, wantErr) {
+			t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, wantErr)
+		}
+
+		// A stricter validator can also reject names that are valid HCL
+		// identifiers.
+		_, diags = ParseCLIArgumentWithOpts(`LogLevel=debug`, &ParseOptions{
+			ValidSegment: func(s string) bool { return s == strings.ToLower(s) },
+		})
+		wantErr = `Invalid component "LogLevel" in argument "LogLevel".`
+		if errStr := diags.Error(); !strings.Contains(errStr, wantErr) {
+			t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, wantErr)
+		}
+
+		// Without a validator, a leading digit is not allowed.
+		if _, diags := ParseCLIArgumentWithOpts(`2fa=totp`, nil); !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+	})
+}
+
+func TestParseCLIArgumentTransform(t *testing.T) {
+	type Service struct {
+		Name    string `hcl:"name,label"`
+		BaseURL string `hcl:"base_url"`
+	}
+	type Config struct {
+		DataDir  string    `hcl:"data_dir,optional"`
+		Name     string    `hcl:"name,optional"`
+		Count    int       `hcl:"count,optional"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	var gotPaths [][]string
+	opts := &ParseOptions{
+		Transform: func(path []string, raw string) (string, hcl.Diagnostics) {
+			gotPaths = append(gotPaths, path)
+			var diags hcl.Diagnostics
+			switch path[len(path)-1] {
+			case "data_dir":
+				if !strings.HasPrefix(raw, "/") {
+					raw = "/srv/" + raw
+				}
+			case "base_url":
+				raw = strings.ToLower(raw)
+			case "name":
+				if raw == "" {
+					diags = diags.Append(&hcl.Diagnostic{
+						Severity: hcl.DiagError,
+						Summary:  "Invalid name",
+						Detail:   "The name must not be empty.",
+					})
+				}
+			}
+			return raw, diags
+		},
+		InferTypes: true,
+	}
+
+	var overlays []Overlay
+	for _, arg := range []string{
+		`data_dir=data`,
+		`service.web.base_url=HTTPS://Example.com/`,
+		`count=2`,
+		`name:="Unchanged"`,
+	} {
+		o, diags := ParseCLIArgumentWithOpts(arg, opts)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+
+	var got Config
+	diags := gohcl.DecodeBody(ApplyOverlays(hcl.EmptyBody(), overlays...), nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		DataDir:  "/srv/data",
+		Name:     "Unchanged",
+		Count:    2,
+		Services: []Service{{Name: "web", BaseURL: "https://example.com/"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong result\n%s", diff)
+	}
+	wantPaths := [][]string{
+		{"data_dir"},
+		{"service", "web", "base_url"},
+		{"count"},
+	}
+	if diff := cmp.Diff(wantPaths, gotPaths); diff != "" {
+		t.Errorf("wrong paths passed to Transform\n%s", diff)
+	}
+
+	t.Run("error", func(t *testing.T) {
+		o, diags := ParseCLIArgumentWithOpts(`name=`, opts)
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+		if o != nil {
+			t.Errorf("unexpected overlay %#v", o)
+		}
+		if got, want := diags.Error(), "The name must not be empty."; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+}
+
+func TestParseCLIArgumentInferTypes(t *testing.T) {
+	tests := map[string]struct {
+		Arg  string
+		Want cty.Value
+	}{
+		"integer": {
+			`port=8080`,
+			cty.NumberIntVal(8080),
+		},
+		"zero": {
+			`port=0`,
+			cty.NumberIntVal(0),
+		},
+		"negative": {
+			`offset=-3`,
+			cty.NumberIntVal(-3),
+		},
+		"fractional": {
+			`ratio=0.25`,
+			cty.NumberFloatVal(0.25),
+		},
+		"fractional zero": {
+			`ratio=1.0`,
+			cty.NumberIntVal(1),
+		},
+		"exponent": {
+			`limit=1e3`,
+			cty.NumberIntVal(1000),
+		},
+		"true": {
+			`enabled=true`,
+			cty.True,
+		},
+		"false": {
+			`enabled=false`,
+			cty.False,
+		},
+		"leading zero": {
+			`zip=08`,
+			cty.StringVal("08"),
+		},
+		"leading plus": {
+			`offset=+1`,
+			cty.StringVal("+1"),
+		},
+		"no integer part": {
+			`ratio=.5`,
+			cty.StringVal(".5"),
+		},
+		"no fractional digits": {
+			`ratio=1.`,
+			cty.StringVal("1."),
+		},
+		"hexadecimal": {
+			`mask=0x10`,
+			cty.StringVal("0x10"),
+		},
+		"capitalized bool": {
+			`enabled=True`,
+			cty.StringVal("True"),
+		},
+		"empty": {
+			`name=`,
+			cty.StringVal(""),
+		},
+		"escaped": {
+			`port=\8080`,
+			cty.StringVal("8080"),
+		},
+		"expression": {
+			`port:="8080"`,
+			cty.StringVal("8080"),
+		},
+		"empty list": {
+			`tags=[]`,
+			cty.EmptyTupleVal,
+		},
+		"empty map": {
+			`labels={}`,
+			cty.EmptyObjectVal,
+		},
+		"non-empty list": {
+			`tags=[a]`,
+			cty.StringVal("[a]"),
+		},
+		"append empty list": {
+			`tags+=[]`,
+			cty.StringVal("[]"),
+		},
+		"escaped empty list": {
+			`tags=\[]`,
+			cty.StringVal("[]"),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, diags := ParseCLIArgumentWithOpts(test.Arg, &ParseOptions{
+				InferTypes: true,
+			})
+			if diags.HasErrors() {
+				t.Fatalf("arg has problems: %s", diags.Error())
+			}
+
+			got, diags := o.(*cliArgOverlay).expr.Value(nil)
+			if diags.HasErrors() {
+				t.Fatalf("value has problems: %s", diags.Error())
+			}
+			if !got.RawEquals(test.Want) {
+				t.Errorf("wrong value\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		o, diags := ParseCLIArgumentWithOpts(`port=8080`, nil)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+
+		got, _ := o.(*cliArgOverlay).expr.Value(nil)
+		if want := cty.StringVal("8080"); !got.RawEquals(want) {
+			t.Errorf("wrong value\ngot:  %#v\nwant: %#v", got, want)
+		}
+	})
+	t.Run("append", func(t *testing.T) {
+		o, diags := ParseCLIArgumentWithOpts(`ports+=8080`, &ParseOptions{
+			InferTypes: true,
+		})
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+
+		content, diags := o.ApplyOverlay(&hcl.BodyContent{}, &hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "ports"}},
+		})
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		got, diags := content.Attributes["ports"].Expr.Value(nil)
+		if diags.HasErrors() {
+			t.Fatalf("value has problems: %s", diags.Error())
+		}
+		want := cty.TupleVal([]cty.Value{cty.NumberIntVal(8080)})
+		if !got.RawEquals(want) {
+			t.Errorf("wrong value\ngot:  %#v\nwant: %#v", got, want)
+		}
+	})
+}
+
+func TestParseCLIArgumentReplaceRanges(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "io_mode"}, {Name: "count"}},
+	}
+	orig, diags := f.Body.Content(schema)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	var overlays []Overlay
+	for _, arg := range []string{"io_mode=async", "count=1"} {
+		o, diags := ParseCLIArgumentWithOpts(arg, &ParseOptions{Filename: "<command-line>"})
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+	content, diags := ApplyOverlays(f.Body, overlays...).Content(schema)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+
+	// The replaced attribute keeps its declaration ranges, but has the
+	// range of the new value for its expression.
+	replaced := content.Attributes["io_mode"]
+	if got, want := replaced.Range, orig.Attributes["io_mode"].Range; got != want {
+		t.Errorf("wrong range for replaced attribute\ngot:  %#v\nwant: %#v", got, want)
+	}
+	if got, want := replaced.NameRange, orig.Attributes["io_mode"].NameRange; got != want {
+		t.Errorf("wrong name range for replaced attribute\ngot:  %#v\nwant: %#v", got, want)
+	}
+	if got, want := replaced.Expr.Range().Filename, "<command-line>"; got != want {
+		t.Errorf("wrong expression filename for replaced attribute %q; want %q", got, want)
+	}
+
+	// The new attribute has only the range of its value.
+	added := content.Attributes["count"]
+	if got, want := added.Range, added.Expr.Range(); got != want {
+		t.Errorf("wrong range for new attribute\ngot:  %#v\nwant: %#v", got, want)
+	}
+	if got, want := added.NameRange, (hcl.Range{}); got != want {
+		t.Errorf("wrong name range for new attribute\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestNewCLIArgumentOverlay(t *testing.T) {
+	type Service struct {
+		Name string `hcl:"name,label"`
+		Env  string `hcl:"env"`
+	}
+	type Config struct {
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+service "web.prod" {
+  env = "a"
+}
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	o, diags := NewCLIArgumentOverlay([]string{"service", "web.prod", "env"}, "FOO=bar")
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	var got Config
+	diags = gohcl.DecodeBody(ApplyOverlays(f.Body, o), nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		Services: []Service{{Name: "web.prod", Env: "FOO=bar"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+
+	if got, want := o.(*cliArgOverlay).fullPath, `service."web.prod".env`; got != want {
+		t.Errorf("wrong path %q; want %q", got, want)
+	}
+
+	_, diags = NewCLIArgumentOverlay(nil, "foo")
+	if !diags.HasErrors() {
+		t.Errorf("unexpected success with empty path")
+	}
+}
+
+func TestExtractCLIOptionsSpaceSeparatedEquals(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "env"}},
+	}
+	opts := &ExtractOptions{
+		Aliases: map[string]string{"-e": "env"},
+	}
+	for _, args := range [][]string{
+		{"--env", "FOO=bar"},
+		{"--env", "\\FOO=bar"},
+		{"--env=\\FOO=bar"},
+		{"-e", "FOO=bar"},
+		{"-e", "\\FOO=bar"},
+		{"-e=FOO=bar"},
+	} {
+		overlays, _, diags := ExtractCLIOptionsWithOpts(args, schema, opts)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems for %q: %s", args, diags.Error())
+		}
+		got := &struct {
+			Env string `hcl:"env"`
+		}{}
+		diags = gohcl.DecodeBody(ApplyOverlays(hcl.EmptyBody(), overlays...), nil, got)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems for %q: %s", args, diags.Error())
+		}
+		if got, want := got.Env, "FOO=bar"; got != want {
+			t.Errorf("wrong value for %q: %q; want %q", args, got, want)
+		}
+	}
+}
+
+func TestExtractCLIOptionsDetachedEquals(t *testing.T) {
+	type Service struct {
+		Name       string   `hcl:"name,label"`
+		ListenAddr string   `hcl:"listen_addr,optional"`
+		Tags       []string `hcl:"tags,optional"`
+		Replicas   int      `hcl:"replicas,optional"`
+	}
+	type Config struct {
+		Query    string    `hcl:"query,optional"`
+		Services []Service `hcl:"service,block"`
+	}
+	schema, _ := gohcl.ImpliedBodySchema(&Config{})
+
+	tests := map[string]struct {
+		Args       []string
+		Want       Config
+		WantRemain []string
+	}{
+		"string": {
+			Args: []string{"--service.web.listen_addr", "=:8080"},
+			Want: Config{Services: []Service{{Name: "web", ListenAddr: ":8080"}}},
+		},
+		"empty": {
+			Args: []string{"--query", "="},
+			Want: Config{Query: ""},
+		},
+		"value with equals": {
+			Args: []string{"--query", "=a=b"},
+			Want: Config{Query: "a=b"},
+		},
+		"expression": {
+			Args: []string{"--service.web.replicas:", "=3"},
+			Want: Config{Services: []Service{{Name: "web", Replicas: 3}}},
+		},
+		"append": {
+			Args: []string{"--service.web.tags+", "=a"},
+			Want: Config{Services: []Service{{Name: "web", Tags: []string{"a"}}}},
+		},
+		"escaped": {
+			Args: []string{"--query", `\=x`},
+			Want: Config{Query: "=x"},
+		},
+		"option with its own equals": {
+			Args:       []string{"--query=a", "=b"},
+			Want:       Config{Query: "a"},
+			WantRemain: []string{"=b"},
+		},
+		"unknown option": {
+			Args:       []string{"--verbose", "=b"},
+			WantRemain: []string{"--verbose", "=b"},
+		},
+		"positional": {
+			Args:       []string{"input.txt", "=b"},
+			WantRemain: []string{"input.txt", "=b"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			overlays, remain, diags := ExtractCLIOptions(test.Args, schema)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.WantRemain, remain); diff != "" {
+				t.Errorf("wrong remaining arguments\n%s", diff)
+			}
+			var got Config
+			diags = gohcl.DecodeBody(ApplyOverlays(hcl.EmptyBody(), overlays...), nil, &got)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCLIArgumentEscape(t *testing.T) {
+	type Service struct {
+		Name  string   `hcl:"name,label"`
+		Query string   `hcl:"query,optional"`
+		Tags  []string `hcl:"tags,optional"`
+	}
+	type Config struct {
+		Value    string    `hcl:"value,optional"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	tests := map[string]struct {
+		Args []string
+		Want Config
+	}{
+		"equals in value": {
+			[]string{`value=a=b`},
+			Config{Value: "a=b"},
+		},
+		"value starting with equals": {
+			[]string{`value==a`},
+			Config{Value: "=a"},
+		},
+		"value starting with colon equals": {
+			[]string{`value=:=a`},
+			Config{Value: ":=a"},
+		},
+		"escaped at sign": {
+			[]string{`value=\@hello`},
+			Config{Value: "@hello"},
+		},
+		"unescaped at sign": {
+			[]string{`value=@hello`},
+			Config{Value: "@hello"},
+		},
+		"escaped backslash": {
+			[]string{`value=\\server`},
+			Config{Value: `\server`},
+		},
+		"backslash alone": {
+			[]string{`value=\`},
+			Config{Value: ""},
+		},
+		"backslash not at start": {
+			[]string{`value=a\b`},
+			Config{Value: `a\b`},
+		},
+		"equals in quoted label": {
+			[]string{`service."a=b".query=c=d`},
+			Config{Services: []Service{{Name: "a=b", Query: "c=d"}}},
+		},
+		"escaped append": {
+			[]string{`service.a.tags+=\@x`},
+			Config{Services: []Service{{Name: "a", Tags: []string{"@x"}}}},
+		},
+		"expression is not escaped": {
+			[]string{`value:="\\x"`},
+			Config{Value: `\x`},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				o, diags := ParseCLIArgument(arg)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			var got Config
+			diags := gohcl.DecodeBody(ApplyOverlays(hcl.EmptyBody(), overlays...), nil, &got)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCLIArgumentNull(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+foo = "a"
+block "a" {
+  foo = "a"
+}
+`), "", hcl.Pos{})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	t.Run("root attribute", func(t *testing.T) {
+		o, diags := ParseCLIArgumentNull("foo")
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		body := ApplyOverlays(f.Body, o)
+		content, diags := body.Content(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "foo"}},
+			Blocks:     []hcl.BlockHeaderSchema{{Type: "block", LabelNames: []string{"name"}}},
+		})
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		attr, exists := content.Attributes["foo"]
+		if !exists {
+			t.Fatalf("attribute foo is not set")
+		}
+		v, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if !v.IsNull() {
+			t.Fatalf("wrong value %#v; want null", v)
+		}
+	})
+	t.Run("new attribute in new block", func(t *testing.T) {
+		o, diags := ParseCLIArgumentNull("block.b.foo")
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		body := ApplyOverlays(f.Body, o)
+		got := &struct {
+			Foo   *string `hcl:"foo"`
+			Block []struct {
+				Name string  `hcl:"name,label"`
+				Foo  *string `hcl:"foo"`
+			} `hcl:"block,block"`
+		}{}
+		diags = gohcl.DecodeBody(body, nil, got)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if got, want := len(got.Block), 2; got != want {
+			t.Fatalf("wrong number of blocks %d; want %d", got, want)
+		}
+		if got.Block[1].Foo != nil {
+			t.Fatalf("block b has foo = %q; want null", *got.Block[1].Foo)
+		}
+	})
+	t.Run("just attributes", func(t *testing.T) {
+		o, diags := ParseCLIArgumentNull("bar")
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		attrsF, diags := hclsyntax.ParseConfig([]byte(`bar = "a"`), "", hcl.Pos{})
+		if diags.HasErrors() {
+			t.Fatalf("config has problems: %s", diags.Error())
+		}
+		attrs, diags := ApplyOverlays(attrsF.Body, o).JustAttributes()
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		v, _ := attrs["bar"].Expr.Value(nil)
+		if !v.IsNull() {
+			t.Fatalf("wrong value %#v; want null", v)
+		}
+	})
+}
+
+func TestParseCLIArgumentEmptyCollection(t *testing.T) {
+	type Service struct {
+		Name   string            `hcl:"name,label"`
+		Tags   []string          `hcl:"tags,optional"`
+		Labels map[string]string `hcl:"labels,optional"`
+	}
+	type Config struct {
+		Tags     []string          `hcl:"tags,optional"`
+		Labels   map[string]string `hcl:"labels,optional"`
+		Services []Service         `hcl:"service,block"`
+	}
+
+	tests := map[string]struct {
+		Args []string
+		Want Config
+	}{
+		"empty list": {
+			Args: []string{"tags:=[]"},
+			Want: Config{
+				Tags:     []string{},
+				Labels:   map[string]string{"env": "prod"},
+				Services: []Service{{Name: "web", Tags: []string{"a"}}},
+			},
+		},
+		"empty map": {
+			Args: []string{"labels:={}"},
+			Want: Config{
+				Tags:     []string{"a", "b"},
+				Labels:   map[string]string{},
+				Services: []Service{{Name: "web", Tags: []string{"a"}}},
+			},
+		},
+		"in block": {
+			Args: []string{"service.web.tags:=[]", "service.web.labels:={}"},
+			Want: Config{
+				Tags:     []string{"a", "b"},
+				Labels:   map[string]string{"env": "prod"},
+				Services: []Service{{Name: "web", Tags: []string{}, Labels: map[string]string{}}},
+			},
+		},
+		"in new block": {
+			Args: []string{"service.api.tags:=[]"},
+			Want: Config{
+				Tags:   []string{"a", "b"},
+				Labels: map[string]string{"env": "prod"},
+				Services: []Service{
+					{Name: "web", Tags: []string{"a"}},
+					{Name: "api", Tags: []string{}},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(`
+tags   = ["a", "b"]
+labels = { env = "prod" }
+
+service "web" {
+  tags = ["a"]
+}
+`), "config.hcl", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+			o, diags := ParseCLIArguments(test.Args)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+
+			var got Config
+			diags = gohcl.DecodeBody(ApplyOverlays(f.Body, o), nil, &got)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			// cmp.Diff distinguishes nil from empty slices and maps, which
+			// is the distinction under test here.
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCLIArgumentFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"server.pem": &fstest.MapFile{Data: []byte("-----BEGIN CERTIFICATE-----\nabc\n")},
+	}
+
+	tests := map[string]struct {
+		Arg     string
+		Want    string
+		WantErr string
+	}{
+		"literal": {
+			`foo=bar`,
+			"bar",
+			``,
+		},
+		"from file": {
+			`foo=@server.pem`,
+			"-----BEGIN CERTIFICATE-----\nabc\n",
+			``,
+		},
+		"escaped at sign": {
+			`foo=@@server.pem`,
+			"@server.pem",
+			``,
+		},
+		"backslash-escaped at sign": {
+			`foo=\@server.pem`,
+			"@server.pem",
+			``,
+		},
+		"missing file": {
+			`foo=@nope.pem`,
+			``,
+			`Failed to read value for argument "foo" from nope.pem`,
+		},
+		"expression": {
+			`foo:="@server.pem"`,
+			"@server.pem",
+			``,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, diags := ParseCLIArgumentFiles(test.Arg, fsys)
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success")
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("arg has problems: %s", diags.Error())
+			}
+
+			body := ApplyOverlays(hcl.EmptyBody(), o)
+			got := &struct {
+				Foo string `hcl:"foo"`
+			}{}
+			diags = gohcl.DecodeBody(body, nil, got)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if got.Foo != test.Want {
+				t.Fatalf("wrong value\ngot:  %q\nwant: %q", got.Foo, test.Want)
+			}
+		})
+	}
+}
+
+func TestParseCLIArgumentMultiLine(t *testing.T) {
+	fsys := fstest.MapFS{
+		"motd.txt": &fstest.MapFile{Data: []byte("Welcome!\n\nBe nice.\n")},
+	}
+
+	tests := map[string]struct {
+		Arg  string
+		Opts *ParseOptions
+		Want cty.Value
+	}{
+		"embedded newlines": {
+			Arg:  "motd=Welcome!\nBe nice.",
+			Want: cty.StringVal("Welcome!\nBe nice."),
+		},
+		"surrounding whitespace": {
+			Arg:  "motd=\n  Welcome!\n\tBe nice.  \n\n",
+			Want: cty.StringVal("\n  Welcome!\n\tBe nice.  \n\n"),
+		},
+		"CRLF line endings": {
+			Arg:  "motd=Welcome!\r\nBe nice.\r\n",
+			Want: cty.StringVal("Welcome!\r\nBe nice.\r\n"),
+		},
+		"backslash escape": {
+			Arg:  "motd=\\@everyone\nBe nice.",
+			Want: cty.StringVal("@everyone\nBe nice."),
+		},
+		"from file": {
+			Arg:  "motd=@motd.txt",
+			Want: cty.StringVal("Welcome!\n\nBe nice.\n"),
+		},
+		"with filename": {
+			Arg:  "motd=Welcome!\nBe nice.\n",
+			Opts: &ParseOptions{Filename: "<command-line>"},
+			Want: cty.StringVal("Welcome!\nBe nice.\n"),
+		},
+		"inferred types": {
+			Arg:  "motd=1\n2",
+			Opts: &ParseOptions{InferTypes: true},
+			Want: cty.StringVal("1\n2"),
+		},
+		"inferred types with trailing newline": {
+			Arg:  "motd=true\n",
+			Opts: &ParseOptions{InferTypes: true},
+			Want: cty.StringVal("true\n"),
+		},
+		"quoted with escapes": {
+			Arg:  `motd="Welcome!\nBe nice.\n"`,
+			Opts: &ParseOptions{UnquoteValues: true},
+			Want: cty.StringVal("Welcome!\nBe nice.\n"),
+		},
+		"heredoc": {
+			Arg:  "motd:=<<EOT\nWelcome!\n  Be nice.\nEOT\n",
+			Want: cty.StringVal("Welcome!\n  Be nice.\n"),
+		},
+		"heredoc without final newline": {
+			Arg:  "motd:=<<EOT\nWelcome!\nEOT",
+			Want: cty.StringVal("Welcome!\n"),
+		},
+		"indented heredoc": {
+			Arg:  "motd:=<<-EOT\n    Welcome!\n      Be nice.\n    EOT\n",
+			Want: cty.StringVal("Welcome!\n  Be nice.\n"),
+		},
+		"append": {
+			Arg:  "motd+=Welcome!\nBe nice.\n",
+			Want: cty.TupleVal([]cty.Value{cty.StringVal("Welcome!\nBe nice.\n")}),
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var o Overlay
+			var diags hcl.Diagnostics
+			switch {
+			case test.Opts != nil:
+				o, diags = ParseCLIArgumentWithOpts(test.Arg, test.Opts)
+			default:
+				o, diags = ParseCLIArgumentFiles(test.Arg, fsys)
+			}
+			if diags.HasErrors() {
+				t.Fatalf("arg has problems: %s", diags.Error())
+			}
+
+			body := ApplyOverlays(hcl.EmptyBody(), o)
+			attrs, diags := body.JustAttributes()
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			got, diags := attrs["motd"].Expr.Value(nil)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if !got.RawEquals(test.Want) {
+				t.Fatalf("wrong value\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestFileArgumentParserStdin(t *testing.T) {
+	fsys := fstest.MapFS{
+		"server.pem": &fstest.MapFile{Data: []byte("cert")},
+	}
+	p := &FileArgumentParser{
+		FS:    fsys,
+		Stdin: strings.NewReader("s3cret"),
+	}
+
+	var overlays []Overlay
+	for _, arg := range []string{"cert=@server.pem", "token=@-", "greeting=@@-"} {
+		o, diags := p.Parse(arg)
+		if diags.HasErrors() {
+			t.Fatalf("arg %q has problems: %s", arg, diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+
+	_, diags := p.Parse("password=@-")
+	if !diags.HasErrors() {
+		t.Fatalf("unexpected success for second use of standard input")
+	}
+	wantErr := `Failed to read value for argument "password" from standard input: it was already read for argument "token".`
+	if errStr := diags.Error(); !strings.Contains(errStr, wantErr) {
+		t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, wantErr)
+	}
+
+	body := ApplyOverlays(hcl.EmptyBody(), overlays...)
+	got := &struct {
+		Cert     string `hcl:"cert"`
+		Token    string `hcl:"token"`
+		Greeting string `hcl:"greeting"`
+	}{}
+	diags = gohcl.DecodeBody(body, nil, got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := got.Token, "s3cret"; got != want {
+		t.Errorf("wrong token %q; want %q", got, want)
+	}
+	if got, want := got.Cert, "cert"; got != want {
+		t.Errorf("wrong cert %q; want %q", got, want)
+	}
+	if got, want := got.Greeting, "@-"; got != want {
+		t.Errorf("wrong greeting %q; want %q", got, want)
+	}
+}
+
+func TestParseCLIArgumentNestedBlocks(t *testing.T) {
+	type Deepest struct {
+		Name string `hcl:"name,label"`
+		Foo  string `hcl:"foo,optional"`
+		Bar  string `hcl:"bar,optional"`
+	}
+	type Inner struct {
+		Deepest []Deepest `hcl:"deepest,block"`
+		Baz     string    `hcl:"baz,optional"`
+	}
+	type Outer struct {
+		Type  string  `hcl:"type,label"`
+		Name  string  `hcl:"name,label"`
+		Inner []Inner `hcl:"inner,block"`
+	}
+	type Config struct {
+		Outer []Outer `hcl:"outer,block"`
+	}
+
+	tests := map[string]struct {
+		Args    []string
+		Remove  string
+		Want    Config
+		WantErr string
+	}{
+		"existing blocks at every level": {
+			Args: []string{`outer.a.b.inner.deepest.x.foo=changed`},
+			Want: Config{
+				Outer: []Outer{
+					{
+						Type: "a", Name: "b",
+						Inner: []Inner{
+							{Deepest: []Deepest{
+								{Name: "x", Foo: "changed", Bar: "x"},
+								{Name: "y", Foo: "y"},
+							}},
+							{Deepest: []Deepest{{Name: "x", Foo: "second"}}},
+						},
+					},
+				},
+			},
+		},
+		"new block at the deepest level": {
+			Args: []string{`outer.a.b.inner.deepest.z.foo=new`},
+			Want: Config{
+				Outer: []Outer{
+					{
+						Type: "a", Name: "b",
+						Inner: []Inner{
+							{Deepest: []Deepest{
+								{Name: "x", Foo: "x", Bar: "x"},
+								{Name: "y", Foo: "y"},
+								{Name: "z", Foo: "new"},
+							}},
+							{Deepest: []Deepest{{Name: "x", Foo: "second"}}},
+						},
+					},
+				},
+			},
+		},
+		"new blocks at every level": {
+			Args: []string{`outer.c.d.inner.deepest.x.foo=new`},
+			Want: Config{
+				Outer: []Outer{
+					{
+						Type: "a", Name: "b",
+						Inner: []Inner{
+							{Deepest: []Deepest{
+								{Name: "x", Foo: "x", Bar: "x"},
+								{Name: "y", Foo: "y"},
+							}},
+							{Deepest: []Deepest{{Name: "x", Foo: "second"}}},
+						},
+					},
+					{
+						Type: "c", Name: "d",
+						Inner: []Inner{
+							{Deepest: []Deepest{{Name: "x", Foo: "new"}}},
+						},
+					},
+				},
+			},
+		},
+		"index at intermediate level": {
+			Args: []string{`outer.a.b.inner[1].deepest.x.foo=changed`},
+			Want: Config{
+				Outer: []Outer{
+					{
+						Type: "a", Name: "b",
+						Inner: []Inner{
+							{Deepest: []Deepest{
+								{Name: "x", Foo: "x", Bar: "x"},
+								{Name: "y", Foo: "y"},
+							}},
+							{Deepest: []Deepest{{Name: "x", Foo: "changed"}}},
+						},
+					},
+				},
+			},
+		},
+		"wildcards at several levels": {
+			Args: []string{`outer.*.b.inner[*].deepest.*.foo=all`},
+			Want: Config{
+				Outer: []Outer{
+					{
+						Type: "a", Name: "b",
+						Inner: []Inner{
+							{Deepest: []Deepest{
+								{Name: "x", Foo: "all", Bar: "x"},
+								{Name: "y", Foo: "all"},
+							}},
+							{Deepest: []Deepest{{Name: "x", Foo: "all"}}},
+						},
+					},
+				},
+			},
+		},
+		"several overlays at different depths": {
+			Args: []string{
+				`outer.a.b.inner.baz=inner`,
+				`outer.a.b.inner.deepest.y.bar=deep`,
+				`outer.a.b.inner.deepest.y.foo=deeper`,
+			},
+			Want: Config{
+				Outer: []Outer{
+					{
+						Type: "a", Name: "b",
+						Inner: []Inner{
+							{
+								Baz: "inner",
+								Deepest: []Deepest{
+									{Name: "x", Foo: "x", Bar: "x"},
+									{Name: "y", Foo: "deeper", Bar: "deep"},
+								},
+							},
+							{Deepest: []Deepest{{Name: "x", Foo: "second"}}},
+						},
+					},
+				},
+			},
+		},
+		"remove at the deepest level": {
+			Remove: `outer.a.b.inner.deepest.x.bar`,
+			Want: Config{
+				Outer: []Outer{
+					{
+						Type: "a", Name: "b",
+						Inner: []Inner{
+							{Deepest: []Deepest{
+								{Name: "x", Foo: "x"},
+								{Name: "y", Foo: "y"},
+							}},
+							{Deepest: []Deepest{{Name: "x", Foo: "second"}}},
+						},
+					},
+				},
+			},
+		},
+		"missing label at the deepest level": {
+			Args:    []string{`outer.a.b.inner.deepest.foo=x`},
+			WantErr: `block type "deepest" requires 1 label, but the path provides 0.`,
+		},
+		"unexpected argument at the deepest level": {
+			Args:    []string{`outer.a.b.inner.deepest.x.nope=x`},
+			WantErr: `Unexpected argument "outer.a.b.inner.deepest.x.nope".`,
+		},
+		"key in string argument at the deepest level": {
+			Args:    []string{`outer.a.b.inner.deepest.x.foo.bar=x`},
+			WantErr: `Cannot set a key in argument "outer.a.b.inner.deepest.x.foo.bar": it is string`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(`
+outer "a" "b" {
+  inner {
+    deepest "x" {
+      foo = "x"
+      bar = "x"
+    }
+    deepest "y" {
+      foo = "y"
+    }
+  }
+  inner {
+    deepest "x" {
+      foo = "second"
+    }
+  }
+}
+`), "config.hcl", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+			var overlays []Overlay
+			for _, raw := range test.Args {
+				o, diags := ParseCLIArgument(raw)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+			if test.Remove != "" {
+				o, diags := NewRemoveOverlay(test.Remove)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			var got Config
+			diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, &got)
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCLIArgumentLabelArity(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "service", LabelNames: []string{"type", "name"}},
+		},
+	}
+	serviceSchema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "listen_addr"},
+		},
+	}
+	f, diags := hclsyntax.ParseConfig([]byte(`
+service "http" "web" {
+  listen_addr = ":80"
+}
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	// mismatched adds a block whose labels don't match the schema, as
+	// could happen if content were decoded using a different schema.
+	mismatched := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		content.Blocks = append(content.Blocks, &hcl.Block{
+			Type:   "service",
+			Labels: []string{"web"},
+			Body:   hcl.EmptyBody(),
+			DefRange: hcl.Range{
+				Filename: "other.hcl",
+				Start:    hcl.Pos{Line: 3, Column: 1, Byte: 20},
+				End:      hcl.Pos{Line: 3, Column: 14, Byte: 33},
+			},
+		})
+		return content, nil
+	})
+
+	tests := map[string]struct {
+		Arg        string
+		Mismatched bool
+		WantAddr   map[string]string
+		WantErr    string
+	}{
+		"exact labels": {
+			Arg:      "service.http.web.listen_addr=:8080",
+			WantAddr: map[string]string{"http web": ":8080"},
+		},
+		"wildcard for the first label": {
+			Arg:      "service.*.web.listen_addr=:8080",
+			WantAddr: map[string]string{"http web": ":8080"},
+		},
+		"too few labels": {
+			Arg:     "service.web.listen_addr=:8080",
+			WantErr: `Unexpected argument "service.web.listen_addr": block type "service" requires 2 labels, but the path provides 1.`,
+		},
+		"too many labels": {
+			Arg:     "service.http.web.main.listen_addr=:8080",
+			WantErr: `Unexpected argument "service.http.web.main.listen_addr".`,
+		},
+		"content with different arity": {
+			Arg:        "service.http.web.listen_addr=:8080",
+			Mismatched: true,
+			WantErr:    `other.hcl:3,1-14: Invalid argument; Cannot apply argument "service.http.web.listen_addr": block service "web" has 1 labels, but block type "service" requires 2 labels, so the block might not have been decoded with the same schema.`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var overlays []Overlay
+			if test.Mismatched {
+				overlays = append(overlays, mismatched)
+			}
+			o, diags := ParseCLIArgument(test.Arg)
+			if diags.HasErrors() {
+				t.Fatalf("arg has problems: %s", diags.Error())
+			}
+			overlays = append(overlays, o)
+
+			// Any extra labels are indistinguishable from the name of a
+			// nested block type, so they are reported only once the body
+			// of the block is decoded.
+			content, diags := ApplyOverlays(f.Body, overlays...).Content(schema)
+			got := make(map[string]string)
+			if !diags.HasErrors() {
+				for _, block := range content.Blocks {
+					blockContent, moreDiags := block.Body.Content(serviceSchema)
+					diags = append(diags, moreDiags...)
+					if attr := blockContent.Attributes["listen_addr"]; attr != nil {
+						got[strings.Join(block.Labels, " ")] = attrStringValue(t, attr)
+					}
+				}
+			}
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.WantAddr, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCLIArgumentDeepKey(t *testing.T) {
+	type Config struct {
+		Database cty.Value `hcl:"database,optional"`
+	}
+
+	tests := map[string]struct {
+		Config  string
+		Args    []string
+		Want    cty.Value
+		WantErr string
+	}{
+		"override nested key": {
+			`database = { primary = { host = "a", port = 5432 }, replica = { host = "r" } }`,
+			[]string{`database.primary.host=b`},
+			cty.ObjectVal(map[string]cty.Value{
+				"primary": cty.ObjectVal(map[string]cty.Value{
+					"host": cty.StringVal("b"),
+					"port": cty.NumberIntVal(5432),
+				}),
+				"replica": cty.ObjectVal(map[string]cty.Value{
+					"host": cty.StringVal("r"),
+				}),
+			}),
+			``,
+		},
+		"new nested key": {
+			`database = { replica = { host = "r" } }`,
+			[]string{`database.primary.host=b`},
+			cty.ObjectVal(map[string]cty.Value{
+				"primary": cty.ObjectVal(map[string]cty.Value{
+					"host": cty.StringVal("b"),
+				}),
+				"replica": cty.ObjectVal(map[string]cty.Value{
+					"host": cty.StringVal("r"),
+				}),
+			}),
+			``,
+		},
+		"absent attribute": {
+			``,
+			[]string{`database.primary.host=b`},
+			cty.ObjectVal(map[string]cty.Value{
+				"primary": cty.ObjectVal(map[string]cty.Value{
+					"host": cty.StringVal("b"),
+				}),
+			}),
+			``,
+		},
+		"null intermediate value": {
+			`database = { primary = null }`,
+			[]string{`database.primary.host=b`},
+			cty.ObjectVal(map[string]cty.Value{
+				"primary": cty.ObjectVal(map[string]cty.Value{
+					"host": cty.StringVal("b"),
+				}),
+			}),
+			``,
+		},
+		"several nested keys": {
+			``,
+			[]string{`database.primary.host=a`, `database.primary.port:=5432`, `database.replica.host=r`},
+			cty.ObjectVal(map[string]cty.Value{
+				"primary": cty.ObjectVal(map[string]cty.Value{
+					"host": cty.StringVal("a"),
+					"port": cty.NumberIntVal(5432),
+				}),
+				"replica": cty.ObjectVal(map[string]cty.Value{
+					"host": cty.StringVal("r"),
+				}),
+			}),
+			``,
+		},
+		"intermediate not a map": {
+			`database = { primary = ["a"] }`,
+			[]string{`database.primary.host=b`},
+			cty.NilVal,
+			`Cannot set a key in argument "database.primary.host": the value of key "primary" is tuple, not a map or object.`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "", hcl.Pos{})
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				o, diags := ParseCLIArgument(arg)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			body := ApplyOverlays(f.Body, overlays...)
+
+			got := &Config{}
+			diags = gohcl.DecodeBody(body, nil, got)
+			if diags.HasErrors() {
+				errStr := diags.Error()
+				if test.WantErr == "" {
+					t.Fatalf("unexpected problems: %s", errStr)
+				}
+				if !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if test.WantErr != "" {
+				t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+			}
+			if !test.Want.RawEquals(got.Database) {
+				t.Fatalf("wrong result\ngot:  %#v\nwant: %#v", got.Database, test.Want)
+			}
+		})
+	}
+}
+
+func TestParseCLIArgumentAppend(t *testing.T) {
+	type BlockOneLabel struct {
+		Name string   `hcl:"name,label"`
+		Tags []string `hcl:"tags,optional"`
+	}
+	type Config struct {
+		Tags  []string        `hcl:"tags,optional"`
+		Block []BlockOneLabel `hcl:"block,block"`
+	}
+
+	tests := map[string]struct {
+		Config  string
+		Args    []string
+		Want    *Config
+		WantErr string
+	}{
+		"append to existing list": {
+			`tags = ["a"]`,
+			[]string{`tags+=b`},
+			&Config{Tags: []string{"a", "b"}},
+			``,
+		},
+		"append to absent list": {
+			``,
+			[]string{`tags+=b`},
+			&Config{Tags: []string{"b"}},
+			``,
+		},
+		"append repeatedly": {
+			`tags = ["a"]`,
+			[]string{`tags+=b`, `tags+=c`, `tags+=d`},
+			&Config{Tags: []string{"a", "b", "c", "d"}},
+			``,
+		},
+		"append after replace": {
+			`tags = ["a"]`,
+			[]string{`tags:=["x"]`, `tags+=y`},
+			&Config{Tags: []string{"x", "y"}},
+			``,
+		},
+		"append in existing block": {
+			`
+			block "a" { tags = ["a"] }
+			`,
+			[]string{`block.a.tags+=b`},
+			&Config{Block: []BlockOneLabel{{Name: "a", Tags: []string{"a", "b"}}}},
+			``,
+		},
+		"append in new block": {
+			``,
+			[]string{`block.a.tags+=b`},
+			&Config{Block: []BlockOneLabel{{Name: "a", Tags: []string{"b"}}}},
+			``,
+		},
+		"append to non-sequence": {
+			`tags = "a"`,
+			[]string{`tags+=b`},
+			nil,
+			`Cannot append to argument "tags": it is string, not a sequence.`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "", hcl.Pos{})
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				o, diags := ParseCLIArgument(arg)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			body := ApplyOverlays(f.Body, overlays...)
+
+			got := &Config{}
+			diags = gohcl.DecodeBody(body, nil, got)
+			if diags.HasErrors() {
+				errStr := diags.Error()
+				if test.WantErr == "" {
+					t.Fatalf("unexpected problems: %s", errStr)
+				}
+				if !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if test.WantErr != "" {
+				t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCLIArgumentMapKey(t *testing.T) {
+	type Block struct {
+		Name   string            `hcl:"name,label"`
+		Labels map[string]string `hcl:"labels,optional"`
+	}
+	type Config struct {
+		Labels map[string]string `hcl:"labels,optional"`
+		Name   string            `hcl:"name,optional"`
+		Block  []Block           `hcl:"block,block"`
+	}
+
+	tests := map[string]struct {
+		Config  string
+		Args    []string
+		Want    *Config
+		WantErr string
+	}{
+		"override existing key": {
+			`labels = { env = "dev", team = "a" }`,
+			[]string{`labels.env=prod`},
+			&Config{Labels: map[string]string{"env": "prod", "team": "a"}},
+			``,
+		},
+		"add new key": {
+			`labels = { team = "a" }`,
+			[]string{`labels.env=prod`},
+			&Config{Labels: map[string]string{"env": "prod", "team": "a"}},
+			``,
+		},
+		"absent attribute": {
+			``,
+			[]string{`labels.env=prod`},
+			&Config{Labels: map[string]string{"env": "prod"}},
+			``,
+		},
+		"several keys": {
+			`labels = { team = "a" }`,
+			[]string{`labels.env=prod`, `labels.team=b`, `labels."app.kubernetes.io/name"=web`},
+			&Config{Labels: map[string]string{"env": "prod", "team": "b", "app.kubernetes.io/name": "web"}},
+			``,
+		},
+		"after replace": {
+			`labels = { team = "a" }`,
+			[]string{`labels:={ x = "y" }`, `labels.env=prod`},
+			&Config{Labels: map[string]string{"env": "prod", "x": "y"}},
+			``,
+		},
+		"in block": {
+			`
+			block "a" { labels = { team = "a" } }
+			`,
+			[]string{`block.a.labels.env=prod`},
+			&Config{Block: []Block{{Name: "a", Labels: map[string]string{"env": "prod", "team": "a"}}}},
+			``,
+		},
+		"not a map": {
+			`name = "a"`,
+			[]string{`name.env=prod`},
+			nil,
+			`Cannot set a key in argument "name.env": it is string, not a map or object.`,
+		},
+		"nested key in string value": {
+			`labels = { env = "dev" }`,
+			[]string{`labels.env.x=prod`},
+			nil,
+			`Cannot set a key in argument "labels.env.x": the value of key "env" is string, not a map or object.`,
+		},
+		"append to key": {
+			``,
+			[]string{`labels.env+=prod`},
+			nil,
+			`Unexpected argument "labels.env".`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "", hcl.Pos{})
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				o, diags := ParseCLIArgument(arg)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			body := ApplyOverlays(f.Body, overlays...)
+
+			got := &Config{}
+			diags = gohcl.DecodeBody(body, nil, got)
+			if diags.HasErrors() {
+				errStr := diags.Error()
+				if test.WantErr == "" {
+					t.Fatalf("unexpected problems: %s", errStr)
+				}
+				if !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if test.WantErr != "" {
+				t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCLIOptions(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode"},
+		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "service", LabelNames: []string{"type", "name"}},
+		},
+	}
+
+	tests := map[string]struct {
+		Args       []string
+		WantPaths  []string
+		WantRemain []string
+		WantErr    string
+	}{
+		"no arguments": {
+			nil,
+			nil,
+			nil,
+			``,
+		},
+		"mix of overlays and other arguments": {
+			[]string{"--io_mode=async", "-v", "--json", "config.hcl", "--service.http.web.listen_addr=:80", "--other=foo"},
+			[]string{"io_mode", "service.http.web.listen_addr"},
+			[]string{"-v", "--json", "config.hcl", "--other=foo"},
+			``,
+		},
+		"space-separated values": {
+			[]string{"--io_mode", "async", "-v", "--service.http.web.listen_addr", "0.0.0.0:80", "config.hcl"},
+			[]string{"io_mode", "service.http.web.listen_addr"},
+			[]string{"-v", "config.hcl"},
+			``,
+		},
+		"space-separated value starting with a single dash": {
+			[]string{"--io_mode", "-1"},
+			[]string{"io_mode"},
+			nil,
+			``,
+		},
+		"empty option name before equals": {
+			[]string{"--=value", "config.hcl"},
+			nil,
+			[]string{"config.hcl"},
+			`Invalid argument "--=value": an option name is required immediately after the "--" prefix.`,
+		},
+		"empty option name before dot": {
+			[]string{"--.io_mode=async"},
+			nil,
+			nil,
+			`Invalid argument "--.io_mode=async": an option name is required immediately after the "--" prefix.`,
+		},
+		"empty option name before operator": {
+			[]string{"--+=a", "--:=1", "--[0].x=y"},
+			nil,
+			nil,
+			`Invalid argument "--+=a": an option name is required immediately after the "--" prefix.`,
+		},
+		"missing value at end": {
+			[]string{"config.hcl", "--io_mode"},
+			nil,
+			[]string{"config.hcl"},
+			`The argument --io_mode requires a value; write --io_mode=VALUE.`,
+		},
+		"missing value before another option": {
+			[]string{"--io_mode", "--json"},
+			nil,
+			[]string{"--json"},
+			`The argument --io_mode requires a value; write --io_mode=VALUE.`,
+		},
+		"missing value before terminator": {
+			[]string{"--io_mode", "--", "--io_mode=sync"},
+			nil,
+			[]string{"--io_mode=sync"},
+			`The argument --io_mode requires a value; write --io_mode=VALUE.`,
+		},
+		"terminator at end": {
+			[]string{"--io_mode=async", "config.hcl", "--"},
+			[]string{"io_mode"},
+			[]string{"config.hcl"},
+			``,
+		},
+		"terminator at start": {
+			[]string{"--", "--io_mode=async", "config.hcl"},
+			nil,
+			[]string{"--io_mode=async", "config.hcl"},
+			``,
+		},
+		"terminator alone": {
+			[]string{"--"},
+			nil,
+			nil,
+			``,
+		},
+		"multiple terminators": {
+			[]string{"--io_mode=async", "--", "a", "--", "--io_mode=sync", "--"},
+			[]string{"io_mode"},
+			[]string{"a", "--", "--io_mode=sync", "--"},
+			``,
+		},
+		"invalid overlay": {
+			[]string{"--service.http.0web.listen_addr=:80", "config.hcl"},
+			nil,
+			[]string{"config.hcl"},
+			`Invalid component "0web"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			overlays, remain, diags := ExtractCLIOptions(test.Args, schema)
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+			} else if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+
+			var gotPaths []string
+			for _, o := range overlays {
+				gotPaths = append(gotPaths, o.(*cliArgOverlay).fullPath)
+			}
+			if diff := cmp.Diff(test.WantPaths, gotPaths); diff != "" {
+				t.Errorf("wrong overlays\n%s", diff)
+			}
+			if diff := cmp.Diff(test.WantRemain, remain); diff != "" {
+				t.Errorf("wrong remaining arguments\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExtractCLIOptionsWithOpts(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode"},
+		},
+	}
+
+	t.Run("UnknownOption", func(t *testing.T) {
+		type unknownArg struct {
+			Arg, Name string
+		}
+		var unknown []unknownArg
+		opts := &ExtractOptions{
+			UnknownOption: func(arg, name string) bool {
+				unknown = append(unknown, unknownArg{arg, name})
+				return name == "json"
+			},
+		}
+
+		args := []string{"--io_mdoe=async", "--json", "--io_mode=sync", "config.hcl", "--", "--ignored"}
+		overlays, remain, diags := ExtractCLIOptionsWithOpts(args, schema, opts)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if got, want := len(overlays), 1; got != want {
+			t.Errorf("wrong number of overlays %d; want %d", got, want)
+		}
+		wantRemain := []string{"--json", "config.hcl", "--ignored"}
+		if diff := cmp.Diff(wantRemain, remain); diff != "" {
+			t.Errorf("wrong remaining arguments\n%s", diff)
+		}
+		wantUnknown := []unknownArg{
+			{"--io_mdoe=async", "io_mdoe"},
+			{"--json", "json"},
+		}
+		if diff := cmp.Diff(wantUnknown, unknown); diff != "" {
+			t.Errorf("wrong unknown arguments\n%s", diff)
+		}
+	})
+	t.Run("Aliases", func(t *testing.T) {
+		opts := &ExtractOptions{
+			Aliases: map[string]string{
+				"-m":     "io_mode",
+				"-L":     "service.web.main.listen_addr",
+				"--mode": "io_mode",
+			},
+		}
+		schema := &hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{
+				{Name: "io_mode"},
+			},
+			Blocks: []hcl.BlockHeaderSchema{
+				{Type: "service", LabelNames: []string{"type", "name"}},
+			},
+		}
+
+		args := []string{"-m=async", "-L", "0.0.0.0:80", "-v", "--mode", "sync", "--", "-m=ignored"}
+		overlays, remain, diags := ExtractCLIOptionsWithOpts(args, schema, opts)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		var gotPaths []string
+		for _, o := range overlays {
+			gotPaths = append(gotPaths, o.(*cliArgOverlay).fullPath)
+		}
+		wantPaths := []string{"io_mode", "service.web.main.listen_addr", "io_mode"}
+		if diff := cmp.Diff(wantPaths, gotPaths); diff != "" {
+			t.Errorf("wrong overlays\n%s", diff)
+		}
+		wantRemain := []string{"-v", "-m=ignored"}
+		if diff := cmp.Diff(wantRemain, remain); diff != "" {
+			t.Errorf("wrong remaining arguments\n%s", diff)
+		}
+
+		_, _, diags = ExtractCLIOptionsWithOpts([]string{"-L"}, schema, opts)
+		if got, want := diags.Error(), "The argument -L requires a value; write -L=VALUE."; !strings.Contains(got, want) {
+			t.Errorf("wrong error for missing value\ngot: %s\nshould contain: %s", got, want)
+		}
+	})
+	t.Run("BoolAttrs", func(t *testing.T) {
+		type Service struct {
+			Name    string `hcl:"name,label"`
+			Enabled bool   `hcl:"enabled,optional"`
+		}
+		type Config struct {
+			Verbose bool      `hcl:"verbose,optional"`
+			Debug   bool      `hcl:"debug,optional"`
+			Color   bool      `hcl:"color,optional"`
+			Service []Service `hcl:"service,block"`
+		}
+		schema, _ := gohcl.ImpliedBodySchema(&Config{})
+		opts := &ExtractOptions{
+			BoolAttrs: map[string]bool{
+				"verbose":              true,
+				"debug":                true,
+				"color":                true,
+				"service.main.enabled": true,
+			},
+		}
+
+		f, diags := hclsyntax.ParseConfig([]byte(`
+color = true
+service "main" {}
+`), "", hcl.Pos{})
+		if diags.HasErrors() {
+			t.Fatalf("config has problems: %s", diags.Error())
+		}
+
+		args := []string{"--debug=false", "--verbose", "--debug", "config.hcl", "--no-color", "--service.main.enabled"}
+		overlays, remain, diags := ExtractCLIOptionsWithOpts(args, schema, opts)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if diff := cmp.Diff([]string{"config.hcl"}, remain); diff != "" {
+			t.Errorf("wrong remaining arguments\n%s", diff)
+		}
+
+		got := &Config{}
+		diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, got)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		want := &Config{
+			Verbose: true,
+			Debug:   false, // explicit value takes precedence
+			Color:   false,
+			Service: []Service{{Name: "main", Enabled: true}},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("incorrect result\n%s", diff)
+		}
+	})
+	t.Run("Aliases collision", func(t *testing.T) {
+		opts := &ExtractOptions{
+			Aliases: map[string]string{
+				"--io_mode": "service.web.main.io_mode",
+			},
+		}
+		_, _, diags := ExtractCLIOptionsWithOpts(nil, schema, opts)
+		if got, want := diags.Error(), `The option alias "--io_mode" conflicts with an argument of the same name.`; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot: %s\nshould contain: %s", got, want)
+		}
+	})
+}
+
+func TestExtractCLIOptionsBlockToggles(t *testing.T) {
+	type Service struct {
+		Type       string `hcl:"type,label"`
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr,optional"`
+	}
+	type Logging struct {
+		Level string `hcl:"level,optional"`
+	}
+	type Config struct {
+		Services []Service `hcl:"service,block"`
+		Logging  *Logging  `hcl:"logging,block"`
+	}
+	schema, _ := gohcl.ImpliedBodySchema(&Config{})
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+service "web" "main" {
+  listen_addr = ":80"
+}
+service "web" "old" {
+  listen_addr = ":81"
+}
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	args := []string{"--service.web.main", "--service.web.admin", "--no-service.web.old", "--logging", "config.hcl"}
+	overlays, remain, diags := ExtractCLIOptions(args, schema)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if diff := cmp.Diff([]string{"config.hcl"}, remain); diff != "" {
+		t.Errorf("wrong remaining arguments\n%s", diff)
+	}
+
+	got := &Config{}
+	diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := &Config{
+		Services: []Service{
+			{Type: "web", Name: "main", ListenAddr: ":80"}, // already present, so unchanged
+			{Type: "web", Name: "admin"},
+		},
+		Logging: &Logging{},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("incorrect result\n%s", diff)
+	}
+
+	t.Run("value for block", func(t *testing.T) {
+		// A path that doesn't end after the block's labels still takes a
+		// value, and so is reported as invalid when applied.
+		overlays, remain, diags := ExtractCLIOptions([]string{"--service.web", "x"}, schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if len(remain) != 0 {
+			t.Errorf("unexpected remaining arguments %#v", remain)
+		}
+		_, diags = ApplyOverlays(hcl.EmptyBody(), overlays...).Content(schema)
+		if got, want := diags.Error(), `block type "service" requires 2 labels, but the path provides 0.`; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot: %s\nshould contain: %s", got, want)
+		}
+	})
+}
+
+func TestExtractCLIOptionsInclude(t *testing.T) {
+	type Service struct {
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Services []Service `hcl:"service,block"`
+	}
+	schema, _ := gohcl.ImpliedBodySchema(&Config{})
+
+	fsys := fstest.MapFS{
+		"web.hcl": &fstest.MapFile{
+			Data: []byte(`service "web" {
+  listen_addr = ":8080"
+}
+`),
+		},
+		"mode.json": &fstest.MapFile{
+			Data: []byte(`{"io_mode": "sync"}`),
+		},
+		"broken.hcl": &fstest.MapFile{
+			Data: []byte("io_mode = \"async\"\nio_mode =\n"),
+		},
+	}
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "async"
+service "web" {
+  listen_addr = ":80"
+}
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		opts := &ExtractOptions{
+			IncludeParser: hclparse.NewParser(),
+			IncludeFS:     fsys,
+		}
+		args := []string{"--@include=web.hcl", "--io_mode=none", "--@include", "mode.json", "run"}
+		overlays, remain, diags := ExtractCLIOptionsWithOpts(args, schema, opts)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if diff := cmp.Diff([]string{"run"}, remain); diff != "" {
+			t.Errorf("wrong remaining arguments\n%s", diff)
+		}
+
+		var got Config
+		diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, &got)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		want := Config{
+			IOMode:   "sync",
+			Services: []Service{{Name: "web", ListenAddr: ":8080"}},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("wrong result\n%s", diff)
+		}
+	})
+	t.Run("parse error", func(t *testing.T) {
+		opts := &ExtractOptions{
+			IncludeParser: hclparse.NewParser(),
+			IncludeFS:     fsys,
+		}
+		overlays, _, diags := ExtractCLIOptionsWithOpts([]string{"--@include=broken.hcl"}, schema, opts)
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+		if len(overlays) != 0 {
+			t.Errorf("unexpected overlays %#v", overlays)
+		}
+		if got, want := diags[0].Subject.Filename, "broken.hcl"; got != want {
+			t.Errorf("wrong filename %q; want %q", got, want)
+		}
+		if got, want := diags[0].Subject.Start.Line, 2; got != want {
+			t.Errorf("wrong line %d; want %d", got, want)
+		}
+	})
+	t.Run("missing file", func(t *testing.T) {
+		opts := &ExtractOptions{
+			IncludeParser: hclparse.NewParser(),
+			IncludeFS:     fsys,
+		}
+		_, _, diags := ExtractCLIOptionsWithOpts([]string{"--@include=nonexist.hcl"}, schema, opts)
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+		if got, want := diags.Error(), `Failed to read included file "nonexist.hcl"`; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("missing value", func(t *testing.T) {
+		opts := &ExtractOptions{
+			IncludeParser: hclparse.NewParser(),
+			IncludeFS:     fsys,
+		}
+		_, _, diags := ExtractCLIOptionsWithOpts([]string{"--@include"}, schema, opts)
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+		if got, want := diags.Error(), "requires a value"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		args := []string{"--@include=web.hcl"}
+		overlays, remain, diags := ExtractCLIOptions(args, schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if len(overlays) != 0 {
+			t.Errorf("unexpected overlays %#v", overlays)
+		}
+		if diff := cmp.Diff(args, remain); diff != "" {
+			t.Errorf("wrong remaining arguments\n%s", diff)
+		}
+	})
+}
+
+func BenchmarkExtractCLIOptions(b *testing.B) {
+	const schemaSize = 300
+	schema := &hcl.BodySchema{}
+	for i := 0; i < schemaSize; i++ {
+		schema.Attributes = append(schema.Attributes, hcl.AttributeSchema{Name: fmt.Sprintf("attr%d", i)})
+		schema.Blocks = append(schema.Blocks, hcl.BlockHeaderSchema{Type: fmt.Sprintf("block%d", i), LabelNames: []string{"name"}})
+	}
+
+	const argCount = 300
+	args := make([]string, 0, argCount)
+	for i := 0; i < argCount; i++ {
+		switch i % 3 {
+		case 0:
+			// The last attribute is the worst case for a linear search.
+			args = append(args, fmt.Sprintf("--attr%d=%d", schemaSize-1-i%schemaSize, i))
+		case 1:
+			args = append(args, fmt.Sprintf("--block%d.b%d.attr=%d", schemaSize-1-i%schemaSize, i, i))
+		default:
+			args = append(args, fmt.Sprintf("--other%d", i))
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, diags := ExtractCLIOptions(args, schema)
+		if diags.HasErrors() {
+			b.Fatalf("unexpected problems: %s", diags.Error())
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package hcloverlay
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// CompleteCLIArgument returns candidates for completing the given partial
+// command line option, such as "--service.we", for use in implementing
+// shell completion for options accepted by ExtractCLIOptions.
+//
+// Candidates for argument names and block types are taken from the given
+// schema. Candidates for block labels are taken from the blocks in the given
+// content, so that users can complete the labels of blocks that already
+// exist in the configuration. The content may be nil, in which case no
+// candidates are returned for label positions.
+//
+// Each candidate is a complete replacement for the given prefix, ending with
+// an equals sign if it completes the name of an argument or with a dot if
+// further steps must follow it. Labels that are not valid identifiers are
+// quoted in the same way as in arguments to ParseCLIArgument. Because a
+// schema describes only a single body, no candidates are returned for
+// positions inside a block. The result is sorted and has no duplicates.
+func CompleteCLIArgument(prefix string, schema *hcl.BodySchema, content *hcl.BodyContent) []string {
+	if strings.ContainsRune(prefix, '=') {
+		return nil // we don't complete values
+	}
+	optPrefix := ""
+	path := prefix
+	if strings.HasPrefix(path, "--") {
+		optPrefix, path = "--", path[2:]
+	}
+
+	// The last component of the path is the partial one we're completing,
+	// while all of the others must already be complete.
+	var steps []pathStep
+	partial := path
+	if dot := lastIndexUnquoted(path, '.'); dot >= 0 {
+		var diags hcl.Diagnostics
+		steps, diags = parseCLIPath(path[:dot])
+		if diags.HasErrors() {
+			return nil
+		}
+		partial = path[dot+1:]
+	}
+	completed := optPrefix + path[:len(path)-len(partial)]
+
+	var candidates []string
+	add := func(step pathStep, suffix string) {
+		formatted := formatCLIPath([]pathStep{step})
+		if strings.HasPrefix(formatted, partial) {
+			candidates = append(candidates, completed+formatted+suffix)
+		}
+	}
+
+	if len(steps) == 0 {
+		for _, attrS := range schema.Attributes {
+			add(pathStep{name: attrS.Name}, "=")
+		}
+		for _, blockS := range schema.Blocks {
+			add(pathStep{name: blockS.Type}, ".")
+		}
+	} else if content != nil {
+		for _, blockS := range schema.Blocks {
+			if blockS.Type != steps[0].name || len(steps) > len(blockS.LabelNames) {
+				continue
+			}
+			labelIdx := len(steps) - 1
+			for _, block := range content.Blocks {
+				if block.Type != blockS.Type || len(block.Labels) != len(blockS.LabelNames) {
+					continue
+				}
+				if !labelStepsMatch(block.Labels[:labelIdx], steps[1:]) {
+					continue
+				}
+				add(pathStep{name: block.Labels[labelIdx]}, ".")
+			}
+		}
+	}
+
+	sort.Strings(candidates)
+	ret := candidates[:0]
+	for i, candidate := range candidates {
+		if i == 0 || candidate != candidates[i-1] {
+			ret = append(ret, candidate)
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
@@ -0,0 +1,119 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestCompleteCLIArgument(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode"},
+			{Name: "instances"},
+		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "service", LabelNames: []string{"type", "name"}},
+			{Type: "logging"},
+		},
+	}
+	f, diags := hclsyntax.ParseConfig([]byte(`
+service "http" "web" {}
+service "http" "web.prod" {}
+service "http" "api" {}
+service "grpc" "web" {}
+service "http" "web" {}
+logging {}
+`), "", hcl.Pos{})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	content, diags := f.Body.Content(schema)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	tests := map[string]struct {
+		Prefix string
+		Want   []string
+	}{
+		"empty": {
+			``,
+			[]string{"instances=", "io_mode=", "logging.", "service."},
+		},
+		"option prefix only": {
+			`--`,
+			[]string{"--instances=", "--io_mode=", "--logging.", "--service."},
+		},
+		"partial attribute": {
+			`--io`,
+			[]string{"--io_mode="},
+		},
+		"shared prefix": {
+			`--i`,
+			[]string{"--instances=", "--io_mode="},
+		},
+		"partial block type": {
+			`--serv`,
+			[]string{"--service."},
+		},
+		"first label": {
+			`--service.`,
+			[]string{"--service.grpc.", "--service.http."},
+		},
+		"partial first label": {
+			`--service.h`,
+			[]string{"--service.http."},
+		},
+		"second label": {
+			`--service.http.`,
+			[]string{`--service.http."web.prod".`, "--service.http.api.", "--service.http.web."},
+		},
+		"partial second label": {
+			`--service.http.we`,
+			[]string{"--service.http.web."},
+		},
+		"partial quoted label": {
+			`--service.http."web.`,
+			[]string{`--service.http."web.prod".`},
+		},
+		"inside block": {
+			`--service.http.web.`,
+			nil,
+		},
+		"inside unlabelled block": {
+			`--logging.`,
+			nil,
+		},
+		"unknown block type": {
+			`--nope.`,
+			nil,
+		},
+		"no match": {
+			`--x`,
+			nil,
+		},
+		"value": {
+			`--io_mode=a`,
+			nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := CompleteCLIArgument(test.Prefix, schema, content)
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Errorf("wrong result\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("no content", func(t *testing.T) {
+		got := CompleteCLIArgument(`--service.`, schema, nil)
+		if got != nil {
+			t.Errorf("unexpected candidates: %#v", got)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package hcloverlay
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// NewConditionalOverlay returns an overlay that applies the given inner
+// overlay only if the argument named by guardPath has the given value in
+// the content the overlay is applied to, such as to set tls_cert only if
+// tls_enabled is true.
+//
+// The guard argument must be an argument of the body the overlay is applied
+// to, so guardPath must be just the name of that argument. Its value is
+// taken from the content as modified by any earlier overlays, and so
+// reflects the effective configuration at the point where the conditional
+// overlay is applied.
+//
+// Overlays don't have access to the evaluation context that the
+// application will eventually use to decode the body, and so the guard
+// argument's expression is evaluated without one: it must be a constant,
+// such as a literal value, rather than referring to variables or calling
+// functions. The overlay returns an error if the expression cannot be
+// evaluated in that way. The value is converted to the type of guardValue
+// before comparing, so that for example the string "true" matches the bool
+// value true, and a value that can't be converted doesn't match. If the
+// guard argument isn't set at all then it matches only a null guardValue.
+//
+// If the condition doesn't hold then the overlay has no effect.
+func NewConditionalOverlay(guardPath string, guardValue cty.Value, inner Overlay) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(guardPath)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	if len(steps) != 1 || steps[0].hasIndex || steps[0].wildcard {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   fmt.Sprintf("Invalid guard argument %q: must be the name of an argument in the same body as the overlay applies to.", guardPath),
+		})
+		return nil, diags
+	}
+
+	return &conditionalOverlay{
+		guard:      steps[0].name,
+		guardValue: guardValue,
+		inner:      inner,
+	}, diags
+}
+
+// conditionalOverlay is the overlay implementation returned by
+// NewConditionalOverlay.
+type conditionalOverlay struct {
+	guard      string
+	guardValue cty.Value
+	inner      Overlay
+}
+
+func (o *conditionalOverlay) String() string {
+	return overlayString(o.inner) + o.describeCondition()
+}
+
+// describeCondition returns a suffix describing the overlay's condition,
+// such as " if tls_enabled is true".
+func (o *conditionalOverlay) describeCondition() string {
+	return " if " + o.guard + " is " + formatValue(o.guardValue)
+}
+
+func (o *conditionalOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	if !schemaHasName(schema, o.guard) || schemaHasBlockType(schema, o.guard) {
+		var diags hcl.Diagnostics
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   fmt.Sprintf("Unexpected guard argument %q for conditional overlay.", o.guard),
+		})
+		return content, diags
+	}
+	content = ensureContent(content)
+	match, diags := o.matches(content.Attributes)
+	if !match {
+		return content, diags
+	}
+	content, moreDiags := o.inner.ApplyOverlay(content, schema)
+	return content, append(diags, moreDiags...)
+}
+
+func (o *conditionalOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	if !schemaHasName(schema, o.guard) || schemaHasBlockType(schema, o.guard) {
+		// We can't decide yet, so we'll wait for a schema that includes
+		// the guard argument.
+		return content, o, nil
+	}
+	content = ensureContent(content)
+	match, diags := o.matches(content.Attributes)
+	if !match {
+		return content, nil, diags
+	}
+
+	// Once the condition holds, whatever the inner overlay doesn't apply
+	// yet must be applied unconditionally, because a later decode won't
+	// include the guard argument that we already consumed.
+	content, remain, moreDiags := o.inner.PartialApplyOverlay(content, schema)
+	return content, remain, append(diags, moreDiags...)
+}
+
+func (o *conditionalOverlay) ApplyJustAttributes(attrs hcl.Attributes) (hcl.Attributes, hcl.Diagnostics) {
+	match, diags := o.matches(attrs)
+	if !match {
+		return attrs, diags
+	}
+	attrs, moreDiags := o.inner.ApplyJustAttributes(attrs)
+	return attrs, append(diags, moreDiags...)
+}
+
+// matches returns true if the guard argument in the given attributes has
+// the guard value, or error diagnostics if its value can't be determined.
+func (o *conditionalOverlay) matches(attrs hcl.Attributes) (bool, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	attr, exists := attrs[o.guard]
+	if !exists {
+		return o.guardValue.IsNull(), diags
+	}
+
+	v, valDiags := attr.Expr.Value(nil)
+	if valDiags.HasErrors() || !v.IsWhollyKnown() {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   fmt.Sprintf("The value of %q decides whether an overlay applies, so it must be a constant value that doesn't refer to variables or functions.", o.guard),
+			Subject:  attr.Expr.Range().Ptr(),
+		})
+		return false, diags
+	}
+
+	v, err := convert.Convert(v, o.guardValue.Type())
+	if err != nil {
+		return false, diags
+	}
+	return v.RawEquals(o.guardValue), diags
+}
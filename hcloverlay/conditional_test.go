@@ -0,0 +1,185 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNewConditionalOverlay(t *testing.T) {
+	type Config struct {
+		TLSEnabled *bool  `hcl:"tls_enabled"`
+		TLSCert    string `hcl:"tls_cert,optional"`
+	}
+	boolPtr := func(b bool) *bool { return &b }
+
+	tests := map[string]struct {
+		Config     string
+		GuardValue cty.Value
+		Before     []string
+		Want       Config
+		WantErr    string
+	}{
+		"matches": {
+			Config: `
+tls_enabled = true
+`,
+			GuardValue: cty.True,
+			Want:       Config{TLSEnabled: boolPtr(true), TLSCert: "cert.pem"},
+		},
+		"does not match": {
+			Config: `
+tls_enabled = false
+`,
+			GuardValue: cty.True,
+			Want:       Config{TLSEnabled: boolPtr(false)},
+		},
+		"matches after conversion": {
+			Config: `
+tls_enabled = "true"
+`,
+			GuardValue: cty.True,
+			Want:       Config{TLSEnabled: boolPtr(true), TLSCert: "cert.pem"},
+		},
+		"cannot convert": {
+			Config: `
+tls_enabled = "maybe"
+`,
+			GuardValue: cty.True,
+			WantErr:    `a bool is required`, // from decoding, not from the overlay
+		},
+		"set by earlier overlay": {
+			Config: `
+tls_enabled = false
+`,
+			GuardValue: cty.True,
+			Before:     []string{"tls_enabled=true"},
+			Want:       Config{TLSEnabled: boolPtr(true), TLSCert: "cert.pem"},
+		},
+		"missing matches null": {
+			Config:     ``,
+			GuardValue: cty.NullVal(cty.Bool),
+			Want:       Config{TLSCert: "cert.pem"},
+		},
+		"missing does not match": {
+			Config:     ``,
+			GuardValue: cty.True,
+			Want:       Config{},
+		},
+		"not constant": {
+			Config: `
+tls_enabled = var.tls
+`,
+			GuardValue: cty.True,
+			WantErr:    `The value of "tls_enabled" decides whether an overlay applies, so it must be a constant value`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "config.hcl", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+			var overlays []Overlay
+			for _, raw := range test.Before {
+				o, diags := ParseCLIArgument(raw)
+				if diags.HasErrors() {
+					t.Fatalf("unexpected problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+			inner, diags := ParseCLIArgument("tls_cert=cert.pem")
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			o, diags := NewConditionalOverlay("tls_enabled", test.GuardValue, inner)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			overlays = append(overlays, o)
+
+			var got Config
+			diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, &got)
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewConditionalOverlayPartial(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+tls_enabled = true
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	inner, diags := ParseCLIArgument("tls_cert=cert.pem")
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	o, diags := NewConditionalOverlay("tls_enabled", cty.True, inner)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	body := ApplyOverlays(f.Body, o)
+
+	// The first decode includes the guard but not the argument the inner
+	// overlay sets, so the inner overlay must apply to the remaining body
+	// even though it no longer includes the guard.
+	_, remain, diags := body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "tls_enabled"}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	content, diags := remain.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "tls_cert"}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := attrStringValue(t, content.Attributes["tls_cert"]), "cert.pem"; got != want {
+		t.Errorf("wrong tls_cert %q; want %q", got, want)
+	}
+}
+
+func TestNewConditionalOverlayInvalid(t *testing.T) {
+	t.Run("nested guard", func(t *testing.T) {
+		_, diags := NewConditionalOverlay("tls.enabled", cty.True, nil)
+		if got, want := diags.Error(), `Invalid guard argument "tls.enabled"`; !strings.Contains(got, want) {
+			t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("unexpected guard", func(t *testing.T) {
+		o, diags := NewConditionalOverlay("tls_enabled", cty.True, nil)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		_, diags = ApplyOverlays(hcl.EmptyBody(), o).Content(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "other"}},
+		})
+		want := `Unexpected guard argument "tls_enabled" for conditional overlay.`
+		if got := diags.Error(); !strings.Contains(got, want) {
+			t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+}
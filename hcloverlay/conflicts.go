@@ -0,0 +1,109 @@
+package hcloverlay
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// DetectOverlayConflicts returns a warning diagnostic for each of the given
+// overlays that replaces the value at a path that an earlier overlay in the
+// sequence also replaces, such as when the same command line option is
+// given twice, because the earlier overlay then has no effect.
+//
+// The overlays must be given in the order they will be applied. Overlays
+// that append to an argument, that set it only if it isn't already set, or
+// that create a block only if it doesn't already exist build on any earlier
+// overlays rather than replacing them, and so they neither conflict with
+// earlier overlays nor count as earlier overlays for later ones. Overlays
+// that remove an argument or block do replace it, but overlays returned by
+// NewResetOverlay deliberately undo earlier overlays and so are not
+// reported.
+//
+// Paths are compared exactly, including any indices, and so overlays whose
+// paths differ only in ways that might select the same blocks, such as by
+// using a wildcard in one and a specific label in the other, are not
+// reported. Only overlays that implement PathReporter are checked.
+//
+// The result contains only warnings, which an application might choose to
+// report as errors, for example when running in an automated environment
+// where a duplicated option is more likely to be a mistake.
+func DetectOverlayConflicts(overlays ...Overlay) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	seen := make(map[string]string) // path to description of latest overlay
+	for _, ov := range flattenMergedOverlays(overlays) {
+		var paths, descs []string
+		switch ov := ov.(type) {
+		case *cliArgOverlay:
+			if ov.op == cliArgAppend || ov.op == cliArgDefault || ov.op == cliArgReset || ov.op == cliArgCreate {
+				continue
+			}
+			paths = []string{formatCLIPath(ov.steps)}
+			descs = []string{"argument " + argDesc(ov.fullPath, ov.source)}
+		case PathReporter:
+			for _, path := range ov.AffectedPaths() {
+				path := formatCLIPath(namedSteps(path))
+				paths = append(paths, path)
+				descs = append(descs, fmt.Sprintf("overlay for %q", path))
+			}
+		}
+		for i, path := range paths {
+			if prev, exists := seen[path]; exists {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagWarning,
+					Summary:  "Conflicting overlays",
+					Detail:   fmt.Sprintf("The %s replaces the value set by the earlier %s, which therefore has no effect.", descs[i], prev),
+				})
+			}
+			seen[path] = descs[i]
+		}
+	}
+	return diags
+}
+
+// flattenOverlays returns the given overlays with any that are produced by
+// MergeOverlays, WithPriority, NewRecordingOverlay, NewOnceOverlay, or
+// NewConditionalOverlay replaced by the overlays they wrap, and without any
+// nil overlays.
+func flattenOverlays(overlays []Overlay) []Overlay {
+	return flattenOverlaysWith(overlays, true)
+}
+
+// flattenMergedOverlays is like flattenOverlays except that it keeps the
+// overlays produced by NewOnceOverlay and NewConditionalOverlay, whose inner
+// overlays might not take effect, so that callers that describe or compare
+// the overlays can still take that into account.
+func flattenMergedOverlays(overlays []Overlay) []Overlay {
+	return flattenOverlaysWith(overlays, false)
+}
+
+func flattenOverlaysWith(overlays []Overlay, unwrapAll bool) []Overlay {
+	var ret []Overlay
+	for _, ov := range overlays {
+		switch ov := ov.(type) {
+		case nil:
+			// ignored, as for ApplyOverlays
+		case *mergedOverlay:
+			ret = append(ret, flattenOverlaysWith(ov.overlays, unwrapAll)...)
+		case *priorityOverlay:
+			ret = append(ret, flattenOverlaysWith([]Overlay{ov.Overlay}, unwrapAll)...)
+		case *recordingOverlay:
+			ret = append(ret, flattenOverlaysWith([]Overlay{ov.inner}, unwrapAll)...)
+		case *onceOverlay:
+			if !unwrapAll {
+				ret = append(ret, ov)
+				continue
+			}
+			ret = append(ret, flattenOverlaysWith([]Overlay{ov.inner}, unwrapAll)...)
+		case *conditionalOverlay:
+			if !unwrapAll {
+				ret = append(ret, ov)
+				continue
+			}
+			ret = append(ret, flattenOverlaysWith([]Overlay{ov.inner}, unwrapAll)...)
+		default:
+			ret = append(ret, ov)
+		}
+	}
+	return ret
+}
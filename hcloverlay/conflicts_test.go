@@ -0,0 +1,137 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestDetectOverlayConflicts(t *testing.T) {
+	parseArg := func(raw string) Overlay {
+		o, diags := ParseCLIArgument(raw)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+	remove, diags := NewRemoveOverlay("io_mode")
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	fn := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		return content, nil
+	})
+	reporter := &testPathReporter{
+		Overlay: fn,
+		paths:   [][]string{{"service", "web.prod", "listen_addr"}},
+	}
+
+	tests := map[string]struct {
+		Overlays []Overlay
+		Want     []string
+	}{
+		"no overlays": {
+			nil,
+			nil,
+		},
+		"different paths": {
+			[]Overlay{parseArg("io_mode=a"), parseArg("count:=2")},
+			nil,
+		},
+		"same path": {
+			[]Overlay{parseArg("io_mode=a"), parseArg("io_mode=b")},
+			[]string{
+				`The argument "io_mode" replaces the value set by the earlier argument "io_mode", which therefore has no effect.`,
+			},
+		},
+		"three times": {
+			[]Overlay{
+				parseArg("io_mode=a"),
+				WithSource(parseArg("io_mode=b"), "file a.txt"),
+				WithSource(parseArg("io_mode=c"), "file b.txt"),
+			},
+			[]string{
+				`The argument "io_mode" (from file a.txt) replaces the value set by the earlier argument "io_mode", which therefore has no effect.`,
+				`The argument "io_mode" (from file b.txt) replaces the value set by the earlier argument "io_mode" (from file a.txt), which therefore has no effect.`,
+			},
+		},
+		"remove": {
+			[]Overlay{parseArg("io_mode=a"), remove},
+			[]string{
+				`The argument "io_mode" replaces the value set by the earlier argument "io_mode", which therefore has no effect.`,
+			},
+		},
+		"append": {
+			[]Overlay{parseArg("tags=a"), parseArg("tags+=b"), parseArg("tags+=c")},
+			nil,
+		},
+		"set after append": {
+			[]Overlay{parseArg("tags+=b"), parseArg("tags=a")},
+			nil,
+		},
+		"default": {
+			[]Overlay{parseArg("io_mode=a"), mustDefault(t, "io_mode", "b")},
+			nil,
+		},
+		"different indices": {
+			[]Overlay{parseArg("service.web[0].listen_addr=a"), parseArg("service.web[1].listen_addr=b")},
+			nil,
+		},
+		"nested key": {
+			[]Overlay{parseArg("labels=a"), parseArg("labels.env=b")},
+			nil,
+		},
+		"merged and prioritized": {
+			[]Overlay{
+				MergeOverlays(parseArg("io_mode=a"), fn),
+				WithPriority(parseArg("io_mode=b"), 1),
+			},
+			[]string{
+				`The argument "io_mode" replaces the value set by the earlier argument "io_mode", which therefore has no effect.`,
+			},
+		},
+		"other reporter": {
+			[]Overlay{reporter, parseArg(`service."web.prod".listen_addr=a`)},
+			[]string{
+				`The argument "service.\"web.prod\".listen_addr" replaces the value set by the earlier overlay for "service.\"web.prod\".listen_addr", which therefore has no effect.`,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			diags := DetectOverlayConflicts(test.Overlays...)
+			var got []string
+			for _, diag := range diags {
+				if diag.Severity != hcl.DiagWarning {
+					t.Errorf("unexpected error: %s", diag.Detail)
+				}
+				got = append(got, diag.Detail)
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Errorf("wrong diagnostics\n%s", diff)
+			}
+		})
+	}
+}
+
+func mustDefault(t *testing.T, path, value string) Overlay {
+	t.Helper()
+	o, diags := NewDefaultOverlay(path, value)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	return o
+}
+
+// testPathReporter is a PathReporter that reports a fixed set of paths
+// regardless of what the overlay it wraps actually does.
+type testPathReporter struct {
+	Overlay
+	paths [][]string
+}
+
+func (o *testPathReporter) AffectedPaths() [][]string {
+	return o.paths
+}
@@ -0,0 +1,83 @@
+package hcloverlay
+
+import (
+	"github.com/hashicorp/hcl/v2"
+)
+
+// NewCreateBlockOverlay returns an overlay that creates an empty block with
+// the type and labels indicated by the given path, unless a block with that
+// type and those labels already exists, in which case it has no effect. The
+// path uses the same dot-separated syntax as the part before the equals sign
+// in arguments to ParseCLIArgument, and must end immediately after the
+// labels of the block to create, as for a path given to NewRemoveOverlay.
+//
+// This allows an application to offer a concise way to enable an optional
+// block, such as the "--service.web.main" form that ExtractCLIOptions
+// accepts. The new block has no content, so if its block type has required
+// arguments then decoding its body reports that they are missing, with the
+// same source ranges as for other blocks created by overlays.
+//
+// As for ParseCLIArgument, a wildcard label never creates a block and a
+// "_" placeholder label causes an error if there is no matching block.
+func NewCreateBlockOverlay(path string) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgCreate,
+	}, diags
+}
+
+// createdBody is the initial body of a block created by an overlay, or the
+// replacement body of a block emptied by NewRemovePrefixOverlay. It has
+// no content of its own, but it reports the given range as its
+// MissingItemRange so that diagnostics about content missing from the new
+// block, such as required arguments, can indicate which overlay created it.
+type createdBody struct {
+	missingRange hcl.Range
+}
+
+func newCreatedBody(missingRange hcl.Range) hcl.Body {
+	return createdBody{missingRange: missingRange}
+}
+
+func (b createdBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, diags := hcl.EmptyBody().Content(schema)
+	if content != nil {
+		content.MissingItemRange = b.missingRange
+	}
+	return content, b.withSubjects(diags)
+}
+
+func (b createdBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	content, _, diags := hcl.EmptyBody().PartialContent(schema)
+	if content != nil {
+		content.MissingItemRange = b.missingRange
+	}
+	return content, b, b.withSubjects(diags)
+}
+
+// withSubjects returns the given diagnostics with the body's missing item
+// range as the subject of any that have no subject, which is the case for
+// the "Missing required argument" diagnostics from hcl.EmptyBody when a
+// block created by an overlay is decoded without any other overlays.
+func (b createdBody) withSubjects(diags hcl.Diagnostics) hcl.Diagnostics {
+	for _, diag := range diags {
+		if diag.Subject == nil {
+			diag.Subject = b.missingRange.Ptr()
+		}
+	}
+	return diags
+}
+
+func (b createdBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	return hcl.EmptyBody().JustAttributes()
+}
+
+func (b createdBody) MissingItemRange() hcl.Range {
+	return b.missingRange
+}
@@ -0,0 +1,147 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+func TestCreatedBlockMissingItemRange(t *testing.T) {
+	type Service struct {
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+		Protocol   string `hcl:"protocol"`
+	}
+	type Config struct {
+		Services []Service `hcl:"service,block"`
+	}
+
+	tests := map[string]struct {
+		Overlay func() (Overlay, hcl.Diagnostics)
+		Want    hcl.Range
+	}{
+		"no filename": {
+			func() (Overlay, hcl.Diagnostics) {
+				return ParseCLIArgument("service.web.listen_addr=:80")
+			},
+			hcl.Range{
+				Filename: `overlay "service.web.listen_addr"`,
+				Start:    hcl.InitialPos,
+				End:      hcl.InitialPos,
+			},
+		},
+		"with source": {
+			func() (Overlay, hcl.Diagnostics) {
+				o, diags := ParseCLIArgument("service.web.listen_addr=:80")
+				return WithSource(o, "command line option --service"), diags
+			},
+			hcl.Range{
+				Filename: `overlay "service.web.listen_addr" (from command line option --service)`,
+				Start:    hcl.InitialPos,
+				End:      hcl.InitialPos,
+			},
+		},
+		"with filename": {
+			func() (Overlay, hcl.Diagnostics) {
+				return ParseCLIArgumentWithOpts("service.web.listen_addr=:80", &ParseOptions{
+					Filename: "<command-line>",
+				})
+			},
+			hcl.Range{
+				Filename: "<command-line>",
+				Start:    hcl.Pos{Line: 1, Column: 25, Byte: 24},
+				End:      hcl.Pos{Line: 1, Column: 28, Byte: 27},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, diags := test.Overlay()
+			if diags.HasErrors() {
+				t.Fatalf("arg has problems: %s", diags.Error())
+			}
+
+			var got Config
+			diags = gohcl.DecodeBody(ApplyOverlays(hcl.EmptyBody(), o), nil, &got)
+			if len(diags) != 1 {
+				t.Fatalf("wrong number of diagnostics %d; want 1\n%s", len(diags), diags.Error())
+			}
+			if got, want := diags[0].Summary, "Missing required argument"; got != want {
+				t.Errorf("wrong summary %q; want %q", got, want)
+			}
+			if diags[0].Subject == nil {
+				t.Fatalf("diagnostic has no subject")
+			}
+			if got := *diags[0].Subject; got != test.Want {
+				t.Errorf("wrong subject\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestNewCreateBlockOverlay(t *testing.T) {
+	type Service struct {
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+	}
+	type Config struct {
+		Services []Service `hcl:"service,block"`
+	}
+
+	t.Run("existing block", func(t *testing.T) {
+		set, diags := ParseCLIArgument("service.web.listen_addr=:80")
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		o, diags := NewCreateBlockOverlay("service.web")
+		if diags.HasErrors() {
+			t.Fatalf("path has problems: %s", diags.Error())
+		}
+		body := ApplyOverlays(hcl.EmptyBody(), set, o)
+
+		var got Config
+		diags = gohcl.DecodeBody(body, nil, &got)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if got, want := len(got.Services), 1; got != want {
+			t.Fatalf("wrong number of services %d; want %d", got, want)
+		}
+		if got, want := got.Services[0].ListenAddr, ":80"; got != want {
+			t.Errorf("wrong listen_addr %q; want %q", got, want)
+		}
+	})
+	t.Run("required arguments", func(t *testing.T) {
+		o, diags := NewCreateBlockOverlay("service.web")
+		if diags.HasErrors() {
+			t.Fatalf("path has problems: %s", diags.Error())
+		}
+
+		var got Config
+		diags = gohcl.DecodeBody(ApplyOverlays(hcl.EmptyBody(), o), nil, &got)
+		if len(diags) != 1 {
+			t.Fatalf("wrong number of diagnostics %d; want 1\n%s", len(diags), diags.Error())
+		}
+		if got, want := diags[0].Summary, "Missing required argument"; got != want {
+			t.Errorf("wrong summary %q; want %q", got, want)
+		}
+		if got, want := diags[0].Subject.Filename, `overlay "service.web"`; got != want {
+			t.Errorf("wrong subject filename %q; want %q", got, want)
+		}
+	})
+	t.Run("path continues after block", func(t *testing.T) {
+		o, diags := NewCreateBlockOverlay("service.web.listen_addr")
+		if diags.HasErrors() {
+			t.Fatalf("path has problems: %s", diags.Error())
+		}
+
+		var got Config
+		diags = gohcl.DecodeBody(ApplyOverlays(hcl.EmptyBody(), o), nil, &got)
+		if got, want := diags.Error(), `Unexpected argument "service.web.listen_addr".`; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot: %s\nshould contain: %s", got, want)
+		}
+	})
+}
@@ -0,0 +1,285 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// NewCtyOverlay returns an overlay that merges the content described by the
+// given object or map value into the content of the body it is applied to,
+// which is convenient for applications that already have override settings
+// as a cty value, such as the result of decoding some other format.
+//
+// Each attribute of the given value is interpreted using the schema the
+// overlay is applied with. An attribute whose name is an argument in the
+// schema sets that argument to the attribute's value. An attribute whose
+// name is a block type in the schema describes blocks of that type: either a
+// single object, whose attributes describe the body of one block, or a
+// list, set, or tuple of such objects, which describes one block for each
+// element. For a block type with labels, the blocks are instead given as
+// nested objects or maps with one level for each label, whose attribute
+// names are the labels, as in the JSON variant of HCL, or as a list, set, or
+// tuple of objects that each have a string attribute for each label, named
+// after the label in the schema, as is more typical in formats like YAML.
+//
+// The result is equivalent to a body overlay as returned by NewBodyOverlay,
+// and so the blocks are merged with existing blocks in the same way. As
+// with any body, it is an error for the value to have attributes that are
+// not in the schema it is decoded with.
+//
+// The given value must be a known, non-null object or map. Its values are
+// used directly as the values of arguments, without the lossy conversion
+// to and from Go values that would be required to use NewMapOverlay.
+func NewCtyOverlay(val cty.Value) (Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if !ctyBodyValueValid(val) {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid overlay value",
+			Detail:   fmt.Sprintf("An overlay value must be a known, non-null object or map, not %s.", val.Type().FriendlyName()),
+		})
+		return nil, diags
+	}
+	return NewBodyOverlay(&ctyBody{val: val}), diags
+}
+
+// ctyBody is an hcl.Body whose content is described by a cty object or map
+// value, as described for NewCtyOverlay.
+type ctyBody struct {
+	val cty.Value
+
+	// path is the path of the block whose body this is, for use in error
+	// messages, or empty for the top-level body.
+	path []pathStep
+
+	// hidden are the names of attributes of val that have already been
+	// consumed by an earlier call to PartialContent.
+	hidden map[string]struct{}
+}
+
+func (b *ctyBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	content, remain, diags := b.PartialContent(schema)
+	extra := remain.(*ctyBody).attrs()
+	names := make([]string, 0, len(extra))
+	for name := range extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   fmt.Sprintf("Unexpected argument %q.", b.childPath(name)),
+		})
+	}
+	return content, diags
+}
+
+func (b *ctyBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	attrs := b.attrs()
+	content := &hcl.BodyContent{
+		Attributes: make(hcl.Attributes),
+	}
+	hidden := make(map[string]struct{}, len(b.hidden)+len(schema.Attributes)+len(schema.Blocks))
+	for name := range b.hidden {
+		hidden[name] = struct{}{}
+	}
+
+	for _, attrS := range schema.Attributes {
+		v, exists := attrs[attrS.Name]
+		if !exists {
+			continue
+		}
+		hidden[attrS.Name] = struct{}{}
+		content.Attributes[attrS.Name] = &hcl.Attribute{
+			Name: attrS.Name,
+			Expr: hcl.StaticExpr(v, hcl.Range{}),
+		}
+	}
+	for _, blockS := range schema.Blocks {
+		v, exists := attrs[blockS.Type]
+		if !exists {
+			continue
+		}
+		hidden[blockS.Type] = struct{}{}
+		var moreDiags hcl.Diagnostics
+		content.Blocks, moreDiags = b.appendBlocks(content.Blocks, blockS, v, nil)
+		diags = append(diags, moreDiags...)
+	}
+
+	remain := &ctyBody{
+		val:    b.val,
+		path:   b.path,
+		hidden: hidden,
+	}
+	return content, remain, diags
+}
+
+func (b *ctyBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	ret := make(hcl.Attributes)
+	for name, v := range b.attrs() {
+		ret[name] = &hcl.Attribute{
+			Name: name,
+			Expr: hcl.StaticExpr(v, hcl.Range{}),
+		}
+	}
+	return ret, nil
+}
+
+func (b *ctyBody) MissingItemRange() hcl.Range {
+	return hcl.Range{}
+}
+
+// attrs returns the attributes of the body's value that have not been
+// consumed by an earlier call to PartialContent.
+func (b *ctyBody) attrs() map[string]cty.Value {
+	ret := make(map[string]cty.Value)
+	for it := b.val.ElementIterator(); it.Next(); {
+		k, v := it.Element()
+		name := k.AsString()
+		if _, hidden := b.hidden[name]; !hidden {
+			ret[name] = v
+		}
+	}
+	return ret
+}
+
+// appendBlocks appends to the given blocks the blocks of the given type
+// described by the given value, where labels are the labels already
+// consumed from enclosing levels of the value.
+func (b *ctyBody) appendBlocks(blocks hcl.Blocks, blockS hcl.BlockHeaderSchema, v cty.Value, labels []string) (hcl.Blocks, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if v.IsNull() {
+		return blocks, diags
+	}
+	ty := v.Type()
+
+	if len(labels) == 0 && len(blockS.LabelNames) != 0 && v.IsKnown() && (ty.IsListType() || ty.IsSetType() || ty.IsTupleType()) {
+		for it := v.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			var moreDiags hcl.Diagnostics
+			blocks, moreDiags = b.appendLabelledBlock(blocks, blockS, ev)
+			diags = append(diags, moreDiags...)
+		}
+		return blocks, diags
+	}
+	if len(labels) < len(blockS.LabelNames) {
+		if !v.IsKnown() || !(ty.IsObjectType() || ty.IsMapType()) {
+			diags = diags.Append(b.invalidBlockValueError(blockS, labels, "an object or map with one attribute per label"))
+			return blocks, diags
+		}
+		for it := v.ElementIterator(); it.Next(); {
+			k, ev := it.Element()
+			childLabels := make([]string, len(labels), len(labels)+1)
+			copy(childLabels, labels)
+			childLabels = append(childLabels, k.AsString())
+			var moreDiags hcl.Diagnostics
+			blocks, moreDiags = b.appendBlocks(blocks, blockS, ev, childLabels)
+			diags = append(diags, moreDiags...)
+		}
+		return blocks, diags
+	}
+
+	if v.IsKnown() && (ty.IsListType() || ty.IsSetType() || ty.IsTupleType()) {
+		for it := v.ElementIterator(); it.Next(); {
+			_, ev := it.Element()
+			if !ctyBodyValueValid(ev) {
+				diags = diags.Append(b.invalidBlockValueError(blockS, labels, "an object or a list of objects"))
+				continue
+			}
+			blocks = append(blocks, b.block(blockS, ev, labels))
+		}
+		return blocks, diags
+	}
+	if !ctyBodyValueValid(v) {
+		diags = diags.Append(b.invalidBlockValueError(blockS, labels, "an object or a list of objects"))
+		return blocks, diags
+	}
+	return append(blocks, b.block(blockS, v, labels)), diags
+}
+
+// appendLabelledBlock appends to the given blocks a block of the given type
+// described by the given value, which is an object or map that has the
+// block's labels as attributes named after the labels in the schema.
+func (b *ctyBody) appendLabelledBlock(blocks hcl.Blocks, blockS hcl.BlockHeaderSchema, v cty.Value) (hcl.Blocks, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if !ctyBodyValueValid(v) {
+		diags = diags.Append(b.invalidBlockValueError(blockS, nil, "an object with one attribute per label, or a list of objects that each have an attribute for each label"))
+		return blocks, diags
+	}
+
+	attrs := v.AsValueMap()
+	labels := make([]string, len(blockS.LabelNames))
+	for i, name := range blockS.LabelNames {
+		lv, exists := attrs[name]
+		if exists && lv.IsKnown() && !lv.IsNull() {
+			lv, err := convert.Convert(lv, cty.String)
+			if err == nil {
+				labels[i] = lv.AsString()
+				delete(attrs, name)
+				continue
+			}
+		}
+		diags = diags.Append(b.invalidBlockValueError(blockS, nil, fmt.Sprintf("a list of objects that each have a string attribute %q for the block's label", name)))
+		return blocks, diags
+	}
+	if len(attrs) == 0 {
+		v = cty.EmptyObjectVal
+	} else {
+		v = cty.ObjectVal(attrs)
+	}
+	return append(blocks, b.block(blockS, v, labels)), diags
+}
+
+// block returns a block of the given type with the given labels whose body
+// is described by the given value.
+func (b *ctyBody) block(blockS hcl.BlockHeaderSchema, v cty.Value, labels []string) *hcl.Block {
+	path := make([]pathStep, len(b.path), len(b.path)+1+len(labels))
+	copy(path, b.path)
+	path = append(path, pathStep{name: blockS.Type})
+	path = append(path, namedSteps(labels)...)
+	return &hcl.Block{
+		Type:        blockS.Type,
+		Labels:      labels,
+		LabelRanges: make([]hcl.Range, len(labels)), // must have same length as Labels even though it's all zero values
+		Body: &ctyBody{
+			val:  v,
+			path: path,
+		},
+	}
+}
+
+// childPath returns the path to the given attribute of the body's value, in
+// the syntax accepted by ParseCLIArgument.
+func (b *ctyBody) childPath(name string) string {
+	steps := make([]pathStep, len(b.path), len(b.path)+1)
+	copy(steps, b.path)
+	return formatCLIPath(append(steps, pathStep{name: name}))
+}
+
+func (b *ctyBody) invalidBlockValueError(blockS hcl.BlockHeaderSchema, labels []string, want string) *hcl.Diagnostic {
+	steps := make([]pathStep, len(b.path), len(b.path)+1+len(labels))
+	copy(steps, b.path)
+	steps = append(steps, pathStep{name: blockS.Type})
+	steps = append(steps, namedSteps(labels)...)
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid argument",
+		Detail:   fmt.Sprintf("Invalid value for %q: must be %s.", formatCLIPath(steps), want),
+	}
+}
+
+// ctyBodyValueValid returns true if the given value can describe the
+// content of a body.
+func ctyBodyValueValid(v cty.Value) bool {
+	if !v.IsKnown() || v.IsNull() {
+		return false
+	}
+	ty := v.Type()
+	return ty.IsObjectType() || ty.IsMapType()
+}
@@ -0,0 +1,198 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNewCtyOverlay(t *testing.T) {
+	type Rule struct {
+		Port int `hcl:"port"`
+	}
+	type Service struct {
+		Type       string            `hcl:"type,label"`
+		Name       string            `hcl:"name,label"`
+		ListenAddr string            `hcl:"listen_addr"`
+		Labels     map[string]string `hcl:"labels,optional"`
+		Rules      []Rule            `hcl:"rule,block"`
+	}
+	type Logging struct {
+		Level string `hcl:"level"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Ports    []int     `hcl:"ports,optional"`
+		Logging  *Logging  `hcl:"logging,block"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+
+service "http" "web" {
+  listen_addr = "127.0.0.1:8080"
+}
+`), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	o, diags := NewCtyOverlay(cty.ObjectVal(map[string]cty.Value{
+		"io_mode": cty.StringVal("async"),
+		"ports":   cty.ListVal([]cty.Value{cty.NumberIntVal(80), cty.NumberIntVal(443)}),
+		"logging": cty.ObjectVal(map[string]cty.Value{
+			"level": cty.StringVal("debug"),
+		}),
+		"service": cty.ObjectVal(map[string]cty.Value{
+			"http": cty.ObjectVal(map[string]cty.Value{
+				"web": cty.ObjectVal(map[string]cty.Value{
+					"labels": cty.MapVal(map[string]cty.Value{
+						"env": cty.StringVal("prod"),
+					}),
+					"rule": cty.TupleVal([]cty.Value{
+						cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(80)}),
+						cty.ObjectVal(map[string]cty.Value{"port": cty.NumberIntVal(443)}),
+					}),
+				}),
+				"web.prod": cty.ObjectVal(map[string]cty.Value{
+					"listen_addr": cty.StringVal("0.0.0.0:80"),
+				}),
+			}),
+		}),
+	}))
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+
+	var got Config
+	diags = gohcl.DecodeBody(ApplyOverlays(f.Body, o), nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		IOMode:  "async",
+		Ports:   []int{80, 443},
+		Logging: &Logging{Level: "debug"},
+		Services: []Service{
+			{
+				Type:       "http",
+				Name:       "web",
+				ListenAddr: "127.0.0.1:8080",
+				Labels:     map[string]string{"env": "prod"},
+				Rules:      []Rule{{Port: 80}, {Port: 443}},
+			},
+			{
+				Type:       "http",
+				Name:       "web.prod",
+				ListenAddr: "0.0.0.0:80",
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+}
+
+func TestNewCtyOverlayErrors(t *testing.T) {
+	type Service struct {
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode,optional"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	tests := map[string]struct {
+		Val     cty.Value
+		WantErr string
+	}{
+		"not an object": {
+			cty.StringVal("hello"),
+			`An overlay value must be a known, non-null object or map, not string.`,
+		},
+		"null": {
+			cty.NullVal(cty.EmptyObject),
+			`An overlay value must be a known, non-null object or map, not object.`,
+		},
+		"unknown": {
+			cty.DynamicVal,
+			`An overlay value must be a known, non-null object or map, not dynamic.`,
+		},
+		"unexpected argument": {
+			cty.ObjectVal(map[string]cty.Value{
+				"io_mdoe": cty.StringVal("async"),
+			}),
+			`Unexpected argument "io_mdoe".`,
+		},
+		"unexpected nested argument": {
+			cty.ObjectVal(map[string]cty.Value{
+				"service": cty.ObjectVal(map[string]cty.Value{
+					"web": cty.ObjectVal(map[string]cty.Value{
+						"listen_adr": cty.StringVal(":80"),
+					}),
+				}),
+			}),
+			`Unexpected argument "service.web.listen_adr".`,
+		},
+		"labels not an object": {
+			cty.ObjectVal(map[string]cty.Value{
+				"service": cty.StringVal("web"),
+			}),
+			`Invalid value for "service": must be an object or map with one attribute per label.`,
+		},
+		"block not an object": {
+			cty.ObjectVal(map[string]cty.Value{
+				"service": cty.ObjectVal(map[string]cty.Value{
+					"web": cty.StringVal(":80"),
+				}),
+			}),
+			`Invalid value for "service.web": must be an object or a list of objects.`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, diags := NewCtyOverlay(test.Val)
+			if !diags.HasErrors() {
+				var got Config
+				diags = gohcl.DecodeBody(ApplyOverlays(hcl.EmptyBody(), o), nil, &got)
+			}
+			if !diags.HasErrors() {
+				t.Fatalf("unexpected success")
+			}
+			if got := diags.Error(); !strings.Contains(got, test.WantErr) {
+				t.Fatalf("wrong error\ngot: %s\nshould contain: %s", got, test.WantErr)
+			}
+		})
+	}
+}
+
+func TestNewCtyOverlayJustAttributes(t *testing.T) {
+	o, diags := NewCtyOverlay(cty.MapVal(map[string]cty.Value{
+		"a": cty.StringVal("x"),
+		"b": cty.StringVal("y"),
+	}))
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+
+	attrs, diags := ApplyOverlays(hcl.EmptyBody(), o).JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	got := make(map[string]string)
+	for name := range attrs {
+		got[name] = attrStringValue(t, attrs[name])
+	}
+	want := map[string]string{"a": "x", "b": "y"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong result\n%s", diff)
+	}
+}
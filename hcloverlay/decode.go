@@ -0,0 +1,28 @@
+package hcloverlay
+
+import (
+	"reflect"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+// DecodeBodyWithOverlays is a convenience wrapper that applies the given
+// overlays to the given body, as with ApplyOverlays, and then decodes the
+// result into the given value using gohcl.DecodeBody.
+//
+// If val is a pointer to a struct then DecodeBodyWithOverlays first checks
+// the overlays against that struct, as with ValidateOverlaysForStruct, and
+// returns any problems without decoding anything, so that a misspelled
+// argument name in an overlay is reported clearly rather than alongside
+// whatever other problems decoding might produce. Names that only a field
+// tagged "remain" would accept are not checked, because the struct does not
+// describe them.
+func DecodeBodyWithOverlays(body hcl.Body, ctx *hcl.EvalContext, val interface{}, overlays ...Overlay) hcl.Diagnostics {
+	if ty := reflect.TypeOf(val); ty != nil && ty.Kind() == reflect.Ptr && ty.Elem().Kind() == reflect.Struct {
+		if diags := ValidateOverlaysForStruct(val, overlays...); diags.HasErrors() {
+			return diags
+		}
+	}
+	return gohcl.DecodeBody(ApplyOverlays(body, overlays...), ctx, val)
+}
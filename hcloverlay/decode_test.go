@@ -0,0 +1,95 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestDecodeBodyWithOverlays(t *testing.T) {
+	type Service struct {
+		Type       string `hcl:"type,label"`
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Services []Service `hcl:"service,block"`
+	}
+	type PartialConfig struct {
+		IOMode string   `hcl:"io_mode"`
+		Remain hcl.Body `hcl:",remain"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+service "http" "web" {
+  listen_addr = ":80"
+}
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	parse := func(arg string) Overlay {
+		t.Helper()
+		o, diags := ParseCLIArgument(arg)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		var got Config
+		diags := DecodeBodyWithOverlays(f.Body, nil, &got, parse(`io_mode=async`), nil, parse(`service.http.web.listen_addr=:8080`))
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		want := Config{
+			IOMode:   "async",
+			Services: []Service{{Type: "http", Name: "web", ListenAddr: ":8080"}},
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("incorrect result\n%s", diff)
+		}
+	})
+	t.Run("invalid overlay", func(t *testing.T) {
+		var got Config
+		diags := DecodeBodyWithOverlays(f.Body, nil, &got, parse(`io_mode=async`), parse(`service.http.listen_addr=:8080`))
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+		if got, want := len(diags), 1; got != want {
+			t.Errorf("wrong number of diagnostics %d; want %d\n%s", got, want, diags.Error())
+		}
+		want := `block type "service" requires 2 labels, but the path provides 1`
+		if errStr := diags.Error(); !strings.Contains(errStr, want) {
+			t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, want)
+		}
+		if got.IOMode != "" {
+			t.Errorf("body was decoded despite invalid overlay")
+		}
+	})
+	t.Run("remain field", func(t *testing.T) {
+		// With a remain field the schema isn't exhaustive, so an overlay
+		// for something the struct doesn't describe isn't an error.
+		var got PartialConfig
+		diags := DecodeBodyWithOverlays(hcl.EmptyBody(), nil, &got, parse(`io_mode=async`), parse(`other=x`))
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if got, want := got.IOMode, "async"; got != want {
+			t.Errorf("wrong io_mode %q; want %q", got, want)
+		}
+		attrs, diags := got.Remain.JustAttributes()
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if _, exists := attrs["other"]; !exists {
+			t.Errorf("remaining body does not include overlay for other")
+		}
+	})
+}
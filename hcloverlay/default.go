@@ -0,0 +1,31 @@
+package hcloverlay
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// NewDefaultOverlay returns an overlay that sets the argument indicated by
+// the given path to the given string value only if that argument is not
+// already set, thus providing a default value without overriding any
+// explicit setting in the configuration.
+//
+// The path uses the same dot-separated syntax as the part before the equals
+// sign in arguments to ParseCLIArgument, and traversal through blocks
+// follows the same rules. In particular, if no block matches a block type
+// and labels in the path then the overlay creates a new block containing
+// only the default argument, but if a matching block exists then the
+// default applies only if that block doesn't already set the argument.
+func NewDefaultOverlay(path, value string) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgDefault,
+		expr:     hcl.StaticExpr(cty.StringVal(value), hcl.Range{}),
+	}, diags
+}
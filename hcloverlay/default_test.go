@@ -0,0 +1,69 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestNewDefaultOverlay(t *testing.T) {
+	type Service struct {
+		Name     string `hcl:"name,label"`
+		LogLevel string `hcl:"log_level"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Region   string    `hcl:"region"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+
+service "a" {
+  log_level = "info"
+}
+service "b" {
+}
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	defaults := map[string]string{
+		"io_mode":             "async",
+		"region":              "us-east-1",
+		"service.a.log_level": "debug",
+		"service.b.log_level": "debug",
+		"service.c.log_level": "debug",
+	}
+	var overlays []Overlay
+	for _, path := range []string{"io_mode", "region", "service.a.log_level", "service.b.log_level", "service.c.log_level"} {
+		o, diags := NewDefaultOverlay(path, defaults[path])
+		if diags.HasErrors() {
+			t.Fatalf("path has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+
+	var got Config
+	diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		IOMode: "sync",
+		Region: "us-east-1",
+		Services: []Service{
+			{Name: "a", LogLevel: "info"},
+			{Name: "b", LogLevel: "debug"},
+			{Name: "c", LogLevel: "debug"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+}
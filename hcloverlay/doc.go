@@ -11,4 +11,10 @@
 // The specific additional constraints implied by an overlay depend on the
 // particular overlay implementation. See the documentation of the overlay
 // factory functions in this package for more details.
+//
+// One constraint common to all overlays is that a body can have at most one
+// argument of each name, because HCL represents arguments as a map keyed by
+// name. Languages that accumulate a list from repeated definitions of the
+// same argument can't be modelled directly; NewAppendAttributeOverlay
+// instead appends to the value of a single list-typed argument.
 package hcloverlay
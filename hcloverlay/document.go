@@ -0,0 +1,130 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ParseDocumentOverlay returns an overlay that merges the settings from a
+// document in some other format, such as a YAML or TOML file of overrides,
+// into the content of the body it is applied to.
+//
+// This package doesn't depend on any particular YAML or TOML library, so
+// the caller provides a function that decodes the document into an
+// interface{} value, such as yaml.Unmarshal from gopkg.in/yaml.v3 or
+// toml.Unmarshal from github.com/BurntSushi/toml. The result must be a map
+// with string keys, which can contain further maps, slices, and scalar
+// values of the types those libraries produce. Maps with interface{} keys,
+// as produced by gopkg.in/yaml.v2, are accepted if all of their keys are
+// strings, and time.Time values, as produced for TOML dates, become
+// strings in RFC 3339 format.
+//
+// The decoded document is then interpreted as described for NewCtyOverlay,
+// using the schema the overlay is applied with, so nested maps describe
+// the bodies of blocks and lists of maps describe repeated blocks. For
+// block types with labels, each map in such a list must have an entry for
+// each label, named after the label in the schema. For example, with a
+// block type "service" whose labels are "type" and "name", the following
+// YAML describes a block service "http" "web":
+//
+//	service:
+//	  - type: http
+//	    name: web
+//	    listen_addr: ":8080"
+//
+// If the document can't be decoded or doesn't have a suitable structure
+// then ParseDocumentOverlay returns error diagnostics. Problems relating to
+// the schema, such as unexpected arguments, are reported only when the
+// overlay is applied.
+func ParseDocumentOverlay(data []byte, unmarshal func(data []byte, v interface{}) error) (Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var doc interface{}
+	if err := unmarshal(data, &doc); err != nil {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid overlay document",
+			Detail:   fmt.Sprintf("Failed to decode overrides: %s.", err),
+		})
+		return nil, diags
+	}
+	if doc == nil {
+		// An empty document has no overrides.
+		return NewCtyOverlay(cty.EmptyObjectVal)
+	}
+
+	val, err := documentValue(doc)
+	if err != nil {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid overlay document",
+			Detail:   fmt.Sprintf("Unsupported overrides: %s.", err),
+		})
+		return nil, diags
+	}
+	if !val.Type().IsObjectType() {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid overlay document",
+			Detail:   fmt.Sprintf("The overrides must be a mapping of argument and block type names, not %s.", val.Type().FriendlyName()),
+		})
+		return nil, diags
+	}
+	return NewCtyOverlay(val)
+}
+
+// documentValue converts a value decoded by a general-purpose document
+// decoder into a cty value, normalizing the container types that such
+// decoders use and then converting as for NewMapOverlay.
+func documentValue(v interface{}) (cty.Value, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		attrs := make(map[string]cty.Value, len(v))
+		for k, ev := range v {
+			var err error
+			attrs[k], err = documentValue(ev)
+			if err != nil {
+				return cty.DynamicVal, fmt.Errorf("%s: %s", k, err)
+			}
+		}
+		if len(attrs) == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		return cty.ObjectVal(attrs), nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, ev := range v {
+			ks, ok := k.(string)
+			if !ok {
+				return cty.DynamicVal, fmt.Errorf("key %#v is not a string", k)
+			}
+			m[ks] = ev
+		}
+		return documentValue(m)
+	case []map[string]interface{}:
+		elems := make([]interface{}, len(v))
+		for i, ev := range v {
+			elems[i] = ev
+		}
+		return documentValue(elems)
+	case []interface{}:
+		if len(v) == 0 {
+			return cty.EmptyTupleVal, nil
+		}
+		elems := make([]cty.Value, len(v))
+		for i, ev := range v {
+			var err error
+			elems[i], err = documentValue(ev)
+			if err != nil {
+				return cty.DynamicVal, fmt.Errorf("element %d: %s", i, err)
+			}
+		}
+		return cty.TupleVal(elems), nil
+	case time.Time:
+		return cty.StringVal(v.Format(time.RFC3339Nano)), nil
+	default:
+		return mapOverlayValue(v)
+	}
+}
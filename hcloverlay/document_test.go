@@ -0,0 +1,164 @@
+package hcloverlay
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestParseDocumentOverlay(t *testing.T) {
+	type Service struct {
+		Type       string `hcl:"type,label"`
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+		Replicas   int    `hcl:"replicas,optional"`
+	}
+	type Logging struct {
+		Level string `hcl:"level"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Logging  *Logging  `hcl:"logging,block"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	// The document format doesn't matter to ParseDocumentOverlay, so JSON
+	// stands in here for YAML or TOML.
+	jsonUnmarshal := json.Unmarshal
+	// yaml.v2 decodes mappings as map[interface{}]interface{}.
+	yamlV2Unmarshal := func(data []byte, v interface{}) error {
+		*(v.(*interface{})) = map[interface{}]interface{}{
+			"io_mode": "async",
+			"logging": map[interface{}]interface{}{
+				"level": "debug",
+			},
+		}
+		return nil
+	}
+
+	tests := map[string]struct {
+		Doc       string
+		Unmarshal func([]byte, interface{}) error
+		Want      Config
+		WantErr   string
+	}{
+		"arguments": {
+			Doc:       `{"io_mode": "async"}`,
+			Unmarshal: jsonUnmarshal,
+			Want: Config{
+				IOMode:   "async",
+				Services: []Service{{Type: "http", Name: "web", ListenAddr: "127.0.0.1:8080"}},
+			},
+		},
+		"nested block": {
+			Doc:       `{"logging": {"level": "debug"}}`,
+			Unmarshal: jsonUnmarshal,
+			Want: Config{
+				IOMode:   "sync",
+				Logging:  &Logging{Level: "debug"},
+				Services: []Service{{Type: "http", Name: "web", ListenAddr: "127.0.0.1:8080"}},
+			},
+		},
+		"labelled blocks as list": {
+			Doc: `{"service": [
+				{"type": "http", "name": "web", "replicas": 3},
+				{"type": "http", "name": "admin", "listen_addr": "127.0.0.1:9090"}
+			]}`,
+			Unmarshal: jsonUnmarshal,
+			Want: Config{
+				IOMode: "sync",
+				Services: []Service{
+					{Type: "http", Name: "web", ListenAddr: "127.0.0.1:8080", Replicas: 3},
+					{Type: "http", Name: "admin", ListenAddr: "127.0.0.1:9090"},
+				},
+			},
+		},
+		"labelled blocks as nested maps": {
+			Doc:       `{"service": {"http": {"web": {"replicas": 2}}}}`,
+			Unmarshal: jsonUnmarshal,
+			Want: Config{
+				IOMode:   "sync",
+				Services: []Service{{Type: "http", Name: "web", ListenAddr: "127.0.0.1:8080", Replicas: 2}},
+			},
+		},
+		"interface keys": {
+			Unmarshal: yamlV2Unmarshal,
+			Want: Config{
+				IOMode:   "async",
+				Logging:  &Logging{Level: "debug"},
+				Services: []Service{{Type: "http", Name: "web", ListenAddr: "127.0.0.1:8080"}},
+			},
+		},
+		"empty document": {
+			Doc:       `null`,
+			Unmarshal: jsonUnmarshal,
+			Want: Config{
+				IOMode:   "sync",
+				Services: []Service{{Type: "http", Name: "web", ListenAddr: "127.0.0.1:8080"}},
+			},
+		},
+		"missing label": {
+			Doc:       `{"service": [{"type": "http", "replicas": 3}]}`,
+			Unmarshal: jsonUnmarshal,
+			WantErr:   `must be a list of objects that each have a string attribute "name"`,
+		},
+		"not a mapping": {
+			Doc:       `["io_mode"]`,
+			Unmarshal: jsonUnmarshal,
+			WantErr:   `The overrides must be a mapping of argument and block type names`,
+		},
+		"decode error": {
+			Unmarshal: func([]byte, interface{}) error { return errors.New("bad indentation") },
+			WantErr:   `Failed to decode overrides: bad indentation.`,
+		},
+		"non-string key": {
+			Unmarshal: func(data []byte, v interface{}) error {
+				*(v.(*interface{})) = map[interface{}]interface{}{1: "a"}
+				return nil
+			},
+			WantErr: `Unsupported overrides: key 1 is not a string.`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+
+service "http" "web" {
+  listen_addr = "127.0.0.1:8080"
+}
+`), "config.hcl", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			var got Config
+			o, diags := ParseDocumentOverlay([]byte(test.Doc), test.Unmarshal)
+			if !diags.HasErrors() {
+				diags = gohcl.DecodeBody(ApplyOverlays(f.Body, o), nil, &got)
+			}
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
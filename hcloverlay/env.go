@@ -0,0 +1,276 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ExtractEnvOptions interprets the given slice as a set of environment
+// variables in the "NAME=value" form returned by os.Environ, and produces an
+// overlay for each one whose name starts with the given prefix followed by
+// an underscore and then identifies an attribute or block type in the given
+// schema.
+//
+// The remainder of the name after the prefix is split into path components
+// at each double underscore and converted to lowercase, so that with the
+// prefix "APP" the variable APP_IO_MODE sets the argument io_mode and the
+// variable APP_SERVICE__HTTP__WEB__LISTEN_ADDR sets the argument
+// service.http.web.listen_addr. Single underscores are retained as part of
+// the names of arguments, block types, and labels. Because environment
+// variable names are conventionally uppercase, it isn't possible to specify
+// block labels that contain uppercase letters using this mechanism.
+//
+// The value of each variable is used as a string value, as with the "="
+// operator in arguments to ParseCLIArgument, and traversal through blocks
+// follows the same rules.
+//
+// If the prefix is empty then all variables are considered, without
+// requiring a leading underscore. Variables that don't correspond to any
+// attribute or block type in the schema are ignored.
+//
+// The resulting overlays are ordered by variable name, so that the result
+// does not depend on the order of the given slice.
+//
+// ExtractEnvOptionsWithOpts additionally supports setting list arguments
+// using several variables.
+func ExtractEnvOptions(environ []string, schema *hcl.BodySchema, prefix string) ([]Overlay, hcl.Diagnostics) {
+	return ExtractEnvOptionsWithOpts(environ, schema, prefix, nil)
+}
+
+// EnvOptions represents optional settings that customize the behavior of
+// ExtractEnvOptionsWithOpts.
+type EnvOptions struct {
+	// ListArgs is the set of paths of arguments that accept lists, in the
+	// syntax accepted by ParseCLIArgument, such as "tags" or
+	// "service.http.web.tags". Each variable for one of these arguments
+	// whose name has an additional suffix of an underscore and a decimal
+	// index, as in APP_TAGS_0 or APP_SERVICE__HTTP__WEB__TAGS_1, appends
+	// its value to the list, as with the "+=" operator in arguments to
+	// ParseCLIArgument.
+	//
+	// The elements are appended in increasing order of their indices,
+	// compared numerically so that APP_TAGS_10 follows APP_TAGS_9. The
+	// indices don't need to be contiguous, and so a gap in the indices just
+	// means that there is no element for the missing index, rather than
+	// an error or a null element. This allows removing an element by unsetting
+	// its variable without renumbering the others.
+	ListArgs map[string]bool
+
+	// ListSeparator, if set, causes a variable for one of the arguments in
+	// ListArgs without an index suffix, as in APP_TAGS, to be split at each
+	// occurrence of the separator, appending each of the resulting values
+	// to the list as separate elements. Those elements are appended before
+	// any given by variables with index suffixes. A variable whose value is
+	// empty appends nothing.
+	//
+	// If ListSeparator is empty then a variable without an index suffix
+	// sets the argument to its value as a string, as usual.
+	ListSeparator string
+}
+
+// ExtractEnvOptionsWithOpts is a variant of ExtractEnvOptions that accepts
+// some additional options to customize its behavior. If opts is nil then
+// the behavior is identical to ExtractEnvOptions.
+//
+// The overlays for the elements of a list argument are ordered as described
+// for EnvOptions.ListArgs and appear together at the position of the first
+// variable for that argument in order of variable name.
+func ExtractEnvOptionsWithOpts(environ []string, schema *hcl.BodySchema, prefix string, opts *EnvOptions) ([]Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if opts == nil {
+		opts = &EnvOptions{}
+	}
+
+	if prefix != "" {
+		prefix += "_"
+	}
+
+	environ = append([]string(nil), environ...)
+	sort.Strings(environ)
+
+	// ret may contain nil placeholders for the overlays of list arguments,
+	// which are in lists, until we've seen all of the list elements.
+	var ret []Overlay
+	lists := make(map[string]*envList)
+	for _, kv := range environ {
+		name, val, hasVal := splitOptionValue(kv)
+		if !hasVal || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		parts := strings.Split(strings.ToLower(name[len(prefix):]), "__")
+		index := -1
+		if base, idx, ok := splitEnvIndex(parts[len(parts)-1]); ok {
+			withBase := append(append([]string(nil), parts[:len(parts)-1]...), base)
+			if opts.ListArgs[formatCLIPath(namedSteps(withBase))] {
+				parts, index = withBase, idx
+			}
+		}
+		if !schemaHasName(schema, parts[0]) {
+			continue
+		}
+
+		steps := make([]pathStep, len(parts))
+		for i, part := range parts {
+			if part == "" {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid environment variable",
+					Detail:   fmt.Sprintf("The environment variable %s has an empty path component: components must be separated by exactly two underscores.", name),
+				})
+				steps = nil
+				break
+			}
+			steps[i] = pathStep{name: part}
+		}
+		if steps == nil {
+			continue
+		}
+
+		path := formatCLIPath(steps)
+		source := "environment variable " + name
+		isList := opts.ListArgs[path] && (index >= 0 || opts.ListSeparator != "")
+		if !isList {
+			ret = append(ret, &cliArgOverlay{
+				fullPath: path,
+				steps:    steps,
+				op:       cliArgSet,
+				expr:     hcl.StaticExpr(cty.StringVal(val), hcl.Range{}),
+				source:   source,
+			})
+			continue
+		}
+
+		list := lists[path]
+		if list == nil {
+			list = &envList{steps: steps, pos: len(ret)}
+			lists[path] = list
+			ret = append(ret, nil) // placeholder
+		}
+		if index >= 0 {
+			list.indexed = append(list.indexed, envListElem{index: index, val: val, source: source})
+			continue
+		}
+		if val == "" {
+			continue
+		}
+		for _, elem := range strings.Split(val, opts.ListSeparator) {
+			list.split = append(list.split, envListElem{val: elem, source: source})
+		}
+	}
+
+	if len(lists) == 0 {
+		return ret, diags
+	}
+	byPos := make(map[int]*envList, len(lists))
+	for _, list := range lists {
+		byPos[list.pos] = list
+	}
+	flat := make([]Overlay, 0, len(ret))
+	for i, o := range ret {
+		if o != nil {
+			flat = append(flat, o)
+			continue
+		}
+		flat = append(flat, byPos[i].overlays()...)
+	}
+	return flat, diags
+}
+
+// envList gathers the elements for a list argument given using several
+// environment variables, as described for EnvOptions.ListArgs.
+type envList struct {
+	steps   []pathStep
+	pos     int // position of the placeholder in the result
+	split   []envListElem
+	indexed []envListElem
+}
+
+type envListElem struct {
+	index  int
+	val    string
+	source string
+}
+
+func (l *envList) overlays() []Overlay {
+	sort.SliceStable(l.indexed, func(i, j int) bool {
+		return l.indexed[i].index < l.indexed[j].index
+	})
+	path := formatCLIPath(l.steps)
+	ret := make([]Overlay, 0, len(l.split)+len(l.indexed))
+	for _, elem := range append(l.split, l.indexed...) {
+		ret = append(ret, &cliArgOverlay{
+			fullPath: path,
+			steps:    l.steps,
+			op:       cliArgAppend,
+			expr:     hcl.StaticExpr(cty.StringVal(elem.val), hcl.Range{}),
+			source:   elem.source,
+		})
+	}
+	return ret
+}
+
+// splitEnvIndex splits a path component like "tags_2" into the name "tags"
+// and the index 2, returning false if the component has no such suffix.
+func splitEnvIndex(part string) (string, int, bool) {
+	us := strings.LastIndexByte(part, '_')
+	if us < 1 || us == len(part)-1 {
+		return "", 0, false
+	}
+	digits := part[us+1:]
+	if len(digits) > 9 { // avoid overflow
+		return "", 0, false
+	}
+	index := 0
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return "", 0, false
+		}
+		index = index*10 + int(c-'0')
+	}
+	return part[:us], index, true
+}
+
+// schemaHasName returns true if the given schema has an attribute or block
+// type of the given name.
+func schemaHasName(schema *hcl.BodySchema, name string) bool {
+	for _, attrS := range schema.Attributes {
+		if attrS.Name == name {
+			return true
+		}
+	}
+	for _, blockS := range schema.Blocks {
+		if blockS.Type == name {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaHasBlockType returns true if the given schema has a block type of
+// the given name.
+func schemaHasBlockType(schema *hcl.BodySchema, name string) bool {
+	for _, blockS := range schema.Blocks {
+		if blockS.Type == name {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaNames returns the set of the names of all of the attributes and
+// block types in the given schema, for repeated lookups.
+func schemaNames(schema *hcl.BodySchema) map[string]struct{} {
+	ret := make(map[string]struct{}, len(schema.Attributes)+len(schema.Blocks))
+	for _, attrS := range schema.Attributes {
+		ret[attrS.Name] = struct{}{}
+	}
+	for _, blockS := range schema.Blocks {
+		ret[blockS.Type] = struct{}{}
+	}
+	return ret
+}
@@ -0,0 +1,279 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestExtractEnvOptions(t *testing.T) {
+	type Service struct {
+		Type       string `hcl:"type,label"`
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+	}
+	type Config struct {
+		IOMode  string    `hcl:"io_mode,optional"`
+		Service []Service `hcl:"service,block"`
+	}
+	schema, _ := gohcl.ImpliedBodySchema(&Config{})
+
+	tests := map[string]struct {
+		Config  string
+		Environ []string
+		Prefix  string
+		Want    *Config
+		WantErr string
+	}{
+		"no variables": {
+			`io_mode = "sync"`,
+			nil,
+			"APP",
+			&Config{IOMode: "sync"},
+			``,
+		},
+		"root attribute": {
+			`io_mode = "sync"`,
+			[]string{"APP_IO_MODE=async"},
+			"APP",
+			&Config{IOMode: "async"},
+			``,
+		},
+		"attribute in existing block": {
+			`
+			service "http" "web" { listen_addr = ":80" }
+			`,
+			[]string{"APP_SERVICE__HTTP__WEB__LISTEN_ADDR=:8080"},
+			"APP",
+			&Config{Service: []Service{{Type: "http", Name: "web", ListenAddr: ":8080"}}},
+			``,
+		},
+		"attribute in new block": {
+			``,
+			[]string{"APP_SERVICE__HTTP__WEB__LISTEN_ADDR=:8080"},
+			"APP",
+			&Config{Service: []Service{{Type: "http", Name: "web", ListenAddr: ":8080"}}},
+			``,
+		},
+		"unrelated variables": {
+			`io_mode = "sync"`,
+			[]string{"HOME=/home/a", "APP_NOPE=x", "OTHER_IO_MODE=async", "APP=x", "APPIO_MODE=async"},
+			"APP",
+			&Config{IOMode: "sync"},
+			``,
+		},
+		"no prefix": {
+			`io_mode = "sync"`,
+			[]string{"HOME=/home/a", "IO_MODE=async"},
+			"",
+			&Config{IOMode: "async"},
+			``,
+		},
+		"value containing equals": {
+			``,
+			[]string{"APP_IO_MODE=a=b"},
+			"APP",
+			&Config{IOMode: "a=b"},
+			``,
+		},
+		"empty path component": {
+			``,
+			[]string{"APP_SERVICE__HTTP____LISTEN_ADDR=:8080"},
+			"APP",
+			nil,
+			`The environment variable APP_SERVICE__HTTP____LISTEN_ADDR has an empty path component`,
+		},
+		"not enough labels": {
+			``,
+			[]string{"APP_SERVICE__HTTP__LISTEN_ADDR=:8080"},
+			"APP",
+			nil,
+			`Unexpected argument "service.http.listen_addr" (from environment variable APP_SERVICE__HTTP__LISTEN_ADDR): block type "service" requires 2 labels, but the path provides 1.`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "", hcl.Pos{})
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			overlays, diags := ExtractEnvOptions(test.Environ, schema, test.Prefix)
+			if !diags.HasErrors() {
+				body := ApplyOverlays(f.Body, overlays...)
+				got := &Config{}
+				diags = gohcl.DecodeBody(body, nil, got)
+				if !diags.HasErrors() {
+					if test.WantErr != "" {
+						t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+					}
+					if diff := cmp.Diff(test.Want, got); diff != "" {
+						t.Fatalf("incorrect result\n%s", diff)
+					}
+					return
+				}
+			}
+
+			errStr := diags.Error()
+			if test.WantErr == "" {
+				t.Fatalf("unexpected problems: %s", errStr)
+			}
+			if !strings.Contains(errStr, test.WantErr) {
+				t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+			}
+		})
+	}
+}
+
+func TestExtractEnvOptionsOrder(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "a"},
+			{Name: "b"},
+		},
+	}
+
+	overlays, diags := ExtractEnvOptions([]string{"APP_B=1", "APP_A=2"}, schema, "APP")
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	var got []string
+	for _, o := range overlays {
+		got = append(got, o.(*cliArgOverlay).fullPath)
+	}
+	want := []string{"a", "b"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("wrong paths\n%s", diff)
+	}
+}
+
+func TestExtractEnvOptionsWithOptsLists(t *testing.T) {
+	type Service struct {
+		Type string   `hcl:"type,label"`
+		Name string   `hcl:"name,label"`
+		Tags []string `hcl:"tags,optional"`
+	}
+	type Config struct {
+		IOMode  string    `hcl:"io_mode,optional"`
+		Tags    []string  `hcl:"tags,optional"`
+		Service []Service `hcl:"service,block"`
+	}
+	schema, _ := gohcl.ImpliedBodySchema(&Config{})
+	listArgs := map[string]bool{
+		"tags":                  true,
+		"service.http.web.tags": true,
+	}
+
+	tests := map[string]struct {
+		Config    string
+		Environ   []string
+		Separator string
+		Want      *Config
+	}{
+		"indexed": {
+			``,
+			[]string{"APP_TAGS_1=b", "APP_TAGS_0=a", "APP_IO_MODE=async"},
+			"",
+			&Config{IOMode: "async", Tags: []string{"a", "b"}},
+		},
+		"indexed numerically with gaps": {
+			``,
+			[]string{"APP_TAGS_10=c", "APP_TAGS_9=b", "APP_TAGS_2=a"},
+			"",
+			&Config{Tags: []string{"a", "b", "c"}},
+		},
+		"indexed appends to existing": {
+			`tags = ["x"]`,
+			[]string{"APP_TAGS_0=a"},
+			"",
+			&Config{Tags: []string{"x", "a"}},
+		},
+		"indexed in block": {
+			``,
+			[]string{"APP_SERVICE__HTTP__WEB__TAGS_1=b", "APP_SERVICE__HTTP__WEB__TAGS_0=a"},
+			"",
+			&Config{Service: []Service{{Type: "http", Name: "web", Tags: []string{"a", "b"}}}},
+		},
+		"separator": {
+			``,
+			[]string{"APP_TAGS=a,b,c"},
+			",",
+			&Config{Tags: []string{"a", "b", "c"}},
+		},
+		"separator then indexed": {
+			``,
+			[]string{"APP_TAGS_0=c", "APP_TAGS=a,b"},
+			",",
+			&Config{Tags: []string{"a", "b", "c"}},
+		},
+		"separator with empty value": {
+			`tags = ["x"]`,
+			[]string{"APP_TAGS="},
+			",",
+			&Config{Tags: []string{"x"}},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+			overlays, diags := ExtractEnvOptionsWithOpts(test.Environ, schema, "APP", &EnvOptions{
+				ListArgs:      listArgs,
+				ListSeparator: test.Separator,
+			})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+
+			got := &Config{}
+			diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, got)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("not a list argument", func(t *testing.T) {
+		// Without ListArgs, an index suffix is just part of the name.
+		overlays, diags := ExtractEnvOptions([]string{"APP_TAGS_0=a"}, schema, "APP")
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if len(overlays) != 0 {
+			t.Fatalf("unexpected overlays %#v", overlays)
+		}
+	})
+	t.Run("order", func(t *testing.T) {
+		overlays, diags := ExtractEnvOptionsWithOpts(
+			[]string{"APP_TAGS_1=b", "APP_IO_MODE=async", "APP_TAGS_0=a"},
+			schema, "APP", &EnvOptions{ListArgs: listArgs},
+		)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		var got []string
+		for _, o := range overlays {
+			o := o.(*cliArgOverlay)
+			got = append(got, o.source)
+		}
+		want := []string{
+			"environment variable APP_IO_MODE",
+			"environment variable APP_TAGS_0",
+			"environment variable APP_TAGS_1",
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("wrong order\n%s", diff)
+		}
+	})
+}
@@ -0,0 +1,349 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// OverlayChange describes a single change that an overlay makes to a body,
+// as reported by ExplainOverlay.
+type OverlayChange struct {
+	// Overlay is the index of the overlay that made the change, among the
+	// overlays given to ExplainOverlay.
+	Overlay int
+
+	// Path is the dot-separated path of the affected argument or block,
+	// using the same syntax as the part before the equals sign in arguments
+	// to ParseCLIArgument.
+	Path string
+
+	Action OverlayAction
+
+	// Value is the new value of the affected argument, if the change sets
+	// an argument and the value can be determined without an evaluation
+	// context. Otherwise it is cty.NilVal.
+	Value cty.Value
+
+	// Prior is the value of the affected argument before the change, if
+	// the action is ReplaceAttribute or RemoveAttribute and the value can be
+	// determined without an evaluation context. Otherwise it is cty.NilVal.
+	Prior cty.Value
+}
+
+// OverlayAction represents the kind of change described by an OverlayChange.
+type OverlayAction int
+
+const (
+	// AddAttribute is an action that sets an argument that was not
+	// previously set.
+	AddAttribute OverlayAction = iota + 1
+
+	// ReplaceAttribute is an action that replaces the value of an argument
+	// that was already set.
+	ReplaceAttribute
+
+	// RemoveAttribute is an action that removes an argument.
+	RemoveAttribute
+
+	// CreateBlock is an action that adds a new block.
+	CreateBlock
+
+	// RemoveBlock is an action that removes a block.
+	RemoveBlock
+
+	// OverrideInBlock is an action that changes something inside the body of
+	// an existing or newly-created block. Because a schema describes only a
+	// single body, the change is described only in terms of the path that
+	// the overlay targets inside the block, if known, and the value it sets.
+	OverrideInBlock
+)
+
+func (a OverlayAction) String() string {
+	switch a {
+	case AddAttribute:
+		return "AddAttribute"
+	case ReplaceAttribute:
+		return "ReplaceAttribute"
+	case RemoveAttribute:
+		return "RemoveAttribute"
+	case CreateBlock:
+		return "CreateBlock"
+	case RemoveBlock:
+		return "RemoveBlock"
+	case OverrideInBlock:
+		return "OverrideInBlock"
+	default:
+		return fmt.Sprintf("OverlayAction(%d)", int(a))
+	}
+}
+
+// String returns a short, human-readable description of the change, such as
+// `io_mode: set to "async" (was "sync")`.
+func (c OverlayChange) String() string {
+	switch c.Action {
+	case AddAttribute, ReplaceAttribute, OverrideInBlock:
+		desc := "overridden"
+		if c.Value != cty.NilVal {
+			desc = "set to " + formatValue(c.Value)
+		}
+		if c.Prior != cty.NilVal {
+			desc += " (was " + formatValue(c.Prior) + ")"
+		}
+		return c.Path + ": " + desc
+	case RemoveAttribute, RemoveBlock:
+		return c.Path + ": removed"
+	case CreateBlock:
+		return c.Path + ": created"
+	default:
+		return c.Path + ": " + c.Action.String()
+	}
+}
+
+// ExplainOverlay applies the given overlays to the content of the given body
+// for the given schema, one at a time, and returns a description of each of
+// the changes they make, without decoding the result. This is intended for
+// debugging and for "dry run" features in applications that apply several
+// layers of overlays.
+//
+// As when applying overlays with ApplyOverlays, the required attributes in
+// the schema are not enforced for the body before overlays are applied.
+// ExplainOverlay does not enforce them after overlays are applied either,
+// because it is concerned only with the changes the overlays make.
+//
+// The changes are returned in the order of the overlays that made them.
+// Changes to arguments made by a single overlay are ordered by argument
+// name, followed by changes to blocks in the order of the blocks.
+// Nil overlays are ignored, as for ApplyOverlays, but they still count
+// when determining the indices of the overlays that made the changes.
+func ExplainOverlay(body hcl.Body, schema *hcl.BodySchema, overlays ...Overlay) ([]OverlayChange, hcl.Diagnostics) {
+	modSchema := schemaWithRenames(schemaWithoutRequired(schema), overlays)
+	current, diags := body.Content(modSchema)
+	current = ensureContent(current)
+
+	var changes []OverlayChange
+	original := copyAttributes(current.Attributes) // for any reset overlays
+	for i, ov := range overlays {
+		if ov == nil {
+			// ignored, as for ApplyOverlays, but we still count it so that
+			// the indices in the changes refer to the given overlays.
+			continue
+		}
+		working := copyBodyContent(current)
+		blockIdx := make(map[*hcl.Block]int, len(working.Blocks))
+		for j, block := range working.Blocks {
+			blockIdx[block] = j
+		}
+
+		next, moreDiags := withOriginal(ov, original).ApplyOverlay(working, modSchema)
+		next = ensureContent(next) // in case the overlay returned nil or nil attributes
+		diags = append(diags, moreDiags...)
+		changes = explainContentChanges(changes, i, current, next, blockIdx)
+		current = next
+	}
+
+	return changes, diags
+}
+
+// PlanOverlays applies the given overlays to a copy of the given content,
+// which must have been produced using the given schema, and returns the
+// paths of the blocks that the overlays would create and of the existing
+// blocks whose headers or bodies they would modify, without changing the
+// given content. This allows an application to warn about structural
+// changes before applying overlays, such as that an overlay with a
+// mistyped label will create a new block rather than modifying an existing
+// one. Use ExplainOverlay for a full description of the changes instead.
+//
+// The paths use the same syntax as the part before the equals sign in
+// arguments to ParseCLIArgument, and are in the order of the blocks in the
+// result of applying the overlays. Blocks that the overlays remove are not
+// included. Only the blocks described by the schema are considered, so
+// creating or modifying a block nested inside one of them counts as
+// modifying the outer block. A block that one overlay creates and a later
+// overlay modifies counts only as created.
+func PlanOverlays(content *hcl.BodyContent, schema *hcl.BodySchema, overlays ...Overlay) (created, modified []string, diags hcl.Diagnostics) {
+	working := copyBodyContent(content)
+	priors := make(map[*hcl.Block]hcl.Block, len(working.Blocks))
+	for _, block := range working.Blocks {
+		priors[block] = *block
+	}
+
+	original := copyAttributes(working.Attributes) // for any reset overlays
+	for _, ov := range nonNilOverlays(overlays) {
+		var moreDiags hcl.Diagnostics
+		working, moreDiags = withOriginal(ov, original).ApplyOverlay(working, schema)
+		working = ensureContent(working)
+		diags = append(diags, moreDiags...)
+	}
+
+	for _, block := range working.Blocks {
+		prior, existed := priors[block]
+		switch {
+		case !existed:
+			created = append(created, blockPath(block))
+		case block.Body != prior.Body || block.Type != prior.Type || !labelsEqual(block.Labels, prior.Labels):
+			modified = append(modified, blockPath(block))
+		}
+	}
+	return created, modified, diags
+}
+
+// labelsEqual returns true if the given block labels are identical.
+func labelsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// explainContentChanges appends to the given changes a description of the
+// differences between the given content before and after the given overlay
+// was applied. blockIdx maps the blocks that were given to the overlay to
+// their indices in the "before" content.
+func explainContentChanges(changes []OverlayChange, overlay int, before, after *hcl.BodyContent, blockIdx map[*hcl.Block]int) []OverlayChange {
+	names := make([]string, 0, len(before.Attributes)+len(after.Attributes))
+	for name := range before.Attributes {
+		names = append(names, name)
+	}
+	for name := range after.Attributes {
+		if _, exists := before.Attributes[name]; !exists {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := formatCLIPath([]pathStep{{name: name}})
+		prior, existed := before.Attributes[name]
+		attr, exists := after.Attributes[name]
+		switch {
+		case !existed:
+			changes = append(changes, OverlayChange{
+				Overlay: overlay,
+				Path:    path,
+				Action:  AddAttribute,
+				Value:   knownValue(attr.Expr),
+			})
+		case !exists:
+			changes = append(changes, OverlayChange{
+				Overlay: overlay,
+				Path:    path,
+				Action:  RemoveAttribute,
+				Prior:   knownValue(prior.Expr),
+			})
+		case attr != prior:
+			changes = append(changes, OverlayChange{
+				Overlay: overlay,
+				Path:    path,
+				Action:  ReplaceAttribute,
+				Value:   knownValue(attr.Expr),
+				Prior:   knownValue(prior.Expr),
+			})
+		}
+	}
+
+	kept := make(map[int]bool, len(after.Blocks))
+	for _, block := range after.Blocks {
+		path := blockPath(block)
+		i, existed := blockIdx[block]
+		if !existed {
+			changes = append(changes, OverlayChange{
+				Overlay: overlay,
+				Path:    path,
+				Action:  CreateBlock,
+			})
+			changes = explainBodyChanges(changes, overlay, path, hcl.EmptyBody(), block.Body)
+			continue
+		}
+		kept[i] = true
+		if prior := before.Blocks[i].Body; block.Body != prior {
+			changes = explainBodyChanges(changes, overlay, path, prior, block.Body)
+		}
+	}
+	for i, block := range before.Blocks {
+		if !kept[i] {
+			changes = append(changes, OverlayChange{
+				Overlay: overlay,
+				Path:    blockPath(block),
+				Action:  RemoveBlock,
+			})
+		}
+	}
+
+	return changes
+}
+
+// explainBodyChanges appends to the given changes a description of the
+// overlays that were applied to a block body, as far as can be determined
+// without knowing the schema for the body.
+func explainBodyChanges(changes []OverlayChange, overlay int, path string, before, after hcl.Body) []OverlayChange {
+	afterApply, ok := after.(*applyBody)
+	if !ok {
+		return append(changes, OverlayChange{
+			Overlay: overlay,
+			Path:    path,
+			Action:  OverrideInBlock,
+		})
+	}
+	added := afterApply.overlays
+	if beforeApply, ok := before.(*applyBody); ok && beforeApply.inner == afterApply.inner {
+		added = added[len(beforeApply.overlays):]
+	}
+
+	for _, ov := range added {
+		change := OverlayChange{
+			Overlay: overlay,
+			Path:    path,
+			Action:  OverrideInBlock,
+		}
+		if po, ok := ov.(*priorityOverlay); ok {
+			ov = po.Overlay
+		}
+		if ov, ok := ov.(*cliArgOverlay); ok {
+			change.Path += "." + formatCLIPath(ov.steps)
+			if ov.op != cliArgRemove && ov.op != cliArgRemoveType && ov.op != cliArgCreate {
+				change.Value = knownValue(ov.expr)
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// blockPath returns the path that would select the given block, in the
+// syntax accepted by ParseCLIArgument.
+func blockPath(block *hcl.Block) string {
+	steps := make([]pathStep, 0, len(block.Labels)+1)
+	steps = append(steps, pathStep{name: block.Type})
+	for _, label := range block.Labels {
+		steps = append(steps, pathStep{name: label})
+	}
+	return formatCLIPath(steps)
+}
+
+// knownValue returns the value of the given expression if it can be
+// evaluated without an evaluation context and the result is wholly known,
+// or cty.NilVal otherwise.
+func knownValue(expr hcl.Expression) cty.Value {
+	if expr == nil {
+		return cty.NilVal
+	}
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() || !v.IsWhollyKnown() {
+		return cty.NilVal
+	}
+	return v
+}
+
+// formatValue returns the given known value in HCL native syntax.
+func formatValue(v cty.Value) string {
+	return string(hclwrite.TokensForValue(v).Bytes())
+}
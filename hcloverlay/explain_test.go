@@ -0,0 +1,363 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestExplainOverlay(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode", Required: true},
+			{Name: "count"},
+			{Name: "name"},
+		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "service", LabelNames: []string{"type", "name"}},
+		},
+	}
+
+	tests := map[string]struct {
+		Config string
+		Args   []string
+		Want   []string
+	}{
+		"no overlays": {
+			`io_mode = "sync"`,
+			nil,
+			nil,
+		},
+		"replace attribute": {
+			`io_mode = "sync"`,
+			[]string{`io_mode=async`},
+			[]string{`0 ReplaceAttribute io_mode: set to "async" (was "sync")`},
+		},
+		"add attribute": {
+			``,
+			[]string{`count:=2`},
+			[]string{`0 AddAttribute count: set to 2`},
+		},
+		"attribute with unknown value": {
+			`io_mode = var.mode`,
+			[]string{`count:=var.count`, `io_mode=async`},
+			[]string{
+				`0 AddAttribute count: overridden`,
+				`1 ReplaceAttribute io_mode: set to "async"`,
+			},
+		},
+		"several overlays": {
+			`io_mode = "sync"`,
+			[]string{`io_mode=async`, `count:=1`, `io_mode=sync`},
+			[]string{
+				`0 ReplaceAttribute io_mode: set to "async" (was "sync")`,
+				`1 AddAttribute count: set to 1`,
+				`2 ReplaceAttribute io_mode: set to "sync" (was "async")`,
+			},
+		},
+		"override in existing block": {
+			`
+			service "http" "web" { listen_addr = ":80" }
+			`,
+			[]string{`service.http.web.listen_addr=:8080`},
+			[]string{`0 OverrideInBlock service.http.web.listen_addr: set to ":8080"`},
+		},
+		"create block": {
+			``,
+			[]string{`service.http."web.prod".listen_addr=:8080`},
+			[]string{
+				`0 CreateBlock service.http."web.prod": created`,
+				`0 OverrideInBlock service.http."web.prod".listen_addr: set to ":8080"`,
+			},
+		},
+		"override in block twice": {
+			`
+			service "http" "web" {}
+			`,
+			[]string{`service.http.web.a=1`, `service.http.web.b=2`},
+			[]string{
+				`0 OverrideInBlock service.http.web.a: set to "1"`,
+				`1 OverrideInBlock service.http.web.b: set to "2"`,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "", hcl.Pos{})
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				o, diags := ParseCLIArgument(arg)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			changes, diags := ExplainOverlay(f.Body, schema, overlays...)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			var got []string
+			for _, change := range changes {
+				got = append(got, explainTestString(change))
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Errorf("wrong changes\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExplainOverlayRemove(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode"},
+		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "service", LabelNames: []string{"name"}},
+		},
+	}
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+service "a" {}
+service "b" {}
+`), "", hcl.Pos{})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	removeAttr, _ := NewRemoveOverlay("io_mode")
+	removeBlock, _ := NewRemoveOverlay("service.a")
+
+	changes, diags := ExplainOverlay(f.Body, schema, removeAttr, removeBlock)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	var got []string
+	for _, change := range changes {
+		got = append(got, explainTestString(change))
+	}
+	want := []string{
+		`0 RemoveAttribute io_mode: removed`,
+		`1 RemoveBlock service.a: removed`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong changes\n%s", diff)
+	}
+}
+
+func TestExplainOverlayReset(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "foo"},
+		},
+	}
+	f, diags := hclsyntax.ParseConfig([]byte(`
+foo = "orig"
+`), "", hcl.Pos{})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	set, diags := ParseCLIArgument("foo=new")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	reset, diags := NewResetOverlay("foo")
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+
+	changes, diags := ExplainOverlay(f.Body, schema, set, reset)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	var got []string
+	for _, change := range changes {
+		got = append(got, explainTestString(change))
+	}
+	want := []string{
+		`0 ReplaceAttribute foo: set to "new" (was "orig")`,
+		`1 ReplaceAttribute foo: set to "orig" (was "new")`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong changes\n%s", diff)
+	}
+}
+
+func TestExplainOverlayNil(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode"},
+		},
+	}
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+`), "", hcl.Pos{})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	empty := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		return nil, nil
+	})
+	set, diags := ParseCLIArgument("io_mode=async")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+
+	changes, diags := ExplainOverlay(f.Body, schema, nil, empty, set)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	var got []string
+	for _, change := range changes {
+		got = append(got, explainTestString(change))
+	}
+	want := []string{
+		`1 RemoveAttribute io_mode: removed`,
+		`2 AddAttribute io_mode: set to "async"`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong changes\n%s", diff)
+	}
+}
+
+func explainTestString(change OverlayChange) string {
+	return fmt.Sprintf("%d %s %s", change.Overlay, change.Action, change)
+}
+
+func TestPlanOverlays(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode"},
+		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "service", LabelNames: []string{"type", "name"}},
+			{Type: "server", LabelNames: []string{"type", "name"}},
+			{Type: "logging"},
+		},
+	}
+
+	tests := map[string]struct {
+		Args         []string
+		Overlay      string
+		Remove       string
+		WantCreated  []string
+		WantModified []string
+	}{
+		"no overlays": {},
+		"argument only": {
+			Args: []string{`io_mode=async`},
+		},
+		"modify existing block": {
+			Args:         []string{`service.http.web.listen_addr=:8080`},
+			WantModified: []string{`service.http.web`},
+		},
+		"create new blocks": {
+			Args: []string{
+				`service.http.api.listen_addr=:8081`,
+				`service.grpc.web.listen_addr=:8082`,
+				`logging.level=debug`,
+			},
+			WantCreated: []string{`service.http.api`, `service.grpc.web`, `logging`},
+		},
+		"created then modified": {
+			Args: []string{
+				`service.http.api.listen_addr=:8081`,
+				`service.http.api.replicas:=2`,
+			},
+			WantCreated: []string{`service.http.api`},
+		},
+		"wildcard": {
+			Args:         []string{`service.http.*.replicas:=2`},
+			WantModified: []string{`service.http.web`, `service.http.admin`},
+		},
+		"merged body": {
+			Args: []string{`service.http.admin.replicas:=2`},
+			Overlay: `
+service "http" "web" {
+  listen_addr = ":9090"
+}
+`,
+			WantModified: []string{`service.http.web`, `service.http.admin`},
+		},
+		"removed blocks are not included": {
+			Args:         []string{`service.http.web.replicas:=2`},
+			Remove:       `service.http.admin`,
+			WantModified: []string{`service.http.web`},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+
+service "http" "web" {
+  listen_addr = ":80"
+}
+
+service "http" "admin" {
+  listen_addr = ":81"
+}
+`), "config.hcl", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+			content, diags := f.Body.Content(schema)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			var overlays []Overlay
+			for _, raw := range test.Args {
+				o, diags := ParseCLIArgument(raw)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+			if test.Overlay != "" {
+				of, diags := hclsyntax.ParseConfig([]byte(test.Overlay), "overlay.hcl", hcl.InitialPos)
+				if diags.HasErrors() {
+					t.Fatalf("overlay has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, NewBodyOverlay(of.Body))
+			}
+			if test.Remove != "" {
+				o, diags := NewRemoveOverlay(test.Remove)
+				if diags.HasErrors() {
+					t.Fatalf("path has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			created, modified, diags := PlanOverlays(content, schema, overlays...)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.WantCreated, created); diff != "" {
+				t.Errorf("wrong created blocks\n%s", diff)
+			}
+			if diff := cmp.Diff(test.WantModified, modified); diff != "" {
+				t.Errorf("wrong modified blocks\n%s", diff)
+			}
+
+			// The given content must not be modified.
+			if got, want := len(content.Blocks), 2; got != want {
+				t.Fatalf("content now has %d blocks; want %d", got, want)
+			}
+			for _, block := range content.Blocks {
+				if _, ok := block.Body.(*applyBody); ok {
+					t.Errorf("content block %s was modified", blockPath(block))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// NewExprOverlay returns an overlay that sets the argument indicated by the
+// given path to the given expression, which is evaluated along with the
+// rest of the configuration using whatever evaluation context the caller
+// provides when decoding. This allows overriding an argument with a value
+// that depends on variables or function calls.
+//
+// The path uses the same dot-separated syntax as the part before the equals
+// sign in arguments to ParseCLIArgument, and traversal through blocks,
+// including the creation of new blocks, follows the same rules.
+//
+// The source range of the given expression is retained, so that diagnostics
+// about the argument's value can refer to wherever the expression was
+// originally defined. It is also used as the range of the resulting argument
+// if the argument was not already set; otherwise, the argument retains the
+// range of its original declaration.
+func NewExprOverlay(path string, expr hcl.Expression) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgSet,
+		expr:     expr,
+	}, diags
+}
+
+// NewTemplateOverlay returns an overlay that sets the argument indicated by
+// the given path to the result of the given string template, which uses the
+// HCL native template syntax, as in "${host}:${port}". The path is
+// interpreted in the same way as for NewExprOverlay.
+//
+// The template is parsed immediately, returning error diagnostics if it is
+// invalid, but it is evaluated only when the resulting argument is
+// evaluated, using whatever evaluation context the caller provides when
+// decoding, just like a template written directly in the configuration.
+// The references in the template therefore resolve to the variables in
+// that context, and not to other arguments in the body being overlaid
+// unless the application also makes their values available as variables.
+//
+// The resulting expression has source ranges within a synthetic filename
+// that describes the overlay, as for the ":=" form of ParseCLIArgument.
+func NewTemplateOverlay(path, template string) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	expr, exprDiags := hclsyntax.ParseTemplate([]byte(template), "overlay "+argDesc(path, ""), hcl.InitialPos)
+	diags = append(diags, exprDiags...)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	o := &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgSet,
+		expr:     expr,
+	}
+	if !strings.ContainsAny(template, "\"\\\r\n") {
+		// The same template is also valid as a quoted template in an
+		// expression, so OverlaysToJSON can serialize it that way.
+		o.exprText = `"` + template + `"`
+	}
+	return o, diags
+}
+
+// NewAppendAttributeOverlay returns an overlay that appends the value of the
+// given expression as a new element of the sequence in the argument
+// indicated by the given path, in the same way as the "+=" form of
+// ParseCLIArgument but with an arbitrary expression as the new element.
+//
+// HCL bodies describe their arguments as a map keyed by name, and so an
+// overlay can't add a second definition of an argument that is already set
+// even if the application's language treats repeated definitions as
+// accumulating a list. Instead, the resulting argument has an expression
+// that combines the argument's existing value, which must be a list, set,
+// or tuple, with the new element, producing a tuple. If the argument isn't
+// already set, or is null, then the result is a single-element tuple.
+//
+// The path is interpreted in the same way as for NewExprOverlay.
+func NewAppendAttributeOverlay(path string, expr hcl.Expression) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgAppend,
+		expr:     expr,
+	}, diags
+}
+
+// appendExpr is an hcl.Expression that appends the result of one expression
+// to the sequence produced by another expression.
+//
+// The prior expression is evaluated only when the appendExpr itself is
+// evaluated, so that its value can depend on the evaluation context given
+// by the caller in the usual way. If prior is nil or evaluates to null then
+// the result is a single-element tuple.
+type appendExpr struct {
+	fullPath string // full path of the argument, for use in error messages
+	source   string // optional description of where the argument came from
+	prior    hcl.Expression
+	elem     hcl.Expression
+}
+
+var _ hcl.Expression = (*appendExpr)(nil)
+
+func (e *appendExpr) Value(ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	elemVal, diags := e.elem.Value(ctx)
+	if e.prior == nil {
+		return cty.TupleVal([]cty.Value{elemVal}), diags
+	}
+
+	priorVal, moreDiags := e.prior.Value(ctx)
+	diags = append(diags, moreDiags...)
+	if moreDiags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+	if priorVal.IsNull() {
+		return cty.TupleVal([]cty.Value{elemVal}), diags
+	}
+	ty := priorVal.Type()
+	if !priorVal.IsKnown() || ty == cty.DynamicPseudoType {
+		// We can't check the type of a value whose type isn't known yet,
+		// such as when validating with unknown variables.
+		return cty.DynamicVal, diags
+	}
+	if !(ty.IsListType() || ty.IsSetType() || ty.IsTupleType()) {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity:    hcl.DiagError,
+			Summary:     "Invalid argument",
+			Detail:      fmt.Sprintf("Cannot append to argument %s: it is %s, not a sequence.", argDesc(e.fullPath, e.source), ty.FriendlyName()),
+			Subject:     e.prior.Range().Ptr(),
+			Expression:  e.prior,
+			EvalContext: ctx,
+		})
+		return cty.DynamicVal, diags
+	}
+
+	elems := make([]cty.Value, 0, priorVal.LengthInt()+1)
+	for it := priorVal.ElementIterator(); it.Next(); {
+		_, v := it.Element()
+		elems = append(elems, v)
+	}
+	elems = append(elems, elemVal)
+	return cty.TupleVal(elems), diags
+}
+
+func (e *appendExpr) Variables() []hcl.Traversal {
+	var ret []hcl.Traversal
+	if e.prior != nil {
+		ret = append(ret, e.prior.Variables()...)
+	}
+	return append(ret, e.elem.Variables()...)
+}
+
+func (e *appendExpr) Range() hcl.Range {
+	if e.prior != nil {
+		return e.prior.Range()
+	}
+	return e.elem.Range()
+}
+
+func (e *appendExpr) StartRange() hcl.Range {
+	if e.prior != nil {
+		return e.prior.StartRange()
+	}
+	return e.elem.StartRange()
+}
+
+// setKeyExpr is an hcl.Expression that produces an object with all of the
+// attributes of the object or map produced by another expression, except
+// that one key is set to the result of a further expression.
+//
+// If there is more than one key then each key after the first is set inside
+// the value of the key before it, which must itself be an object or a map,
+// so that a deeply-nested key can be set while leaving its siblings at each
+// level unchanged.
+//
+// As with appendExpr, the prior expression is evaluated only when the
+// setKeyExpr itself is evaluated. If prior is nil or evaluates to null then
+// the result is an object with only the first key, whose value is in turn
+// an object containing only the next key, and so on. The same applies to
+// any nested key that is absent or null in the prior value.
+type setKeyExpr struct {
+	fullPath string // full path of the argument, for use in error messages
+	source   string // optional description of where the argument came from
+	prior    hcl.Expression
+	keys     []string
+	val      hcl.Expression
+}
+
+var _ hcl.Expression = (*setKeyExpr)(nil)
+
+func (e *setKeyExpr) Value(ctx *hcl.EvalContext) (cty.Value, hcl.Diagnostics) {
+	val, diags := e.val.Value(ctx)
+	if e.prior == nil {
+		return setKeys(cty.NullVal(cty.DynamicPseudoType), e.keys, val), diags
+	}
+
+	priorVal, moreDiags := e.prior.Value(ctx)
+	diags = append(diags, moreDiags...)
+	if moreDiags.HasErrors() {
+		return cty.DynamicVal, diags
+	}
+
+	// Before we construct the result we'll make sure that each of the
+	// existing values we'll traverse through is a map or object.
+	current := priorVal
+	for i := range e.keys {
+		if current.IsNull() {
+			break
+		}
+		ty := current.Type()
+		if !current.IsKnown() || ty == cty.DynamicPseudoType {
+			// We can't check the type of a value whose type isn't known
+			// yet, such as when validating with unknown variables.
+			return cty.DynamicVal, diags
+		}
+		if !(ty.IsMapType() || ty.IsObjectType()) {
+			what := "it"
+			if i > 0 {
+				what = fmt.Sprintf("the value of key %q", e.keys[i-1])
+			}
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity:    hcl.DiagError,
+				Summary:     "Invalid argument",
+				Detail:      fmt.Sprintf("Cannot set a key in argument %s: %s is %s, not a map or object.", argDesc(e.fullPath, e.source), what, ty.FriendlyName()),
+				Subject:     e.prior.Range().Ptr(),
+				Expression:  e.prior,
+				EvalContext: ctx,
+			})
+			return cty.DynamicVal, diags
+		}
+		if i == len(e.keys)-1 {
+			break
+		}
+		current = elementOrNull(current, e.keys[i])
+	}
+
+	return setKeys(priorVal, e.keys, val), diags
+}
+
+// setKeys returns a copy of the given object or map value, or of an empty
+// object if it is null, with the value at the given sequence of nested keys
+// set to val. The given value and any nested values traversed through must
+// be known and be either null or of an object or map type.
+func setKeys(obj cty.Value, keys []string, val cty.Value) cty.Value {
+	if len(keys) == 0 {
+		return val
+	}
+	if obj.IsNull() {
+		return cty.ObjectVal(map[string]cty.Value{
+			keys[0]: setKeys(cty.NullVal(cty.DynamicPseudoType), keys[1:], val),
+		})
+	}
+
+	attrs := make(map[string]cty.Value, obj.LengthInt()+1)
+	for it := obj.ElementIterator(); it.Next(); {
+		k, v := it.Element()
+		attrs[k.AsString()] = v
+	}
+	attrs[keys[0]] = setKeys(elementOrNull(obj, keys[0]), keys[1:], val)
+	return cty.ObjectVal(attrs)
+}
+
+// elementOrNull returns the value of the given key in the given known,
+// non-null object or map value, or a null value if there is no such key.
+func elementOrNull(obj cty.Value, key string) cty.Value {
+	ty := obj.Type()
+	switch {
+	case ty.IsObjectType() && ty.HasAttribute(key):
+		return obj.GetAttr(key)
+	case ty.IsMapType() && obj.HasIndex(cty.StringVal(key)).True():
+		return obj.Index(cty.StringVal(key))
+	default:
+		return cty.NullVal(cty.DynamicPseudoType)
+	}
+}
+
+func (e *setKeyExpr) Variables() []hcl.Traversal {
+	var ret []hcl.Traversal
+	if e.prior != nil {
+		ret = append(ret, e.prior.Variables()...)
+	}
+	return append(ret, e.val.Variables()...)
+}
+
+func (e *setKeyExpr) Range() hcl.Range {
+	if e.prior != nil {
+		return e.prior.Range()
+	}
+	return e.val.Range()
+}
+
+func (e *setKeyExpr) StartRange() hcl.Range {
+	if e.prior != nil {
+		return e.prior.StartRange()
+	}
+	return e.val.StartRange()
+}
@@ -0,0 +1,331 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+func TestNewExprOverlay(t *testing.T) {
+	type Service struct {
+		Name     string `hcl:"name,label"`
+		Endpoint string `hcl:"endpoint"`
+	}
+	type Config struct {
+		Endpoint string    `hcl:"endpoint"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+endpoint = "localhost"
+
+service "a" {
+  endpoint = "localhost"
+}
+`), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	expr, diags := hclsyntax.ParseExpression([]byte(`upper(var.host)`), "override.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("expression has problems: %s", diags.Error())
+	}
+
+	var overlays []Overlay
+	for _, path := range []string{"endpoint", "service.a.endpoint", "service.b.endpoint"} {
+		o, diags := NewExprOverlay(path, expr)
+		if diags.HasErrors() {
+			t.Fatalf("path has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+	body := ApplyOverlays(f.Body, overlays...)
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"var": cty.ObjectVal(map[string]cty.Value{
+				"host": cty.StringVal("example.com"),
+			}),
+		},
+		Functions: map[string]function.Function{
+			"upper": stdlib.UpperFunc,
+		},
+	}
+	var got Config
+	diags = gohcl.DecodeBody(body, ctx, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		Endpoint: "EXAMPLE.COM",
+		Services: []Service{
+			{Name: "a", Endpoint: "EXAMPLE.COM"},
+			{Name: "b", Endpoint: "EXAMPLE.COM"},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+
+	content, diags := body.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "endpoint"}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "service", LabelNames: []string{"name"}}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := content.Attributes["endpoint"].Expr.Range(), expr.Range(); got != want {
+		t.Errorf("wrong expression range\ngot:  %#v\nwant: %#v", got, want)
+	}
+	// The attribute itself was already declared in the configuration, so
+	// it retains its original declaration range.
+	wantRange := hcl.Range{
+		Filename: "config.hcl",
+		Start:    hcl.Pos{Line: 2, Column: 1, Byte: 1},
+		End:      hcl.Pos{Line: 2, Column: 23, Byte: 23},
+	}
+	if got, want := content.Attributes["endpoint"].Range, wantRange; got != want {
+		t.Errorf("wrong attribute range\ngot:  %#v\nwant: %#v", got, want)
+	}
+	newAttrs, diags := content.Blocks[1].Body.JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := newAttrs["endpoint"].Range, expr.Range(); got != want {
+		t.Errorf("wrong range for new attribute\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
+
+func TestNewAppendAttributeOverlay(t *testing.T) {
+	type Config struct {
+		Include []string `hcl:"include,optional"`
+		Exclude []string `hcl:"exclude,optional"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+include = ["a", "b"]
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	expr, diags := hclsyntax.ParseExpression([]byte(`upper(var.name)`), "override.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("expression has problems: %s", diags.Error())
+	}
+
+	var overlays []Overlay
+	for _, path := range []string{"include", "include", "exclude"} {
+		o, diags := NewAppendAttributeOverlay(path, expr)
+		if diags.HasErrors() {
+			t.Fatalf("path has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"var": cty.ObjectVal(map[string]cty.Value{
+				"name": cty.StringVal("c"),
+			}),
+		},
+		Functions: map[string]function.Function{
+			"upper": stdlib.UpperFunc,
+		},
+	}
+	var got Config
+	diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), ctx, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		Include: []string{"a", "b", "C", "C"},
+		Exclude: []string{"C"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+}
+
+func TestAppendExprUnknown(t *testing.T) {
+	tests := map[string]struct {
+		Prior   cty.Value
+		WantErr string
+	}{
+		"dynamic": {
+			Prior: cty.DynamicVal,
+		},
+		"unknown list": {
+			Prior: cty.UnknownVal(cty.List(cty.String)),
+		},
+		"unknown string": {
+			Prior: cty.UnknownVal(cty.String),
+		},
+		"known string": {
+			Prior:   cty.StringVal("a"),
+			WantErr: `Cannot append to argument "tags": it is string, not a sequence.`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			expr := &appendExpr{
+				fullPath: "tags",
+				prior:    hcl.StaticExpr(test.Prior, hcl.Range{}),
+				elem:     hcl.StaticExpr(cty.StringVal("b"), hcl.Range{}),
+			}
+			got, diags := expr.Value(nil)
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success")
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if !got.RawEquals(cty.DynamicVal) {
+				t.Fatalf("wrong result\ngot:  %#v\nwant: %#v", got, cty.DynamicVal)
+			}
+		})
+	}
+}
+
+func TestNewTemplateOverlay(t *testing.T) {
+	type Service struct {
+		Name     string `hcl:"name,label"`
+		Endpoint string `hcl:"endpoint"`
+	}
+	type Config struct {
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+service "web" {
+  endpoint = "localhost:80"
+}
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	o, diags := NewTemplateOverlay("service.web.endpoint", "${var.host}:${var.port}")
+	if diags.HasErrors() {
+		t.Fatalf("template has problems: %s", diags.Error())
+	}
+	if got, want := fmt.Sprint(o), `service.web.endpoint:="${var.host}:${var.port}"`; got != want {
+		t.Errorf("wrong string\ngot:  %s\nwant: %s", got, want)
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"var": cty.ObjectVal(map[string]cty.Value{
+				"host": cty.StringVal("example.com"),
+				"port": cty.NumberIntVal(8080),
+			}),
+		},
+	}
+	var got Config
+	diags = gohcl.DecodeBody(ApplyOverlays(f.Body, o), ctx, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		Services: []Service{{Name: "web", Endpoint: "example.com:8080"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+
+	t.Run("invalid template", func(t *testing.T) {
+		_, diags := NewTemplateOverlay("endpoint", "${var.host")
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+		if got, want := diags[0].Subject.Filename, `overlay "endpoint"`; got != want {
+			t.Errorf("wrong filename %q; want %q", got, want)
+		}
+	})
+}
+
+func TestSetKeyExprUnknown(t *testing.T) {
+	tests := map[string]struct {
+		Prior   cty.Value
+		WantErr string
+	}{
+		"dynamic": {
+			Prior: cty.DynamicVal,
+		},
+		"unknown map": {
+			Prior: cty.UnknownVal(cty.Map(cty.String)),
+		},
+		"dynamic nested value": {
+			Prior: cty.ObjectVal(map[string]cty.Value{
+				"primary": cty.DynamicVal,
+			}),
+		},
+		"known nested string": {
+			Prior: cty.ObjectVal(map[string]cty.Value{
+				"primary": cty.StringVal("a"),
+			}),
+			WantErr: `Cannot set a key in argument "database": the value of key "primary" is string, not a map or object.`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			expr := &setKeyExpr{
+				fullPath: "database",
+				prior:    hcl.StaticExpr(test.Prior, hcl.Range{}),
+				keys:     []string{"primary", "host"},
+				val:      hcl.StaticExpr(cty.StringVal("b"), hcl.Range{}),
+			}
+			got, diags := expr.Value(nil)
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success")
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if !got.RawEquals(cty.DynamicVal) {
+				t.Fatalf("wrong result\ngot:  %#v\nwant: %#v", got, cty.DynamicVal)
+			}
+		})
+	}
+}
+
+func TestSetKeys(t *testing.T) {
+	prior := cty.ObjectVal(map[string]cty.Value{
+		"primary": cty.MapVal(map[string]cty.Value{
+			"host": cty.StringVal("a"),
+			"user": cty.StringVal("u"),
+		}),
+	})
+	got := setKeys(prior, []string{"primary", "host"}, cty.StringVal("b"))
+	want := cty.ObjectVal(map[string]cty.Value{
+		"primary": cty.ObjectVal(map[string]cty.Value{
+			"host": cty.StringVal("b"),
+			"user": cty.StringVal("u"),
+		}),
+	})
+	if !want.RawEquals(got) {
+		t.Fatalf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/spf13/pflag"
+)
+
+// BindOverlayFlags registers flags in the given flag set for overriding the
+// arguments and blocks described by the given schema, so that applications
+// that already use the pflag package can accept overrides alongside their
+// other options, with the overrides included in the flag set's usage output.
+//
+// Each attribute in the schema is registered as a flag of the same name,
+// whose value is the value to set the attribute to, as in "--io_mode=async".
+// Each block type is registered as a flag of the same name whose value is
+// the remainder of an argument as accepted by ParseCLIArgument, starting
+// with the block labels, as in "--service=http.web.listen_addr=:8080". All of
+// these flags can be used multiple times.
+//
+// BindOverlayFlags returns a function that must be called after the flag set
+// has been parsed, which returns an overlay for each use of the registered
+// flags in the order they appeared on the command line, along with any
+// diagnostics for values that could not be parsed.
+//
+// As with any other flag, registering a flag whose name is already defined
+// in the flag set causes a panic.
+func BindOverlayFlags(fs *pflag.FlagSet, schema *hcl.BodySchema) func() ([]Overlay, hcl.Diagnostics) {
+	var raws []string // full arguments to ParseCLIArgument, in command line order
+
+	for _, attrS := range schema.Attributes {
+		fs.Var(&overlayFlagValue{prefix: attrS.Name + "=", raws: &raws}, attrS.Name, fmt.Sprintf(
+			"Override the %s argument.", attrS.Name,
+		))
+	}
+	for _, blockS := range schema.Blocks {
+		placeholders := make([]string, 0, len(blockS.LabelNames)+1)
+		for _, labelName := range blockS.LabelNames {
+			placeholders = append(placeholders, strings.ToUpper(labelName))
+		}
+		placeholders = append(placeholders, "ARGUMENT=VALUE")
+		fs.Var(&overlayFlagValue{prefix: blockS.Type + ".", raws: &raws}, blockS.Type, fmt.Sprintf(
+			"Override an argument in a %s block, as `%s`.", blockS.Type, strings.Join(placeholders, "."),
+		))
+	}
+
+	return func() ([]Overlay, hcl.Diagnostics) {
+		var overlays []Overlay
+		var diags hcl.Diagnostics
+		for _, raw := range raws {
+			o, moreDiags := ParseCLIArgument(raw)
+			diags = append(diags, moreDiags...)
+			if o != nil {
+				overlays = append(overlays, o)
+			}
+		}
+		return overlays, diags
+	}
+}
+
+// ParseArgsWithOverlays is a convenience wrapper that uses ExtractCLIOptions
+// to interpret the options in the given arguments that relate to the given
+// schema and then passes the remaining arguments to the Parse method of the
+// given flag set, returning the overlays along with the positional arguments
+// that remain after both steps.
+//
+// Extracting the overlays first allows them to use the full syntax accepted
+// by ExtractCLIOptions, which pflag would otherwise reject as unknown flags.
+// If the arguments include a "--" terminator then ParseArgsWithOverlays
+// passes it on to the flag set so that neither step interprets any of the
+// arguments after it.
+//
+// If the flag set returns an error from Parse, including pflag.ErrHelp,
+// ParseArgsWithOverlays returns it as an error diagnostic. Flag sets using
+// pflag.ExitOnError instead exit the program, as usual.
+func ParseArgsWithOverlays(args []string, schema *hcl.BodySchema, fs *pflag.FlagSet) (overlays []Overlay, positionals []string, diags hcl.Diagnostics) {
+	var after []string // arguments after a "--" terminator, if any
+	for i, arg := range args {
+		if arg == "--" {
+			args, after = args[:i], args[i:]
+			break
+		}
+	}
+
+	overlays, remain, diags := ExtractCLIOptions(args, schema)
+	remain = append(remain, after...)
+	if err := fs.Parse(remain); err != nil {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid command line arguments",
+			Detail:   fmt.Sprintf("Failed to parse command line options: %s.", err),
+		})
+		return overlays, nil, diags
+	}
+	return overlays, fs.Args(), diags
+}
+
+// overlayFlagValue is the pflag.Value implementation for the flags
+// registered by BindOverlayFlags, which records each value it is given
+// as a full argument for ParseCLIArgument.
+type overlayFlagValue struct {
+	prefix string
+	raws   *[]string
+	set    []string
+}
+
+func (v *overlayFlagValue) String() string {
+	return strings.Join(v.set, ",")
+}
+
+func (v *overlayFlagValue) Set(val string) error {
+	v.set = append(v.set, val)
+	*v.raws = append(*v.raws, v.prefix+val)
+	return nil
+}
+
+func (v *overlayFlagValue) Type() string {
+	return "string"
+}
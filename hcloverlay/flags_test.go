@@ -0,0 +1,166 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/spf13/pflag"
+)
+
+func TestBindOverlayFlags(t *testing.T) {
+	type Service struct {
+		Type       string   `hcl:"type,label"`
+		Name       string   `hcl:"name,label"`
+		ListenAddr string   `hcl:"listen_addr"`
+		Tags       []string `hcl:"tags,optional"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Services []Service `hcl:"service,block"`
+	}
+	schema, _ := gohcl.ImpliedBodySchema(&Config{})
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+service "http" "web" {
+  listen_addr = ":80"
+}
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	verbose := fs.BoolP("verbose", "v", false, "")
+	collect := BindOverlayFlags(fs, schema)
+
+	err := fs.Parse([]string{
+		"--io_mode=async",
+		"-v",
+		"--service", "http.web.listen_addr=:8080",
+		"--service=http.web.tags+=a",
+		"config.hcl",
+		"--service=http.web.tags+=b",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !*verbose {
+		t.Errorf("verbose flag not set")
+	}
+	if got, want := fs.Args(), []string{"config.hcl"}; !cmp.Equal(got, want) {
+		t.Errorf("wrong remaining args\n%s", cmp.Diff(want, got))
+	}
+
+	overlays, diags := collect()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	var got Config
+	diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		IOMode: "async",
+		Services: []Service{
+			{Type: "http", Name: "web", ListenAddr: ":8080", Tags: []string{"a", "b"}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+
+	usage := fs.FlagUsages()
+	for _, want := range []string{
+		"--io_mode string",
+		"Override the io_mode argument.",
+		"--service TYPE.NAME.ARGUMENT=VALUE",
+		"Override an argument in a service block, as TYPE.NAME.ARGUMENT=VALUE.",
+	} {
+		if !strings.Contains(usage, want) {
+			t.Errorf("usage does not contain %q\n%s", want, usage)
+		}
+	}
+}
+
+func TestBindOverlayFlagsInvalid(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "service", LabelNames: []string{"name"}}},
+	}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	collect := BindOverlayFlags(fs, schema)
+
+	if err := fs.Parse([]string{"--service=web.listen_addr"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	_, diags := collect()
+	if !diags.HasErrors() {
+		t.Fatalf("unexpected success")
+	}
+	if got, want := diags.Error(), "service.web.listen_addr"; !strings.Contains(got, want) {
+		t.Fatalf("wrong error\ngot: %s\nshould contain: %s", got, want)
+	}
+}
+
+func TestParseArgsWithOverlays(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "io_mode"}},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "service", LabelNames: []string{"type", "name"}},
+		},
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		verbose := fs.BoolP("verbose", "v", false, "")
+
+		overlays, positionals, diags := ParseArgsWithOverlays([]string{
+			"--io_mode=async",
+			"-v",
+			"--service.http.web.tags+=a",
+			"config.hcl",
+			"--",
+			"--io_mode=sync",
+			"-v",
+		}, schema, fs)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if !*verbose {
+			t.Errorf("verbose flag not set")
+		}
+		if got, want := len(overlays), 2; got != want {
+			t.Errorf("wrong number of overlays %d; want %d", got, want)
+		}
+		want := []string{"config.hcl", "--io_mode=sync", "-v"}
+		if diff := cmp.Diff(want, positionals); diff != "" {
+			t.Errorf("wrong positional arguments\n%s", diff)
+		}
+	})
+	t.Run("unknown flag", func(t *testing.T) {
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		fs.SetOutput(new(strings.Builder))
+
+		overlays, positionals, diags := ParseArgsWithOverlays([]string{
+			"--io_mode=async",
+			"--nonexist",
+		}, schema, fs)
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+		if got, want := diags.Error(), "unknown flag: --nonexist"; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+		if got, want := len(overlays), 1; got != want {
+			t.Errorf("wrong number of overlays %d; want %d", got, want)
+		}
+		if positionals != nil {
+			t.Errorf("unexpected positional arguments %#v", positionals)
+		}
+	})
+}
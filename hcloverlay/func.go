@@ -0,0 +1,64 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// NewFuncOverlay returns an overlay whose behavior is defined entirely by the
+// given function, which has the same signature and contract as the
+// ApplyOverlay method of the Overlay interface.
+//
+// This is a convenient way to implement a custom overlay without
+// implementing all of the methods of the Overlay interface. The other
+// methods are derived from the given function as follows:
+//
+//     - PartialApplyOverlay calls the function in the same way as
+//       ApplyOverlay, and always reports that the overlay was fully applied.
+//
+//     - ApplyJustAttributes calls the function with a synthetic content
+//       object containing only the given attributes, along with a schema
+//       that declares all of those attributes as optional and no block
+//       types. It is an error for the function to add blocks in that case.
+func NewFuncOverlay(fn func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics)) Overlay {
+	return funcOverlay(fn)
+}
+
+type funcOverlay func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics)
+
+func (o funcOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	return o(content, schema)
+}
+
+func (o funcOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	content, diags := o(content, schema)
+	return content, nil, diags
+}
+
+func (o funcOverlay) ApplyJustAttributes(attrs hcl.Attributes) (hcl.Attributes, hcl.Diagnostics) {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	schema := &hcl.BodySchema{
+		Attributes: make([]hcl.AttributeSchema, len(names)),
+	}
+	for i, name := range names {
+		schema.Attributes[i].Name = name
+	}
+
+	content, diags := o(&hcl.BodyContent{Attributes: attrs}, schema)
+	content = ensureContent(content) // as in applyBody.Content
+	for _, block := range content.Blocks {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Unexpected block",
+			Detail:   fmt.Sprintf("An overlay tried to add a block of type %q where only arguments are expected.", block.Type),
+		})
+	}
+	return content.Attributes, diags
+}
@@ -0,0 +1,118 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNewFuncOverlay(t *testing.T) {
+	// This overlay sets "greeting" to "hello" if the schema calls for it.
+	o := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		for _, attrS := range schema.Attributes {
+			if attrS.Name == "greeting" {
+				content.Attributes["greeting"] = &hcl.Attribute{
+					Name: "greeting",
+					Expr: hcl.StaticExpr(cty.StringVal("hello"), hcl.Range{}),
+				}
+			}
+		}
+		return content, nil
+	})
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+greeting = "hi"
+name     = "world"
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	body := ApplyOverlays(f.Body, o)
+
+	t.Run("Content", func(t *testing.T) {
+		type Config struct {
+			Greeting string `hcl:"greeting"`
+			Name     string `hcl:"name"`
+		}
+		var got Config
+		diags := gohcl.DecodeBody(body, nil, &got)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		want := Config{Greeting: "hello", Name: "world"}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("incorrect result\n%s", diff)
+		}
+	})
+	t.Run("PartialContent", func(t *testing.T) {
+		content, remain, diags := body.PartialContent(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "greeting"}},
+		})
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		v, _ := content.Attributes["greeting"].Expr.Value(nil)
+		if !v.RawEquals(cty.StringVal("hello")) {
+			t.Errorf("wrong greeting %#v", v)
+		}
+		if _, isApply := remain.(*applyBody); isApply {
+			t.Errorf("overlay was retained in the remaining body")
+		}
+	})
+	t.Run("JustAttributes", func(t *testing.T) {
+		attrs, diags := body.JustAttributes()
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		v, _ := attrs["greeting"].Expr.Value(nil)
+		if !v.RawEquals(cty.StringVal("hello")) {
+			t.Errorf("wrong greeting %#v", v)
+		}
+		if _, exists := attrs["name"]; !exists {
+			t.Errorf("name is missing")
+		}
+	})
+}
+
+func TestNewFuncOverlayJustAttributesBlock(t *testing.T) {
+	o := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		content.Blocks = append(content.Blocks, &hcl.Block{
+			Type: "nope",
+			Body: hcl.EmptyBody(),
+		})
+		return content, nil
+	})
+
+	_, diags := ApplyOverlays(hcl.EmptyBody(), o).JustAttributes()
+	if !diags.HasErrors() {
+		t.Fatalf("unexpected success")
+	}
+	if got, want := diags.Error(), `An overlay tried to add a block of type "nope" where only arguments are expected.`; !strings.Contains(got, want) {
+		t.Fatalf("wrong error\ngot: %s\nshould contain: %s", got, want)
+	}
+}
+
+func TestNewFuncOverlayJustAttributesNil(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+greeting = "hi"
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	o := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		return nil, nil
+	})
+
+	attrs, diags := ApplyOverlays(f.Body, o).JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if len(attrs) != 0 {
+		t.Errorf("wrong number of attributes %d; want 0", len(attrs))
+	}
+}
@@ -0,0 +1,68 @@
+package hcloverlaytest
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/apparentlymart/go-hcl-overlay/hcloverlay"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// configFilename is the filename used for the configuration source given to
+// the assertion functions, as reported in diagnostics.
+const configFilename = "config.hcl"
+
+// AssertOverlayResult parses the given HCL native syntax configuration,
+// applies the given overlays to its body, and then decodes the result using
+// gohcl into a new value of the same type that the given want pointer points
+// to. The test fails if any of those steps produce errors, or if the decoded
+// value is not equal to the value that want points to.
+//
+// Diagnostics are reported in the test log along with the relevant portions
+// of the given configuration, and differences between the decoded value and
+// the wanted value are reported as a diff.
+func AssertOverlayResult(t testing.TB, configHCL string, overlays []hcloverlay.Overlay, want interface{}) {
+	t.Helper()
+
+	wantVal := reflect.ValueOf(want)
+	if wantVal.Kind() != reflect.Ptr || wantVal.IsNil() {
+		t.Fatalf("want must be a non-nil pointer, not %T", want)
+		return
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(configHCL), configFilename, hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("configuration has problems:\n%s", formatDiagnostics(diags, f))
+		return
+	}
+
+	body := hcloverlay.ApplyOverlays(f.Body, overlays...)
+	got := reflect.New(wantVal.Type().Elem()).Interface()
+	diags = gohcl.DecodeBody(body, nil, got)
+	if diags.HasErrors() {
+		t.Fatalf("failed to decode overlaid configuration:\n%s", formatDiagnostics(diags, f))
+		return
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("incorrect result\n%s", diff)
+	}
+}
+
+// formatDiagnostics renders the given diagnostics as text, including source
+// snippets from the given file where available. The file may be nil if the
+// configuration could not be parsed at all.
+func formatDiagnostics(diags hcl.Diagnostics, f *hcl.File) string {
+	files := map[string]*hcl.File{}
+	if f != nil {
+		files[configFilename] = f
+	}
+	var buf strings.Builder
+	wr := hcl.NewDiagnosticTextWriter(&buf, files, 78, false)
+	wr.WriteDiagnostics(diags)
+	return buf.String()
+}
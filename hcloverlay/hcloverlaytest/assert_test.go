@@ -0,0 +1,113 @@
+package hcloverlaytest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/apparentlymart/go-hcl-overlay/hcloverlay"
+)
+
+func TestAssertOverlayResult(t *testing.T) {
+	type Config struct {
+		IOMode string `hcl:"io_mode"`
+	}
+	overlay := func(raw string) hcloverlay.Overlay {
+		o, diags := hcloverlay.ParseCLIArgument(raw)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+
+	tests := map[string]struct {
+		Config   string
+		Overlays []hcloverlay.Overlay
+		Want     interface{}
+		WantFail string
+	}{
+		"success": {
+			`io_mode = "sync"`,
+			[]hcloverlay.Overlay{overlay("io_mode=async")},
+			&Config{IOMode: "async"},
+			``,
+		},
+		"no overlays": {
+			`io_mode = "sync"`,
+			nil,
+			&Config{IOMode: "sync"},
+			``,
+		},
+		"wrong result": {
+			`io_mode = "sync"`,
+			[]hcloverlay.Overlay{overlay("io_mode=async")},
+			&Config{IOMode: "sync"},
+			`incorrect result`,
+		},
+		"invalid configuration": {
+			`io_mode = `,
+			nil,
+			&Config{},
+			`configuration has problems:`,
+		},
+		"decode error": {
+			`io_mode = "sync"`,
+			[]hcloverlay.Overlay{overlay("nope=async")},
+			&Config{},
+			`Unexpected argument "nope".`,
+		},
+		"decode error with source snippet": {
+			`io_mode = ["sync"]`,
+			nil,
+			&Config{},
+			`on config.hcl line 1:`,
+		},
+		"want not a pointer": {
+			`io_mode = "sync"`,
+			nil,
+			Config{},
+			`want must be a non-nil pointer`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := &recordingT{TB: t}
+			AssertOverlayResult(rec, test.Config, test.Overlays, test.Want)
+
+			if test.WantFail == "" {
+				if rec.failed {
+					t.Fatalf("unexpected failure:\n%s", rec.log.String())
+				}
+				return
+			}
+			if !rec.failed {
+				t.Fatalf("unexpected success\nwant failure: %s", test.WantFail)
+			}
+			if got := rec.log.String(); !strings.Contains(got, test.WantFail) {
+				t.Fatalf("wrong failure\ngot: %s\nshould contain: %s", got, test.WantFail)
+			}
+		})
+	}
+}
+
+// recordingT is a testing.TB that records failures instead of reporting
+// them, so that we can test the behavior of the assertion functions.
+type recordingT struct {
+	testing.TB
+	failed bool
+	log    strings.Builder
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.failed = true
+	fmt.Fprintf(&t.log, format, args...)
+}
+
+func (t *recordingT) Fatalf(format string, args ...interface{}) {
+	// The real Fatalf would stop the test goroutine, but the assertion
+	// functions always return immediately after calling it anyway.
+	t.Errorf(format, args...)
+}
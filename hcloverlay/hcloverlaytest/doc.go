@@ -0,0 +1,3 @@
+// Package hcloverlaytest contains helpers for testing overlays, including
+// custom overlay implementations outside of package hcloverlay.
+package hcloverlaytest
@@ -0,0 +1,247 @@
+package hcloverlay
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// OverlaysToJSON serializes the given overlays as JSON, so that they can be
+// stored or sent elsewhere and later reconstructed using OverlaysFromJSON.
+//
+// The result is a JSON array with one object for each overlay, in the order
+// the overlays would be applied. Each object has the following properties:
+//
+//     - "path" is the path of the overlay, in the syntax accepted by
+//       ParseCLIArgument.
+//
+//     - "op" is one of "set", "append", "default", "remove", "remove_type",
+//       "reset", or "create", describing what the overlay does with the
+//       argument or block at that path.
+//
+//     - For the "set", "append", and "default" operations, either "expr" is
+//       an expression in HCL native syntax, or "value" is a JSON value and
+//       "type" is its type, in the JSON type syntax of the cty package.
+//
+//     - "source", "priority", and "no_create" are present only if the
+//       overlay has a source from WithSource, a priority from WithPriority,
+//       or was created with ParseOptions.NoCreate, respectively.
+//
+// Only the following overlays can be serialized: those returned by
+// ParseCLIArgument and its variants, NewCLIArgumentOverlay, the
+// FileArgumentParser, ExtractCLIOptions, ExtractEnvOptions,
+// ParseOverlayLines, NewMapOverlay, NewExprOverlay, NewAppendAttributeOverlay,
+// NewTemplateOverlay, NewDefaultOverlay, NewRemoveOverlay,
+// NewRemoveBlockTypeOverlay, NewResetOverlay, and NewCreateBlockOverlay,
+// along with overlays produced from them by MergeOverlays, WithPriority, or
+// WithSource. Other overlays, including those returned by NewRenameOverlay,
+// NewRemovePrefixOverlay, NewLabelPredicateOverlay, NewConditionalOverlay,
+// NewRecordingOverlay, and NewOnceOverlay, can't be serialized even though
+// some of them also take paths.
+//
+// An overlay that sets a value must have a value that is known without an
+// evaluation context, unless its expression was given as source text, as
+// with the ":=" form of ParseCLIArgument or with NewTemplateOverlay, in
+// which case that text is serialized as it was given.
+// OverlaysToJSON returns an error if any of the overlays can't be
+// serialized.
+func OverlaysToJSON(overlays []Overlay) ([]byte, error) {
+	ret := make([]jsonOverlay, 0, len(overlays))
+	var err error
+	for _, ov := range overlays {
+		ret, err = appendJSONOverlays(ret, ov, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(ret)
+}
+
+// OverlaysFromJSON reconstructs overlays from JSON produced by
+// OverlaysToJSON, returning error diagnostics if the JSON is not valid.
+//
+// The expressions of reconstructed overlays have source ranges whose
+// filename describes the overlay, as for the ":=" form of ParseCLIArgument
+// without a filename. Values given in the "value" property have no source
+// ranges.
+func OverlaysFromJSON(src []byte) ([]Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var raws []jsonOverlay
+	if err := json.Unmarshal(src, &raws); err != nil {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid overlays JSON",
+			Detail:   fmt.Sprintf("Failed to decode overlays: %s.", err),
+		})
+		return nil, diags
+	}
+
+	ret := make([]Overlay, 0, len(raws))
+	for i, raw := range raws {
+		o, moreDiags := raw.overlay(i)
+		diags = append(diags, moreDiags...)
+		if o != nil {
+			ret = append(ret, o)
+		}
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return ret, diags
+}
+
+// jsonOverlay is the JSON representation of a single overlay, as produced by
+// OverlaysToJSON.
+type jsonOverlay struct {
+	Path     string          `json:"path"`
+	Op       string          `json:"op"`
+	Expr     string          `json:"expr,omitempty"`
+	Value    json.RawMessage `json:"value,omitempty"`
+	Type     json.RawMessage `json:"type,omitempty"`
+	Source   string          `json:"source,omitempty"`
+	Priority int             `json:"priority,omitempty"`
+	NoCreate bool            `json:"no_create,omitempty"`
+}
+
+var jsonOverlayOps = map[cliArgOp]string{
+	cliArgSet:        "set",
+	cliArgAppend:     "append",
+	cliArgDefault:    "default",
+	cliArgRemove:     "remove",
+	cliArgRemoveType: "remove_type",
+	cliArgReset:      "reset",
+	cliArgCreate:     "create",
+}
+
+func appendJSONOverlays(ret []jsonOverlay, ov Overlay, priority int) ([]jsonOverlay, error) {
+	switch ov := ov.(type) {
+	case nil:
+		return ret, nil // ignored, as for ApplyOverlays
+	case *mergedOverlay:
+		var err error
+		for _, ov := range ov.overlays {
+			ret, err = appendJSONOverlays(ret, ov, priority)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return ret, nil
+	case *priorityOverlay:
+		return appendJSONOverlays(ret, ov.Overlay, ov.priority)
+	case *cliArgOverlay:
+		path := formatCLIPath(ov.steps)
+		raw := jsonOverlay{
+			Path:     path,
+			Op:       jsonOverlayOps[ov.op],
+			Source:   ov.source,
+			Priority: priority,
+			NoCreate: ov.noCreate,
+		}
+		switch ov.op {
+		case cliArgRemove, cliArgRemoveType, cliArgReset, cliArgCreate:
+			return append(ret, raw), nil
+		}
+		if ov.exprText != "" {
+			raw.Expr = ov.exprText
+			return append(ret, raw), nil
+		}
+		v := knownValue(ov.expr)
+		if v == cty.NilVal {
+			return nil, fmt.Errorf("overlay for %q cannot be encoded as JSON: its value depends on an expression", path)
+		}
+		var err error
+		raw.Value, err = ctyjson.Marshal(v, v.Type())
+		if err != nil {
+			return nil, fmt.Errorf("overlay for %q cannot be encoded as JSON: %s", path, err)
+		}
+		raw.Type, err = ctyjson.MarshalType(v.Type())
+		if err != nil {
+			return nil, fmt.Errorf("overlay for %q cannot be encoded as JSON: %s", path, err)
+		}
+		return append(ret, raw), nil
+	default:
+		return nil, fmt.Errorf("overlay of type %T cannot be encoded as JSON", ov)
+	}
+}
+
+// overlay returns the overlay described by the receiver, which is at the
+// given index in the JSON array, or error diagnostics if it is invalid.
+func (raw *jsonOverlay) overlay(idx int) (Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	invalid := func(format string, args ...interface{}) hcl.Diagnostics {
+		return diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid overlays JSON",
+			Detail:   fmt.Sprintf("Invalid overlay at index %d: %s.", idx, fmt.Sprintf(format, args...)),
+		})
+	}
+
+	steps, diags := parseCLIPath(raw.Path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	o := &cliArgOverlay{
+		fullPath: raw.Path,
+		steps:    steps,
+		source:   raw.Source,
+		noCreate: raw.NoCreate,
+	}
+	for op, name := range jsonOverlayOps {
+		if name == raw.Op {
+			o.op = op
+		}
+	}
+
+	hasValue := raw.Expr != "" || len(raw.Value) != 0
+	switch o.op {
+	case 0:
+		return nil, invalid("unsupported operation %q", raw.Op)
+	case cliArgRemove, cliArgRemoveType, cliArgReset, cliArgCreate:
+		if hasValue {
+			return nil, invalid("the %q operation does not accept a value", raw.Op)
+		}
+	default:
+		switch {
+		case raw.Expr != "" && len(raw.Value) != 0:
+			return nil, invalid("must have either \"expr\" or \"value\", not both")
+		case raw.Expr != "":
+			// As in parseCLIArgument, a heredoc's closing marker must be
+			// followed by a newline that the text might not include.
+			expr, exprDiags := hclsyntax.ParseExpression([]byte(raw.Expr+"\n"), "overlay "+argDesc(raw.Path, raw.Source), hcl.InitialPos)
+			for _, exprDiag := range exprDiags {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: exprDiag.Severity,
+					Summary:  "Invalid overlays JSON",
+					Detail:   fmt.Sprintf("Invalid expression for overlay at index %d: %s", idx, exprDiag.Detail),
+					Subject:  exprDiag.Subject,
+				})
+			}
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			o.expr = expr
+			o.exprText = raw.Expr
+		case len(raw.Value) != 0:
+			ty, err := ctyjson.UnmarshalType(raw.Type)
+			if err != nil {
+				return nil, invalid("invalid type: %s", err)
+			}
+			v, err := ctyjson.Unmarshal(raw.Value, ty)
+			if err != nil {
+				return nil, invalid("invalid value: %s", err)
+			}
+			o.expr = hcl.StaticExpr(v, hcl.Range{})
+		default:
+			return nil, invalid("the %q operation requires either \"expr\" or \"value\"", raw.Op)
+		}
+	}
+
+	if raw.Priority != 0 {
+		return WithPriority(o, raw.Priority), diags
+	}
+	return o, diags
+}
@@ -0,0 +1,283 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestOverlaysJSON(t *testing.T) {
+	type Service struct {
+		Type       string   `hcl:"type,label"`
+		Name       string   `hcl:"name,label"`
+		ListenAddr string   `hcl:"listen_addr"`
+		Tags       []string `hcl:"tags,optional"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Count    int       `hcl:"count,optional"`
+		LogLevel *string   `hcl:"log_level,optional"`
+		Ports    []int     `hcl:"ports,optional"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode   = "sync"
+log_level = "info"
+
+service "http" "web" {
+  listen_addr = ":80"
+  tags        = ["a"]
+}
+service "http" "old" {
+  listen_addr = ":81"
+}
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	var overlays []Overlay
+	for _, arg := range []string{
+		`io_mode=async`,
+		`ports:=[for p in [1, 2] : p * 80]`,
+		`service.http.web.tags+=b`,
+		`service."http".new.listen_addr=:82`,
+	} {
+		o, diags := ParseCLIArgument(arg)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+	def, diags := NewDefaultOverlay(`count`, `3`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	remove, diags := NewRemoveOverlay(`service.http.old`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	null, diags := ParseCLIArgumentNull(`log_level`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	overlays = append(overlays,
+		WithPriority(WithSource(def, "defaults file"), 2),
+		MergeOverlays(remove, null),
+		nil,
+	)
+
+	src, err := OverlaysToJSON(overlays)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	decoded, diags := OverlaysFromJSON(src)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s\n%s", diags.Error(), src)
+	}
+	if got, want := len(decoded), 7; got != want {
+		t.Fatalf("wrong number of decoded overlays %d; want %d\n%s", got, want, src)
+	}
+	if got, want := overlayPriority(decoded[4]), 2; got != want {
+		t.Errorf("wrong priority %d; want %d", got, want)
+	}
+
+	var want, got Config
+	diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, &want)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems with original overlays: %s", diags.Error())
+	}
+	diags = gohcl.DecodeBody(ApplyOverlays(f.Body, decoded...), nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems with decoded overlays: %s", diags.Error())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("decoded overlays have different effect\n%s", diff)
+	}
+
+	// Encoding the decoded overlays again should produce the same result.
+	again, err := OverlaysToJSON(decoded)
+	if err != nil {
+		t.Fatalf("unexpected error encoding again: %s", err)
+	}
+	if diff := cmp.Diff(string(src), string(again)); diff != "" {
+		t.Errorf("second encoding differs\n%s", diff)
+	}
+}
+
+func TestOverlaysJSONHeredoc(t *testing.T) {
+	o, diags := ParseCLIArgument("motd:=<<EOT\nWelcome!\nEOT")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	src, err := OverlaysToJSON([]Overlay{o})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	decoded, diags := OverlaysFromJSON(src)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s\n%s", diags.Error(), src)
+	}
+
+	attrs, diags := ApplyOverlays(hcl.EmptyBody(), decoded...).JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := attrStringValue(t, attrs["motd"]), "Welcome!\n"; got != want {
+		t.Errorf("wrong value %q; want %q", got, want)
+	}
+}
+
+func TestOverlaysToJSON(t *testing.T) {
+	o, diags := ParseCLIArgument(`io_mode=async`)
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	remove, diags := NewRemoveBlockTypeOverlay(`service`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+
+	got, err := OverlaysToJSON([]Overlay{WithSource(o, "command line"), remove})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := `[{"path":"io_mode","op":"set","value":"async","type":"string","source":"command line"},{"path":"service","op":"remove_type"}]`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Fatalf("wrong result\n%s", diff)
+	}
+}
+
+func TestOverlaysToJSONInvalid(t *testing.T) {
+	expr, diags := hclsyntax.ParseExpression([]byte(`var.host`), "override.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("expression has problems: %s", diags.Error())
+	}
+	exprOverlay, diags := NewExprOverlay(`endpoint`, expr)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	fn := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		return content, nil
+	})
+	rename, diags := NewRenameOverlay(`mode`, `io_mode`, false)
+	if diags.HasErrors() {
+		t.Fatalf("names have problems: %s", diags.Error())
+	}
+
+	tests := map[string]struct {
+		Overlay Overlay
+		WantErr string
+	}{
+		"rename": {
+			rename,
+			`overlay of type *hcloverlay.renameOverlay cannot be encoded as JSON`,
+		},
+		"expression": {
+			exprOverlay,
+			`overlay for "endpoint" cannot be encoded as JSON: its value depends on an expression`,
+		},
+		"function": {
+			fn,
+			`overlay of type hcloverlay.funcOverlay cannot be encoded as JSON`,
+		},
+		"nested function": {
+			MergeOverlays(exprOverlay, WithPriority(fn, 1)),
+			`overlay for "endpoint" cannot be encoded as JSON`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := OverlaysToJSON([]Overlay{test.Overlay})
+			if err == nil {
+				t.Fatalf("unexpected success")
+			}
+			if got := err.Error(); !strings.Contains(got, test.WantErr) {
+				t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, test.WantErr)
+			}
+		})
+	}
+}
+
+func TestOverlaysFromJSON(t *testing.T) {
+	t.Run("value", func(t *testing.T) {
+		overlays, diags := OverlaysFromJSON([]byte(`[{"path":"ports","op":"set","value":[80,443],"type":["list","number"]}]`))
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		attrs, diags := ApplyOverlays(hcl.EmptyBody(), overlays...).JustAttributes()
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		got, diags := attrs["ports"].Expr.Value(nil)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		want := cty.ListVal([]cty.Value{cty.NumberIntVal(80), cty.NumberIntVal(443)})
+		if !got.RawEquals(want) {
+			t.Fatalf("wrong value\ngot:  %#v\nwant: %#v", got, want)
+		}
+	})
+
+	tests := map[string]struct {
+		Src     string
+		WantErr string
+	}{
+		"not JSON": {
+			`{`,
+			`Failed to decode overlays`,
+		},
+		"not an array": {
+			`{"path":"a","op":"remove"}`,
+			`Failed to decode overlays`,
+		},
+		"unsupported operation": {
+			`[{"path":"a","op":"frob"}]`,
+			`Invalid overlay at index 0: unsupported operation "frob".`,
+		},
+		"invalid path": {
+			`[{"path":"a..b","op":"remove"}]`,
+			`Invalid argument`,
+		},
+		"missing value": {
+			`[{"path":"a","op":"set"}]`,
+			`Invalid overlay at index 0: the "set" operation requires either "expr" or "value".`,
+		},
+		"unexpected value": {
+			`[{"path":"a","op":"remove","value":1,"type":"number"}]`,
+			`Invalid overlay at index 0: the "remove" operation does not accept a value.`,
+		},
+		"both expr and value": {
+			`[{"path":"a","op":"set","expr":"1","value":1,"type":"number"}]`,
+			`Invalid overlay at index 0: must have either "expr" or "value", not both.`,
+		},
+		"invalid expression": {
+			`[{"path":"a","op":"remove"},{"path":"b","op":"set","expr":"[1,"}]`,
+			`Invalid expression for overlay at index 1`,
+		},
+		"value of wrong type": {
+			`[{"path":"a","op":"set","value":"x","type":"number"}]`,
+			`Invalid overlay at index 0: invalid value`,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			overlays, diags := OverlaysFromJSON([]byte(test.Src))
+			if !diags.HasErrors() {
+				t.Fatalf("unexpected success")
+			}
+			if overlays != nil {
+				t.Errorf("unexpected overlays %#v", overlays)
+			}
+			if got := diags.Error(); !strings.Contains(got, test.WantErr) {
+				t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, test.WantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// The tests in this file check that overlays behave identically whether the
+// base configuration is written in native syntax or in JSON syntax.
+
+type jsonTestService struct {
+	Type       string            `hcl:"type,label"`
+	Name       string            `hcl:"name,label"`
+	ListenAddr string            `hcl:"listen_addr"`
+	Tags       []string          `hcl:"tags,optional"`
+	Labels     map[string]string `hcl:"labels,optional"`
+}
+
+type jsonTestConfig struct {
+	IOMode   string            `hcl:"io_mode"`
+	Count    int               `hcl:"count,optional"`
+	Tags     []string          `hcl:"tags,optional"`
+	Labels   map[string]string `hcl:"labels,optional"`
+	Services []jsonTestService `hcl:"service,block"`
+}
+
+func TestApplyOverlaysJSON(t *testing.T) {
+	tests := map[string]struct {
+		Native string
+		JSON   string
+		Args   []string
+		Want   *jsonTestConfig
+	}{
+		"override root attribute": {
+			`io_mode = "sync"`,
+			`{"io_mode": "sync"}`,
+			[]string{`io_mode=async`},
+			&jsonTestConfig{IOMode: "async"},
+		},
+		"set required attribute": {
+			``,
+			`{}`,
+			[]string{`io_mode=async`},
+			&jsonTestConfig{IOMode: "async"},
+		},
+		"expression": {
+			`io_mode = "sync"`,
+			`{"io_mode": "sync"}`,
+			[]string{`count:=2`},
+			&jsonTestConfig{IOMode: "sync", Count: 2},
+		},
+		"append": {
+			`
+			io_mode = "sync"
+			tags = ["a"]
+			`,
+			`{"io_mode": "sync", "tags": ["a"]}`,
+			[]string{`tags+=b`},
+			&jsonTestConfig{IOMode: "sync", Tags: []string{"a", "b"}},
+		},
+		"map key": {
+			`
+			io_mode = "sync"
+			labels = { team = "a" }
+			`,
+			`{"io_mode": "sync", "labels": {"team": "a"}}`,
+			[]string{`labels.env=prod`},
+			&jsonTestConfig{IOMode: "sync", Labels: map[string]string{"env": "prod", "team": "a"}},
+		},
+		"override in existing block": {
+			`
+			io_mode = "sync"
+			service "http" "web" {
+			  listen_addr = ":80"
+			  tags = ["a"]
+			  labels = { team = "a" }
+			}
+			`,
+			`{
+				"io_mode": "sync",
+				"service": {
+					"http": {
+						"web": {
+							"listen_addr": ":80",
+							"tags": ["a"],
+							"labels": {"team": "a"}
+						}
+					}
+				}
+			}`,
+			[]string{
+				`service.http.web.listen_addr=:8080`,
+				`service.http.web.tags+=b`,
+				`service.http.web.labels.env=prod`,
+			},
+			&jsonTestConfig{
+				IOMode: "sync",
+				Services: []jsonTestService{
+					{
+						Type:       "http",
+						Name:       "web",
+						ListenAddr: ":8080",
+						Tags:       []string{"a", "b"},
+						Labels:     map[string]string{"env": "prod", "team": "a"},
+					},
+				},
+			},
+		},
+		"create block": {
+			`
+			io_mode = "sync"
+			service "http" "web" {
+			  listen_addr = ":80"
+			}
+			`,
+			`{
+				"io_mode": "sync",
+				"service": {"http": {"web": {"listen_addr": ":80"}}}
+			}`,
+			[]string{`service.http.api.listen_addr=:81`},
+			&jsonTestConfig{
+				IOMode: "sync",
+				Services: []jsonTestService{
+					{Type: "http", Name: "web", ListenAddr: ":80"},
+					{Type: "http", Name: "api", ListenAddr: ":81"},
+				},
+			},
+		},
+		"remove block": {
+			`
+			io_mode = "sync"
+			service "http" "web" {
+			  listen_addr = ":80"
+			}
+			service "http" "api" {
+			  listen_addr = ":81"
+			}
+			`,
+			`{
+				"io_mode": "sync",
+				"service": {"http": [
+					{"web": {"listen_addr": ":80"}},
+					{"api": {"listen_addr": ":81"}}
+				]}
+			}`,
+			[]string{`-service.http.web`},
+			&jsonTestConfig{
+				IOMode: "sync",
+				Services: []jsonTestService{
+					{Type: "http", Name: "api", ListenAddr: ":81"},
+				},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				var o Overlay
+				var diags hcl.Diagnostics
+				if arg[0] == '-' {
+					o, diags = NewRemoveOverlay(arg[1:])
+				} else {
+					o, diags = ParseCLIArgument(arg)
+				}
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			for _, body := range jsonTestBodies(t, test.Native, test.JSON) {
+				got := &jsonTestConfig{}
+				diags := gohcl.DecodeBody(ApplyOverlays(body.Body, overlays...), nil, got)
+				if diags.HasErrors() {
+					t.Fatalf("unexpected problems with %s: %s", body.Syntax, diags.Error())
+				}
+				if diff := cmp.Diff(test.Want, got); diff != "" {
+					t.Errorf("incorrect result with %s\n%s", body.Syntax, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyOverlaysJSONJustAttributes(t *testing.T) {
+	overlays := make([]Overlay, 0, 3)
+	for _, arg := range []string{`io_mode=async`, `tags+=b`, `labels.env=prod`} {
+		o, diags := ParseCLIArgument(arg)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+	want := map[string]cty.Value{
+		"io_mode": cty.StringVal("async"),
+		"tags":    cty.TupleVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+		"labels": cty.ObjectVal(map[string]cty.Value{
+			"env":  cty.StringVal("prod"),
+			"team": cty.StringVal("a"),
+		}),
+	}
+
+	bodies := jsonTestBodies(t,
+		`
+		io_mode = "sync"
+		tags = ["a"]
+		labels = { team = "a" }
+		`,
+		`{"io_mode": "sync", "tags": ["a"], "labels": {"team": "a"}}`,
+	)
+	for _, body := range bodies {
+		attrs, diags := ApplyOverlays(body.Body, overlays...).JustAttributes()
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems with %s: %s", body.Syntax, diags.Error())
+		}
+		got := make(map[string]cty.Value, len(attrs))
+		for name, attr := range attrs {
+			v, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems with %s: %s", body.Syntax, diags.Error())
+			}
+			got[name] = v
+		}
+		for name, wantV := range want {
+			if !wantV.RawEquals(got[name]) {
+				t.Errorf("wrong value for %s with %s\ngot:  %#v\nwant: %#v", name, body.Syntax, got[name], wantV)
+			}
+		}
+		if len(got) != len(want) {
+			t.Errorf("wrong number of attributes with %s: got %d, want %d", body.Syntax, len(got), len(want))
+		}
+	}
+}
+
+func TestApplyOverlaysJSONDecoderSpec(t *testing.T) {
+	spec := hcldec.ObjectSpec{
+		"io_mode": &hcldec.AttrSpec{Name: "io_mode", Type: cty.String, Required: true},
+		"count":   &hcldec.AttrSpec{Name: "count", Type: cty.Number},
+		"services": &hcldec.BlockMapSpec{
+			TypeName:   "service",
+			LabelNames: []string{"type", "name"},
+			Nested: hcldec.ObjectSpec{
+				"listen_addr": &hcldec.AttrSpec{Name: "listen_addr", Type: cty.String},
+			},
+		},
+	}
+	overlays := make([]Overlay, 0, 3)
+	for _, arg := range []string{`io_mode=async`, `count:=3`, `service.http.web.listen_addr=:8080`} {
+		o, diags := ParseCLIArgument(arg)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+	want := cty.ObjectVal(map[string]cty.Value{
+		"io_mode": cty.StringVal("async"),
+		"count":   cty.NumberIntVal(3),
+		"services": cty.MapVal(map[string]cty.Value{
+			"http": cty.MapVal(map[string]cty.Value{
+				"web": cty.ObjectVal(map[string]cty.Value{
+					"listen_addr": cty.StringVal(":8080"),
+				}),
+			}),
+		}),
+	})
+
+	bodies := jsonTestBodies(t,
+		`
+		service "http" "web" {
+		  listen_addr = ":80"
+		}
+		`,
+		`{"service": {"http": {"web": {"listen_addr": ":80"}}}}`,
+	)
+	for _, body := range bodies {
+		got, diags := hcldec.Decode(ApplyOverlays(body.Body, overlays...), spec, nil)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems with %s: %s", body.Syntax, diags.Error())
+		}
+		if !want.RawEquals(got) {
+			t.Errorf("wrong result with %s\ngot:  %#v\nwant: %#v", body.Syntax, got, want)
+		}
+	}
+}
+
+type jsonTestBody struct {
+	Syntax string
+	Body   hcl.Body
+}
+
+// jsonTestBodies parses the given native syntax and JSON configurations,
+// which should be equivalent, returning both bodies for testing.
+func jsonTestBodies(t *testing.T, native, json string) []jsonTestBody {
+	t.Helper()
+
+	nativeFile, diags := hclsyntax.ParseConfig([]byte(native), "test.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("native syntax config has problems: %s", diags.Error())
+	}
+	jsonFile, diags := hcljson.Parse([]byte(json), "test.hcl.json")
+	if diags.HasErrors() {
+		t.Fatalf("JSON config has problems: %s", diags.Error())
+	}
+	return []jsonTestBody{
+		{"native syntax", nativeFile.Body},
+		{"JSON", jsonFile.Body},
+	}
+}
@@ -0,0 +1,104 @@
+package hcloverlay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// ParseOverlayLines reads a sequence of lines from the given reader, each
+// of which uses the same "path.to.argument=value" syntax accepted by
+// ParseCLIArgument, and returns one overlay per line. This is a lightweight
+// alternative to writing override files in full HCL syntax.
+//
+// Blank lines are ignored, as are lines whose first non-whitespace
+// character is "#", which can therefore be used for comments. Leading
+// whitespace is also ignored on all other lines, but the value after the
+// equals sign is otherwise used verbatim, including any trailing whitespace.
+// Use ParseOverlayLinesWithOpts with ParseOptions.UnquoteValues to instead
+// allow values in quotes, which makes any surrounding whitespace explicit.
+//
+// The given filename is used in source ranges, so that diagnostics about
+// a particular line, and about the arguments set by it, can refer to
+// locations like "override.env:12". Each line must set an argument or
+// traverse a block type defined in the given schema, and any line that
+// does not is reported as an error.
+//
+// If ParseOverlayLines returns error diagnostics then the returned overlays
+// include only the lines that were valid.
+func ParseOverlayLines(r io.Reader, filename string, schema *hcl.BodySchema) ([]Overlay, hcl.Diagnostics) {
+	return ParseOverlayLinesWithOpts(r, filename, schema, nil)
+}
+
+// ParseOverlayLinesWithOpts is a variant of ParseOverlayLines that accepts
+// options to customize how each line is parsed, as for
+// ParseCLIArgumentWithOpts. The given filename takes the place of the
+// Filename option. If opts is nil then the behavior is identical to
+// ParseOverlayLines.
+func ParseOverlayLinesWithOpts(r io.Reader, filename string, schema *hcl.BodySchema, opts *ParseOptions) ([]Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var lineOpts ParseOptions
+	if opts != nil {
+		lineOpts = *opts
+	}
+	lineOpts.Filename = filename
+
+	var ret []Overlay
+
+	br := bufio.NewReader(r)
+	pos := hcl.InitialPos
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Failed to read overlays",
+				Detail:   fmt.Sprintf("Failed to read %s: %s.", filename, err),
+			})
+			return ret, diags
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+
+		next := pos
+		next.Line++
+		next.Byte += len(line)
+
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		trimmed := strings.TrimLeft(line, " \t")
+		start := pos
+		start.Column += len(line) - len(trimmed)
+		start.Byte += len(line) - len(trimmed)
+
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			lineRange := argRange(filename, trimmed, start, 0, len(trimmed))
+			o, moreDiags := parseCLIArgument(trimmed, nil, &lineOpts, start)
+			for _, diag := range moreDiags {
+				if diag.Subject == nil {
+					diag.Subject = lineRange.Ptr()
+				}
+			}
+			diags = append(diags, moreDiags...)
+			if o != nil {
+				if o := o.(*cliArgOverlay); schemaHasName(schema, o.steps[0].name) {
+					ret = append(ret, o)
+				} else {
+					diag := o.unexpectedArgError(schema)
+					diag.Subject = lineRange.Ptr()
+					diags = diags.Append(diag)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		pos = next
+	}
+
+	return ret, diags
+}
@@ -0,0 +1,241 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+func TestParseOverlayLines(t *testing.T) {
+	type Service struct {
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+	}
+	type Config struct {
+		IOMode  string    `hcl:"io_mode,optional"`
+		Count   int       `hcl:"count,optional"`
+		Service []Service `hcl:"service,block"`
+	}
+	schema, _ := gohcl.ImpliedBodySchema(&Config{})
+
+	tests := map[string]struct {
+		Input   string
+		Want    *Config
+		WantErr string
+	}{
+		"empty": {
+			``,
+			&Config{},
+			``,
+		},
+		"several lines": {
+			"io_mode=async\ncount:=2\nservice.web.listen_addr=:80\n",
+			&Config{IOMode: "async", Count: 2, Service: []Service{{Name: "web", ListenAddr: ":80"}}},
+			``,
+		},
+		"no trailing newline": {
+			"io_mode=async",
+			&Config{IOMode: "async"},
+			``,
+		},
+		"comments and blank lines": {
+			"# Settings\n\n  # indented comment\nio_mode=async\n\t\n",
+			&Config{IOMode: "async"},
+			``,
+		},
+		"leading whitespace": {
+			"  io_mode=async\n",
+			&Config{IOMode: "async"},
+			``,
+		},
+		"trailing whitespace in value": {
+			"io_mode=async  \n",
+			&Config{IOMode: "async  "},
+			``,
+		},
+		"windows line endings": {
+			"io_mode=async\r\ncount:=2\r\n",
+			&Config{IOMode: "async", Count: 2},
+			``,
+		},
+		"later lines override earlier lines": {
+			"io_mode=async\nio_mode=sync\n",
+			&Config{IOMode: "sync"},
+			``,
+		},
+		"quoted label": {
+			"service.\"web.prod\".listen_addr=:80\n",
+			&Config{Service: []Service{{Name: "web.prod", ListenAddr: ":80"}}},
+			``,
+		},
+		"missing equals": {
+			"io_mode=async\n\nio_mode\n",
+			nil,
+			`override.env:3,1-8: Invalid argument; Invalid argument "io_mode": must be a configuration setting`,
+		},
+		"unexpected argument": {
+			"# comment\n  io_mdoe=async\n",
+			nil,
+			`override.env:2,3-16: Invalid argument; Unexpected argument "io_mdoe". Did you mean "io_mode"?`,
+		},
+		"invalid value": {
+			"io_mode=async\ncount=many\n",
+			nil,
+			`override.env:2,7-11: Unsuitable value type`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			overlays, diags := ParseOverlayLines(strings.NewReader(test.Input), "override.env", schema)
+			if !diags.HasErrors() {
+				body := ApplyOverlays(hcl.EmptyBody(), overlays...)
+				got := &Config{}
+				diags = gohcl.DecodeBody(body, nil, got)
+				if !diags.HasErrors() {
+					if test.WantErr != "" {
+						t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+					}
+					if diff := cmp.Diff(test.Want, got); diff != "" {
+						t.Fatalf("incorrect result\n%s", diff)
+					}
+					return
+				}
+			}
+
+			errStr := diags.Error()
+			if test.WantErr == "" {
+				t.Fatalf("unexpected problems: %s", errStr)
+			}
+			if !strings.Contains(errStr, test.WantErr) {
+				t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+			}
+		})
+	}
+}
+
+func TestParseOverlayLinesWithOpts(t *testing.T) {
+	type Config struct {
+		Greeting string   `hcl:"greeting,optional"`
+		Count    int      `hcl:"count,optional"`
+		Tags     []string `hcl:"tags,optional"`
+	}
+	schema, _ := gohcl.ImpliedBodySchema(&Config{})
+
+	tests := map[string]struct {
+		Input   string
+		Opts    *ParseOptions
+		Want    *Config
+		WantErr string
+	}{
+		"quoted whitespace": {
+			"greeting=\"  hello  \"\n",
+			&ParseOptions{UnquoteValues: true},
+			&Config{Greeting: "  hello  "},
+			``,
+		},
+		"escaped quote": {
+			`greeting="a\"b"`,
+			&ParseOptions{UnquoteValues: true},
+			&Config{Greeting: `a"b`},
+			``,
+		},
+		"escape sequences": {
+			`greeting="tab\there\\"`,
+			&ParseOptions{UnquoteValues: true},
+			&Config{Greeting: "tab\there\\"},
+			``,
+		},
+		"whitespace after closing quote": {
+			"greeting=\"hi\" \t\n",
+			&ParseOptions{UnquoteValues: true},
+			&Config{Greeting: "hi"},
+			``,
+		},
+		"unquoted value": {
+			"greeting=  hi  \n",
+			&ParseOptions{UnquoteValues: true},
+			&Config{Greeting: "  hi  "},
+			``,
+		},
+		"quote inside value": {
+			`greeting=say "hi"`,
+			&ParseOptions{UnquoteValues: true},
+			&Config{Greeting: `say "hi"`},
+			``,
+		},
+		"backslash escape": {
+			`greeting=\"hi"`,
+			&ParseOptions{UnquoteValues: true},
+			&Config{Greeting: `"hi"`},
+			``,
+		},
+		"append": {
+			"tags+=\" a \"\ntags+=b\n",
+			&ParseOptions{UnquoteValues: true},
+			&Config{Tags: []string{" a ", "b"}},
+			``,
+		},
+		"quoted value with inferred types": {
+			"greeting=\"8080\"\ncount=2\n",
+			&ParseOptions{UnquoteValues: true, InferTypes: true},
+			&Config{Greeting: "8080", Count: 2},
+			``,
+		},
+		"expression": {
+			`greeting:="  hi  "`,
+			&ParseOptions{UnquoteValues: true},
+			&Config{Greeting: "  hi  "},
+			``,
+		},
+		"disabled": {
+			"greeting=\"  hello  \"\n",
+			nil,
+			&Config{Greeting: `"  hello  "`},
+			``,
+		},
+		"unterminated": {
+			"\ngreeting=\"hello\n",
+			&ParseOptions{UnquoteValues: true},
+			nil,
+			`override.env:2,1-16: Invalid argument; Invalid quoted value for argument "greeting"`,
+		},
+		"text after closing quote": {
+			`greeting="hello" world`,
+			&ParseOptions{UnquoteValues: true},
+			nil,
+			`Invalid quoted value for argument "greeting"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			overlays, diags := ParseOverlayLinesWithOpts(strings.NewReader(test.Input), "override.env", schema, test.Opts)
+			if !diags.HasErrors() {
+				body := ApplyOverlays(hcl.EmptyBody(), overlays...)
+				got := &Config{}
+				diags = gohcl.DecodeBody(body, nil, got)
+				if !diags.HasErrors() {
+					if test.WantErr != "" {
+						t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+					}
+					if diff := cmp.Diff(test.Want, got); diff != "" {
+						t.Fatalf("incorrect result\n%s", diff)
+					}
+					return
+				}
+			}
+
+			errStr := diags.Error()
+			if test.WantErr == "" {
+				t.Fatalf("unexpected problems: %s", errStr)
+			}
+			if !strings.Contains(errStr, test.WantErr) {
+				t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+			}
+		})
+	}
+}
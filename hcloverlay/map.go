@@ -0,0 +1,142 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/gocty"
+)
+
+// NewMapOverlay returns an overlay that sets arguments based on the
+// elements of the given map, which is convenient for applications that
+// already have override settings in some other form, such as the result of
+// parsing a JSON document.
+//
+// Each key in the map is a path using the same dot-separated syntax as the
+// part before the equals sign in arguments to ParseCLIArgument, and the
+// corresponding value is the value to set the indicated argument to.
+// Traversal through blocks, including the creation of new blocks, follows
+// the same rules as for ParseCLIArgument.
+//
+// If a value is itself of type map[string]interface{} then it is not used
+// as a value directly, but is instead interpreted as a further set of
+// settings whose keys are appended as additional steps to the path of its
+// parent key. Keys in such nested maps are used literally as single steps,
+// and so they may contain dots or any other characters. To set an argument
+// to a map value, use a map with a more specific element type, such as
+// map[string]string.
+//
+// Other values are converted to cty values using the conventions of the
+// gocty package. Slices of type []interface{} become tuple values, and
+// cty.Value values are used directly.
+func NewMapOverlay(m map[string]interface{}) (Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var overlays []Overlay
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		steps, moreDiags := parseCLIPath(k)
+		diags = append(diags, moreDiags...)
+		if moreDiags.HasErrors() {
+			continue
+		}
+		overlays, moreDiags = appendMapOverlays(overlays, steps, m[k])
+		diags = append(diags, moreDiags...)
+	}
+
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	return MergeOverlays(overlays...), diags
+}
+
+func appendMapOverlays(overlays []Overlay, steps []pathStep, v interface{}) ([]Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	if m, ok := v.(map[string]interface{}); ok {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			var moreDiags hcl.Diagnostics
+			childSteps := make([]pathStep, len(steps), len(steps)+1)
+			copy(childSteps, steps)
+			childSteps = append(childSteps, pathStep{name: k})
+			overlays, moreDiags = appendMapOverlays(overlays, childSteps, m[k])
+			diags = append(diags, moreDiags...)
+		}
+		return overlays, diags
+	}
+
+	path := formatCLIPath(steps)
+	val, err := mapOverlayValue(v)
+	if err != nil {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   fmt.Sprintf("Invalid value for argument %q: %s.", path, err),
+		})
+		return overlays, diags
+	}
+
+	overlays = append(overlays, &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgSet,
+		expr:     hcl.StaticExpr(val, hcl.Range{}),
+	})
+	return overlays, diags
+}
+
+func mapOverlayValue(v interface{}) (cty.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	case cty.Value:
+		return v, nil
+	case []interface{}:
+		if len(v) == 0 {
+			return cty.EmptyTupleVal, nil
+		}
+		elems := make([]cty.Value, len(v))
+		for i, ev := range v {
+			var err error
+			elems[i], err = mapOverlayValue(ev)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+		}
+		return cty.TupleVal(elems), nil
+	case map[string]interface{}:
+		// This case is reachable only for maps nested inside slices, since
+		// appendMapOverlays handles maps directly.
+		if len(v) == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		attrs := make(map[string]cty.Value, len(v))
+		for k, ev := range v {
+			var err error
+			attrs[k], err = mapOverlayValue(ev)
+			if err != nil {
+				return cty.DynamicVal, err
+			}
+		}
+		return cty.ObjectVal(attrs), nil
+	default:
+		ty, err := gocty.ImpliedType(v)
+		if err != nil {
+			return cty.DynamicVal, err
+		}
+		return gocty.ToCtyValue(v, ty)
+	}
+}
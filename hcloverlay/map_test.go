@@ -0,0 +1,167 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNewMapOverlay(t *testing.T) {
+	type Service struct {
+		Type       string            `hcl:"type,label"`
+		Name       string            `hcl:"name,label"`
+		ListenAddr string            `hcl:"listen_addr"`
+		Replicas   int               `hcl:"replicas,optional"`
+		Labels     map[string]string `hcl:"labels,optional"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Debug    bool      `hcl:"debug,optional"`
+		Tags     []string  `hcl:"tags,optional"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+
+service "http" "web" {
+  listen_addr = "127.0.0.1:8080"
+}
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	o, diags := NewMapOverlay(map[string]interface{}{
+		"io_mode": "async",
+		"debug":   true,
+		"tags":    []interface{}{"a", "b"},
+		"service.http.web": map[string]interface{}{
+			"replicas": 3,
+			"labels":   map[string]string{"env": "prod"},
+		},
+		"service": map[string]interface{}{
+			"http": map[string]interface{}{
+				"web.prod": map[string]interface{}{
+					"listen_addr": "0.0.0.0:80",
+				},
+			},
+		},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+
+	var got Config
+	diags = gohcl.DecodeBody(ApplyOverlays(f.Body, o), nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		IOMode: "async",
+		Debug:  true,
+		Tags:   []string{"a", "b"},
+		Services: []Service{
+			{
+				Type:       "http",
+				Name:       "web",
+				ListenAddr: "127.0.0.1:8080",
+				Replicas:   3,
+				Labels:     map[string]string{"env": "prod"},
+			},
+			{
+				Type:       "http",
+				Name:       "web.prod",
+				ListenAddr: "0.0.0.0:80",
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+}
+
+func TestNewMapOverlayValues(t *testing.T) {
+	tests := map[string]struct {
+		Value   interface{}
+		Want    cty.Value
+		WantErr string
+	}{
+		"nil": {
+			nil,
+			cty.NullVal(cty.DynamicPseudoType),
+			``,
+		},
+		"string": {
+			"hello",
+			cty.StringVal("hello"),
+			``,
+		},
+		"float": {
+			1.5,
+			cty.NumberFloatVal(1.5),
+			``,
+		},
+		"cty value": {
+			cty.ListVal([]cty.Value{cty.True}),
+			cty.ListVal([]cty.Value{cty.True}),
+			``,
+		},
+		"empty slice": {
+			[]interface{}{},
+			cty.EmptyTupleVal,
+			``,
+		},
+		"slice of maps": {
+			[]interface{}{
+				map[string]interface{}{"a": "b"},
+			},
+			cty.TupleVal([]cty.Value{
+				cty.ObjectVal(map[string]cty.Value{"a": cty.StringVal("b")}),
+			}),
+			``,
+		},
+		"unsupported": {
+			func() {},
+			cty.NilVal,
+			`Invalid value for argument "foo"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, diags := NewMapOverlay(map[string]interface{}{
+				"foo": test.Value,
+			})
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success")
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+
+			attrs, diags := ApplyOverlays(hcl.EmptyBody(), o).JustAttributes()
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			got, diags := attrs["foo"].Expr.Value(nil)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if !got.RawEquals(test.Want) {
+				t.Fatalf("wrong value\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package hcloverlay
+
+import (
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// MergeOverlays returns a single overlay that has the same effect as
+// applying all of the given overlays in the given order, with each
+// subsequent overlay consuming the result of the one preceding it.
+//
+// This is useful for passing around a set of overlays as a single object,
+// and also avoids some overhead when the resulting overlay is used to
+// traverse into nested blocks. If any of the given overlays were themselves
+// produced by MergeOverlays then their constituent overlays are merged
+// directly into the result, rather than being nested.
+//
+// Any nil elements of overlays are ignored, as for ApplyOverlays.
+func MergeOverlays(overlays ...Overlay) Overlay {
+	overlays = nonNilOverlays(overlays)
+	if len(overlays) == 1 {
+		return overlays[0]
+	}
+
+	var flat []Overlay
+	for _, ov := range overlays {
+		if merged, ok := ov.(*mergedOverlay); ok {
+			flat = append(flat, merged.overlays...)
+			continue
+		}
+		flat = append(flat, ov)
+	}
+	return &mergedOverlay{overlays: flat}
+}
+
+// mergedOverlay is an overlay that applies a sequence of other overlays in
+// order, each consuming the result of the one preceding it.
+type mergedOverlay struct {
+	overlays []Overlay
+}
+
+// String returns the strings for each of the merged overlays, separated by
+// spaces, such as "io_mode=async replicas:=3".
+func (o *mergedOverlay) String() string {
+	strs := make([]string, 0, len(o.overlays))
+	for _, ov := range o.overlays {
+		if ov != nil {
+			strs = append(strs, overlayString(ov))
+		}
+	}
+	return strings.Join(strs, " ")
+}
+
+func (o *mergedOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	for _, ov := range o.overlays {
+		var moreDiags hcl.Diagnostics
+		content, moreDiags = ov.ApplyOverlay(content, schema)
+		diags = append(diags, moreDiags...)
+	}
+	return content, diags
+}
+
+func (o *mergedOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var remainOverlays []Overlay
+	for _, ov := range o.overlays {
+		var moreDiags hcl.Diagnostics
+		var remainOverlay Overlay
+		content, remainOverlay, moreDiags = ov.PartialApplyOverlay(content, schema)
+		diags = append(diags, moreDiags...)
+		if remainOverlay != nil {
+			remainOverlays = append(remainOverlays, remainOverlay)
+		}
+	}
+
+	if len(remainOverlays) == 0 {
+		return content, nil, diags
+	}
+	return content, MergeOverlays(remainOverlays...), diags
+}
+
+func (o *mergedOverlay) ApplyJustAttributes(attrs hcl.Attributes) (hcl.Attributes, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	for _, ov := range o.overlays {
+		var moreDiags hcl.Diagnostics
+		attrs, moreDiags = ov.ApplyJustAttributes(attrs)
+		diags = append(diags, moreDiags...)
+	}
+	return attrs, diags
+}
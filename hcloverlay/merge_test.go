@@ -0,0 +1,95 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestMergeOverlays(t *testing.T) {
+	type Service struct {
+		Name     string   `hcl:"name,label"`
+		LogLevel string   `hcl:"log_level"`
+		Tags     []string `hcl:"tags,optional"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+
+service "a" {
+  log_level = "info"
+}
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	var overlays []Overlay
+	for _, arg := range []string{"io_mode=async", "service.a.tags+=x", "service.a.tags+=y", "service.b.log_level=debug"} {
+		o, diags := ParseCLIArgument(arg)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+	merged := MergeOverlays(
+		MergeOverlays(overlays[0], overlays[1]),
+		MergeOverlays(overlays[2], overlays[3]),
+	)
+	if got, want := len(merged.(*mergedOverlay).overlays), len(overlays); got != want {
+		t.Errorf("merged overlay has %d children; want %d", got, want)
+	}
+
+	want := Config{
+		IOMode: "async",
+		Services: []Service{
+			{Name: "a", LogLevel: "info", Tags: []string{"x", "y"}},
+			{Name: "b", LogLevel: "debug"},
+		},
+	}
+
+	t.Run("Content", func(t *testing.T) {
+		var got Config
+		diags := gohcl.DecodeBody(ApplyOverlays(f.Body, merged), nil, &got)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("incorrect result\n%s", diff)
+		}
+	})
+	t.Run("PartialContent", func(t *testing.T) {
+		body := ApplyOverlays(f.Body, merged)
+
+		// First we'll decode only io_mode, leaving the service blocks and
+		// their overlays in the remaining body.
+		content, remain, diags := body.PartialContent(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "io_mode"}},
+		})
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		v, _ := content.Attributes["io_mode"].Expr.Value(nil)
+		if got, want := v.AsString(), "async"; got != want {
+			t.Errorf("wrong io_mode %q; want %q", got, want)
+		}
+
+		var got struct {
+			Services []Service `hcl:"service,block"`
+		}
+		diags = gohcl.DecodeBody(remain, nil, &got)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if diff := cmp.Diff(want.Services, got.Services); diff != "" {
+			t.Fatalf("incorrect result\n%s", diff)
+		}
+	})
+}
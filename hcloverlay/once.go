@@ -0,0 +1,117 @@
+package hcloverlay
+
+import (
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// NewOnceOverlay returns an overlay that behaves like the given overlay the
+// first time it is applied and has no effect after that, for overrides that
+// represent a transient action in a long-lived process that decodes the same
+// body repeatedly, such as forcing a one-time reload.
+//
+// Each call to Content, PartialContent, or JustAttributes on the body the
+// overlay belongs to counts as an application, even if the inner overlay
+// returned errors or had nothing to change. The results of decoding a
+// body are not cached if the overlay is given directly to ApplyOverlays,
+// or through MergeOverlays, WithPriority, NewRecordingOverlay, or
+// NewConditionalOverlay, so a later decode with the same schema sees the
+// content without the change.
+// If PartialContent applies only part of the inner overlay then the
+// remaining part is passed on to the remaining body, where it is again
+// applied only once.
+//
+// The overlay is safe to apply concurrently: exactly one of several
+// concurrent decodes of the body applies the inner overlay.
+//
+// If the given overlay is nil then the result is also nil, which
+// ApplyOverlays ignores.
+func NewOnceOverlay(inner Overlay) Overlay {
+	if inner == nil {
+		return nil
+	}
+	return &onceOverlay{
+		inner: inner,
+		state: &onceState{},
+	}
+}
+
+// onceOverlay is the overlay implementation returned by NewOnceOverlay.
+type onceOverlay struct {
+	inner Overlay
+
+	// state is shared with any copies of the overlay that wrap a modified
+	// inner overlay, such as those made by withOriginal, so that applying
+	// any of them consumes all of them.
+	state *onceState
+}
+
+// onceState records whether a onceOverlay has been applied.
+type onceState struct {
+	mu   sync.Mutex
+	used bool
+}
+
+func (o *onceOverlay) String() string {
+	return overlayString(o.inner) + " (once)"
+}
+
+// claim returns true if this is the first application of the overlay, in
+// which case the caller must apply the inner overlay.
+func (o *onceOverlay) claim() bool {
+	o.state.mu.Lock()
+	defer o.state.mu.Unlock()
+	if o.state.used {
+		return false
+	}
+	o.state.used = true
+	return true
+}
+
+// withInner returns a copy of the overlay that applies the given inner
+// overlay instead, sharing the same record of whether it has been applied.
+func (o *onceOverlay) withInner(inner Overlay) *onceOverlay {
+	return &onceOverlay{
+		inner: inner,
+		state: o.state,
+	}
+}
+
+func (o *onceOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	if !o.claim() {
+		return content, nil
+	}
+	return o.inner.ApplyOverlay(content, schema)
+}
+
+func (o *onceOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	if !o.claim() {
+		return content, nil, nil
+	}
+	content, remain, diags := o.inner.PartialApplyOverlay(content, schema)
+	return content, NewOnceOverlay(remain), diags
+}
+
+func (o *onceOverlay) ApplyJustAttributes(attrs hcl.Attributes) (hcl.Attributes, hcl.Diagnostics) {
+	if !o.claim() {
+		return attrs, nil
+	}
+	return o.inner.ApplyJustAttributes(attrs)
+}
+
+// hasOnceOverlay returns true if any of the given overlays, or any of the
+// overlays they wrap, was returned by NewOnceOverlay.
+func hasOnceOverlay(overlays []Overlay) bool {
+	for _, ov := range flattenMergedOverlays(overlays) {
+		switch ov := ov.(type) {
+		case *onceOverlay:
+			return true
+		case *conditionalOverlay:
+			if hasOnceOverlay([]Overlay{ov.inner}) {
+				return true
+			}
+		}
+	}
+	return false
+}
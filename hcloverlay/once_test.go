@@ -0,0 +1,191 @@
+package hcloverlay
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestNewOnceOverlay(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode"},
+			{Name: "reload"},
+		},
+	}
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	newOverlays := func(t *testing.T) []Overlay {
+		var overlays []Overlay
+		for _, arg := range []string{"io_mode=async", "reload=true"} {
+			o, diags := ParseCLIArgument(arg)
+			if diags.HasErrors() {
+				t.Fatalf("arg has problems: %s", diags.Error())
+			}
+			overlays = append(overlays, o)
+		}
+		// Only the reload argument is transient.
+		overlays[1] = NewOnceOverlay(overlays[1])
+		return overlays
+	}
+
+	// check verifies that io_mode is always overridden while reload is
+	// set only if wantReload.
+	check := func(t *testing.T, attrs hcl.Attributes, wantReload bool) {
+		t.Helper()
+		if got, want := attrStringValue(t, attrs["io_mode"]), "async"; got != want {
+			t.Errorf("wrong io_mode %q; want %q", got, want)
+		}
+		_, gotReload := attrs["reload"]
+		if gotReload != wantReload {
+			t.Errorf("reload set is %t; want %t", gotReload, wantReload)
+		}
+	}
+
+	t.Run("Content", func(t *testing.T) {
+		body := ApplyOverlays(f.Body, newOverlays(t)...)
+		for i, wantReload := range []bool{true, false, false} {
+			content, diags := body.Content(schema)
+			if diags.HasErrors() {
+				t.Fatalf("decode %d has problems: %s", i, diags.Error())
+			}
+			check(t, content.Attributes, wantReload)
+		}
+	})
+	t.Run("JustAttributes", func(t *testing.T) {
+		body := ApplyOverlays(f.Body, newOverlays(t)...)
+		for i, wantReload := range []bool{true, false} {
+			attrs, diags := body.JustAttributes()
+			if diags.HasErrors() {
+				t.Fatalf("decode %d has problems: %s", i, diags.Error())
+			}
+			check(t, attrs, wantReload)
+		}
+	})
+	t.Run("PartialContent", func(t *testing.T) {
+		body := ApplyOverlays(f.Body, newOverlays(t)...)
+		ioSchema := &hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{
+				{Name: "io_mode"},
+			},
+		}
+		reloadSchema := &hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{
+				{Name: "reload"},
+			},
+		}
+
+		// The first decode doesn't include reload, so the remaining body
+		// applies it once in turn.
+		_, remain, diags := body.PartialContent(ioSchema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		for i, wantReload := range []bool{true, false} {
+			content, diags := remain.Content(reloadSchema)
+			if diags.HasErrors() {
+				t.Fatalf("decode %d has problems: %s", i, diags.Error())
+			}
+			if _, got := content.Attributes["reload"]; got != wantReload {
+				t.Errorf("decode %d: reload set is %t; want %t", i, got, wantReload)
+			}
+		}
+
+		// The overlay was consumed by the first decode of the original
+		// body, so a second one doesn't pass it on again.
+		_, remain, diags = body.PartialContent(ioSchema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		content, diags := remain.Content(reloadSchema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if _, got := content.Attributes["reload"]; got {
+			t.Errorf("reload set after second partial decode")
+		}
+	})
+	t.Run("MergeOverlays", func(t *testing.T) {
+		body := ApplyOverlays(f.Body, MergeOverlays(newOverlays(t)...))
+		for i, wantReload := range []bool{true, false} {
+			content, diags := body.Content(schema)
+			if diags.HasErrors() {
+				t.Fatalf("decode %d has problems: %s", i, diags.Error())
+			}
+			check(t, content.Attributes, wantReload)
+		}
+	})
+	t.Run("concurrent", func(t *testing.T) {
+		body := ApplyOverlays(f.Body, newOverlays(t)...)
+		const n = 16
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		reloads := 0
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				content, diags := body.Content(schema)
+				if diags.HasErrors() {
+					t.Errorf("unexpected problems: %s", diags.Error())
+					return
+				}
+				if _, ok := content.Attributes["reload"]; ok {
+					mu.Lock()
+					reloads++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if reloads != 1 {
+			t.Errorf("reload was set by %d decodes; want 1", reloads)
+		}
+	})
+}
+
+func TestNewOnceOverlayReset(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "a"},
+		},
+	}
+	f, diags := hclsyntax.ParseConfig([]byte(`
+a = "orig"
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	set, diags := ParseCLIArgument("a=new")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	reset, diags := NewResetOverlay("a")
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+
+	body := ApplyOverlays(f.Body, set, NewOnceOverlay(reset))
+	for i, want := range []string{"orig", "new"} {
+		content, diags := body.Content(schema)
+		if diags.HasErrors() {
+			t.Fatalf("decode %d has problems: %s", i, diags.Error())
+		}
+		if got := attrStringValue(t, content.Attributes["a"]); got != want {
+			t.Errorf("decode %d: wrong value %q; want %q", i, got, want)
+		}
+	}
+}
+
+func TestNewOnceOverlayNil(t *testing.T) {
+	if got := NewOnceOverlay(nil); got != nil {
+		t.Errorf("wrong result %#v; want nil", got)
+	}
+}
@@ -2,6 +2,7 @@ package hcloverlay
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/hashicorp/hcl/v2"
 )
@@ -9,6 +10,12 @@ import (
 // An Overlay is an object that can be applied to a body using the OverlayBody
 // function, in which case it will get an opportunity to modify the result of
 // decoding that body, usually by adding or replacing attributes or blocks.
+//
+// Overlay implementations must be deterministic: applying a particular
+// overlay to equivalent content using the same schema must always produce
+// an equivalent result. Bodies returned by ApplyOverlays rely on this to
+// cache the results of decoding with a particular schema, except for
+// bodies with overlays returned by NewOnceOverlay.
 type Overlay interface {
 	// ApplyOverlay receives the result of decoding a body along with the
 	// schema that was used to decode that body and produces a new body
@@ -59,57 +66,233 @@ type Overlay interface {
 // When applying overlays to a body, the original body is required to be
 // valid per the schema except that the "Required" flag for attributes is
 // not enforced. Requiredness is instead enforced on the result of applying
-// the overlays.
+// the overlays. ApplyOverlaysNativeRequired is an alternative for callers
+// that prefer the body's own diagnostics for missing required arguments.
+//
+// The JustAttributes method of hcl.Body has no schema, and so it cannot
+// enforce requiredness either with or without overlays. Callers that need
+// to check for required attributes in that mode can use
+// JustAttributesRequired, which checks the result after applying overlays.
+//
+// The given body may have been produced by either the native syntax parser
+// or the JSON parser, and overlays behave identically for both. Values given
+// as expressions, such as with the ":=" form of ParseCLIArgument, always use
+// native syntax regardless of the syntax of the body they are applied to.
+//
+// The resulting body may be decoded concurrently from multiple goroutines,
+// as long as the given body and overlays also allow that. The built-in
+// overlays in this package all do.
+//
+// If the given body is itself the result of an earlier call to
+// ApplyOverlays, and not ApplyOverlaysNativeRequired, then the result is a
+// single wrapper that applies the earlier overlays followed by the new
+// overlays, which is equivalent to wrapping the body twice but avoids
+// redundant work.
+//
+// Any nil elements of overlays are ignored, so that callers can build the
+// sequence of overlays from functions that return nil when there is nothing
+// to override.
 func ApplyOverlays(body hcl.Body, overlays ...Overlay) hcl.Body {
+	return applyOverlays(body, overlays, false)
+}
+
+// ApplyOverlaysNativeRequired is a variant of ApplyOverlays that does not
+// defer enforcing the "Required" flag for attributes, instead passing the
+// schema unmodified to the given body so that it can enforce requiredness
+// itself.
+//
+// This preserves the body's own "Missing required argument" diagnostics,
+// whose source ranges are often more precise than those ApplyOverlays
+// reports, but it means that an overlay cannot satisfy a required attribute
+// that the given body doesn't define. Use this only when the overlays are
+// not expected to set any required attributes.
+//
+// If the given body is itself the result of ApplyOverlaysNativeRequired
+// then the result applies all of the overlays together, as with
+// ApplyOverlays. A body from ApplyOverlays is instead wrapped as it is, so
+// it enforces requiredness after its own overlays and before the new ones,
+// and similarly the result of passing a body from this function to
+// ApplyOverlays defers requiredness until after all of the overlays.
+func ApplyOverlaysNativeRequired(body hcl.Body, overlays ...Overlay) hcl.Body {
+	return applyOverlays(body, overlays, true)
+}
+
+func applyOverlays(body hcl.Body, overlays []Overlay, nativeRequired bool) hcl.Body {
+	return applyOverlaysTracked(body, nonNilOverlays(overlays), nil, nativeRequired)
+}
+
+// applyOverlaysTracked is the implementation of applyOverlays, which
+// additionally accepts states for ApplyOverlaysStrict to track whether each
+// of the overlays has been applied. If states is not nil then it must have
+// the same length as overlays, and overlays must not have nil elements.
+func applyOverlaysTracked(body hcl.Body, overlays []Overlay, states []*strictState, nativeRequired bool) hcl.Body {
 	if len(overlays) == 0 {
 		return body // wrapping is pointless
 	}
+	if sb, ok := body.(*specBody); ok && sb.applyBody.nativeRequired == nativeRequired {
+		// A body from ApplyOverlaysSpec is flattened in the same way, so
+		// that requiredness is still enforced only after all overlays.
+		body = sb.applyBody
+	}
+	// We flatten only if both bodies enforce requiredness in the same way,
+	// because otherwise the result would not be equivalent to nesting them:
+	// the outer body would either defer requiredness that the inner body
+	// enforces natively, or enforce natively what the inner body defers.
+	if inner, ok := body.(*applyBody); ok && inner.nativeRequired == nativeRequired {
+		// Rather than nesting one applyBody inside another, we'll just
+		// append our new overlays to the existing ones. Requiredness
+		// is then enforced only once, after all of the overlays have
+		// been applied.
+		combined := make([]Overlay, 0, len(inner.overlays)+len(overlays))
+		combined = append(combined, inner.overlays...)
+		combined = append(combined, overlays...)
+		var combinedStates []*strictState
+		if inner.states != nil || states != nil {
+			combinedStates = make([]*strictState, len(combined))
+			copy(combinedStates, inner.states)
+			copy(combinedStates[len(inner.overlays):], states)
+		}
+		return &applyBody{
+			inner:          inner.inner,
+			overlays:       combined,
+			states:         combinedStates,
+			nativeRequired: nativeRequired,
+			uncached:       hasOnceOverlay(combined),
+		}
+	}
 	return &applyBody{
-		inner:    body,
-		overlays: overlays,
+		inner:          body,
+		overlays:       overlays,
+		states:         states,
+		nativeRequired: nativeRequired,
+		uncached:       hasOnceOverlay(overlays),
 	}
 }
 
 type applyBody struct {
 	inner    hcl.Body
 	overlays []Overlay
+
+	// states is set for bodies derived from ApplyOverlaysStrict, and has
+	// an element for each element of overlays that tracks whether it has
+	// been applied. Elements for overlays that aren't tracked are nil.
+	states []*strictState
+
+	// nativeRequired is set for bodies returned by
+	// ApplyOverlaysNativeRequired, in which case the inner body enforces
+	// requiredness rather than prepareContent.
+	nativeRequired bool
+
+	// uncached is set if any of the overlays is from NewOnceOverlay, in
+	// which case decoding with the same schema twice can produce different
+	// results and so we must not cache the content.
+	uncached bool
+
+	// mu guards the cache fields below, which remember the results for
+	// the most recent schema pointer passed by a caller. Schemas must not
+	// be modified after they have been used for decoding, so it's safe to
+	// assume that a particular pointer always refers to the same schema.
+	//
+	// We remember only one schema because callers that decode a body
+	// repeatedly typically use the same schema each time, while callers
+	// that construct a new schema for each call would otherwise cause the
+	// cache to grow without bound.
+	mu            sync.Mutex
+	cachedSchema  *hcl.BodySchema
+	cachedMod     *hcl.BodySchema
+	cachedContent *hcl.BodyContent
+	cachedDiags   hcl.Diagnostics
 }
 
 func (b *applyBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	b.mu.Lock()
+	var cached *hcl.BodyContent
+	var cachedDiags hcl.Diagnostics
+	if b.cachedSchema == schema && b.cachedContent != nil && !b.uncached {
+		cached, cachedDiags = b.cachedContent, b.cachedDiags
+	}
+	b.mu.Unlock()
+	if cached != nil {
+		// We return a copy of the cached content so that the caller can
+		// modify it, as the overlays themselves do, without affecting
+		// future results.
+		return copyBodyContent(cached), cachedDiags
+	}
+
 	// modSchema is the same as schema except that attributes are
 	// always optional. This allows is to delay enforcing requiredness
 	// until overlaying is complete.
-	modSchema := b.schemaNoRequired(schema)
+	modSchema := b.innerSchema(schema)
 
+	// The overlays modify the content in-place, so we must copy it first
+	// in case the inner body returns content that is shared with other
+	// callers, which might be running concurrently.
 	content, diags := b.inner.Content(modSchema)
-	for _, ov := range b.overlays {
+	content = copyBodyContent(content)
+	original := copyAttributes(content.Attributes) // for any reset overlays
+	for i, ov := range b.overlays {
 		var moreDiags hcl.Diagnostics
-		content, moreDiags = ov.ApplyOverlay(content, modSchema)
+		b.state(i).markApplied()
+		content, moreDiags = withOriginal(ov, original).ApplyOverlay(content, modSchema)
+		content = ensureContent(content) // in case the overlay returned nil or nil attributes
 		diags = append(diags, moreDiags...)
 	}
 
-	return b.prepareContent(content, schema, diags)
+	content, diags = b.prepareContent(content, schema, diags)
+
+	b.mu.Lock()
+	if b.cachedSchema == schema && !b.uncached {
+		b.cachedContent = copyBodyContent(content)
+		b.cachedDiags = diags
+	}
+	b.mu.Unlock()
+
+	return content, diags
 }
 
 func (b *applyBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
 	// modSchema is the same as schema except that attributes are
 	// always optional. This allows is to delay enforcing requiredness
 	// until overlaying is complete.
-	modSchema := b.schemaNoRequired(schema)
+	modSchema := b.innerSchema(schema)
 
 	content, remain, diags := b.inner.PartialContent(modSchema)
+	content = copyBodyContent(content) // as in Content
+	original := copyAttributes(content.Attributes)
 	var remainOverlays []Overlay
-	for _, ov := range b.overlays {
+	var remainStates []*strictState
+	for i, ov := range b.overlays {
 		var moreDiags hcl.Diagnostics
 		var remainOverlay Overlay
-		content, remainOverlay, moreDiags = ov.PartialApplyOverlay(content, modSchema)
+		applied := withOriginal(ov, original)
+		content, remainOverlay, moreDiags = applied.PartialApplyOverlay(content, modSchema)
+		content = ensureContent(content) // as in Content
 		diags = append(diags, moreDiags...)
 		if remainOverlay != nil {
 			remainOverlays = append(remainOverlays, remainOverlay)
 		}
+		if b.states != nil {
+			st := b.state(i)
+			if remainOverlay != nil && (sameOverlay(remainOverlay, ov) || sameOverlay(remainOverlay, applied)) {
+				// The overlay didn't apply to anything yet, so it's still
+				// waiting for its first application.
+				remainStates = append(remainStates, st)
+				continue
+			}
+			st.markApplied()
+			if remainOverlay != nil {
+				remainStates = append(remainStates, st.remnant(remainOverlay))
+			}
+		}
 	}
 
-	remain = ApplyOverlays(remain, remainOverlays...)
+	if remain == nil {
+		// Some body implementations don't return a remaining body when
+		// they consume everything, but our remaining overlays might still
+		// add content that a later PartialContent call will ask for.
+		remain = hcl.EmptyBody()
+	}
+	remain = applyOverlaysTracked(remain, remainOverlays, remainStates, b.nativeRequired)
 
 	content, diags = b.prepareContent(content, schema, diags)
 	return content, remain, diags
@@ -117,38 +300,92 @@ func (b *applyBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hc
 
 func (b *applyBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
 	attrs, diags := b.inner.JustAttributes()
-	for _, ov := range b.overlays {
+	attrs = copyAttributes(attrs) // as in Content
+	original := copyAttributes(attrs)
+	for i, ov := range b.overlays {
 		var moreDiags hcl.Diagnostics
-		attrs, moreDiags = ov.ApplyJustAttributes(attrs)
+		b.state(i).markApplied()
+		attrs, moreDiags = withOriginal(ov, original).ApplyJustAttributes(attrs)
+		if attrs == nil {
+			attrs = make(hcl.Attributes) // as in Content
+		}
 		diags = append(diags, moreDiags...)
 	}
 	return attrs, diags
 }
 
+// JustAttributesRequired calls JustAttributes on the given body and then
+// additionally checks that the result includes all of the attributes whose
+// names are given, returning error diagnostics for any that are missing.
+//
+// This is intended for use with bodies returned from ApplyOverlays, where
+// the required attributes might be set either in the original body or by
+// one of the overlays, but it works with any body.
+func JustAttributesRequired(body hcl.Body, required ...string) (hcl.Attributes, hcl.Diagnostics) {
+	attrs, diags := body.JustAttributes()
+	if diags.HasErrors() {
+		return attrs, diags
+	}
+
+	for _, name := range required {
+		if _, exists := attrs[name]; !exists {
+			diags = append(diags, missingRequiredArgError(name, body.MissingItemRange()))
+		}
+	}
+
+	return attrs, diags
+}
+
 func (b *applyBody) MissingItemRange() hcl.Range {
 	return b.inner.MissingItemRange()
 }
 
 func (b *applyBody) prepareContent(result *hcl.BodyContent, schema *hcl.BodySchema, diags hcl.Diagnostics) (*hcl.BodyContent, hcl.Diagnostics) {
+	if b.nativeRequired {
+		return result, diags // the inner body already enforced requiredness
+	}
 
 	for _, attrS := range schema.Attributes {
 		if !attrS.Required {
 			continue
 		}
 		if _, exists := result.Attributes[attrS.Name]; !exists {
-			diags = append(diags, &hcl.Diagnostic{
-				Severity: hcl.DiagError,
-				Summary:  "Missing required argument",
-				Detail:   fmt.Sprintf("The argument %q is required, but no definition was found.", attrS.Name),
-				Subject:  b.MissingItemRange().Ptr(),
-			})
+			diags = append(diags, missingRequiredArgError(attrS.Name, b.MissingItemRange()))
 		}
 	}
 
 	return result, diags
 }
 
-func (b *applyBody) schemaNoRequired(given *hcl.BodySchema) *hcl.BodySchema {
+// innerSchema returns the schema to use when decoding the inner body, which
+// is the given schema with all attributes optional unless the inner body is
+// enforcing requiredness itself, and with any legacy names accepted by
+// rename overlays.
+func (b *applyBody) innerSchema(given *hcl.BodySchema) *hcl.BodySchema {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cachedSchema == given {
+		return b.cachedMod
+	}
+
+	ret := given
+	if !b.nativeRequired {
+		ret = schemaWithoutRequired(given)
+	}
+	ret = schemaWithRenames(ret, b.overlays)
+
+	// This schema is now the one we're caching results for, so any
+	// content we cached for a previous schema is no longer relevant.
+	b.cachedSchema = given
+	b.cachedMod = ret
+	b.cachedContent = nil
+	b.cachedDiags = nil
+	return ret
+}
+
+// schemaWithoutRequired returns a copy of the given schema where all of the
+// attributes are optional.
+func schemaWithoutRequired(given *hcl.BodySchema) *hcl.BodySchema {
 	ret := &hcl.BodySchema{
 		Blocks: given.Blocks,
 	}
@@ -163,3 +400,78 @@ func (b *applyBody) schemaNoRequired(given *hcl.BodySchema) *hcl.BodySchema {
 
 	return ret
 }
+
+// nonNilOverlays returns the given overlays without any nil elements. If
+// there are no nil elements then it returns the given slice itself.
+func nonNilOverlays(overlays []Overlay) []Overlay {
+	for i, ov := range overlays {
+		if ov != nil {
+			continue
+		}
+		ret := make([]Overlay, i, len(overlays)-1)
+		copy(ret, overlays[:i])
+		for _, ov := range overlays[i+1:] {
+			if ov != nil {
+				ret = append(ret, ov)
+			}
+		}
+		return ret
+	}
+	return overlays
+}
+
+// copyBodyContent returns a copy of the given content that can be modified
+// without affecting the original. The attributes map, the blocks slice, and
+// the blocks themselves are all copied, but the attributes and the block
+// bodies are shared.
+func copyBodyContent(content *hcl.BodyContent) *hcl.BodyContent {
+	if content == nil {
+		return &hcl.BodyContent{Attributes: make(hcl.Attributes)}
+	}
+	ret := &hcl.BodyContent{
+		Attributes:       copyAttributes(content.Attributes),
+		MissingItemRange: content.MissingItemRange,
+	}
+	if content.Blocks != nil {
+		ret.Blocks = make(hcl.Blocks, len(content.Blocks))
+		for i, block := range content.Blocks {
+			blockCopy := *block
+			ret.Blocks[i] = &blockCopy
+		}
+	}
+	return ret
+}
+
+// ensureContent returns the given content if it is non-nil and has a
+// non-nil attributes map, so that overlays can safely add attributes to it.
+// Otherwise it returns either new empty content or the given content with
+// a new empty attributes map.
+func ensureContent(content *hcl.BodyContent) *hcl.BodyContent {
+	if content == nil {
+		return &hcl.BodyContent{Attributes: make(hcl.Attributes)}
+	}
+	if content.Attributes == nil {
+		content.Attributes = make(hcl.Attributes)
+	}
+	return content
+}
+
+// copyAttributes returns a copy of the given attributes map that can be
+// modified without affecting the original. The attributes themselves are
+// shared.
+func copyAttributes(attrs hcl.Attributes) hcl.Attributes {
+	ret := make(hcl.Attributes, len(attrs))
+	for name, attr := range attrs {
+		ret[name] = attr
+	}
+	return ret
+}
+
+func missingRequiredArgError(name string, rng hcl.Range) *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Missing required argument",
+		Detail:   fmt.Sprintf("The argument %q is required, but no definition was found.", name),
+		Subject:  rng.Ptr(),
+	}
+}
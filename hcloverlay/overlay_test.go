@@ -0,0 +1,735 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestApplyOverlaysFlatten(t *testing.T) {
+	type Config struct {
+		Foo  string   `hcl:"foo"`
+		Bar  string   `hcl:"bar"`
+		Tags []string `hcl:"tags"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+tags = ["a"]
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	parseArg := func(raw string) Overlay {
+		o, diags := ParseCLIArgument(raw)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+
+	// The required "foo" and "bar" arguments are each provided by only one
+	// of the two layers, so this would fail if requiredness were enforced
+	// for the first layer alone.
+	body := ApplyOverlays(f.Body, parseArg("foo=a"), parseArg("tags+=b"))
+	body = ApplyOverlays(body, parseArg("bar=b"), parseArg("tags+=c"))
+
+	ab, ok := body.(*applyBody)
+	if !ok {
+		t.Fatalf("result is %T, not *applyBody", body)
+	}
+	if ab.inner != f.Body {
+		t.Errorf("inner body is %T, not the original body", ab.inner)
+	}
+	if got, want := len(ab.overlays), 4; got != want {
+		t.Errorf("wrong number of overlays %d; want %d", got, want)
+	}
+
+	var got Config
+	diags = gohcl.DecodeBody(body, nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		Foo:  "a",
+		Bar:  "b",
+		Tags: []string{"a", "b", "c"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+}
+
+func TestJustAttributesRequired(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+foo = "a"
+`), "config.hcl", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	o, diags := ParseCLIArgument("bar=b")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	body := ApplyOverlays(f.Body, o)
+
+	t.Run("supplied by overlay", func(t *testing.T) {
+		attrs, diags := JustAttributesRequired(body, "foo", "bar")
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if got, want := len(attrs), 2; got != want {
+			t.Errorf("wrong number of attributes %d; want %d", got, want)
+		}
+	})
+	t.Run("missing", func(t *testing.T) {
+		_, diags := JustAttributesRequired(body, "foo", "baz")
+		if got, want := len(diags), 1; got != want {
+			t.Fatalf("wrong number of diagnostics %d; want %d\n%s", got, want, diags.Error())
+		}
+		if got, want := diags[0].Detail, `The argument "baz" is required, but no definition was found.`; got != want {
+			t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+		if got, want := diags[0].Subject.Filename, "config.hcl"; got != want {
+			t.Errorf("wrong filename %q; want %q", got, want)
+		}
+	})
+	t.Run("missing without overlay", func(t *testing.T) {
+		_, diags := JustAttributesRequired(f.Body, "bar")
+		if !diags.HasErrors() {
+			t.Fatalf("unexpected success")
+		}
+	})
+}
+
+func TestApplyOverlaysContentCached(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+service "a" {
+  foo = "a"
+}
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	o, diags := ParseCLIArgument("service.a.foo=b")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	body := ApplyOverlays(f.Body, o)
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "service", LabelNames: []string{"name"}}},
+	}
+
+	first, diags := body.Content(schema)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+
+	// Modifying the first result must not affect the second.
+	first.Blocks[0].Type = "modified"
+	first.Blocks = append(first.Blocks, &hcl.Block{Type: "extra"})
+
+	second, diags := body.Content(schema)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := len(second.Blocks), 1; got != want {
+		t.Fatalf("wrong number of blocks %d; want %d", got, want)
+	}
+	if got, want := second.Blocks[0].Type, "service"; got != want {
+		t.Fatalf("wrong block type %q; want %q", got, want)
+	}
+	attrs, diags := second.Blocks[0].Body.JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	v, _ := attrs["foo"].Expr.Value(nil)
+	if got, want := v.AsString(), "b"; got != want {
+		t.Fatalf("wrong value for foo %q; want %q", got, want)
+	}
+}
+
+func TestApplyOverlaysConcurrent(t *testing.T) {
+	// This test is most useful when run with the race detector enabled,
+	// as in "go test -race".
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+service "a" {
+  foo = "a"
+}
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	type Service struct {
+		Name string `hcl:"name,label"`
+		Foo  string `hcl:"foo"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Services []Service `hcl:"service,block"`
+	}
+	schema, _ := gohcl.ImpliedBodySchema(&Config{})
+	content, diags := f.Body.Content(schema)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	var overlays []Overlay
+	for _, arg := range []string{"io_mode=async", "service.a.foo=b", "service.b.foo=c"} {
+		o, diags := ParseCLIArgument(arg)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+	want := &Config{
+		IOMode: "async",
+		Services: []Service{
+			{Name: "a", Foo: "b"},
+			{Name: "b", Foo: "c"},
+		},
+	}
+
+	// sharedContentBody returns the same content on every call, which
+	// means that the overlays must not modify it in-place.
+	body := ApplyOverlays(sharedContentBody{content}, overlays...)
+
+	const goroutines = 8
+	errs := make(chan string, goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			for j := 0; j < 20; j++ {
+				got := &Config{}
+				diags := gohcl.DecodeBody(body, nil, got)
+				if diags.HasErrors() {
+					errs <- fmt.Sprintf("unexpected problems: %s", diags.Error())
+					return
+				}
+				if diff := cmp.Diff(want, got); diff != "" {
+					errs <- fmt.Sprintf("incorrect result\n%s", diff)
+					return
+				}
+			}
+			errs <- ""
+		}()
+	}
+	for i := 0; i < goroutines; i++ {
+		if err := <-errs; err != "" {
+			t.Error(err)
+		}
+	}
+}
+
+func TestApplyOverlaysRepeatedDecode(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+service "a" {
+  foo = "a"
+}
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	schema := &hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "service", LabelNames: []string{"name"}}},
+	}
+	content, diags := f.Body.Content(schema)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	original := content.Blocks[0].Body
+
+	var overlays []Overlay
+	for _, arg := range []string{"service.a.foo=b", "service.a.bar=c"} {
+		o, diags := ParseCLIArgument(arg)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+
+	// sharedContentBody returns the same block pointers on every call, and
+	// we use a new schema each time so that no result is cached. Each
+	// result must still wrap the original block body exactly once, rather
+	// than wrapping the result of an earlier decode.
+	body := ApplyOverlays(sharedContentBody{content}, overlays...)
+	decode := map[string]func() *hcl.BodyContent{
+		"Content": func() *hcl.BodyContent {
+			content, diags := body.Content(&hcl.BodySchema{Blocks: schema.Blocks})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			return content
+		},
+		"PartialContent": func() *hcl.BodyContent {
+			content, _, diags := body.PartialContent(&hcl.BodySchema{Blocks: schema.Blocks})
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			return content
+		},
+	}
+	for name, decode := range decode {
+		t.Run(name, func(t *testing.T) {
+			var results []map[string]string
+			for i := 0; i < 2; i++ {
+				got := decode()
+				if got, want := len(got.Blocks), 1; got != want {
+					t.Fatalf("wrong number of blocks %d; want %d", got, want)
+				}
+				applied, ok := got.Blocks[0].Body.(*applyBody)
+				if !ok {
+					t.Fatalf("block body is %T, not *applyBody", got.Blocks[0].Body)
+				}
+				if applied.inner != original {
+					t.Errorf("decode %d wraps %T rather than the original block body", i, applied.inner)
+				}
+				if got, want := len(applied.overlays), 2; got != want {
+					t.Errorf("decode %d has %d overlays for the block; want %d", i, got, want)
+				}
+				attrs, diags := got.Blocks[0].Body.JustAttributes()
+				if diags.HasErrors() {
+					t.Fatalf("unexpected problems: %s", diags.Error())
+				}
+				values := make(map[string]string)
+				for name := range attrs {
+					values[name] = attrStringValue(t, attrs[name])
+				}
+				results = append(results, values)
+			}
+			if diff := cmp.Diff(results[0], results[1]); diff != "" {
+				t.Errorf("second decode differs from the first\n%s", diff)
+			}
+			if content.Blocks[0].Body != original {
+				t.Errorf("inner body's block was modified")
+			}
+		})
+	}
+}
+
+// sharedContentBody is an hcl.Body that always returns the same content,
+// regardless of the schema.
+type sharedContentBody struct {
+	content *hcl.BodyContent
+}
+
+func (b sharedContentBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	return b.content, nil
+}
+
+func (b sharedContentBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	return b.content, hcl.EmptyBody(), nil
+}
+
+func (b sharedContentBody) JustAttributes() (hcl.Attributes, hcl.Diagnostics) {
+	return b.content.Attributes, nil
+}
+
+func (b sharedContentBody) MissingItemRange() hcl.Range {
+	return b.content.MissingItemRange
+}
+
+func BenchmarkApplyBodyContent(b *testing.B) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		b.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	const overlayCount = 500
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "io_mode", Required: true}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "service", LabelNames: []string{"name"}}},
+	}
+	overlays := make([]Overlay, overlayCount)
+	for i := range overlays {
+		o, diags := ParseCLIArgument(fmt.Sprintf("service.s%d.listen_addr=:%d", i%10, i))
+		if diags.HasErrors() {
+			b.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays[i] = o
+	}
+	body := ApplyOverlays(f.Body, overlays...)
+
+	// Decoding repeatedly with the same schema can reuse the cached result.
+	b.Run("same schema", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, diags := body.Content(schema)
+			if diags.HasErrors() {
+				b.Fatalf("unexpected problems: %s", diags.Error())
+			}
+		}
+	})
+
+	// Decoding with a new schema each time, as gohcl.DecodeBody does,
+	// must apply all of the overlays again.
+	b.Run("new schema", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			schema := &hcl.BodySchema{
+				Attributes: schema.Attributes,
+				Blocks:     schema.Blocks,
+			}
+			_, diags := body.Content(schema)
+			if diags.HasErrors() {
+				b.Fatalf("unexpected problems: %s", diags.Error())
+			}
+		}
+	})
+}
+
+func TestApplyOverlaysNilAttributes(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "foo"}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "block", LabelNames: []string{"name"}}},
+	}
+	o, diags := ParseCLIArgument("foo=a")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	// nilAttrs is an overlay that discards all of the content, leaving
+	// nil attributes for the overlay that follows it.
+	nilAttrs := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		return &hcl.BodyContent{}, nil
+	})
+
+	bodies := map[string]hcl.Body{
+		"empty body":              ApplyOverlays(hcl.EmptyBody(), o),
+		"nil content":             ApplyOverlays(sharedContentBody{&hcl.BodyContent{}}, o),
+		"after overlay with nil":  ApplyOverlays(hcl.EmptyBody(), nilAttrs, o),
+		"body overlay after nil":  ApplyOverlays(hcl.EmptyBody(), nilAttrs, NewBodyOverlay(ApplyOverlays(hcl.EmptyBody(), o))),
+		"merged overlay with nil": ApplyOverlays(hcl.EmptyBody(), MergeOverlays(nilAttrs, o)),
+	}
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			content, diags := body.Content(schema)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if _, exists := content.Attributes["foo"]; !exists {
+				t.Errorf("foo is not set in Content result")
+			}
+
+			content, _, diags = body.PartialContent(schema)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if _, exists := content.Attributes["foo"]; !exists {
+				t.Errorf("foo is not set in PartialContent result")
+			}
+
+			attrs, diags := body.JustAttributes()
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if _, exists := attrs["foo"]; !exists {
+				t.Errorf("foo is not set in JustAttributes result")
+			}
+		})
+	}
+
+	t.Run("direct", func(t *testing.T) {
+		content, diags := o.ApplyOverlay(&hcl.BodyContent{}, schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if _, exists := content.Attributes["foo"]; !exists {
+			t.Errorf("foo is not set in ApplyOverlay result")
+		}
+		attrs, diags := o.ApplyJustAttributes(nil)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if _, exists := attrs["foo"]; !exists {
+			t.Errorf("foo is not set in ApplyJustAttributes result")
+		}
+	})
+}
+
+func TestApplyOverlaysPartialContentStages(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+tags    = ["a"]
+name    = "original"
+
+service "web" {
+  listen_addr = ":80"
+}
+
+logging {
+  level = "info"
+}
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	override, diags := hclsyntax.ParseConfig([]byte(`
+name = "from-body"
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("override has problems: %s", diags.Error())
+	}
+	parseArg := func(raw string) Overlay {
+		o, diags := ParseCLIArgument(raw)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+	remove, _ := NewRemoveOverlay("logging")
+
+	body := ApplyOverlays(f.Body,
+		parseArg("io_mode=async"),
+		MergeOverlays(parseArg("tags+=b"), parseArg("service.web.listen_addr=:8080")),
+		NewBodyOverlay(override.Body),
+		remove,
+		parseArg("extra=new"),
+	)
+
+	// The first stage decodes only io_mode.
+	content, remain, diags := body.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "io_mode", Required: true}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems in first stage: %s", diags.Error())
+	}
+	if got, want := attrStringValue(t, content.Attributes["io_mode"]), "async"; got != want {
+		t.Errorf("wrong io_mode %q; want %q", got, want)
+	}
+
+	// The second stage decodes the tags and the service blocks.
+	content, remain, diags = remain.PartialContent(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "tags"}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "service", LabelNames: []string{"name"}}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems in second stage: %s", diags.Error())
+	}
+	tagsVal, diags := content.Attributes["tags"].Expr.Value(nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := tagsVal.LengthInt(), 2; got != want {
+		t.Errorf("wrong number of tags %d; want %d", got, want)
+	}
+	if got, want := len(content.Blocks), 1; got != want {
+		t.Fatalf("wrong number of service blocks %d; want %d", got, want)
+	}
+	serviceAttrs, diags := content.Blocks[0].Body.JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := attrStringValue(t, serviceAttrs["listen_addr"]), ":8080"; got != want {
+		t.Errorf("wrong listen_addr %q; want %q", got, want)
+	}
+
+	// The third stage decodes everything that remains, and so must see
+	// the overlays that didn't apply to either of the earlier stages.
+	content, diags = remain.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "name"}, {Name: "extra"}},
+		Blocks:     []hcl.BlockHeaderSchema{{Type: "logging"}},
+	})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems in third stage: %s", diags.Error())
+	}
+	if got, want := attrStringValue(t, content.Attributes["name"]), "from-body"; got != want {
+		t.Errorf("wrong name %q; want %q", got, want)
+	}
+	if got, want := attrStringValue(t, content.Attributes["extra"]), "new"; got != want {
+		t.Errorf("wrong extra %q; want %q", got, want)
+	}
+	if got, want := len(content.Blocks), 0; got != want {
+		t.Errorf("wrong number of logging blocks %d; want %d", got, want)
+	}
+}
+
+func TestApplyOverlaysPartialContentNilRemain(t *testing.T) {
+	o, diags := ParseCLIArgument("extra=new")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	body := ApplyOverlays(nilRemainBody{}, o)
+
+	_, remain, diags := body.PartialContent(&hcl.BodySchema{})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	attrs, diags := remain.JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := attrStringValue(t, attrs["extra"]), "new"; got != want {
+		t.Errorf("wrong extra %q; want %q", got, want)
+	}
+}
+
+// nilRemainBody is an empty hcl.Body whose PartialContent method returns
+// a nil remaining body.
+type nilRemainBody struct {
+	hcl.Body
+}
+
+func (b nilRemainBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	return &hcl.BodyContent{}, nil
+}
+
+func (b nilRemainBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	return &hcl.BodyContent{}, nil, nil
+}
+
+func attrStringValue(t *testing.T, attr *hcl.Attribute) string {
+	t.Helper()
+	if attr == nil {
+		t.Fatalf("attribute is not set")
+	}
+	v, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	return v.AsString()
+}
+
+func TestApplyOverlaysNilOverlays(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "io_mode"}, {Name: "count"}},
+	}
+	mode, diags := ParseCLIArgument("io_mode=async")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	count, diags := ParseCLIArgument("count=2")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+
+	if got := ApplyOverlays(f.Body, nil, nil); got != f.Body {
+		t.Errorf("body with only nil overlays was wrapped as %T", got)
+	}
+
+	bodies := map[string]hcl.Body{
+		"interleaved":    ApplyOverlays(f.Body, nil, mode, nil, count, nil),
+		"separate calls": ApplyOverlays(ApplyOverlays(f.Body, mode, nil), nil, count),
+		"merged":         ApplyOverlays(f.Body, MergeOverlays(nil, mode, nil, count)),
+		"sorted":         ApplyOverlaysSorted(f.Body, nil, mode, nil, count),
+	}
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			content, diags := body.Content(schema)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if got, want := attrStringValue(t, content.Attributes["io_mode"]), "async"; got != want {
+				t.Errorf("wrong io_mode in Content result %q; want %q", got, want)
+			}
+			if got, want := attrStringValue(t, content.Attributes["count"]), "2"; got != want {
+				t.Errorf("wrong count in Content result %q; want %q", got, want)
+			}
+
+			content, _, diags = body.PartialContent(schema)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if got, want := attrStringValue(t, content.Attributes["io_mode"]), "async"; got != want {
+				t.Errorf("wrong io_mode in PartialContent result %q; want %q", got, want)
+			}
+
+			attrs, diags := body.JustAttributes()
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if got, want := attrStringValue(t, attrs["count"]), "2"; got != want {
+				t.Errorf("wrong count in JustAttributes result %q; want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyOverlaysNativeRequired(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode"},
+			{Name: "name", Required: true},
+		},
+	}
+	mode, diags := ParseCLIArgument("io_mode=async")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	name, diags := ParseCLIArgument("name=web")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		_, wantDiags := f.Body.Content(schema)
+		if !wantDiags.HasErrors() {
+			t.Fatalf("inner body did not report the missing argument")
+		}
+
+		bodies := map[string]hcl.Body{
+			"direct":  ApplyOverlaysNativeRequired(f.Body, mode),
+			"nested":  ApplyOverlays(ApplyOverlaysNativeRequired(f.Body, mode), nil),
+			"wrapped": ApplyOverlaysNativeRequired(ApplyOverlays(f.Body, mode), nil),
+		}
+		for name, body := range bodies {
+			t.Run(name, func(t *testing.T) {
+				content, diags := body.Content(schema)
+				if got, want := attrStringValue(t, content.Attributes["io_mode"]), "async"; got != want {
+					t.Errorf("wrong io_mode %q; want %q", got, want)
+				}
+				if diff := cmp.Diff(wantDiags.Error(), diags.Error()); diff != "" {
+					t.Errorf("wrong diagnostics from Content\n%s", diff)
+				}
+
+				_, _, diags = body.PartialContent(schema)
+				if diff := cmp.Diff(wantDiags.Error(), diags.Error()); diff != "" {
+					t.Errorf("wrong diagnostics from PartialContent\n%s", diff)
+				}
+			})
+		}
+	})
+	t.Run("set by overlay", func(t *testing.T) {
+		// An overlay can't satisfy a required argument in this mode, which
+		// is the tradeoff for preserving the inner body's diagnostics.
+		_, diags := ApplyOverlaysNativeRequired(f.Body, name).Content(schema)
+		if !diags.HasErrors() {
+			t.Fatalf("missing required argument was not reported")
+		}
+
+		// ...whereas ApplyOverlays defers the check until after the overlay.
+		_, diags = ApplyOverlays(f.Body, name).Content(schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+
+		// That remains true when ApplyOverlays wraps a body that enforces
+		// requiredness natively, as it would if the bodies were nested.
+		body := ApplyOverlays(ApplyOverlaysNativeRequired(f.Body, mode), name)
+		content, diags := body.Content(schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if got, want := attrStringValue(t, content.Attributes["io_mode"]), "async"; got != want {
+			t.Errorf("wrong io_mode %q; want %q", got, want)
+		}
+		if got, want := attrStringValue(t, content.Attributes["name"]), "web"; got != want {
+			t.Errorf("wrong name %q; want %q", got, want)
+		}
+	})
+}
@@ -0,0 +1,316 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// pathStep is a single step in a path parsed by parseCLIPath.
+type pathStep struct {
+	name string
+
+	// wildcard is set if the step is an unquoted asterisk, which matches
+	// any block label. A quoted asterisk is just a literal name.
+	wildcard bool
+
+	// placeholder is set if the step is an unquoted underscore, which
+	// matches any block label in the same way as a wildcard, except that
+	// the overlay reports an error instead of ignoring it if there are no
+	// matching blocks. In any other position it is just the name "_", and
+	// a quoted underscore is always just a literal name.
+	placeholder bool
+
+	// hasIndex is set if the step has an index suffix like [2], in which
+	// case index is the zero-based index it specifies, or allIndex if the
+	// suffix is [*].
+	hasIndex bool
+	index    int
+}
+
+// allIndex is the index of a pathStep with the suffix [*], which selects
+// all of the blocks matching the preceding steps.
+const allIndex = -1
+
+// parseCLIPath parses the dot-separated path portion of a CLI argument into
+// a sequence of steps.
+//
+// Each step is either an HCL identifier or a double-quoted string using the
+// same escaping conventions as Go string literals. Quoted steps are not
+// required to be valid identifiers, so they can be used to specify block
+// labels that contain dots or other special characters.
+//
+// An unquoted asterisk in place of a block label matches any label.
+//
+// Each step may optionally be followed by a non-negative integer index in
+// square brackets, which selects one of several blocks that have the same
+// type and labels, or by an asterisk in square brackets, which selects all
+// such blocks.
+func parseCLIPath(path string) ([]pathStep, hcl.Diagnostics) {
+	return parseCLIPathNames(path, nil)
+}
+
+// parseCLIPathNames is a variant of parseCLIPath that uses the given
+// function instead of hclsyntax.ValidIdentifier to decide which unquoted
+// steps are acceptable, unless it is nil.
+func parseCLIPathNames(path string, validName func(string) bool) ([]pathStep, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	var steps []pathStep
+
+	remain := path
+	for {
+		var step pathStep
+		if strings.HasPrefix(remain, `"`) {
+			end := quotedLen(remain)
+			if end < 0 {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid argument",
+					Detail:   fmt.Sprintf("Invalid argument %q: unterminated quoted component.", path),
+				})
+				return nil, diags
+			}
+			var err error
+			step.name, err = strconv.Unquote(remain[:end])
+			if err != nil {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid argument",
+					Detail:   fmt.Sprintf("Invalid quoted component %s in argument %q: %s.", remain[:end], path, err),
+				})
+				return nil, diags
+			}
+			remain = remain[end:]
+			if remain != "" && remain[0] != '.' && remain[0] != '[' {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid argument",
+					Detail:   fmt.Sprintf("Invalid argument %q: a quoted component must be followed either by a dot or by the end of the path.", path),
+				})
+				return nil, diags
+			}
+		} else {
+			end := strings.IndexAny(remain, ".[")
+			if end < 0 {
+				end = len(remain)
+			}
+			step.name = remain[:end]
+			remain = remain[end:]
+			step.wildcard = step.name == "*"
+			step.placeholder = step.name == "_"
+			switch {
+			case step.wildcard || step.placeholder:
+				// A wildcard or placeholder is always acceptable here.
+			case validName == nil && !hclsyntax.ValidIdentifier(step.name):
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid argument",
+					Detail:   fmt.Sprintf("Invalid component %q in argument %q: dot-separated parts must be a letter followed by zero or more letters, digits, or underscores.", step.name, path),
+				})
+			case validName != nil && !validName(step.name):
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid argument",
+					Detail:   fmt.Sprintf("Invalid component %q in argument %q.", step.name, path),
+				})
+			}
+		}
+		if strings.HasPrefix(remain, "[") {
+			end := strings.IndexByte(remain, ']')
+			if end < 0 || (remain[1:end] != "*" && !validIndex(remain[1:end])) {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid argument",
+					Detail:   fmt.Sprintf("Invalid argument %q: an index must be a non-negative integer in square brackets, like [0].", path),
+				})
+				return nil, diags
+			}
+			step.hasIndex = true
+			if remain[1:end] == "*" {
+				step.index = allIndex
+			} else {
+				step.index, _ = strconv.Atoi(remain[1:end])
+			}
+			remain = remain[end+1:]
+			if remain != "" && remain[0] != '.' {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid argument",
+					Detail:   fmt.Sprintf("Invalid argument %q: an index must be followed either by a dot or by the end of the path.", path),
+				})
+				return nil, diags
+			}
+		}
+		steps = append(steps, step)
+
+		if remain == "" {
+			break
+		}
+		remain = remain[1:] // skip the dot separator
+	}
+
+	return steps, diags
+}
+
+// validIndex returns true if the given string is a decimal integer that is
+// acceptable as an index in square brackets in a path.
+func validIndex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	_, err := strconv.Atoi(s)
+	return err == nil // fails only if the number is too large
+}
+
+// formatCLIPath is the inverse of parseCLIPath, returning a string that
+// would parse to the given steps.
+func formatCLIPath(steps []pathStep) string {
+	var buf strings.Builder
+	for i, step := range steps {
+		if i > 0 {
+			buf.WriteByte('.')
+		}
+		if step.wildcard || (hclsyntax.ValidIdentifier(step.name) && (step.name != "_" || step.placeholder)) {
+			buf.WriteString(step.name)
+		} else {
+			buf.WriteString(strconv.Quote(step.name))
+		}
+		switch {
+		case step.hasIndex && step.index == allIndex:
+			buf.WriteString("[*]")
+		case step.hasIndex:
+			fmt.Fprintf(&buf, "[%d]", step.index)
+		}
+	}
+	return buf.String()
+}
+
+// stepNames returns the names of the given steps, ignoring any indices.
+func stepNames(steps []pathStep) []string {
+	ret := make([]string, len(steps))
+	for i, step := range steps {
+		ret[i] = step.name
+	}
+	return ret
+}
+
+// namedSteps is the inverse of stepNames, returning a step without an index
+// for each of the given names.
+func namedSteps(names []string) []pathStep {
+	steps := make([]pathStep, len(names))
+	for i, name := range names {
+		steps[i] = pathStep{name: name}
+	}
+	return steps
+}
+
+// labelsMatch returns true if the two given sets of block labels are equal.
+func labelsMatch(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// labelStepsMatch returns true if the given block labels are matched by the
+// given path steps, taking into account any wildcard or placeholder steps.
+func labelStepsMatch(labels []string, steps []pathStep) bool {
+	if len(labels) != len(steps) {
+		return false
+	}
+	for i, step := range steps {
+		if !step.wildcard && !step.placeholder && step.name != labels[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// argRange returns a range covering the given byte offsets within the given
+// CLI argument string, which begins at the given position in a source file
+// with the given name.
+func argRange(filename, raw string, start hcl.Pos, from, to int) hcl.Range {
+	return hcl.Range{
+		Filename: filename,
+		Start:    argPos(raw, start, from),
+		End:      argPos(raw, start, to),
+	}
+}
+
+// argPos returns the position of the given byte offset within the given CLI
+// argument string, which begins at the given position.
+func argPos(raw string, start hcl.Pos, offset int) hcl.Pos {
+	pos := start
+	pos.Byte += offset
+	for _, c := range raw[:offset] {
+		if c == '\n' {
+			pos.Line++
+			pos.Column = 1
+		} else {
+			pos.Column++
+		}
+	}
+	return pos
+}
+
+// indexUnquoted is like strings.IndexByte except that it ignores any
+// occurrences of the given byte that appear inside double-quoted sequences.
+func indexUnquoted(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case c:
+			return i
+		case '"':
+			end := quotedLen(s[i:])
+			if end < 0 {
+				return -1
+			}
+			i += end - 1
+		}
+	}
+	return -1
+}
+
+// lastIndexUnquoted is like strings.LastIndexByte except that it ignores any
+// occurrences of the given byte that appear inside double-quoted sequences,
+// including a trailing quoted sequence that is not terminated.
+func lastIndexUnquoted(s string, c byte) int {
+	last := -1
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case c:
+			last = i
+		case '"':
+			end := quotedLen(s[i:])
+			if end < 0 {
+				return last
+			}
+			i += end - 1
+		}
+	}
+	return last
+}
+
+// quotedLen returns the length of the double-quoted sequence at the start of
+// the given string, including both quotes, or -1 if the quoted sequence is
+// not terminated.
+func quotedLen(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++ // skip the escaped character
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
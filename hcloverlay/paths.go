@@ -0,0 +1,53 @@
+package hcloverlay
+
+// PathReporter is an optional interface implemented by overlays that can
+// report which arguments or blocks they affect without being applied, which
+// can be useful for describing overlays in a user interface or for
+// detecting when more than one overlay affects the same argument.
+//
+// Callers should use a type assertion to determine whether a particular
+// overlay implements PathReporter. Overlays whose effect can't be known
+// without applying them, such as those returned by NewFuncOverlay, do not.
+type PathReporter interface {
+	// AffectedPaths returns the paths of the arguments or blocks that the
+	// overlay might affect, with each path given as a sequence of steps in
+	// the same form as the arguments to NewCLIArgumentOverlay.
+	//
+	// An unquoted wildcard or placeholder label in the path the overlay was
+	// created from appears as a step "*" or "_" respectively, and any index
+	// in square brackets is omitted, so a path may describe more than one
+	// block.
+	AffectedPaths() [][]string
+}
+
+var (
+	_ PathReporter = (*cliArgOverlay)(nil)
+	_ PathReporter = (*mergedOverlay)(nil)
+	_ PathReporter = (*priorityOverlay)(nil)
+)
+
+func (o *cliArgOverlay) AffectedPaths() [][]string {
+	return [][]string{stepNames(o.steps)}
+}
+
+// AffectedPaths returns the paths affected by all of the merged overlays
+// that are themselves PathReporters, in the order the overlays are applied.
+// Any merged overlays that are not PathReporters are ignored.
+func (o *mergedOverlay) AffectedPaths() [][]string {
+	var ret [][]string
+	for _, ov := range o.overlays {
+		if pr, ok := ov.(PathReporter); ok {
+			ret = append(ret, pr.AffectedPaths()...)
+		}
+	}
+	return ret
+}
+
+// AffectedPaths returns the paths affected by the wrapped overlay, or nil
+// if it is not a PathReporter.
+func (o *priorityOverlay) AffectedPaths() [][]string {
+	if pr, ok := o.Overlay.(PathReporter); ok {
+		return pr.AffectedPaths()
+	}
+	return nil
+}
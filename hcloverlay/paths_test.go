@@ -0,0 +1,76 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestAffectedPaths(t *testing.T) {
+	parseArg := func(raw string) Overlay {
+		o, diags := ParseCLIArgument(raw)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+	remove, diags := NewRemoveOverlay("service.http.web")
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	fn := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		return content, nil
+	})
+
+	tests := map[string]struct {
+		Overlay Overlay
+		Want    [][]string
+	}{
+		"attribute": {
+			parseArg("io_mode=async"),
+			[][]string{{"io_mode"}},
+		},
+		"quoted label": {
+			parseArg(`service.http."web.prod".listen_addr=:80`),
+			[][]string{{"service", "http", "web.prod", "listen_addr"}},
+		},
+		"wildcard and index": {
+			parseArg(`service.*.web[1].listen_addr=:80`),
+			[][]string{{"service", "*", "web", "listen_addr"}},
+		},
+		"remove": {
+			remove,
+			[][]string{{"service", "http", "web"}},
+		},
+		"merged": {
+			MergeOverlays(parseArg("io_mode=async"), fn, remove),
+			[][]string{{"io_mode"}, {"service", "http", "web"}},
+		},
+		"priority": {
+			WithPriority(parseArg("io_mode=async"), 1),
+			[][]string{{"io_mode"}},
+		},
+		"priority with other overlay": {
+			WithPriority(fn, 1),
+			nil,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			pr, ok := test.Overlay.(PathReporter)
+			if !ok {
+				t.Fatalf("%T is not a PathReporter", test.Overlay)
+			}
+			got := pr.AffectedPaths()
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Errorf("wrong paths\n%s", diff)
+			}
+		})
+	}
+
+	if _, ok := fn.(PathReporter); ok {
+		t.Errorf("function overlay is a PathReporter")
+	}
+}
@@ -0,0 +1,98 @@
+package hcloverlay
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// NewLabelPredicateOverlay returns an overlay that sets the argument named
+// attr to the given string value inside every block of the given type whose
+// labels satisfy the given predicate function, such as all "service" blocks
+// whose name starts with "test-".
+//
+// This is a more general form of the wildcard label matching available in
+// arguments to ParseCLIArgument, for situations where the blocks to modify
+// cannot be described by exact labels. The predicate function must not
+// modify the labels it is given, and must be deterministic as described for
+// the Overlay interface.
+//
+// Because the labels of a new block cannot be derived from a predicate, the
+// overlay never creates new blocks and has no effect if no existing blocks
+// match. The block type must be declared in the schema used for decoding,
+// and attr must be an argument in the schema of the blocks' bodies.
+func NewLabelPredicateOverlay(blockType string, match func(labels []string) bool, attr, value string) Overlay {
+	return &labelPredicateOverlay{
+		blockType: blockType,
+		match:     match,
+		attr:      attr,
+		value:     value,
+	}
+}
+
+type labelPredicateOverlay struct {
+	blockType string
+	match     func(labels []string) bool
+	attr      string
+	value     string
+}
+
+func (o *labelPredicateOverlay) String() string {
+	return fmt.Sprintf("%s.*.%s: set to %s in blocks selected by a function", o.blockType, o.attr, formatValue(cty.StringVal(o.value)))
+}
+
+func (o *labelPredicateOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	ret, remain, diags := o.PartialApplyOverlay(content, schema)
+	if remain != nil {
+		diags = diags.Append(o.unexpectedBlockTypeError())
+	}
+	return ret, diags
+}
+
+func (o *labelPredicateOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	found := false
+	for _, blockS := range schema.Blocks {
+		if blockS.Type == o.blockType {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return content, o, nil
+	}
+
+	content = ensureContent(content)
+	for _, block := range content.Blocks {
+		if block.Type != o.blockType || !o.match(block.Labels) {
+			continue
+		}
+		steps := []pathStep{{name: block.Type}}
+		for _, label := range block.Labels {
+			steps = append(steps, pathStep{name: label})
+		}
+		steps = append(steps, pathStep{name: o.attr})
+		block.Body = ApplyOverlays(block.Body, &cliArgOverlay{
+			fullPath: formatCLIPath(steps),
+			steps:    steps[len(steps)-1:],
+			op:       cliArgSet,
+			expr:     hcl.StaticExpr(cty.StringVal(o.value), hcl.Range{}),
+		})
+	}
+	return content, nil, nil
+}
+
+func (o *labelPredicateOverlay) ApplyJustAttributes(attrs hcl.Attributes) (hcl.Attributes, hcl.Diagnostics) {
+	// There can be no blocks in "just attributes" mode.
+	var diags hcl.Diagnostics
+	diags = diags.Append(o.unexpectedBlockTypeError())
+	return attrs, diags
+}
+
+func (o *labelPredicateOverlay) unexpectedBlockTypeError() *hcl.Diagnostic {
+	return &hcl.Diagnostic{
+		Severity: hcl.DiagError,
+		Summary:  "Invalid argument",
+		Detail:   fmt.Sprintf("Unexpected block type %q.", o.blockType),
+	}
+}
@@ -0,0 +1,115 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestNewLabelPredicateOverlay(t *testing.T) {
+	type Service struct {
+		Name     string `hcl:"name,label"`
+		LogLevel string `hcl:"log_level,optional"`
+	}
+	type Config struct {
+		Services []Service `hcl:"service,block"`
+	}
+	testService := func(labels []string) bool {
+		return strings.HasPrefix(labels[0], "test-")
+	}
+
+	tests := map[string]struct {
+		Config    string
+		BlockType string
+		Attr      string
+		Want      Config
+		WantErr   string
+	}{
+		"some match": {
+			`
+			service "test-a" {}
+			service "prod" { log_level = "warn" }
+			service "test-b" { log_level = "info" }
+			`,
+			"service",
+			"log_level",
+			Config{
+				Services: []Service{
+					{Name: "test-a", LogLevel: "debug"},
+					{Name: "prod", LogLevel: "warn"},
+					{Name: "test-b", LogLevel: "debug"},
+				},
+			},
+			``,
+		},
+		"none match": {
+			`
+			service "prod" {}
+			`,
+			"service",
+			"log_level",
+			Config{
+				Services: []Service{
+					{Name: "prod"},
+				},
+			},
+			``,
+		},
+		"no blocks": {
+			``,
+			"service",
+			"log_level",
+			Config{},
+			``,
+		},
+		"unexpected argument": {
+			`
+			service "test-a" {}
+			`,
+			"service",
+			"log_levle",
+			Config{},
+			`Unexpected argument "service.test-a.log_levle". Did you mean "log_level"?`,
+		},
+		"unexpected block type": {
+			``,
+			"servce",
+			"log_level",
+			Config{},
+			`Unexpected block type "servce".`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "", hcl.Pos{})
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			o := NewLabelPredicateOverlay(test.BlockType, testService, test.Attr, "debug")
+			var got Config
+			diags = gohcl.DecodeBody(ApplyOverlays(f.Body, o), nil, &got)
+			if diags.HasErrors() {
+				errStr := diags.Error()
+				if test.WantErr == "" {
+					t.Fatalf("unexpected problems: %s", errStr)
+				}
+				if !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if test.WantErr != "" {
+				t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package hcloverlay
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// NewRemovePrefixOverlay returns an overlay that removes everything whose
+// path starts with the given prefix, which uses the same dot-separated
+// syntax as the part before the equals sign in arguments to
+// ParseCLIArgument, such as to clear all of the settings for one service
+// in an interactive session.
+//
+// If the prefix ends with the name of an argument then that argument is
+// removed. Otherwise the prefix selects blocks, and it may end after the
+// block type or after any number of its labels: all of the blocks whose
+// type and leading labels match the prefix, not just the first, then have
+// their bodies replaced with empty bodies. The blocks themselves remain, so
+// that their labels are still present, and so a block type with required
+// arguments reports them as missing unless later overlays set them. If the
+// prefix continues after the labels of a block type then it traverses into
+// the bodies of the matching blocks, selecting nested arguments or blocks
+// in the same way. Wildcard labels are allowed, but indices are not.
+//
+// The overlay removes whatever matches at the point where it is applied,
+// regardless of whether it came from the configuration or from earlier
+// overlays, because the content it operates on doesn't distinguish between
+// those. Overlays after it in the same sequence are applied to the result,
+// so they can set new values under the prefix. To undo only the changes
+// made by earlier overlays, omit those overlays or use NewResetOverlay.
+//
+// If nothing matches the prefix then the overlay has no effect, and it
+// never creates new blocks.
+func NewRemovePrefixOverlay(prefix string) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(prefix)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	for _, step := range steps {
+		if step.hasIndex {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid argument",
+				Detail:   fmt.Sprintf("Invalid prefix %q: a prefix to remove can't include an index, because it always selects all of the matching blocks.", prefix),
+			})
+			return nil, diags
+		}
+	}
+
+	return &removePrefixOverlay{
+		fullPath: prefix,
+		steps:    steps,
+	}, diags
+}
+
+// removePrefixOverlay is the overlay implementation returned by
+// NewRemovePrefixOverlay.
+type removePrefixOverlay struct {
+	fullPath string
+	steps    []pathStep
+}
+
+func (o *removePrefixOverlay) String() string {
+	return o.fullPath + ": remove everything under this prefix"
+}
+
+func (o *removePrefixOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	ret, remain, diags := o.PartialApplyOverlay(content, schema)
+	if remain != nil {
+		detail := fmt.Sprintf("Unexpected prefix %q to remove: %q is not an expected argument or block type.", o.fullPath, o.steps[0].name)
+		if suggestion := schemaNameSuggestion(o.steps[0].name, schema); suggestion != "" {
+			detail += fmt.Sprintf(" Did you mean %q?", suggestion)
+		}
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   detail,
+		})
+	}
+	return ret, diags
+}
+
+func (o *removePrefixOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	content = ensureContent(content)
+	name := o.steps[0].name
+
+	for _, blockS := range schema.Blocks {
+		if blockS.Type != name {
+			continue
+		}
+		headerLen := 1 + len(blockS.LabelNames)
+		labelSteps := o.steps[1:]
+		if len(labelSteps) > len(blockS.LabelNames) {
+			labelSteps = labelSteps[:len(blockS.LabelNames)]
+		}
+
+		var sub *removePrefixOverlay
+		if len(o.steps) > headerLen {
+			sub = &removePrefixOverlay{
+				fullPath: o.fullPath,
+				steps:    o.steps[headerLen:],
+			}
+		}
+		for _, block := range content.Blocks {
+			if block.Type == blockS.Type && len(block.Labels) != len(blockS.LabelNames) {
+				diags = diags.Append(labelArityError(fmt.Sprintf("prefix %q to remove", o.fullPath), block, blockS))
+				return content, nil, diags
+			}
+		}
+		// The blocks in the content belong to it, so we can modify them
+		// in place, as described for Overlay.ApplyOverlay.
+		for _, block := range content.Blocks {
+			if block.Type != blockS.Type || !labelStepsMatch(block.Labels[:len(labelSteps)], labelSteps) {
+				continue
+			}
+			if sub != nil {
+				block.Body = ApplyOverlays(block.Body, sub)
+				continue
+			}
+			block.Body = newCreatedBody(block.Body.MissingItemRange())
+		}
+		return content, nil, diags
+	}
+
+	if schemaHasName(schema, name) {
+		if len(o.steps) > 1 {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid argument",
+				Detail:   fmt.Sprintf("Invalid prefix %q to remove: %q is an argument, so the prefix must end after its name.", o.fullPath, name),
+			})
+			return content, nil, diags
+		}
+		delete(content.Attributes, name)
+		return content, nil, diags
+	}
+
+	return content, o, diags
+}
+
+func (o *removePrefixOverlay) ApplyJustAttributes(attrs hcl.Attributes) (hcl.Attributes, hcl.Diagnostics) {
+	// Without a schema, everything is an argument, and so only a prefix
+	// that consists of just an argument name can match anything.
+	if len(o.steps) == 1 {
+		delete(attrs, o.steps[0].name)
+	}
+	return attrs, nil
+}
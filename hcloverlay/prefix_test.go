@@ -0,0 +1,246 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestNewRemovePrefixOverlay(t *testing.T) {
+	type TLS struct {
+		Cert string `hcl:"cert,optional"`
+		Key  string `hcl:"key,optional"`
+	}
+	type Service struct {
+		Type       string `hcl:"type,label"`
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr,optional"`
+		Replicas   int    `hcl:"replicas,optional"`
+		TLS        *TLS   `hcl:"tls,block"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode,optional"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	tests := map[string]struct {
+		Before  []string
+		Prefix  string
+		After   []string
+		Want    Config
+		WantErr string
+	}{
+		"argument": {
+			Prefix: "io_mode",
+			Want: Config{
+				Services: []Service{
+					{Type: "http", Name: "web", ListenAddr: ":80", Replicas: 2, TLS: &TLS{Cert: "web.pem", Key: "web.key"}},
+					{Type: "http", Name: "admin", ListenAddr: ":81"},
+					{Type: "grpc", Name: "web", ListenAddr: ":82"},
+				},
+			},
+		},
+		"all labels": {
+			Prefix: "service.http.web",
+			Want: Config{
+				IOMode: "sync",
+				Services: []Service{
+					{Type: "http", Name: "web"},
+					{Type: "http", Name: "admin", ListenAddr: ":81"},
+					{Type: "grpc", Name: "web", ListenAddr: ":82"},
+				},
+			},
+		},
+		"some labels": {
+			Prefix: "service.http",
+			Want: Config{
+				IOMode: "sync",
+				Services: []Service{
+					{Type: "http", Name: "web"},
+					{Type: "http", Name: "admin"},
+					{Type: "grpc", Name: "web", ListenAddr: ":82"},
+				},
+			},
+		},
+		"block type": {
+			Prefix: "service",
+			Want: Config{
+				IOMode: "sync",
+				Services: []Service{
+					{Type: "http", Name: "web"},
+					{Type: "http", Name: "admin"},
+					{Type: "grpc", Name: "web"},
+				},
+			},
+		},
+		"wildcard label": {
+			Prefix: "service.*.web",
+			Want: Config{
+				IOMode: "sync",
+				Services: []Service{
+					{Type: "http", Name: "web"},
+					{Type: "http", Name: "admin", ListenAddr: ":81"},
+					{Type: "grpc", Name: "web"},
+				},
+			},
+		},
+		"nested block": {
+			Prefix: "service.http.web.tls",
+			Want: Config{
+				IOMode: "sync",
+				Services: []Service{
+					{Type: "http", Name: "web", ListenAddr: ":80", Replicas: 2, TLS: &TLS{}},
+					{Type: "http", Name: "admin", ListenAddr: ":81"},
+					{Type: "grpc", Name: "web", ListenAddr: ":82"},
+				},
+			},
+		},
+		"nested argument": {
+			Prefix: "service.http.web.tls.key",
+			Want: Config{
+				IOMode: "sync",
+				Services: []Service{
+					{Type: "http", Name: "web", ListenAddr: ":80", Replicas: 2, TLS: &TLS{Cert: "web.pem"}},
+					{Type: "http", Name: "admin", ListenAddr: ":81"},
+					{Type: "grpc", Name: "web", ListenAddr: ":82"},
+				},
+			},
+		},
+		"no match": {
+			Prefix: "service.http.api",
+			Want: Config{
+				IOMode: "sync",
+				Services: []Service{
+					{Type: "http", Name: "web", ListenAddr: ":80", Replicas: 2, TLS: &TLS{Cert: "web.pem", Key: "web.key"}},
+					{Type: "http", Name: "admin", ListenAddr: ":81"},
+					{Type: "grpc", Name: "web", ListenAddr: ":82"},
+				},
+			},
+		},
+		// The overlay affects everything present where it's applied,
+		// including content from earlier overlays, while later overlays
+		// apply to its result.
+		"earlier and later overlays": {
+			Before: []string{"service.http.web.replicas:=5", "service.http.api.listen_addr=:83"},
+			Prefix: "service.http",
+			After:  []string{"service.http.web.listen_addr=:8080"},
+			Want: Config{
+				IOMode: "sync",
+				Services: []Service{
+					{Type: "http", Name: "web", ListenAddr: ":8080"},
+					{Type: "http", Name: "admin"},
+					{Type: "grpc", Name: "web", ListenAddr: ":82"},
+					{Type: "http", Name: "api"},
+				},
+			},
+		},
+		"unexpected name": {
+			Prefix:  "servic.http",
+			WantErr: `Unexpected prefix "servic.http" to remove: "servic" is not an expected argument or block type. Did you mean "service"?`,
+		},
+		"beyond an argument": {
+			Prefix:  "io_mode.foo",
+			WantErr: `Invalid prefix "io_mode.foo" to remove: "io_mode" is an argument, so the prefix must end after its name.`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+
+service "http" "web" {
+  listen_addr = ":80"
+  replicas    = 2
+  tls {
+    cert = "web.pem"
+    key  = "web.key"
+  }
+}
+
+service "http" "admin" {
+  listen_addr = ":81"
+}
+
+service "grpc" "web" {
+  listen_addr = ":82"
+}
+`), "config.hcl", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			var overlays []Overlay
+			parseArgs := func(raws []string) {
+				for _, raw := range raws {
+					o, diags := ParseCLIArgument(raw)
+					if diags.HasErrors() {
+						t.Fatalf("arg has problems: %s", diags.Error())
+					}
+					overlays = append(overlays, o)
+				}
+			}
+			parseArgs(test.Before)
+			o, diags := NewRemovePrefixOverlay(test.Prefix)
+			if diags.HasErrors() {
+				t.Fatalf("prefix has problems: %s", diags.Error())
+			}
+			overlays = append(overlays, o)
+			parseArgs(test.After)
+
+			var got Config
+			diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, &got)
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewRemovePrefixOverlayInvalid(t *testing.T) {
+	_, diags := NewRemovePrefixOverlay("service.http.web[1]")
+	want := `Invalid prefix "service.http.web[1]": a prefix to remove can't include an index`
+	if got := diags.Error(); !strings.Contains(got, want) {
+		t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestNewRemovePrefixOverlayJustAttributes(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+a = 1
+b = 2
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	o, diags := NewRemovePrefixOverlay("a")
+	if diags.HasErrors() {
+		t.Fatalf("prefix has problems: %s", diags.Error())
+	}
+	attrs, diags := ApplyOverlays(f.Body, o).JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if _, exists := attrs["a"]; exists {
+		t.Errorf("attribute a was not removed")
+	}
+	if _, exists := attrs["b"]; !exists {
+		t.Errorf("attribute b was removed")
+	}
+}
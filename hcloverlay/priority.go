@@ -0,0 +1,80 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// WithPriority returns an overlay that behaves exactly like the given
+// overlay but that is annotated with the given priority, which decides
+// where ApplyOverlaysSorted places it relative to other overlays.
+//
+// Overlays that have not been wrapped by WithPriority have priority zero.
+func WithPriority(o Overlay, p int) Overlay {
+	if po, ok := o.(*priorityOverlay); ok {
+		o = po.Overlay // replace the existing priority, rather than nesting
+	}
+	return &priorityOverlay{
+		Overlay:  o,
+		priority: p,
+	}
+}
+
+// ApplyOverlaysSorted is like ApplyOverlays except that it first sorts the
+// given overlays by their priorities as given to WithPriority, so that
+// overlays with a higher priority are applied after, and thus take
+// precedence over, those with a lower priority. Overlays with equal priority
+// are applied in the order they were given.
+//
+// For example, an application might give overlays derived from environment
+// variables priority 1 and overlays derived from command line arguments
+// priority 2, so that command line arguments always override environment
+// variables regardless of the order in which the overlays were collected.
+//
+// The priority decides only the order in which the overlays are applied,
+// and so the usual rules for combining overlays that affect the same
+// argument still apply to the result of sorting. An overlay that replaces
+// an argument discards the effect of any overlays for that argument with
+// lower priority, including those that append to it, while an overlay that
+// appends to an argument builds on the result of any overlays with lower
+// priority. The order of overlays with the same priority therefore still
+// matters when more than one of them affects the same argument.
+//
+// If the given body is itself the result of an earlier call to
+// ApplyOverlays or ApplyOverlaysSorted then the new overlays are always
+// applied after the existing ones, regardless of priority.
+func ApplyOverlaysSorted(body hcl.Body, overlays ...Overlay) hcl.Body {
+	sorted := make([]Overlay, len(overlays))
+	copy(sorted, overlays)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return overlayPriority(sorted[i]) < overlayPriority(sorted[j])
+	})
+	return ApplyOverlays(body, sorted...)
+}
+
+func overlayPriority(o Overlay) int {
+	if po, ok := o.(*priorityOverlay); ok {
+		return po.priority
+	}
+	return 0
+}
+
+// priorityOverlay is the overlay implementation returned by WithPriority.
+type priorityOverlay struct {
+	Overlay
+	priority int
+}
+
+func (o *priorityOverlay) String() string {
+	return fmt.Sprintf("%s (priority %d)", overlayString(o.Overlay), o.priority)
+}
+
+func (o *priorityOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	content, remain, diags := o.Overlay.PartialApplyOverlay(content, schema)
+	if remain != nil {
+		remain = WithPriority(remain, o.priority)
+	}
+	return content, remain, diags
+}
@@ -0,0 +1,88 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestApplyOverlaysSorted(t *testing.T) {
+	type Service struct {
+		Name     string `hcl:"name,label"`
+		LogLevel string `hcl:"log_level"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Tags     []string  `hcl:"tags"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+tags = ["config"]
+`), "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	parseArg := func(raw string) Overlay {
+		o, diags := ParseCLIArgument(raw)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+
+	const (
+		defaults = iota
+		env
+		cli
+	)
+	overlays := []Overlay{
+		WithPriority(parseArg("io_mode=cli"), cli),
+		WithPriority(parseArg("tags+=cli"), cli),
+		WithPriority(parseArg("io_mode=env"), env),
+		WithPriority(parseArg("tags+=env"), env),
+		// Service overlays must still work with the remaining overlays
+		// from PartialApplyOverlay inside the block.
+		WithPriority(parseArg("service.web.log_level=cli"), cli),
+		WithPriority(parseArg("service.web.log_level=env"), env),
+		parseArg("tags+=default"), // priority zero, same as defaults
+		WithPriority(parseArg("io_mode=default"), defaults),
+	}
+
+	var got Config
+	diags = gohcl.DecodeBody(ApplyOverlaysSorted(f.Body, overlays...), nil, &got)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := Config{
+		IOMode:   "cli",
+		Tags:     []string{"config", "default", "env", "cli"},
+		Services: []Service{{Name: "web", LogLevel: "cli"}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("incorrect result\n%s", diff)
+	}
+
+	// The given slice must not be reordered.
+	if got, want := overlayPriority(overlays[0]), cli; got != want {
+		t.Errorf("first overlay has priority %d after sorting; want %d", got, want)
+	}
+}
+
+func TestWithPriorityReplace(t *testing.T) {
+	o := WithPriority(WithPriority(NewFuncOverlay(nil), 1), 2)
+	po, ok := o.(*priorityOverlay)
+	if !ok {
+		t.Fatalf("result is %T, not *priorityOverlay", o)
+	}
+	if _, nested := po.Overlay.(*priorityOverlay); nested {
+		t.Errorf("priority overlays are nested")
+	}
+	if got, want := overlayPriority(o), 2; got != want {
+		t.Errorf("wrong priority %d; want %d", got, want)
+	}
+}
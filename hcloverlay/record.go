@@ -0,0 +1,209 @@
+package hcloverlay
+
+import (
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// NewRecordingOverlay returns an overlay that behaves like the given overlay
+// except that it also records in the given map the path of each argument
+// that the given overlay sets, so that an application can tell after
+// decoding which values came from overlays rather than from the original
+// configuration, such as for audit logging.
+//
+// The keys of the map are paths in the syntax accepted by ParseCLIArgument,
+// such as "io_mode" or "service.http.web.listen_addr", and the value for
+// each is always true. Arguments that the overlay removes are not recorded.
+//
+// Paths are recorded as the overlay is applied, which happens only when the
+// body returned by ApplyOverlays is decoded. Arguments inside blocks are
+// recorded only when the content of the block is decoded in turn, and that
+// includes the arguments of blocks the overlay creates and blocks whose
+// entire content comes from the overlay, such as new blocks from a body
+// given to NewBodyOverlay. The map is therefore complete only after the
+// application has finished decoding everything it needs.
+//
+// The overlay serializes its own updates to the map, so the resulting body
+// can be decoded concurrently as usual, but the caller must not access the
+// map until decoding is complete.
+//
+// If the given overlay is nil then the result is also nil, which
+// ApplyOverlays ignores.
+func NewRecordingOverlay(inner Overlay, record map[string]bool) Overlay {
+	if inner == nil {
+		return nil
+	}
+	return &recordingOverlay{
+		inner: inner,
+		rec: &overlayRecord{
+			paths: record,
+		},
+	}
+}
+
+// overlayRecord is the destination for paths recorded by recordingOverlay,
+// shared between all of the overlays derived from a single call to
+// NewRecordingOverlay.
+type overlayRecord struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+func (r *overlayRecord) add(steps []pathStep) {
+	path := formatCLIPath(steps)
+	r.mu.Lock()
+	r.paths[path] = true
+	r.mu.Unlock()
+}
+
+// recordingOverlay is the overlay implementation returned by
+// NewRecordingOverlay.
+type recordingOverlay struct {
+	// inner is the overlay whose changes are recorded. If it is nil then
+	// the overlay instead records all of the content it is applied to,
+	// which is how we handle blocks whose content came entirely from an
+	// overlay.
+	inner Overlay
+
+	rec *overlayRecord
+
+	// prefix is the path of the block whose body the overlay is applied to,
+	// if any, which is prepended to the recorded paths.
+	prefix []pathStep
+}
+
+func (o *recordingOverlay) String() string {
+	if o.inner == nil {
+		return "record all content"
+	}
+	return overlayString(o.inner)
+}
+
+func (o *recordingOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	if o.inner == nil {
+		o.recordContent(nil, content, nil)
+		return content, nil
+	}
+	// We give the inner overlay a copy of the content, so that we can
+	// compare the result with the original, as ExplainOverlay does.
+	before := ensureContent(content)
+	working, blockIdx := copyContentIndexed(before)
+	after, diags := o.inner.ApplyOverlay(working, schema)
+	after = ensureContent(after)
+	o.recordContent(before, after, blockIdx)
+	return after, diags
+}
+
+func (o *recordingOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	if o.inner == nil {
+		o.recordContent(nil, content, nil)
+		return content, nil, nil
+	}
+	before := ensureContent(content)
+	working, blockIdx := copyContentIndexed(before)
+	after, remain, diags := o.inner.PartialApplyOverlay(working, schema)
+	after = ensureContent(after)
+	o.recordContent(before, after, blockIdx)
+	if remain != nil {
+		remain = o.withInner(remain)
+	}
+	return after, remain, diags
+}
+
+func (o *recordingOverlay) ApplyJustAttributes(attrs hcl.Attributes) (hcl.Attributes, hcl.Diagnostics) {
+	if o.inner == nil {
+		o.recordAttributes(nil, attrs)
+		return attrs, nil
+	}
+	before := copyAttributes(attrs)
+	attrs, diags := o.inner.ApplyJustAttributes(attrs)
+	o.recordAttributes(before, attrs)
+	return attrs, diags
+}
+
+func (o *recordingOverlay) withInner(inner Overlay) *recordingOverlay {
+	return &recordingOverlay{
+		inner:  inner,
+		rec:    o.rec,
+		prefix: o.prefix,
+	}
+}
+
+// recordAttributes records the paths of the attributes in after that are
+// not also in before, or all of them if the overlay has no inner overlay.
+func (o *recordingOverlay) recordAttributes(before, after hcl.Attributes) {
+	for name, attr := range after {
+		if o.inner != nil && before[name] == attr {
+			continue
+		}
+		o.rec.add(o.childPath(name))
+	}
+}
+
+// recordContent records the attributes that changed between the given
+// content before and after applying the overlay, and then arranges for the
+// bodies of any blocks that changed to be recorded when they are decoded.
+// blockIdx maps the blocks that were given to the inner overlay to their
+// indices in the "before" content.
+//
+// If the overlay has no inner overlay then before and blockIdx are ignored
+// and all of the content is recorded.
+func (o *recordingOverlay) recordContent(before, after *hcl.BodyContent, blockIdx map[*hcl.Block]int) {
+	if o.inner == nil {
+		before = &hcl.BodyContent{}
+	}
+	o.recordAttributes(before.Attributes, after.Attributes)
+
+	for _, block := range after.Blocks {
+		var prior hcl.Body
+		if i, existed := blockIdx[block]; existed {
+			prior = before.Blocks[i].Body
+			if block.Body == prior {
+				continue // unchanged
+			}
+		}
+		steps := make([]string, 0, len(block.Labels)+1)
+		steps = append(steps, block.Type)
+		steps = append(steps, block.Labels...)
+		sub := &recordingOverlay{
+			rec:    o.rec,
+			prefix: o.childPath(steps...),
+		}
+
+		// If the overlay wrapped the block's body then we can record just
+		// the overlays it added, as ExplainOverlay does. Otherwise the
+		// whole content of the block came from the overlay.
+		applied, ok := block.Body.(*applyBody)
+		if !ok || o.inner == nil {
+			block.Body = ApplyOverlays(block.Body, sub)
+			continue
+		}
+		base, added := applied.inner, applied.overlays
+		if prior, ok := prior.(*applyBody); ok && prior.inner == applied.inner {
+			base, added = prior, added[len(prior.overlays):]
+		}
+		recorded := make([]Overlay, len(added))
+		for i, ov := range added {
+			recorded[i] = sub.withInner(ov)
+		}
+		block.Body = applyOverlays(base, recorded, applied.nativeRequired)
+	}
+}
+
+// copyContentIndexed is like copyBodyContent but also returns a map from
+// each of the copied blocks to its index.
+func copyContentIndexed(content *hcl.BodyContent) (*hcl.BodyContent, map[*hcl.Block]int) {
+	ret := copyBodyContent(content)
+	blockIdx := make(map[*hcl.Block]int, len(ret.Blocks))
+	for i, block := range ret.Blocks {
+		blockIdx[block] = i
+	}
+	return ret, blockIdx
+}
+
+func (o *recordingOverlay) childPath(names ...string) []pathStep {
+	ret := make([]pathStep, 0, len(o.prefix)+len(names))
+	ret = append(ret, o.prefix...)
+	return append(ret, namedSteps(names)...)
+}
@@ -0,0 +1,129 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestNewRecordingOverlay(t *testing.T) {
+	type Service struct {
+		Type       string `hcl:"type,label"`
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+		LogLevel   string `hcl:"log_level,optional"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Count    int       `hcl:"count,optional"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+count   = 1
+
+service "http" "web" {
+  listen_addr = ":80"
+}
+service "http" "api" {
+  listen_addr = ":81"
+}
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	overrideF, diags := hclsyntax.ParseConfig([]byte(`
+service "http" "admin" {
+  listen_addr = ":82"
+}
+`), "override.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("override config has problems: %s", diags.Error())
+	}
+
+	var overlays []Overlay
+	for _, arg := range []string{
+		`io_mode=async`,
+		`service.http.web.log_level=debug`,
+		`service.grpc.internal.listen_addr=:90`,
+	} {
+		o, diags := ParseCLIArgument(arg)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+	remove, diags := NewRemoveOverlay(`count`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	overlays = append(overlays, remove, NewBodyOverlay(overrideF.Body))
+
+	got := make(map[string]bool)
+	body := ApplyOverlays(f.Body, NewRecordingOverlay(MergeOverlays(overlays...), got))
+
+	// An unrecorded overlay applied alongside the recorded ones must not
+	// have its changes recorded.
+	unrecorded, diags := ParseCLIArgument(`service.http.api.log_level=warn`)
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	body = ApplyOverlays(body, unrecorded)
+
+	var config Config
+	diags = gohcl.DecodeBody(body, nil, &config)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+
+	want := map[string]bool{
+		"io_mode":                           true,
+		"service.http.web.log_level":        true,
+		"service.grpc.internal.listen_addr": true,
+		"service.http.admin.listen_addr":    true,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("wrong recorded paths\n%s", diff)
+	}
+}
+
+func TestNewRecordingOverlayJustAttributes(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+count   = "1"
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	o, diags := ParseCLIArguments([]string{`io_mode=async`, `count=2`})
+	if diags.HasErrors() {
+		t.Fatalf("args have problems: %s", diags.Error())
+	}
+	reset, diags := NewResetOverlay(`count`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+
+	// The reset overlay restores the original definition of count, so that
+	// it is not recorded even though an earlier overlay changed it.
+	got := make(map[string]bool)
+	body := ApplyOverlays(f.Body, NewRecordingOverlay(MergeOverlays(o, reset), got))
+	attrs, diags := body.JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if got, want := attrStringValue(t, attrs["count"]), "1"; got != want {
+		t.Errorf("wrong count %q; want %q", got, want)
+	}
+
+	want := map[string]bool{
+		"io_mode": true,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("wrong recorded paths\n%s", diff)
+	}
+}
@@ -0,0 +1,60 @@
+package hcloverlay
+
+import (
+	"github.com/hashicorp/hcl/v2"
+)
+
+// NewRemoveOverlay returns an overlay that removes the argument or block
+// indicated by the given path, which uses the same dot-separated syntax as
+// the part before the equals sign in arguments to ParseCLIArgument.
+//
+// If the path ends with the name of an argument then that argument is
+// removed. If the path ends immediately after the labels of a block then
+// the first block with that type and those labels is removed.
+//
+// If the indicated argument or block is not present then the overlay has no
+// effect. In particular, unlike the overlays returned by ParseCLIArgument,
+// a removal overlay never creates new blocks while traversing the path.
+func NewRemoveOverlay(path string) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgRemove,
+	}, diags
+}
+
+// NewRemoveBlockTypeOverlay returns an overlay that removes all of the blocks
+// of the type given in the final step of the given path, regardless of
+// their labels. The steps before the final step, if any, select the blocks
+// that contain the blocks to remove, using the same dot-separated syntax as
+// the part before the equals sign in arguments to ParseCLIArgument.
+//
+// For example, the path "service" removes all of the "service" blocks from
+// the body the overlay is applied to, while "group.a.service" removes the
+// "service" blocks only from inside the first "group" block labelled "a".
+// Use a wildcard or the index [*] to select more than one containing block,
+// as in "group.*.service".
+//
+// This is useful in conjunction with other overlays that then add new blocks
+// of the same type, so that the new blocks replace the original ones rather
+// than being appended to them.
+//
+// As with NewRemoveOverlay, the overlay never creates new blocks while
+// traversing the path and has no effect if there are no matching blocks.
+func NewRemoveBlockTypeOverlay(path string) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgRemoveType,
+	}, diags
+}
@@ -0,0 +1,411 @@
+package hcloverlay
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestNewRemoveOverlay(t *testing.T) {
+	type BlockNoLabels struct {
+		Foo *string `hcl:"foo"`
+	}
+	type BlockOneLabel struct {
+		Name string  `hcl:"name,label"`
+		Foo  *string `hcl:"foo"`
+	}
+	strPtr := func(s string) *string {
+		return &s
+	}
+
+	tests := map[string]struct {
+		Config  string
+		Path    string
+		Want    interface{}
+		WantErr string
+	}{
+		"remove root attribute": {
+			`
+			foo = "a"
+			bar = "b"
+			`,
+			`foo`,
+			&struct {
+				Foo *string `hcl:"foo"`
+				Bar *string `hcl:"bar"`
+			}{
+				Bar: strPtr("b"),
+			},
+			``,
+		},
+		"remove absent root attribute": {
+			`
+			bar = "b"
+			`,
+			`foo`,
+			&struct {
+				Foo *string `hcl:"foo"`
+				Bar *string `hcl:"bar"`
+			}{
+				Bar: strPtr("b"),
+			},
+			``,
+		},
+		"remove attribute in unlabelled block": {
+			`
+			block { foo = "a" }
+			`,
+			`block.foo`,
+			&struct {
+				Block *BlockNoLabels `hcl:"block,block"`
+			}{
+				Block: &BlockNoLabels{},
+			},
+			``,
+		},
+		"remove attribute in labelled block": {
+			`
+			block "a" { foo = "a" }
+			block "b" { foo = "b" }
+			`,
+			`block.b.foo`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: strPtr("a")},
+					{Name: "b"},
+				},
+			},
+			``,
+		},
+		"remove attribute in absent block": {
+			`
+			block "a" { foo = "a" }
+			`,
+			`block.b.foo`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: strPtr("a")},
+				},
+			},
+			``,
+		},
+		"remove labelled block": {
+			`
+			block "a" { foo = "a" }
+			block "b" { foo = "b" }
+			block "c" { foo = "c" }
+			`,
+			`block.b`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: strPtr("a")},
+					{Name: "c", Foo: strPtr("c")},
+				},
+			},
+			``,
+		},
+		"remove unlabelled block": {
+			`
+			block { foo = "a" }
+			`,
+			`block`,
+			&struct {
+				Block *BlockNoLabels `hcl:"block,block"`
+			}{},
+			``,
+		},
+		"remove labelled block selected by index": {
+			`
+			block "a" { foo = "a" }
+			block "a" { foo = "b" }
+			`,
+			`block.a[1]`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: strPtr("a")},
+				},
+			},
+			``,
+		},
+		"remove blocks with wildcard label": {
+			`
+			block "a" { foo = "a" }
+			block "b" { foo = "b" }
+			`,
+			`block.*`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{},
+			``,
+		},
+		"remove all blocks with same labels": {
+			`
+			block "a" { foo = "a" }
+			block "b" { foo = "b" }
+			block "a" { foo = "c" }
+			`,
+			`block.a[*]`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "b", Foo: strPtr("b")},
+				},
+			},
+			``,
+		},
+		"remove absent block": {
+			`
+			block "a" { foo = "a" }
+			`,
+			`block.b`,
+			&struct {
+				Block []BlockOneLabel `hcl:"block,block"`
+			}{
+				Block: []BlockOneLabel{
+					{Name: "a", Foo: strPtr("a")},
+				},
+			},
+			``,
+		},
+		"remove unexpected argument": {
+			`
+			foo = "a"
+			`,
+			`bar`,
+			&struct {
+				Foo *string `hcl:"foo"`
+			}{},
+			`Unexpected argument "bar".`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "", hcl.Pos{})
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			o, diags := NewRemoveOverlay(test.Path)
+			if diags.HasErrors() {
+				t.Fatalf("path has problems: %s", diags.Error())
+			}
+
+			body := ApplyOverlays(f.Body, o)
+
+			wantType := reflect.TypeOf(test.Want).Elem()
+			got := reflect.New(wantType).Interface() // zero value of same type as "want"
+			diags = gohcl.DecodeBody(body, nil, got)
+			if diags.HasErrors() {
+				errStr := diags.Error()
+				if test.WantErr == "" {
+					t.Fatalf("unexpected problems: %s", errStr)
+				}
+				if !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if test.WantErr != "" {
+				t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewRemoveOverlayJustAttributes(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte("foo = 1\nbar = 2\n"), "", hcl.Pos{})
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	o, diags := NewRemoveOverlay("foo")
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+
+	attrs, diags := ApplyOverlays(f.Body, o).JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if _, exists := attrs["foo"]; exists {
+		t.Errorf("foo was not removed")
+	}
+	if _, exists := attrs["bar"]; !exists {
+		t.Errorf("bar was removed")
+	}
+}
+
+func TestNewRemoveBlockTypeOverlay(t *testing.T) {
+	type Service struct {
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+	}
+	type Group struct {
+		Name     string    `hcl:"name,label"`
+		Services []Service `hcl:"service,block"`
+	}
+	type Config struct {
+		Services []Service `hcl:"service,block"`
+		Groups   []Group   `hcl:"group,block"`
+	}
+
+	config := `
+service "a" { listen_addr = ":1" }
+service "b" { listen_addr = ":2" }
+group "x" {
+  service "c" { listen_addr = ":3" }
+}
+group "y" {
+  service "d" { listen_addr = ":4" }
+}
+`
+
+	tests := map[string]struct {
+		Path    string
+		Args    []string
+		Want    Config
+		WantErr string
+	}{
+		"root blocks": {
+			`service`,
+			nil,
+			Config{
+				Groups: []Group{
+					{Name: "x", Services: []Service{{Name: "c", ListenAddr: ":3"}}},
+					{Name: "y", Services: []Service{{Name: "d", ListenAddr: ":4"}}},
+				},
+			},
+			``,
+		},
+		"replaced by new blocks": {
+			`service`,
+			[]string{`service.new.listen_addr=:5`, `service.b.listen_addr=:6`},
+			Config{
+				Services: []Service{
+					{Name: "new", ListenAddr: ":5"},
+					{Name: "b", ListenAddr: ":6"},
+				},
+				Groups: []Group{
+					{Name: "x", Services: []Service{{Name: "c", ListenAddr: ":3"}}},
+					{Name: "y", Services: []Service{{Name: "d", ListenAddr: ":4"}}},
+				},
+			},
+			``,
+		},
+		"nested blocks": {
+			`group.x.service`,
+			nil,
+			Config{
+				Services: []Service{
+					{Name: "a", ListenAddr: ":1"},
+					{Name: "b", ListenAddr: ":2"},
+				},
+				Groups: []Group{
+					{Name: "x"},
+					{Name: "y", Services: []Service{{Name: "d", ListenAddr: ":4"}}},
+				},
+			},
+			``,
+		},
+		"nested blocks with wildcard": {
+			`group.*.service`,
+			nil,
+			Config{
+				Services: []Service{
+					{Name: "a", ListenAddr: ":1"},
+					{Name: "b", ListenAddr: ":2"},
+				},
+				Groups: []Group{
+					{Name: "x"},
+					{Name: "y"},
+				},
+			},
+			``,
+		},
+		"absent containing block": {
+			`group.z.service`,
+			nil,
+			Config{
+				Services: []Service{
+					{Name: "a", ListenAddr: ":1"},
+					{Name: "b", ListenAddr: ":2"},
+				},
+				Groups: []Group{
+					{Name: "x", Services: []Service{{Name: "c", ListenAddr: ":3"}}},
+					{Name: "y", Services: []Service{{Name: "d", ListenAddr: ":4"}}},
+				},
+			},
+			``,
+		},
+		"labels given": {
+			`service.a`,
+			nil,
+			Config{},
+			`Unexpected argument "service.a": block type "service" requires 1 label, but the path provides 0.`,
+		},
+		"unknown block type": {
+			`widget`,
+			nil,
+			Config{},
+			`Unexpected argument "widget".`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(config), "", hcl.Pos{})
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			o, diags := NewRemoveBlockTypeOverlay(test.Path)
+			if diags.HasErrors() {
+				t.Fatalf("path has problems: %s", diags.Error())
+			}
+			overlays := []Overlay{o}
+			for _, arg := range test.Args {
+				o, diags := ParseCLIArgument(arg)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			var got Config
+			diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, &got)
+			if diags.HasErrors() {
+				errStr := diags.Error()
+				if test.WantErr == "" {
+					t.Fatalf("unexpected problems: %s", errStr)
+				}
+				if !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if test.WantErr != "" {
+				t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package hcloverlay
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// NewRenameOverlay returns an overlay that renames an argument or block
+// type, so that an application can continue to accept a legacy name from
+// existing configuration while decoding it using only the new name.
+//
+// The to name must be the name of an argument or block type in the schema
+// used to decode the body. The body returned by ApplyOverlays then also
+// accepts the from name, which the schema does not need to include, and
+// the overlay moves any argument or blocks given under that name to the
+// new name. For a block type, the legacy blocks are expected to have the
+// same labels as the new block type requires.
+//
+// The from name is a path in the same syntax as the part before the equals
+// sign in arguments to ParseCLIArgument. Any steps before the last select
+// the nested blocks whose bodies contain the legacy name, as in
+// service.http.web.addr to rename addr only inside service "http" "web",
+// or service.*.*.addr to rename it inside all service blocks. Such a path
+// must give all of the labels of each block type it traverses, and it
+// can't include an index because a rename applies to all of the matching
+// blocks. It never creates blocks. The last step of the path and the to
+// name must both be valid HCL identifiers, because both name something in
+// the same body.
+//
+// If the body doesn't use the from name then the overlay has no effect. If
+// the body uses both the from and to names then the overlay returns an error
+// when applied, unless overwrite is set, in which case the definitions under
+// the from name replace those under the to name.
+func NewRenameOverlay(from, to string, overwrite bool) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(from)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	last := steps[len(steps)-1]
+	if !hclsyntax.ValidIdentifier(last.name) || last.wildcard || last.placeholder || last.hasIndex {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   fmt.Sprintf("Invalid name %q to rename: must end with a valid identifier.", from),
+		})
+	}
+	for _, step := range steps[:len(steps)-1] {
+		if step.hasIndex {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid argument",
+				Detail:   fmt.Sprintf("Invalid name %q to rename: can't include an index, because a rename applies to all of the matching blocks.", from),
+			})
+			break
+		}
+	}
+	if !hclsyntax.ValidIdentifier(to) {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   fmt.Sprintf("Invalid name %q to rename: must be a valid identifier.", to),
+		})
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return &renameOverlay{
+		fullPath:  from,
+		blocks:    steps[:len(steps)-1],
+		from:      last.name,
+		to:        to,
+		overwrite: overwrite,
+	}, diags
+}
+
+type renameOverlay struct {
+	fullPath string
+
+	// blocks are the steps that select the blocks whose bodies the rename
+	// applies to, or empty if it applies to the body the overlay is
+	// applied to.
+	blocks []pathStep
+
+	from, to  string
+	overwrite bool
+}
+
+func (o *renameOverlay) String() string {
+	return o.fullPath + ": rename to " + o.to
+}
+
+func (o *renameOverlay) ApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	ret, remain, diags := o.PartialApplyOverlay(content, schema)
+	if remain != nil {
+		detail := fmt.Sprintf("Cannot rename %q to %q: %q is not an expected argument or block type.", o.from, o.to, o.to)
+		if len(o.blocks) != 0 {
+			detail = fmt.Sprintf("Cannot rename %q to %q: %q is not an expected block type.", o.fullPath, o.to, o.blocks[0].name)
+		}
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   detail,
+		})
+	}
+	return ret, diags
+}
+
+func (o *renameOverlay) PartialApplyOverlay(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	content = ensureContent(content)
+	switch {
+	case len(o.blocks) != 0:
+		return o.renameInBlocks(content, schema)
+	case schemaHasName(schema, o.to) && !schemaHasBlockType(schema, o.to):
+		attrs, diags := o.ApplyJustAttributes(content.Attributes)
+		content.Attributes = attrs
+		return content, nil, diags
+	case schemaHasBlockType(schema, o.to):
+		return content, nil, o.renameBlocks(content)
+	default:
+		return content, o, nil
+	}
+}
+
+// renameInBlocks applies the rename to the bodies of the blocks selected by
+// the overlay's block steps, in the same way as NewRemovePrefixOverlay
+// traverses into blocks.
+func (o *renameOverlay) renameInBlocks(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, Overlay, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	for _, blockS := range schema.Blocks {
+		if blockS.Type != o.blocks[0].name {
+			continue
+		}
+		headerLen := 1 + len(blockS.LabelNames)
+		if len(o.blocks) < headerLen {
+			diags = diags.Append(&hcl.Diagnostic{
+				Severity: hcl.DiagError,
+				Summary:  "Invalid argument",
+				Detail:   fmt.Sprintf("Invalid name %q to rename: block type %q requires %d labels before the name inside the block.", o.fullPath, blockS.Type, len(blockS.LabelNames)),
+			})
+			return content, nil, diags
+		}
+		for _, block := range content.Blocks {
+			if block.Type == blockS.Type && len(block.Labels) != len(blockS.LabelNames) {
+				diags = diags.Append(labelArityError(fmt.Sprintf("rename %q", o.fullPath), block, blockS))
+				return content, nil, diags
+			}
+		}
+
+		sub := &renameOverlay{
+			fullPath:  o.fullPath,
+			blocks:    o.blocks[headerLen:],
+			from:      o.from,
+			to:        o.to,
+			overwrite: o.overwrite,
+		}
+		// The blocks in the content belong to it, so we can modify them
+		// in place, as described for Overlay.ApplyOverlay.
+		for _, block := range content.Blocks {
+			if block.Type == blockS.Type && labelStepsMatch(block.Labels, o.blocks[1:headerLen]) {
+				block.Body = ApplyOverlays(block.Body, sub)
+			}
+		}
+		return content, nil, diags
+	}
+	return content, o, diags
+}
+
+func (o *renameOverlay) ApplyJustAttributes(attrs hcl.Attributes) (hcl.Attributes, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	if len(o.blocks) != 0 {
+		// Without a schema there are no blocks to traverse into.
+		return attrs, diags
+	}
+	attr, exists := attrs[o.from]
+	if !exists {
+		return attrs, diags
+	}
+	if _, exists := attrs[o.to]; exists && !o.overwrite {
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   fmt.Sprintf("Cannot rename argument %q to %q because %q is already set.", o.from, o.to, o.to),
+			Subject:  attr.NameRange.Ptr(),
+		})
+		return attrs, diags
+	}
+
+	renamed := *attr
+	renamed.Name = o.to
+	delete(attrs, o.from)
+	attrs[o.to] = &renamed
+	return attrs, diags
+}
+
+// renameBlocks changes the type of any blocks in the given content that have
+// the overlay's from type, after removing any blocks of the to type if the
+// overlay is allowed to overwrite them.
+func (o *renameOverlay) renameBlocks(content *hcl.BodyContent) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	var legacy, existing int
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case o.from:
+			legacy++
+		case o.to:
+			existing++
+		}
+	}
+	if legacy == 0 {
+		return diags
+	}
+	if existing > 0 && !o.overwrite {
+		for _, block := range content.Blocks {
+			if block.Type == o.from {
+				diags = diags.Append(&hcl.Diagnostic{
+					Severity: hcl.DiagError,
+					Summary:  "Invalid argument",
+					Detail:   fmt.Sprintf("Cannot rename blocks of type %q to %q because there are already blocks of type %q.", o.from, o.to, o.to),
+					Subject:  block.TypeRange.Ptr(),
+				})
+				break
+			}
+		}
+		return diags
+	}
+
+	// The blocks in the content belong to it, so we can modify them in
+	// place, as described for Overlay.ApplyOverlay.
+	blocks := make(hcl.Blocks, 0, len(content.Blocks)-existing)
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case o.to:
+			continue // overwritten
+		case o.from:
+			block.Type = o.to
+		}
+		blocks = append(blocks, block)
+	}
+	content.Blocks = blocks
+	return diags
+}
+
+// schemaWithRenames returns the given schema extended with the legacy names
+// of any rename overlays among the given overlays, so that the body being
+// overlaid can be decoded with those names. If there are no such overlays
+// then the given schema is returned unchanged. Rename overlays for nested
+// blocks are ignored, because they extend the schemas of the bodies of
+// those blocks instead.
+func schemaWithRenames(schema *hcl.BodySchema, overlays []Overlay) *hcl.BodySchema {
+	ret := schema
+	for _, ov := range flattenOverlays(overlays) {
+		o, ok := ov.(*renameOverlay)
+		if !ok || len(o.blocks) != 0 || !schemaHasName(schema, o.to) || schemaHasName(ret, o.from) {
+			continue
+		}
+		if ret == schema {
+			// We must not modify the caller's schema.
+			ret = &hcl.BodySchema{
+				Attributes: append([]hcl.AttributeSchema(nil), schema.Attributes...),
+				Blocks:     append([]hcl.BlockHeaderSchema(nil), schema.Blocks...),
+			}
+		}
+		if !schemaHasBlockType(schema, o.to) {
+			ret.Attributes = append(ret.Attributes, hcl.AttributeSchema{Name: o.from})
+			continue
+		}
+		for _, blockS := range schema.Blocks {
+			if blockS.Type == o.to {
+				ret.Blocks = append(ret.Blocks, hcl.BlockHeaderSchema{
+					Type:       o.from,
+					LabelNames: blockS.LabelNames,
+				})
+				break
+			}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,318 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestNewRenameOverlay(t *testing.T) {
+	type Service struct {
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Services []Service `hcl:"service,block"`
+	}
+
+	tests := map[string]struct {
+		Config    string
+		Overwrite bool
+		Want      Config
+		WantErr   string
+	}{
+		"legacy names": {
+			Config: `
+mode = "async"
+svc "web" {
+  listen_addr = ":80"
+}
+`,
+			Want: Config{
+				IOMode:   "async",
+				Services: []Service{{Name: "web", ListenAddr: ":80"}},
+			},
+		},
+		"new names": {
+			Config: `
+io_mode = "sync"
+service "web" {
+  listen_addr = ":80"
+}
+`,
+			Want: Config{
+				IOMode:   "sync",
+				Services: []Service{{Name: "web", ListenAddr: ":80"}},
+			},
+		},
+		"both names for argument": {
+			Config: `
+io_mode = "sync"
+mode = "async"
+`,
+			WantErr: `Cannot rename argument "mode" to "io_mode" because "io_mode" is already set.`,
+		},
+		"both names for argument with overwrite": {
+			Config: `
+io_mode = "sync"
+mode = "async"
+`,
+			Overwrite: true,
+			Want: Config{
+				IOMode: "async",
+			},
+		},
+		"both names for block type": {
+			Config: `
+io_mode = "sync"
+service "web" {
+  listen_addr = ":80"
+}
+svc "api" {
+  listen_addr = ":81"
+}
+`,
+			WantErr: `Cannot rename blocks of type "svc" to "service" because there are already blocks of type "service".`,
+		},
+		"both names for block type with overwrite": {
+			Config: `
+io_mode = "sync"
+service "web" {
+  listen_addr = ":80"
+}
+svc "api" {
+  listen_addr = ":81"
+}
+`,
+			Overwrite: true,
+			Want: Config{
+				IOMode:   "sync",
+				Services: []Service{{Name: "api", ListenAddr: ":81"}},
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "config.hcl", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+			var overlays []Overlay
+			for _, names := range [][2]string{{"mode", "io_mode"}, {"svc", "service"}} {
+				o, diags := NewRenameOverlay(names[0], names[1], test.Overwrite)
+				if diags.HasErrors() {
+					t.Fatalf("unexpected problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			var got Config
+			diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, &got)
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewRenameOverlayNested(t *testing.T) {
+	type Service struct {
+		Type       string `hcl:"type,label"`
+		Name       string `hcl:"name,label"`
+		ListenAddr string `hcl:"listen_addr,optional"`
+	}
+	type Config struct {
+		Services []Service `hcl:"service,block"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+service "http" "web" {
+  addr = ":80"
+}
+service "http" "api" {
+  addr = ":81"
+}
+service "grpc" "internal" {
+  listen_addr = ":90"
+}
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	tests := map[string]struct {
+		From    string
+		Want    Config
+		WantErr string
+	}{
+		"wildcard labels": {
+			From: "service.*.*.addr",
+			Want: Config{
+				Services: []Service{
+					{Type: "http", Name: "web", ListenAddr: ":80"},
+					{Type: "http", Name: "api", ListenAddr: ":81"},
+					{Type: "grpc", Name: "internal", ListenAddr: ":90"},
+				},
+			},
+		},
+		"specific block": {
+			From:    "service.http.web.addr",
+			WantErr: `Unsupported argument; An argument named "addr" is not expected here.`,
+		},
+		"too few labels": {
+			From:    "service.http.addr",
+			WantErr: `Invalid name "service.http.addr" to rename: block type "service" requires 2 labels before the name inside the block.`,
+		},
+		"unexpected block type": {
+			From:    "svc.*.*.addr",
+			WantErr: `Cannot rename "svc.*.*.addr" to "listen_addr": "svc" is not an expected block type.`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, diags := NewRenameOverlay(test.From, "listen_addr", false)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+
+			var got Config
+			diags = gohcl.DecodeBody(ApplyOverlays(f.Body, o), nil, &got)
+			if test.WantErr != "" {
+				if !diags.HasErrors() {
+					t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+				}
+				if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot:  %s\nwant: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewRenameOverlayWrapped(t *testing.T) {
+	type Config struct {
+		IOMode string `hcl:"io_mode"`
+		Async  bool   `hcl:"async,optional"`
+	}
+
+	f, diags := hclsyntax.ParseConfig([]byte(`
+mode  = "async"
+async = true
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	rename, diags := NewRenameOverlay("mode", "io_mode", false)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	cond, diags := NewConditionalOverlay("async", cty.True, rename)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+
+	tests := map[string]Overlay{
+		"once":        NewOnceOverlay(rename),
+		"conditional": cond,
+	}
+	for name, o := range tests {
+		t.Run(name, func(t *testing.T) {
+			var got Config
+			diags := gohcl.DecodeBody(ApplyOverlays(f.Body, o), nil, &got)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if want := (Config{IOMode: "async", Async: true}); got != want {
+				t.Errorf("wrong result %#v; want %#v", got, want)
+			}
+		})
+	}
+}
+
+func TestNewRenameOverlayJustAttributes(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+mode = "async"
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	o, diags := NewRenameOverlay("mode", "io_mode", false)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+
+	attrs, diags := ApplyOverlays(f.Body, o).JustAttributes()
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	if _, exists := attrs["mode"]; exists {
+		t.Errorf("legacy argument is still present")
+	}
+	if got, want := attrStringValue(t, attrs["io_mode"]), "async"; got != want {
+		t.Errorf("wrong io_mode %q; want %q", got, want)
+	}
+	if got, want := attrs["io_mode"].Name, "io_mode"; got != want {
+		t.Errorf("wrong attribute name %q; want %q", got, want)
+	}
+}
+
+func TestNewRenameOverlayInvalid(t *testing.T) {
+	t.Run("invalid name", func(t *testing.T) {
+		_, diags := NewRenameOverlay("mode", "io.mode", false)
+		if got, want := diags.Error(), `Invalid name "io.mode" to rename`; !strings.Contains(got, want) {
+			t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("index in path", func(t *testing.T) {
+		_, diags := NewRenameOverlay("service.http.web[1].addr", "listen_addr", false)
+		if got, want := diags.Error(), `Invalid name "service.http.web[1].addr" to rename: can't include an index`; !strings.Contains(got, want) {
+			t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("wildcard name", func(t *testing.T) {
+		_, diags := NewRenameOverlay("service.http.web.*", "listen_addr", false)
+		if got, want := diags.Error(), `Invalid name "service.http.web.*" to rename: must end with a valid identifier.`; !strings.Contains(got, want) {
+			t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("unexpected new name", func(t *testing.T) {
+		o, diags := NewRenameOverlay("mode", "io_mode", false)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		_, diags = ApplyOverlays(hcl.EmptyBody(), o).Content(&hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "other"}},
+		})
+		want := `Cannot rename "mode" to "io_mode": "io_mode" is not an expected argument or block type.`
+		if got := diags.Error(); !strings.Contains(got, want) {
+			t.Fatalf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+}
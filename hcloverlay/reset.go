@@ -0,0 +1,115 @@
+package hcloverlay
+
+import (
+	"github.com/hashicorp/hcl/v2"
+)
+
+// NewResetOverlay returns an overlay that undoes the effect of any earlier
+// overlays on the argument indicated by the given path, which uses the same
+// dot-separated syntax as the part before the equals sign in arguments to
+// ParseCLIArgument, so that the value from the original configuration shows
+// through again.
+//
+// If the original body defines the argument then the overlay restores that
+// original definition. Otherwise the overlay removes the argument, because
+// any definition of it must have been introduced by an earlier overlay.
+//
+// The original body is the body given to ApplyOverlays, and the reset
+// overlay must be applied using the same call or a subsequent call that
+// wraps its result. Inside a block, the original body is the body of the
+// block as it appears in the content the earlier overlays started from, and
+// so the overlay has no effect on blocks added by earlier overlays except
+// to remove arguments from them. Like NewRemoveOverlay, a reset overlay never
+// creates new blocks while traversing the path.
+//
+// The path must end with the name of an argument: a reset overlay cannot
+// restore a whole block or a key inside an argument's value.
+func NewResetOverlay(path string) (Overlay, hcl.Diagnostics) {
+	steps, diags := parseCLIPath(path)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	return &cliArgOverlay{
+		fullPath: path,
+		steps:    steps,
+		op:       cliArgReset,
+	}, diags
+}
+
+// withOriginal returns the given overlay with any reset overlays within it
+// replaced by copies that restore arguments from the given original
+// attributes, which are those of the body the overlays are being applied to
+// before any overlays have modified them. Overlays that don't contain any
+// reset overlays are returned unchanged.
+func withOriginal(o Overlay, original hcl.Attributes) Overlay {
+	ret, _ := withOriginalChanged(o, original)
+	return ret
+}
+
+// withOriginalChanged is the implementation of withOriginal, which
+// additionally returns whether the result differs from the given overlay.
+// We can't just compare the overlays, because some overlay implementations
+// are not comparable.
+func withOriginalChanged(o Overlay, original hcl.Attributes) (Overlay, bool) {
+	switch o := o.(type) {
+	case *cliArgOverlay:
+		if o.op != cliArgReset {
+			return o, false
+		}
+		ret := *o
+		ret.original = original
+		return &ret, true
+	case *mergedOverlay:
+		var overlays []Overlay
+		for i, ov := range o.overlays {
+			newOv, changed := withOriginalChanged(ov, original)
+			if !changed {
+				continue
+			}
+			if overlays == nil {
+				overlays = make([]Overlay, len(o.overlays))
+				copy(overlays, o.overlays)
+			}
+			overlays[i] = newOv
+		}
+		if overlays == nil {
+			return o, false
+		}
+		return &mergedOverlay{overlays: overlays}, true
+	case *priorityOverlay:
+		inner, changed := withOriginalChanged(o.Overlay, original)
+		if !changed {
+			return o, false
+		}
+		return &priorityOverlay{
+			Overlay:  inner,
+			priority: o.priority,
+		}, true
+	case *recordingOverlay:
+		if o.inner == nil {
+			return o, false
+		}
+		inner, changed := withOriginalChanged(o.inner, original)
+		if !changed {
+			return o, false
+		}
+		return o.withInner(inner), true
+	case *conditionalOverlay:
+		inner, changed := withOriginalChanged(o.inner, original)
+		if !changed {
+			return o, false
+		}
+		ret := *o
+		ret.inner = inner
+		return &ret, true
+	case *onceOverlay:
+		inner, changed := withOriginalChanged(o.inner, original)
+		if !changed {
+			return o, false
+		}
+		return o.withInner(inner), true
+	default:
+		return o, false
+	}
+}
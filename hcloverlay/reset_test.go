@@ -0,0 +1,211 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestNewResetOverlay(t *testing.T) {
+	type Service struct {
+		Name       string  `hcl:"name,label"`
+		ListenAddr *string `hcl:"listen_addr"`
+	}
+	type Config struct {
+		IOMode   *string   `hcl:"io_mode"`
+		Count    *int      `hcl:"count"`
+		Services []Service `hcl:"service,block"`
+	}
+	strPtr := func(s string) *string {
+		return &s
+	}
+	intPtr := func(n int) *int {
+		return &n
+	}
+
+	const config = `
+io_mode = "async"
+service "web" {
+  listen_addr = ":80"
+}
+`
+
+	tests := map[string]struct {
+		Args    []string // arguments for ParseCLIArgument, or "~path" for a reset overlay
+		Want    *Config
+		WantErr string
+	}{
+		"reset only": {
+			[]string{"~io_mode"},
+			&Config{
+				IOMode:   strPtr("async"),
+				Services: []Service{{Name: "web", ListenAddr: strPtr(":80")}},
+			},
+			``,
+		},
+		"restore original": {
+			[]string{"io_mode=sync", "~io_mode"},
+			&Config{
+				IOMode:   strPtr("async"),
+				Services: []Service{{Name: "web", ListenAddr: strPtr(":80")}},
+			},
+			``,
+		},
+		"remove added": {
+			[]string{"count:=2", "~count"},
+			&Config{
+				IOMode:   strPtr("async"),
+				Services: []Service{{Name: "web", ListenAddr: strPtr(":80")}},
+			},
+			``,
+		},
+		"restore after removal": {
+			[]string{"-io_mode", "~io_mode"},
+			&Config{
+				IOMode:   strPtr("async"),
+				Services: []Service{{Name: "web", ListenAddr: strPtr(":80")}},
+			},
+			``,
+		},
+		"set after reset": {
+			[]string{"io_mode=sync", "~io_mode", "io_mode=none", "count:=1"},
+			&Config{
+				IOMode:   strPtr("none"),
+				Count:    intPtr(1),
+				Services: []Service{{Name: "web", ListenAddr: strPtr(":80")}},
+			},
+			``,
+		},
+		"restore in block": {
+			[]string{"service.web.listen_addr=:8080", "~service.web.listen_addr"},
+			&Config{
+				IOMode:   strPtr("async"),
+				Services: []Service{{Name: "web", ListenAddr: strPtr(":80")}},
+			},
+			``,
+		},
+		"remove in added block": {
+			[]string{"service.api.listen_addr=:8080", "~service.api.listen_addr"},
+			&Config{
+				IOMode: strPtr("async"),
+				Services: []Service{
+					{Name: "web", ListenAddr: strPtr(":80")},
+					{Name: "api"},
+				},
+			},
+			``,
+		},
+		"no new block": {
+			[]string{"~service.api.listen_addr"},
+			&Config{
+				IOMode:   strPtr("async"),
+				Services: []Service{{Name: "web", ListenAddr: strPtr(":80")}},
+			},
+			``,
+		},
+		"whole block": {
+			[]string{"~service.web"},
+			nil,
+			`Unexpected argument "service.web"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(config), "", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				var o Overlay
+				var diags hcl.Diagnostics
+				switch {
+				case strings.HasPrefix(arg, "~"):
+					o, diags = NewResetOverlay(arg[1:])
+				case strings.HasPrefix(arg, "-"):
+					o, diags = NewRemoveOverlay(arg[1:])
+				default:
+					o, diags = ParseCLIArgument(arg)
+				}
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			got := &Config{}
+			diags = gohcl.DecodeBody(ApplyOverlays(f.Body, overlays...), nil, got)
+			if diags.HasErrors() {
+				errStr := diags.Error()
+				if test.WantErr == "" {
+					t.Fatalf("unexpected problems: %s", errStr)
+				}
+				if !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if test.WantErr != "" {
+				t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Fatalf("incorrect result\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestNewResetOverlayWrapped(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`io_mode = "async"`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	set, diags := ParseCLIArgument("io_mode=sync")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	reset, diags := NewResetOverlay("io_mode")
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "io_mode"}},
+	}
+	orig, diags := f.Body.Content(schema)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+
+	tests := map[string]hcl.Body{
+		"separate calls": ApplyOverlays(ApplyOverlays(f.Body, set), reset),
+		"merged":         ApplyOverlays(f.Body, MergeOverlays(set, reset)),
+		"prioritized":    ApplyOverlaysSorted(f.Body, WithPriority(reset, 1), set),
+		"with source":    ApplyOverlays(f.Body, set, WithSource(reset, "test")),
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			content, diags := body.Content(schema)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if got, want := content.Attributes["io_mode"].Expr, orig.Attributes["io_mode"].Expr; got != want {
+				t.Errorf("argument was not restored\ngot:  %#v\nwant: %#v", got, want)
+			}
+
+			attrs, diags := body.JustAttributes()
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if got, want := attrs["io_mode"].Expr, orig.Attributes["io_mode"].Expr; got != want {
+				t.Errorf("argument was not restored by JustAttributes\ngot:  %#v\nwant: %#v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package hcloverlay
+
+// WithSource returns an overlay that behaves like the given overlay except
+// that the messages of any diagnostics it produces about its path or value
+// include the given description of where the overlay came from, as in
+// `Unexpected argument "bar" (from environment variable APP_BAR).`
+//
+// The source should be a short phrase that reads naturally after "from",
+// such as "environment variable APP_BAR" or "command line option --bar".
+// The overlays returned by ExtractEnvOptions and ExtractCLIOptions already
+// have suitable sources, which WithSource replaces.
+//
+// Sources are recorded only for overlays created by the functions in this
+// package that take paths, and for overlays produced by MergeOverlays,
+// WithPriority, NewRecordingOverlay, NewConditionalOverlay, or
+// NewOnceOverlay from such overlays. Other overlays are returned unchanged.
+func WithSource(o Overlay, source string) Overlay {
+	switch o := o.(type) {
+	case *cliArgOverlay:
+		ret := *o
+		ret.source = source
+		return &ret
+	case *mergedOverlay:
+		overlays := make([]Overlay, len(o.overlays))
+		for i, ov := range o.overlays {
+			overlays[i] = WithSource(ov, source)
+		}
+		return &mergedOverlay{overlays: overlays}
+	case *priorityOverlay:
+		return WithPriority(WithSource(o.Overlay, source), o.priority)
+	case *recordingOverlay:
+		if o.inner == nil {
+			return o
+		}
+		return o.withInner(WithSource(o.inner, source))
+	case *conditionalOverlay:
+		ret := *o
+		ret.inner = WithSource(o.inner, source)
+		return &ret
+	case *onceOverlay:
+		// The result shares the record of whether the overlay has been
+		// applied, because it stands in for the given overlay.
+		return o.withInner(WithSource(o.inner, source))
+	default:
+		return o
+	}
+}
@@ -0,0 +1,109 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestWithSource(t *testing.T) {
+	type Config struct {
+		Name string   `hcl:"name,optional"`
+		Tags []string `hcl:"tags,optional"`
+	}
+	parseArg := func(raw string) Overlay {
+		o, diags := ParseCLIArgument(raw)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+	extract := func(args ...string) Overlay {
+		overlays, _, diags := ExtractCLIOptions(args, &hcl.BodySchema{
+			Attributes: []hcl.AttributeSchema{{Name: "nmae"}, {Name: "name"}},
+		})
+		if diags.HasErrors() {
+			t.Fatalf("args have problems: %s", diags.Error())
+		}
+		return MergeOverlays(overlays...)
+	}
+	parseWithSource := func(raw, source string) Overlay {
+		o, diags := ParseCLIArgumentWithOpts(raw, &ParseOptions{Source: source})
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+	conditional, diags := NewConditionalOverlay("name", cty.StringVal("a"), parseArg("bar=b"))
+	if diags.HasErrors() {
+		t.Fatalf("guard has problems: %s", diags.Error())
+	}
+
+	tests := map[string]struct {
+		Config  string
+		Overlay Overlay
+		WantErr string
+	}{
+		"unexpected argument": {
+			``,
+			WithSource(parseArg("nmae=a"), "environment variable APP_NMAE"),
+			`Unexpected argument "nmae" (from environment variable APP_NMAE). Did you mean "name"?`,
+		},
+		"merged": {
+			``,
+			WithSource(MergeOverlays(parseArg("name=a"), parseArg("bar=b")), "config.overrides"),
+			`Unexpected argument "bar" (from config.overrides).`,
+		},
+		"with priority": {
+			``,
+			WithSource(WithPriority(parseArg("bar=b"), 1), "config.overrides"),
+			`Unexpected argument "bar" (from config.overrides).`,
+		},
+		"append": {
+			`tags = "a"`,
+			WithSource(parseArg("tags+=b"), "command line option --tags+"),
+			`Cannot append to argument "tags" (from command line option --tags+): it is string, not a sequence.`,
+		},
+		"set key": {
+			`name = "a"`,
+			parseWithSource("name.x=b", "line 3"),
+			`Cannot set a key in argument "name.x" (from line 3): it is string, not a map or object.`,
+		},
+		"conditional": {
+			`name = "a"`,
+			WithSource(conditional, "config.overrides"),
+			`Unexpected argument "bar" (from config.overrides).`,
+		},
+		"once": {
+			``,
+			WithSource(NewOnceOverlay(parseArg("bar=b")), "config.overrides"),
+			`Unexpected argument "bar" (from config.overrides).`,
+		},
+		"extracted from command line": {
+			``,
+			extract("--nmae", "a"),
+			`Unexpected argument "nmae" (from command line option --nmae).`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "", hcl.Pos{})
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+			body := ApplyOverlays(f.Body, test.Overlay)
+			diags = gohcl.DecodeBody(body, nil, &Config{})
+			if !diags.HasErrors() {
+				t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+			}
+			if errStr := diags.Error(); !strings.Contains(errStr, test.WantErr) {
+				t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package hcloverlay
+
+import (
+	"reflect"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+)
+
+// ApplyOverlaysSpec is a variant of ApplyOverlays for applications that
+// decode bodies using hcldec, with the given spec, rather than decoding them
+// directly with a schema.
+//
+// The result can be decoded using hcldec.Decode with the given spec, and
+// behaves in the same way as the result of ApplyOverlays, including that
+// the requiredness of any required attributes in the spec is enforced only
+// after applying the overlays.
+//
+// The hcldec package derives a new schema from a spec each time it decodes
+// a body, which would normally prevent the result of applying the overlays
+// from being reused between calls. The body returned by ApplyOverlaysSpec
+// recognizes schemas that are equal to the one derived from the given spec,
+// so that decoding the same body repeatedly with that spec does not apply
+// all of the overlays again each time.
+func ApplyOverlaysSpec(body hcl.Body, spec hcldec.Spec, overlays ...Overlay) hcl.Body {
+	applied, ok := ApplyOverlays(body, overlays...).(*applyBody)
+	if !ok {
+		return body // no overlays, so nothing to do
+	}
+	return &specBody{
+		applyBody: applied,
+		schema:    hcldec.ImpliedSchema(spec),
+	}
+}
+
+// specBody is the hcl.Body implementation returned by ApplyOverlaysSpec.
+type specBody struct {
+	*applyBody
+
+	// schema is the schema implied by the spec, which we substitute for
+	// any equal schema given by a caller so that the cache in applyBody
+	// can recognize it.
+	schema *hcl.BodySchema
+}
+
+func (b *specBody) Content(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+	return b.applyBody.Content(b.canonicalSchema(schema))
+}
+
+func (b *specBody) PartialContent(schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Body, hcl.Diagnostics) {
+	return b.applyBody.PartialContent(b.canonicalSchema(schema))
+}
+
+func (b *specBody) canonicalSchema(given *hcl.BodySchema) *hcl.BodySchema {
+	if given != b.schema && reflect.DeepEqual(given, b.schema) {
+		return b.schema
+	}
+	return given
+}
@@ -0,0 +1,207 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestApplyOverlaysSpec(t *testing.T) {
+	spec := hcldec.ObjectSpec{
+		"io_mode": &hcldec.AttrSpec{Name: "io_mode", Type: cty.String, Required: true},
+		"services": &hcldec.BlockMapSpec{
+			TypeName:   "service",
+			LabelNames: []string{"name"},
+			Nested: hcldec.ObjectSpec{
+				"listen_addr": &hcldec.AttrSpec{Name: "listen_addr", Type: cty.String, Required: true},
+				"tags":        &hcldec.AttrSpec{Name: "tags", Type: cty.List(cty.String)},
+			},
+		},
+		"logging": &hcldec.BlockSpec{
+			TypeName: "logging",
+			Required: true,
+			Nested: hcldec.ObjectSpec{
+				"level": &hcldec.AttrSpec{Name: "level", Type: cty.String},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		Config  string
+		Args    []string
+		Want    cty.Value
+		WantErr string
+	}{
+		"required attribute set by overlay": {
+			`
+			logging {}
+			`,
+			[]string{`io_mode=async`},
+			cty.ObjectVal(map[string]cty.Value{
+				"io_mode":  cty.StringVal("async"),
+				"services": cty.MapValEmpty(cty.Object(map[string]cty.Type{"listen_addr": cty.String, "tags": cty.List(cty.String)})),
+				"logging": cty.ObjectVal(map[string]cty.Value{
+					"level": cty.NullVal(cty.String),
+				}),
+			}),
+			``,
+		},
+		"required attribute still missing": {
+			`
+			logging {}
+			`,
+			[]string{`logging.level=debug`},
+			cty.NilVal,
+			`The argument "io_mode" is required, but no definition was found.`,
+		},
+		"required block created by overlay": {
+			`
+			io_mode = "sync"
+			`,
+			[]string{`logging.level=debug`},
+			cty.ObjectVal(map[string]cty.Value{
+				"io_mode":  cty.StringVal("sync"),
+				"services": cty.MapValEmpty(cty.Object(map[string]cty.Type{"listen_addr": cty.String, "tags": cty.List(cty.String)})),
+				"logging": cty.ObjectVal(map[string]cty.Value{
+					"level": cty.StringVal("debug"),
+				}),
+			}),
+			``,
+		},
+		"required nested attribute in existing block": {
+			`
+			io_mode = "sync"
+			logging {}
+			service "web" {
+			  tags = ["a"]
+			}
+			`,
+			[]string{`service.web.listen_addr=:80`, `service.web.tags+=b`},
+			cty.ObjectVal(map[string]cty.Value{
+				"io_mode": cty.StringVal("sync"),
+				"services": cty.MapVal(map[string]cty.Value{
+					"web": cty.ObjectVal(map[string]cty.Value{
+						"listen_addr": cty.StringVal(":80"),
+						"tags":        cty.ListVal([]cty.Value{cty.StringVal("a"), cty.StringVal("b")}),
+					}),
+				}),
+				"logging": cty.ObjectVal(map[string]cty.Value{
+					"level": cty.NullVal(cty.String),
+				}),
+			}),
+			``,
+		},
+		"required nested attribute missing in new block": {
+			`
+			io_mode = "sync"
+			logging {}
+			`,
+			[]string{`service.web.tags:=["a"]`},
+			cty.NilVal,
+			`The argument "listen_addr" is required, but no definition was found.`,
+		},
+		"unexpected argument": {
+			`
+			io_mode = "sync"
+			logging {}
+			`,
+			[]string{`io_mdoe=async`},
+			cty.NilVal,
+			`Unexpected argument "io_mdoe". Did you mean "io_mode"?`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(test.Config), "", hcl.Pos{})
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				o, diags := ParseCLIArgument(arg)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			body := ApplyOverlaysSpec(f.Body, spec, overlays...)
+			got, diags := hcldec.Decode(body, spec, nil)
+			if diags.HasErrors() {
+				errStr := diags.Error()
+				if test.WantErr == "" {
+					t.Fatalf("unexpected problems: %s", errStr)
+				}
+				if !strings.Contains(errStr, test.WantErr) {
+					t.Fatalf("wrong error\ngot: %s\nshould contain: %s", errStr, test.WantErr)
+				}
+				return
+			}
+			if test.WantErr != "" {
+				t.Fatalf("unexpected success\nwant error: %s", test.WantErr)
+			}
+			if !test.Want.RawEquals(got) {
+				t.Fatalf("wrong result\ngot:  %#v\nwant: %#v", got, test.Want)
+			}
+		})
+	}
+}
+
+func TestApplyOverlaysSpecCached(t *testing.T) {
+	spec := &hcldec.AttrSpec{Name: "io_mode", Type: cty.String}
+	o, diags := ParseCLIArgument("io_mode=async")
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	body := ApplyOverlaysSpec(hcl.EmptyBody(), spec, o).(*specBody)
+
+	for i := 0; i < 2; i++ {
+		got, diags := hcldec.Decode(body, spec, nil)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+		if want := cty.StringVal("async"); !want.RawEquals(got) {
+			t.Fatalf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+		}
+		if body.applyBody.cachedSchema != body.schema {
+			t.Fatalf("decoding did not use the schema implied by the spec")
+		}
+	}
+}
+
+func TestApplyOverlaysSpecFlatten(t *testing.T) {
+	spec := hcldec.ObjectSpec{
+		"foo": &hcldec.AttrSpec{Name: "foo", Type: cty.String, Required: true},
+		"bar": &hcldec.AttrSpec{Name: "bar", Type: cty.String, Required: true},
+	}
+	parseArg := func(raw string) Overlay {
+		o, diags := ParseCLIArgument(raw)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+
+	// "bar" is only set by the second layer, so requiredness must not be
+	// enforced by the first layer alone.
+	body := ApplyOverlaysSpec(hcl.EmptyBody(), spec, parseArg("foo=a"))
+	body = ApplyOverlays(body, parseArg("bar=b"))
+
+	got, diags := hcldec.Decode(body, spec, nil)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := cty.ObjectVal(map[string]cty.Value{
+		"foo": cty.StringVal("a"),
+		"bar": cty.StringVal("b"),
+	})
+	if !want.RawEquals(got) {
+		t.Fatalf("wrong result\ngot:  %#v\nwant: %#v", got, want)
+	}
+}
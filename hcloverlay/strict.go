@@ -0,0 +1,143 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// ApplyOverlaysStrict is a variant of ApplyOverlays that additionally
+// returns a function that reports an error for each of the given overlays
+// that was never applied while decoding the resulting body.
+//
+// An overlay whose path doesn't correspond to anything in the schema given
+// to PartialContent is passed on to the remaining body, in case a later
+// call with a different schema expects it. If the remaining body is never
+// decoded then such an overlay has no effect, so a misspelled argument name
+// can go unnoticed. A body can't know when its caller has finished decoding
+// it, so the caller must call the returned function afterwards to check
+// for any overlays that were still waiting to be applied.
+//
+// An overlay counts as applied once it has been given an opportunity to
+// change the content for a schema that includes what it refers to, even if
+// that produced errors, because those errors are already reported by the
+// decoding. If an overlay made up of several parts, such as the result of
+// MergeOverlays, applies only some of them then the remaining parts are
+// tracked in the same way. Overlays that apply only to the content of
+// nested blocks are not tracked separately: they are the responsibility of
+// whatever decodes those blocks.
+//
+// If the body is decoded several times, such as with different schemas,
+// an overlay counts as applied if any of those decodes applied it. If the
+// body is never decoded at all then all of the overlays are reported.
+func ApplyOverlaysStrict(body hcl.Body, overlays ...Overlay) (hcl.Body, func() hcl.Diagnostics) {
+	overlays = nonNilOverlays(overlays)
+	tracker := &strictTracker{}
+	states := make([]*strictState, len(overlays))
+	for i, ov := range overlays {
+		states[i] = tracker.track(ov)
+	}
+	return applyOverlaysTracked(body, overlays, states, false), tracker.unapplied
+}
+
+// strictTracker tracks which overlays given to ApplyOverlaysStrict, or
+// remaining parts of them, have been applied.
+type strictTracker struct {
+	mu     sync.Mutex
+	states []*strictState
+}
+
+// strictState tracks whether one overlay has been applied.
+type strictState struct {
+	tracker *strictTracker
+	overlay Overlay
+	applied bool
+
+	// rest tracks the remaining part of the overlay if it applied only
+	// partially.
+	rest *strictState
+}
+
+func (t *strictTracker) track(ov Overlay) *strictState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.trackLocked(ov)
+}
+
+func (t *strictTracker) trackLocked(ov Overlay) *strictState {
+	st := &strictState{
+		tracker: t,
+		overlay: ov,
+	}
+	t.states = append(t.states, st)
+	return st
+}
+
+// unapplied returns an error diagnostic for each tracked overlay that
+// hasn't been applied.
+func (t *strictTracker) unapplied() hcl.Diagnostics {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var diags hcl.Diagnostics
+	for _, st := range t.states {
+		if st.applied {
+			continue
+		}
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Invalid argument",
+			Detail:   fmt.Sprintf("The overlay %q was never applied, because no part of the configuration that was decoded has the argument or block type it refers to.", overlayString(st.overlay)),
+		})
+	}
+	return diags
+}
+
+// markApplied records that the overlay has been applied. It does nothing
+// for a nil state, so that callers don't need to check whether the
+// overlay is tracked.
+func (s *strictState) markApplied() {
+	if s == nil {
+		return
+	}
+	s.tracker.mu.Lock()
+	s.applied = true
+	s.tracker.mu.Unlock()
+}
+
+// remnant returns the state for the given remaining part of the overlay
+// after it applied partially. The remaining part is tracked only once
+// even if the overlay applies partially several times, so that it counts
+// as applied if any of the remaining bodies applies it.
+func (s *strictState) remnant(rest Overlay) *strictState {
+	if s == nil {
+		return nil
+	}
+	s.tracker.mu.Lock()
+	defer s.tracker.mu.Unlock()
+	if s.rest == nil {
+		s.rest = s.tracker.trackLocked(rest)
+	}
+	return s.rest
+}
+
+// state returns the strict state for the overlay at the given index, or
+// nil if the body doesn't track its overlays.
+func (b *applyBody) state(i int) *strictState {
+	if b.states == nil {
+		return nil
+	}
+	return b.states[i]
+}
+
+// sameOverlay returns true if the two overlays are identical. Some overlay
+// implementations are not comparable, in which case the result is false.
+func sameOverlay(a, b Overlay) bool {
+	ty := reflect.TypeOf(a)
+	if ty != reflect.TypeOf(b) || !ty.Comparable() {
+		return false
+	}
+	return a == b
+}
@@ -0,0 +1,162 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestApplyOverlaysStrict(t *testing.T) {
+	type Stage1 struct {
+		IOMode string   `hcl:"io_mode,optional"`
+		Remain hcl.Body `hcl:",remain"`
+	}
+	type Stage2 struct {
+		Debug bool `hcl:"debug,optional"`
+	}
+
+	tests := map[string]struct {
+		Args []string
+		// Stage2 decodes the remaining body from the first stage if set.
+		Stage2   bool
+		WantErrs []string
+	}{
+		"all applied in first stage": {
+			Args: []string{"io_mode=async"},
+		},
+		"applied in second stage": {
+			Args:   []string{"io_mode=async", "debug:=true"},
+			Stage2: true,
+		},
+		"second stage not decoded": {
+			Args: []string{"io_mode=async", "debug:=true"},
+			WantErrs: []string{
+				`The overlay "debug:=true" was never applied`,
+			},
+		},
+		"misspelled in remain": {
+			Args: []string{"io_mode=async", "debgu:=true"},
+			WantErrs: []string{
+				`The overlay "debgu:=true" was never applied`,
+			},
+		},
+		"several unapplied": {
+			Args: []string{"iomode=async", "io_mode=sync", "debgu:=true"},
+			WantErrs: []string{
+				`The overlay "iomode=async" was never applied`,
+				`The overlay "debgu:=true" was never applied`,
+			},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+`), "config.hcl", hcl.InitialPos)
+			if diags.HasErrors() {
+				t.Fatalf("config has problems: %s", diags.Error())
+			}
+			var overlays []Overlay
+			for _, raw := range test.Args {
+				o, diags := ParseCLIArgument(raw)
+				if diags.HasErrors() {
+					t.Fatalf("unexpected problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			body, unapplied := ApplyOverlaysStrict(f.Body, overlays...)
+			var got1 Stage1
+			diags = gohcl.DecodeBody(body, nil, &got1)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if test.Stage2 {
+				var got2 Stage2
+				diags = gohcl.DecodeBody(got1.Remain, nil, &got2)
+				if diags.HasErrors() {
+					t.Fatalf("unexpected problems: %s", diags.Error())
+				}
+			}
+
+			diags = unapplied()
+			if got, want := len(diags), len(test.WantErrs); got != want {
+				t.Fatalf("wrong number of diagnostics %d; want %d\n%s", got, want, diags.Error())
+			}
+			for i, want := range test.WantErrs {
+				if got := diags[i].Detail; !strings.Contains(got, want) {
+					t.Errorf("wrong error %d\ngot:  %s\nwant: %s", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyOverlaysStrictMerged(t *testing.T) {
+	f, diags := hclsyntax.ParseConfig([]byte(`
+io_mode = "sync"
+`), "config.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	o, diags := ParseCLIArguments([]string{"io_mode=async", "debgu:=true"})
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+
+	body, unapplied := ApplyOverlaysStrict(f.Body, o)
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "io_mode"}},
+	}
+	// Decoding twice with the same schema must not track the remaining
+	// part of the merged overlay twice.
+	for i := 0; i < 2; i++ {
+		_, _, diags = body.PartialContent(schema)
+		if diags.HasErrors() {
+			t.Fatalf("unexpected problems: %s", diags.Error())
+		}
+	}
+
+	diags = unapplied()
+	if got, want := len(diags), 1; got != want {
+		t.Fatalf("wrong number of diagnostics %d; want %d\n%s", got, want, diags.Error())
+	}
+	if got, want := diags[0].Detail, `The overlay "debgu:=true" was never applied`; !strings.Contains(got, want) {
+		t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestApplyOverlaysStrictNotDecoded(t *testing.T) {
+	o, diags := ParseCLIArgument("io_mode=async")
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	_, unapplied := ApplyOverlaysStrict(hcl.EmptyBody(), o, nil)
+	diags = unapplied()
+	if got, want := len(diags), 1; got != want {
+		t.Fatalf("wrong number of diagnostics %d; want %d\n%s", got, want, diags.Error())
+	}
+}
+
+func TestApplyOverlaysStrictContent(t *testing.T) {
+	o, diags := ParseCLIArgument("debgu:=true")
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	body, unapplied := ApplyOverlaysStrict(hcl.EmptyBody(), o)
+
+	// Content reports the problem itself, so the overlay counts as applied.
+	_, diags = body.Content(&hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{{Name: "debug"}},
+	})
+	if !diags.HasErrors() {
+		t.Fatalf("unexpected success")
+	}
+	if diags := unapplied(); len(diags) != 0 {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+}
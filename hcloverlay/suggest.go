@@ -0,0 +1,71 @@
+package hcloverlay
+
+import (
+	"github.com/hashicorp/hcl/v2"
+)
+
+// schemaNameSuggestion returns the name of the attribute or block type in
+// the given schema that is most similar to the given name, or an empty
+// string if there is no name similar enough to be a plausible suggestion.
+func schemaNameSuggestion(given string, schema *hcl.BodySchema) string {
+	var candidates []string
+	for _, attrS := range schema.Attributes {
+		candidates = append(candidates, attrS.Name)
+	}
+	for _, blockS := range schema.Blocks {
+		candidates = append(candidates, blockS.Type)
+	}
+	return nameSuggestion(given, candidates)
+}
+
+// nameSuggestion returns the candidate with the smallest edit distance from
+// the given name, or an empty string if no candidate is within a small edit
+// distance. If there are several equally-close candidates then the first
+// of them is returned.
+func nameSuggestion(given string, candidates []string) string {
+	const maxDistance = 2
+
+	best := ""
+	bestDistance := maxDistance + 1
+	for _, candidate := range candidates {
+		if d := levenshtein(given, candidate); d < bestDistance {
+			best = candidate
+			bestDistance = d
+		}
+	}
+	return best
+}
+
+// levenshtein returns the Levenshtein edit distance between the two given
+// strings, counting insertions, deletions, and substitutions of individual
+// characters.
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,53 @@
+package hcloverlay
+
+import (
+	"testing"
+)
+
+func TestNameSuggestion(t *testing.T) {
+	candidates := []string{"io_mode", "service", "listen_addr"}
+	tests := map[string]string{
+		"io_mode":      "io_mode",
+		"io_mdoe":      "io_mode",
+		"io-mode":      "io_mode",
+		"servce":       "service",
+		"services":     "service",
+		"listen_adr":   "listen_addr",
+		"mode":         "",
+		"nonsense":     "",
+		"":             "",
+		"listen_addrs": "listen_addr",
+	}
+
+	for given, want := range tests {
+		t.Run(given, func(t *testing.T) {
+			got := nameSuggestion(given, candidates)
+			if got != want {
+				t.Errorf("wrong result\ngot:  %q\nwant: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		A, B string
+		Want int
+	}{
+		{"", "", 0},
+		{"a", "", 1},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"io_mode", "io_mdoe", 2},
+		{"héllo", "hello", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.A+"/"+test.B, func(t *testing.T) {
+			got := levenshtein(test.A, test.B)
+			if got != test.Want {
+				t.Errorf("wrong result\ngot:  %d\nwant: %d", got, test.Want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// SummarizeOverlays writes a short, human-readable description of each of
+// the given overlays to the given writer, one per line, such as
+// `io_mode: set to "async" (from command line option --io_mode)`. This is
+// intended for "verbose" modes in applications that want to echo which
+// overlays they recognized before decoding a configuration.
+//
+// Overlays produced by MergeOverlays or WithPriority are described in terms
+// of the overlays they wrap, as are those produced by NewConditionalOverlay
+// or NewOnceOverlay, along with their condition or a note that they apply
+// only once. Overlays that can't describe themselves, such
+// as those returned by NewFuncOverlay, are described as "custom overlay",
+// along with the paths they affect if they implement PathReporter.
+//
+// The result is the first error returned by the writer, if any.
+func SummarizeOverlays(w io.Writer, overlays []Overlay) error {
+	for _, ov := range flattenMergedOverlays(overlays) {
+		if _, err := fmt.Fprintln(w, describeOverlay(ov)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// describeOverlay returns a single-line description of the given overlay
+// for SummarizeOverlays.
+func describeOverlay(ov Overlay) string {
+	switch ov := ov.(type) {
+	case *cliArgOverlay:
+		ret := ov.describe()
+		if ov.source != "" {
+			ret += " (from " + ov.source + ")"
+		}
+		return ret
+	case *conditionalOverlay:
+		return describeOverlay(ov.inner) + ov.describeCondition()
+	case *onceOverlay:
+		return describeOverlay(ov.inner) + " (once)"
+	case fmt.Stringer:
+		return ov.String()
+	case PathReporter:
+		paths := ov.AffectedPaths()
+		if len(paths) == 0 {
+			return "custom overlay"
+		}
+		formatted := make([]string, len(paths))
+		for i, path := range paths {
+			formatted[i] = formatCLIPath(namedSteps(path))
+		}
+		return "custom overlay affecting " + strings.Join(formatted, ", ")
+	default:
+		return "custom overlay"
+	}
+}
+
+// describe returns a description of the overlay without its source, such as
+// `io_mode: set to "async"`.
+func (o *cliArgOverlay) describe() string {
+	var desc string
+	switch o.op {
+	case cliArgRemove:
+		desc = "remove"
+	case cliArgRemoveType:
+		desc = "remove all blocks"
+	case cliArgReset:
+		desc = "reset to original value"
+	case cliArgCreate:
+		desc = "create if not already present"
+	case cliArgAppend:
+		desc = "append " + describeValue(knownValue(o.expr))
+	case cliArgDefault:
+		desc = "set to " + describeValue(knownValue(o.expr)) + " if not already set"
+	default:
+		desc = "set to " + describeValue(knownValue(o.expr))
+	}
+	return o.fullPath + ": " + desc
+}
+
+// overlayString returns the String result for the given overlay if it has
+// one, or its description for SummarizeOverlays otherwise.
+func overlayString(ov Overlay) string {
+	if s, ok := ov.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return describeOverlay(ov)
+}
+
+// describeValue returns the given value in HCL native syntax, or a generic
+// description if it is cty.NilVal because it isn't known.
+func describeValue(v cty.Value) string {
+	if v == cty.NilVal {
+		return "an expression"
+	}
+	return formatValue(v)
+}
@@ -0,0 +1,153 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSummarizeOverlays(t *testing.T) {
+	var overlays []Overlay
+	for _, arg := range []string{
+		`io_mode=async`,
+		`count:=2`,
+		`tags+=prod`,
+		`service.http.web.listen_addr=:80`,
+		`ports:=[for p in var.ports : p]`,
+	} {
+		o, diags := ParseCLIArgument(arg)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		overlays = append(overlays, o)
+	}
+	withSource, diags := ParseCLIArgument(`io_mode=sync`)
+	if diags.HasErrors() {
+		t.Fatalf("arg has problems: %s", diags.Error())
+	}
+	remove, diags := NewRemoveOverlay(`service.http.web`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	removeType, diags := NewRemoveBlockTypeOverlay(`service`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	reset, diags := NewResetOverlay(`io_mode`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	def, diags := NewDefaultOverlay(`log_level`, `info`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	rename, diags := NewRenameOverlay(`mode`, `io_mode`, false)
+	if diags.HasErrors() {
+		t.Fatalf("names have problems: %s", diags.Error())
+	}
+	f, diags := hclsyntax.ParseConfig([]byte(`io_mode = "sync"`), "overrides.hcl", hcl.InitialPos)
+	if diags.HasErrors() {
+		t.Fatalf("config has problems: %s", diags.Error())
+	}
+	fn := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		return content, nil
+	})
+	overlays = append(overlays,
+		WithSource(withSource, "command line option --io_mode"),
+		MergeOverlays(remove, removeType),
+		WithPriority(reset, 1),
+		def,
+		rename,
+		NewLabelPredicateOverlay("service", func(labels []string) bool { return true }, "log_level", "debug"),
+		NewBodyOverlay(f.Body),
+		&testPathReporter{Overlay: fn, paths: [][]string{{"a"}, {"b", "c"}}},
+		fn,
+		WithSource(NewOnceOverlay(withSource), "command line option --io_mode"),
+	)
+
+	var buf strings.Builder
+	if err := SummarizeOverlays(&buf, overlays); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	want := []string{
+		`io_mode: set to "async"`,
+		`count: set to 2`,
+		`tags: append "prod"`,
+		`service.http.web.listen_addr: set to ":80"`,
+		`ports: set to an expression`,
+		`io_mode: set to "sync" (from command line option --io_mode)`,
+		`service.http.web: remove`,
+		`service: remove all blocks`,
+		`io_mode: reset to original value`,
+		`log_level: set to "info" if not already set`,
+		`mode: rename to io_mode`,
+		`service.*.log_level: set to "debug" in blocks selected by a function`,
+		`merge content from overrides.hcl`,
+		`custom overlay affecting a, b.c`,
+		`custom overlay`,
+		`io_mode: set to "sync" (from command line option --io_mode) (once)`,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong summary\n%s", diff)
+	}
+}
+
+func TestOverlayString(t *testing.T) {
+	parse := func(raw string) Overlay {
+		o, diags := ParseCLIArgument(raw)
+		if diags.HasErrors() {
+			t.Fatalf("arg has problems: %s", diags.Error())
+		}
+		return o
+	}
+	remove, diags := NewRemoveOverlay(`service.http.web`)
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	static, diags := NewExprOverlay(`count`, hcl.StaticExpr(cty.NumberIntVal(2), hcl.Range{}))
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+	cond, diags := NewConditionalOverlay(`tls_enabled`, cty.True, parse(`tls_cert=cert.pem`))
+	if diags.HasErrors() {
+		t.Fatalf("path has problems: %s", diags.Error())
+	}
+
+	tests := map[string]struct {
+		Overlay Overlay
+		Want    string
+	}{
+		"string":            {parse(`io_mode=async`), `io_mode=async`},
+		"nested":            {parse(`service.web.main.listen_addr=0.0.0.0:80`), `service.web.main.listen_addr=0.0.0.0:80`},
+		"escaped":           {parse(`greeting=\@hello`), `greeting=\@hello`},
+		"expression":        {parse(`ports:=[for p in var.ports : p]`), `ports:=[for p in var.ports : p]`},
+		"append":            {parse(`tags+=prod`), `tags+=prod`},
+		"known value":       {static, `count:=2`},
+		"remove":            {remove, `service.http.web: remove`},
+		"merged":            {MergeOverlays(parse(`io_mode=async`), nil, parse(`count:=2`)), `io_mode=async count:=2`},
+		"priority":          {WithPriority(parse(`io_mode=async`), 10), `io_mode=async (priority 10)`},
+		"source is omitted": {WithSource(parse(`io_mode=async`), "environment variable APP_IO_MODE"), `io_mode=async`},
+		"conditional":       {cond, `tls_cert=cert.pem if tls_enabled is true`},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := fmt.Sprint(test.Overlay); got != test.Want {
+				t.Errorf("wrong result\ngot:  %s\nwant: %s", got, test.Want)
+			}
+		})
+	}
+
+	t.Run("sub-overlay", func(t *testing.T) {
+		o := parse(`service.web.main.listen_addr=0.0.0.0:80`).(*cliArgOverlay)
+		sub := o.subOverlay(o.steps[3:])
+		if got, want := sub.String(), `service.web.main.listen_addr=0.0.0.0:80`; got != want {
+			t.Errorf("wrong result\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package hcloverlay
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// OverlaysToHCL returns HCL native syntax source code describing the
+// arguments and blocks that the given overlays would set, for logging or
+// auditing the effective overrides in a reproducible form.
+//
+// Overlays produced from paths, such as those returned by ParseCLIArgument,
+// are rendered by reconstructing blocks from their paths. Because overlays
+// are not associated with a schema, a path of more than one step is assumed
+// to consist of a block type, then zero or more labels, and then the name
+// of an argument in that block, which is correct for the typical case of
+// a block type nested directly inside the root body. Overlays with the same
+// block type and labels contribute to the same block.
+//
+// Overlays that cannot be rendered in this way, such as those returned by
+// NewFuncOverlay, removal or default overlays, overlays that append to a
+// sequence, and overlays whose values cannot be determined without an
+// evaluation context, are represented by comments and also reported by
+// warning diagnostics. Nil overlays are ignored, as for ApplyOverlays.
+func OverlaysToHCL(overlays ...Overlay) ([]byte, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+	f := hclwrite.NewEmptyFile()
+	for _, ov := range overlays {
+		diags = append(diags, writeOverlayHCL(f.Body(), ov)...)
+	}
+	return hclwrite.Format(f.Bytes()), diags
+}
+
+func writeOverlayHCL(body *hclwrite.Body, ov Overlay) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+
+	switch ov := ov.(type) {
+	case nil:
+		return diags // ignored, as for ApplyOverlays
+	case *mergedOverlay:
+		for _, ov := range ov.overlays {
+			diags = append(diags, writeOverlayHCL(body, ov)...)
+		}
+		return diags
+	case *priorityOverlay:
+		return writeOverlayHCL(body, ov.Overlay)
+	case *recordingOverlay:
+		return writeOverlayHCL(body, ov.inner)
+	case *cliArgOverlay:
+		for _, step := range ov.steps {
+			if step.wildcard || step.placeholder || step.hasIndex {
+				return writeOverlayPlaceholder(body, ov.fullPath, "selects blocks by wildcard or index")
+			}
+		}
+		switch ov.op {
+		case cliArgRemove:
+			return writeOverlayPlaceholder(body, ov.fullPath, "removes an argument or block")
+		case cliArgRemoveType:
+			return writeOverlayPlaceholder(body, ov.fullPath, "removes all blocks of a type")
+		case cliArgDefault:
+			return writeOverlayPlaceholder(body, ov.fullPath, "sets an argument only if it isn't already set")
+		case cliArgReset:
+			return writeOverlayPlaceholder(body, ov.fullPath, "restores an argument's original value")
+		case cliArgAppend:
+			return writeOverlayPlaceholder(body, ov.fullPath, "appends to a sequence")
+		case cliArgCreate:
+			blockType, labels := ov.steps[0].name, stepNames(ov.steps[1:])
+			if body.FirstMatchingBlock(blockType, labels) == nil {
+				body.AppendNewBlock(blockType, labels)
+			}
+			return diags
+		}
+
+		target := body
+		if len(ov.steps) > 1 {
+			blockType := ov.steps[0].name
+			labels := stepNames(ov.steps[1 : len(ov.steps)-1])
+			block := body.FirstMatchingBlock(blockType, labels)
+			if block == nil {
+				block = body.AppendNewBlock(blockType, labels)
+			}
+			target = block.Body()
+		}
+		name := ov.steps[len(ov.steps)-1].name
+		if !hclsyntax.ValidIdentifier(name) {
+			return writeOverlayPlaceholder(body, ov.fullPath, "has a name that isn't a valid identifier")
+		}
+
+		if v := knownValue(ov.expr); v != cty.NilVal {
+			target.SetAttributeValue(name, v)
+			return diags
+		}
+		if traversal, travDiags := hcl.AbsTraversalForExpr(ov.expr); !travDiags.HasErrors() {
+			target.SetAttributeTraversal(name, traversal)
+			return diags
+		}
+		return writeOverlayPlaceholder(body, ov.fullPath, "sets an expression that cannot be rendered")
+	default:
+		diags = diags.Append(&hcl.Diagnostic{
+			Severity: hcl.DiagWarning,
+			Summary:  "Overlay cannot be rendered as HCL",
+			Detail:   fmt.Sprintf("An overlay of type %T cannot be rendered as HCL, so it is represented only by a comment.", ov),
+		})
+		body.AppendUnstructuredTokens(commentTokens(fmt.Sprintf("# (overlay of type %T)\n", ov)))
+		return diags
+	}
+}
+
+func writeOverlayPlaceholder(body *hclwrite.Body, path, desc string) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	diags = diags.Append(&hcl.Diagnostic{
+		Severity: hcl.DiagWarning,
+		Summary:  "Overlay cannot be rendered as HCL",
+		Detail:   fmt.Sprintf("The overlay for %q %s, so it is represented only by a comment.", path, desc),
+	})
+	body.AppendUnstructuredTokens(commentTokens(fmt.Sprintf("# %s: %s\n", path, desc)))
+	return diags
+}
+
+func commentTokens(comment string) hclwrite.Tokens {
+	return hclwrite.Tokens{
+		{
+			Type:  hclsyntax.TokenComment,
+			Bytes: []byte(comment),
+		},
+	}
+}
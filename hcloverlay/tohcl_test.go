@@ -0,0 +1,122 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestOverlaysToHCL(t *testing.T) {
+	tests := map[string]struct {
+		Args         []string
+		Want         string
+		WantWarnings int
+	}{
+		"none": {
+			nil,
+			``,
+			0,
+		},
+		"root attributes": {
+			[]string{`io_mode=async`, `count:=2`, `tags:=["a", "b"]`},
+			`io_mode = "async"
+count   = 2
+tags    = ["a", "b"]
+`,
+			0,
+		},
+		"later overlay replaces earlier": {
+			[]string{`io_mode=async`, `io_mode=sync`},
+			`io_mode = "sync"
+`,
+			0,
+		},
+		"blocks": {
+			[]string{
+				`service.http.web.listen_addr=:80`,
+				`service.http.api.listen_addr=:81`,
+				`service.http.web.tls:=true`,
+				`logging.level=debug`,
+				`service.http."web.prod".listen_addr=:82`,
+			},
+			`service "http" "web" {
+  listen_addr = ":80"
+  tls         = true
+}
+service "http" "api" {
+  listen_addr = ":81"
+}
+logging {
+  level = "debug"
+}
+service "http" "web.prod" {
+  listen_addr = ":82"
+}
+`,
+			0,
+		},
+		"traversal": {
+			[]string{`io_mode:=var.mode`},
+			`io_mode = var.mode
+`,
+			0,
+		},
+		"not renderable": {
+			[]string{`io_mode=async`, `tags+=a`, `count:=var.a + 1`, `service.http[0].listen_addr=:80`},
+			`io_mode = "async"
+# tags: appends to a sequence
+# count: sets an expression that cannot be rendered
+# service.http[0].listen_addr: selects blocks by wildcard or index
+`,
+			3,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				o, diags := ParseCLIArgument(arg)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			got, diags := OverlaysToHCL(overlays...)
+			if diags.HasErrors() {
+				t.Fatalf("unexpected problems: %s", diags.Error())
+			}
+			if diff := cmp.Diff(test.Want, string(got)); diff != "" {
+				t.Errorf("wrong result\n%s", diff)
+			}
+			if got, want := len(diags), test.WantWarnings; got != want {
+				t.Errorf("wrong number of warnings %d; want %d\n%s", got, want, diags.Error())
+			}
+		})
+	}
+}
+
+func TestOverlaysToHCLOtherOverlays(t *testing.T) {
+	remove, _ := NewRemoveOverlay("io_mode")
+	set, _ := ParseCLIArgument("count:=1")
+	fn := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+		return content, nil
+	})
+
+	got, diags := OverlaysToHCL(MergeOverlays(remove, set), nil, fn)
+	if diags.HasErrors() {
+		t.Fatalf("unexpected problems: %s", diags.Error())
+	}
+	want := `# io_mode: removes an argument or block
+count = 1
+# (overlay of type hcloverlay.funcOverlay)
+`
+	if diff := cmp.Diff(want, string(got)); diff != "" {
+		t.Errorf("wrong result\n%s", diff)
+	}
+	if got, want := len(diags), 2; got != want {
+		t.Errorf("wrong number of warnings %d; want %d\n%s", got, want, diags.Error())
+	}
+}
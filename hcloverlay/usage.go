@@ -0,0 +1,183 @@
+package hcloverlay
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// GenerateUsage returns text describing the options that ExtractCLIOptions
+// would accept for the given schema, with one option per line, so that
+// applications can keep their usage text in sync with their configuration
+// schema.
+//
+// Labels of block types are shown as placeholders derived from the label
+// names in the schema, written in uppercase. Because a schema describes only
+// a single body, the arguments inside each block are shown using the
+// placeholder ARGUMENT. Use GenerateUsageForStruct to describe the
+// arguments inside blocks too, when the schema is implied by a Go struct.
+//
+// For example, the result might include the following lines:
+//
+//     --io_mode=VALUE
+//     --service.TYPE.NAME.ARGUMENT=VALUE
+func GenerateUsage(schema *hcl.BodySchema) string {
+	var buf strings.Builder
+	for _, attrS := range schema.Attributes {
+		writeUsageLine(&buf, []structPathStep{{name: attrS.Name}})
+	}
+	for _, blockS := range schema.Blocks {
+		steps := []structPathStep{{name: blockS.Type}}
+		for _, labelName := range blockS.LabelNames {
+			steps = append(steps, structPathStep{name: labelName, label: true})
+		}
+		steps = append(steps, structPathStep{name: "argument", label: true})
+		writeUsageLine(&buf, steps)
+	}
+	return buf.String()
+}
+
+// GenerateUsageForStruct is like GenerateUsage except that it works with a
+// Go struct value, or a pointer to one, that is annotated with the "hcl"
+// struct tags that gohcl uses to decode bodies. This allows it to also
+// describe the arguments inside blocks, recursively.
+//
+// It returns an error if the given value is not a struct or a pointer to a
+// struct, or if it has "hcl" struct tags that gohcl would not accept.
+func GenerateUsageForStruct(v interface{}) (string, error) {
+	var buf strings.Builder
+	err := walkStructPaths(v, func(steps []structPathStep) {
+		writeUsageLine(&buf, steps)
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// EnumeratePaths returns the dot-separated paths of all of the arguments
+// that can be set in a body decoded into the given Go struct value, or
+// pointer to one, using the "hcl" struct tags that gohcl uses. This includes
+// the arguments inside nested blocks, recursively.
+//
+// Block labels are represented in the paths by placeholders consisting of
+// the label name in angle brackets, as in "service.<type>.<name>.listen_addr",
+// so that applications can use the results to validate or complete paths.
+// Paths are returned in the order the corresponding fields are declared.
+//
+// It returns an error if the given value is not a struct or a pointer to a
+// struct, or if it has "hcl" struct tags that gohcl would not accept.
+func EnumeratePaths(v interface{}) ([]string, error) {
+	var ret []string
+	err := walkStructPaths(v, func(steps []structPathStep) {
+		var buf strings.Builder
+		for i, step := range steps {
+			if i > 0 {
+				buf.WriteByte('.')
+			}
+			if step.label {
+				buf.WriteString("<" + step.name + ">")
+			} else {
+				buf.WriteString(step.name)
+			}
+		}
+		ret = append(ret, buf.String())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func writeUsageLine(buf *strings.Builder, steps []structPathStep) {
+	buf.WriteString("--")
+	for i, step := range steps {
+		if i > 0 {
+			buf.WriteByte('.')
+		}
+		if step.label {
+			buf.WriteString(strings.ToUpper(step.name))
+		} else {
+			buf.WriteString(step.name)
+		}
+	}
+	buf.WriteString("=VALUE\n")
+}
+
+// structPathStep is a single step in a path found by walkStructPaths.
+type structPathStep struct {
+	// name is the name of an argument or block type, or the name of a
+	// block label if label is set.
+	name  string
+	label bool
+}
+
+// walkStructPaths calls the given function for the path of each argument
+// that can be set in a body decoded into the given struct value, including
+// the arguments inside nested blocks.
+//
+// The given function must not retain the slice it is passed, because it
+// will be modified by subsequent calls.
+func walkStructPaths(v interface{}, fn func([]structPathStep)) error {
+	ty := reflect.TypeOf(v)
+	if ty != nil && ty.Kind() == reflect.Ptr {
+		ty = ty.Elem()
+	}
+	if ty == nil || ty.Kind() != reflect.Struct {
+		return fmt.Errorf("value must be a struct or a pointer to a struct, not %T", v)
+	}
+	return walkStructTypePaths(ty, nil, map[reflect.Type]bool{}, fn)
+}
+
+func walkStructTypePaths(ty reflect.Type, prefix []structPathStep, visiting map[reflect.Type]bool, fn func([]structPathStep)) error {
+	if visiting[ty] {
+		// A block type that contains itself, directly or indirectly, would
+		// have infinitely many paths, so we'll just stop here.
+		return nil
+	}
+	visiting[ty] = true
+	defer delete(visiting, ty)
+
+	for i := 0; i < ty.NumField(); i++ {
+		field := ty.Field(i)
+		tag := field.Tag.Get("hcl")
+		if tag == "" {
+			continue
+		}
+		name, kind := tag, "attr"
+		if comma := strings.IndexByte(tag, ','); comma >= 0 {
+			name, kind = tag[:comma], tag[comma+1:]
+		}
+
+		switch kind {
+		case "attr", "optional":
+			fn(append(prefix, structPathStep{name: name}))
+		case "block":
+			blockTy := field.Type
+			for blockTy.Kind() == reflect.Ptr || blockTy.Kind() == reflect.Slice {
+				blockTy = blockTy.Elem()
+			}
+			if blockTy.Kind() != reflect.Struct {
+				return fmt.Errorf("field %s of %s must be a struct, a pointer to a struct, or a slice of either to be used as a block", field.Name, ty)
+			}
+			steps := append(prefix, structPathStep{name: name})
+			for j := 0; j < blockTy.NumField(); j++ {
+				labelTag := blockTy.Field(j).Tag.Get("hcl")
+				if strings.HasSuffix(labelTag, ",label") {
+					steps = append(steps, structPathStep{name: strings.TrimSuffix(labelTag, ",label"), label: true})
+				}
+			}
+			if err := walkStructTypePaths(blockTy, steps, visiting, fn); err != nil {
+				return err
+			}
+		case "label", "remain":
+			// Labels are handled by the containing struct, and a remaining
+			// body has no predefined arguments, so we ignore these.
+		default:
+			return fmt.Errorf("field %s of %s has invalid hcl struct tag kind %q", field.Name, ty, kind)
+		}
+	}
+	return nil
+}
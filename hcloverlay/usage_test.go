@@ -0,0 +1,149 @@
+package hcloverlay
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestGenerateUsage(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode"},
+		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "service", LabelNames: []string{"type", "name"}},
+			{Type: "logging"},
+		},
+	}
+
+	got := GenerateUsage(schema)
+	want := `--io_mode=VALUE
+--service.TYPE.NAME.ARGUMENT=VALUE
+--logging.ARGUMENT=VALUE
+`
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("wrong result\n%s", diff)
+	}
+}
+
+func TestGenerateUsageForStruct(t *testing.T) {
+	type Listener struct {
+		Port int `hcl:"port"`
+	}
+	type Service struct {
+		Type       string     `hcl:"type,label"`
+		Name       string     `hcl:"name,label"`
+		ListenAddr string     `hcl:"listen_addr"`
+		Listeners  []Listener `hcl:"listener,block"`
+		Remain     hcl.Body   `hcl:",remain"`
+	}
+	type Logging struct {
+		Level string `hcl:"level,optional"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Services []Service `hcl:"service,block"`
+		Logging  *Logging  `hcl:"logging,block"`
+		Ignored  string
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		got, err := GenerateUsageForStruct(&Config{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := `--io_mode=VALUE
+--service.TYPE.NAME.listen_addr=VALUE
+--service.TYPE.NAME.listener.port=VALUE
+--logging.level=VALUE
+`
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("wrong result\n%s", diff)
+		}
+	})
+	t.Run("not a struct", func(t *testing.T) {
+		_, err := GenerateUsageForStruct("nope")
+		if err == nil {
+			t.Fatalf("unexpected success")
+		}
+		if got, want := err.Error(), "value must be a struct or a pointer to a struct, not string"; got != want {
+			t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("recursive block type", func(t *testing.T) {
+		type Node struct {
+			Value    string  `hcl:"value"`
+			Children []*Node `hcl:"child,block"`
+		}
+		got, err := GenerateUsageForStruct(Node{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := `--value=VALUE
+`
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("wrong result\n%s", diff)
+		}
+	})
+}
+
+func TestEnumeratePaths(t *testing.T) {
+	type Listener struct {
+		Port int `hcl:"port"`
+	}
+	type Service struct {
+		Type       string      `hcl:"type,label"`
+		Name       string      `hcl:"name,label"`
+		ListenAddr string      `hcl:"listen_addr"`
+		Listeners  []*Listener `hcl:"listener,block"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode,optional"`
+		Services []Service `hcl:"service,block"`
+		Bad      string    `hcl:"bad,nope"`
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		got, err := EnumeratePaths(Service{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := []string{
+			"listen_addr",
+			"listener.port",
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("wrong result\n%s", diff)
+		}
+	})
+	t.Run("invalid tag", func(t *testing.T) {
+		_, err := EnumeratePaths(&Config{})
+		if err == nil {
+			t.Fatalf("unexpected success")
+		}
+		if got, want := err.Error(), `has invalid hcl struct tag kind "nope"`; !strings.Contains(got, want) {
+			t.Errorf("wrong error\ngot:  %s\nwant: %s", got, want)
+		}
+	})
+	t.Run("nested labels", func(t *testing.T) {
+		type ValidConfig struct {
+			IOMode   string    `hcl:"io_mode,optional"`
+			Services []Service `hcl:"service,block"`
+		}
+		got, err := EnumeratePaths(&ValidConfig{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		want := []string{
+			"io_mode",
+			"service.<type>.<name>.listen_addr",
+			"service.<type>.<name>.listener.port",
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("wrong result\n%s", diff)
+		}
+	})
+}
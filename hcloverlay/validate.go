@@ -0,0 +1,177 @@
+package hcloverlay
+
+import (
+	"reflect"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+)
+
+// ValidateOverlays checks whether the given overlays are valid for a body
+// with the given schema, returning error diagnostics for any that are not.
+//
+// Normally an invalid overlay is detected only when the content of the
+// body it is applied to is decoded, and only if the relevant part of the
+// schema is decoded. ValidateOverlays allows an application to instead
+// detect problems like misspelled argument names or missing block labels
+// before doing any other work.
+//
+// Only the parts of the overlays' paths that relate to the given schema
+// are checked: the first step of each path must be the name of an argument
+// or block type in the schema, and paths through a block type must specify
+// the expected number of labels. Because a schema describes only a single
+// body, paths are not checked any further inside blocks, but
+// ValidateOverlaysForStruct can check them all the way to the argument they
+// set if the application decodes into Go structs. Overlays that are
+// not based on paths, such as those returned by NewFuncOverlay, are not
+// checked at all.
+func ValidateOverlays(schema *hcl.BodySchema, overlays ...Overlay) hcl.Diagnostics {
+	var diags hcl.Diagnostics
+	for _, ov := range overlays {
+		switch ov := ov.(type) {
+		case *mergedOverlay:
+			diags = append(diags, ValidateOverlays(schema, ov.overlays...)...)
+		case *priorityOverlay:
+			diags = append(diags, ValidateOverlays(schema, ov.Overlay)...)
+		case *recordingOverlay:
+			diags = append(diags, ValidateOverlays(schema, ov.inner)...)
+		case *cliArgOverlay:
+			if diag := ov.validate(schema); diag != nil {
+				diags = diags.Append(diag)
+			}
+		}
+	}
+	return diags
+}
+
+// validate returns a diagnostic describing why the overlay is not valid
+// for the given schema, or nil if it is valid.
+func (o *cliArgOverlay) validate(schema *hcl.BodySchema) *hcl.Diagnostic {
+	name := o.steps[0].name
+	for _, attrS := range schema.Attributes {
+		if attrS.Name == name {
+			if o.prefersBlockType() && schemaHasBlockType(schema, name) {
+				break
+			}
+			if !o.attributeStepsValid() {
+				return o.invalidArgError()
+			}
+			return nil
+		}
+	}
+	for _, blockS := range schema.Blocks {
+		if blockS.Type == name {
+			if !o.blockStepsValid(blockS) {
+				return o.invalidBlockStepsError(blockS)
+			}
+			return nil
+		}
+	}
+	return o.unexpectedArgError(schema)
+}
+
+// ValidateOverlaysForStruct is like ValidateOverlays except that it takes a
+// Go struct value, or a pointer to one, that is annotated with the "hcl"
+// struct tags that gohcl uses to decode bodies, rather than a schema.
+//
+// Because the struct also describes the content of nested blocks, the paths
+// of the overlays are then checked all the way to the argument they set, so
+// that for example an overlay whose path has too few labels for a nested
+// block type is reported even if the application never decodes that block.
+// Otherwise such an overlay would be ignored without any error if the
+// nested block is not decoded.
+//
+// A struct with a field tagged "remain" may accept arguments and block
+// types that it doesn't describe, so paths that refer to such names are not
+// checked any further. As for gohcl.ImpliedBodySchema, ValidateOverlaysForStruct
+// panics if the given value is not a struct or a pointer to a struct.
+func ValidateOverlaysForStruct(v interface{}, overlays ...Overlay) hcl.Diagnostics {
+	ty := reflect.TypeOf(v)
+	if ty != nil && ty.Kind() == reflect.Ptr {
+		ty = ty.Elem()
+	}
+	var diags hcl.Diagnostics
+	for _, ov := range flattenOverlays(overlays) {
+		if ov, ok := ov.(*cliArgOverlay); ok {
+			if diag := ov.validateStructType(ty); diag != nil {
+				diags = diags.Append(diag)
+			}
+		}
+	}
+	return diags
+}
+
+// validateStructType is like validate except that it checks the overlay
+// against the schema implied by the given struct type, and then recursively
+// checks the remainder of its path against the struct types of any block
+// it traverses through.
+func (o *cliArgOverlay) validateStructType(ty reflect.Type) *hcl.Diagnostic {
+	schema, partial := gohcl.ImpliedBodySchema(reflect.New(ty).Interface())
+	name := o.steps[0].name
+	if partial && !schemaHasName(schema, name) {
+		return nil // belongs to the remaining body, which we can't check
+	}
+	if diag := o.validate(schema); diag != nil {
+		return diag
+	}
+
+	// Only a path that continues past its first step can traverse into a
+	// block, as in validate.
+	var blockS hcl.BlockHeaderSchema
+	for _, s := range schema.Blocks {
+		if s.Type == name && o.prefersBlockType() {
+			blockS = s
+		}
+	}
+	if blockS.Type == "" {
+		return nil // the path ends at an argument or at the block itself
+	}
+	headerLen := 1 + len(blockS.LabelNames)
+	if o.op == cliArgRemoveType || len(o.steps) == headerLen {
+		return nil // the path ends at the block itself
+	}
+	blockTy := structBlockType(ty, name)
+	if blockTy == nil {
+		return nil
+	}
+	return o.subOverlay(o.steps[headerLen:]).validateStructType(blockTy)
+}
+
+// structBlockType returns the struct type of the field of the given struct
+// type that decodes blocks of the given type, or nil if there is no such
+// field.
+func structBlockType(ty reflect.Type, blockType string) reflect.Type {
+	for i := 0; i < ty.NumField(); i++ {
+		field := ty.Field(i)
+		if field.Tag.Get("hcl") != blockType+",block" {
+			continue
+		}
+		blockTy := field.Type
+		for blockTy.Kind() == reflect.Ptr || blockTy.Kind() == reflect.Slice {
+			blockTy = blockTy.Elem()
+		}
+		if blockTy.Kind() != reflect.Struct {
+			return nil
+		}
+		return blockTy
+	}
+	return nil
+}
+
+// ParseCLIArgumentForSchema is like ParseCLIArgument except that it also
+// immediately checks the resulting overlay against the given schema, in
+// the same way as ValidateOverlays, so that an application can report a
+// misspelled argument name or missing block labels before it has loaded
+// the configuration the overlay will be applied to.
+//
+// If the argument is syntactically valid then the overlay is returned even
+// if it is not valid for the schema, along with error diagnostics
+// describing the problem, so that callers can choose to proceed anyway.
+func ParseCLIArgumentForSchema(raw string, schema *hcl.BodySchema) (Overlay, hcl.Diagnostics) {
+	o, diags := ParseCLIArgument(raw)
+	if o == nil {
+		return nil, diags
+	}
+	diags = append(diags, ValidateOverlays(schema, o)...)
+	return o, diags
+}
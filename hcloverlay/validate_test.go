@@ -0,0 +1,253 @@
+package hcloverlay
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hashicorp/hcl/v2"
+)
+
+func TestValidateOverlays(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode", Required: true},
+			{Name: "labels"},
+		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "service", LabelNames: []string{"type", "name"}},
+			{Type: "logging"},
+		},
+	}
+
+	tests := map[string]struct {
+		Args []string
+		Want []string
+	}{
+		"none": {
+			nil,
+			nil,
+		},
+		"valid": {
+			[]string{
+				`io_mode=async`,
+				`labels.env=prod`,
+				`service.http.web.listen_addr=:80`,
+				`service.http.web.anything.at.all=:80`,
+				`service.http.*[0].listen_addr=:80`,
+				`logging.level=debug`,
+			},
+			nil,
+		},
+		"unexpected argument": {
+			[]string{`io_mdoe=async`, `nope=a`},
+			[]string{
+				`Unexpected argument "io_mdoe". Did you mean "io_mode"?`,
+				`Unexpected argument "nope".`,
+			},
+		},
+		"missing labels": {
+			[]string{`service.web=x`, `service.http.web=x`},
+			[]string{
+				`Unexpected argument "service.web": block type "service" requires 2 labels, but the path provides 0.`,
+				`Unexpected argument "service.http.web": block type "service" requires 2 labels, but the path provides 1.`,
+			},
+		},
+		"nested key in attribute": {
+			[]string{`io_mode.a.b=x`},
+			nil,
+		},
+		"append to key in attribute": {
+			[]string{`io_mode.a+=x`},
+			[]string{`Unexpected argument "io_mode.a".`},
+		},
+		"index on attribute": {
+			[]string{`io_mode[0]=x`},
+			[]string{`Unexpected argument "io_mode[0]".`},
+		},
+		"index on label that isn't last": {
+			[]string{`service.http[0].web.listen_addr=x`},
+			[]string{`Unexpected argument "service.http[0].web.listen_addr".`},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				o, diags := ParseCLIArgument(arg)
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			diags := ValidateOverlays(schema, overlays...)
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Detail)
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Errorf("wrong diagnostics\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("other overlays", func(t *testing.T) {
+		remove, _ := NewRemoveOverlay("service.http.web")
+		bad, _ := NewRemoveOverlay("servce.http.web")
+		fn := NewFuncOverlay(func(content *hcl.BodyContent, schema *hcl.BodySchema) (*hcl.BodyContent, hcl.Diagnostics) {
+			return content, nil
+		})
+
+		diags := ValidateOverlays(schema, MergeOverlays(remove, bad), fn)
+		var got []string
+		for _, diag := range diags {
+			got = append(got, diag.Detail)
+		}
+		want := []string{`Unexpected argument "servce.http.web". Did you mean "service"?`}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("wrong diagnostics\n%s", diff)
+		}
+	})
+}
+
+func TestValidateOverlaysForStruct(t *testing.T) {
+	type Listener struct {
+		Protocol string `hcl:"protocol,label"`
+		Port     int    `hcl:"port"`
+	}
+	type Service struct {
+		Type       string     `hcl:"type,label"`
+		Name       string     `hcl:"name,label"`
+		ListenAddr string     `hcl:"listen_addr,optional"`
+		Listeners  []Listener `hcl:"listener,block"`
+	}
+	type Plugin struct {
+		Name   string   `hcl:"name,label"`
+		Remain hcl.Body `hcl:",remain"`
+	}
+	type Config struct {
+		IOMode   string    `hcl:"io_mode"`
+		Services []Service `hcl:"service,block"`
+		Plugins  []*Plugin `hcl:"plugin,block"`
+	}
+
+	tests := map[string]struct {
+		Args []string
+		Want []string
+	}{
+		"valid": {
+			[]string{
+				`io_mode=async`,
+				`service.http.web.listen_addr=:80`,
+				`service.http.web.listener.tcp.port:=80`,
+				`service.http.*.listener.tcp[*].port:=80`,
+				`plugin.foo.anything.at.all=x`,
+			},
+			nil,
+		},
+		"removing blocks": {
+			[]string{`service.http.web.listener.tcp`, `service.http.web`},
+			nil,
+		},
+		"unexpected nested argument": {
+			[]string{`service.http.web.listen_adr=:80`},
+			[]string{`Unexpected argument "service.http.web.listen_adr". Did you mean "listen_addr"?`},
+		},
+		"missing nested labels": {
+			[]string{`service.http.web.listener.port:=80`},
+			[]string{`Unexpected argument "service.http.web.listener.port": block type "listener" requires 1 label, but the path provides 0.`},
+		},
+		"missing top-level labels": {
+			[]string{`service.web.listen_addr=:80`},
+			[]string{`Unexpected argument "service.web.listen_addr": block type "service" requires 2 labels, but the path provides 1.`},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var overlays []Overlay
+			for _, arg := range test.Args {
+				var o Overlay
+				var diags hcl.Diagnostics
+				if name == "removing blocks" {
+					o, diags = NewRemoveOverlay(arg)
+				} else {
+					o, diags = ParseCLIArgument(arg)
+				}
+				if diags.HasErrors() {
+					t.Fatalf("arg has problems: %s", diags.Error())
+				}
+				overlays = append(overlays, o)
+			}
+
+			diags := ValidateOverlaysForStruct(&Config{}, MergeOverlays(overlays...))
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Detail)
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Errorf("wrong diagnostics\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCLIArgumentForSchema(t *testing.T) {
+	schema := &hcl.BodySchema{
+		Attributes: []hcl.AttributeSchema{
+			{Name: "io_mode"},
+		},
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "service", LabelNames: []string{"type", "name"}},
+		},
+	}
+
+	tests := map[string]struct {
+		Arg         string
+		WantOverlay bool
+		Want        []string
+	}{
+		"valid attribute": {
+			`io_mode=async`,
+			true,
+			nil,
+		},
+		"valid block": {
+			`service.http.web.listen_addr=:80`,
+			true,
+			nil,
+		},
+		"unexpected argument": {
+			`io_mdoe=async`,
+			true,
+			[]string{`Unexpected argument "io_mdoe". Did you mean "io_mode"?`},
+		},
+		"missing labels": {
+			`service.web.listen_addr=:80`,
+			true,
+			[]string{`Unexpected argument "service.web.listen_addr": block type "service" requires 2 labels, but the path provides 1.`},
+		},
+		"invalid syntax": {
+			`io_mode`,
+			false,
+			[]string{`Invalid argument "io_mode": must be a configuration setting, followed by an equals sign, and then a value for that setting.`},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			o, diags := ParseCLIArgumentForSchema(test.Arg, schema)
+			if got, want := o != nil, test.WantOverlay; got != want {
+				t.Errorf("wrong overlay result %#v", o)
+			}
+			var got []string
+			for _, diag := range diags {
+				got = append(got, diag.Detail)
+			}
+			if diff := cmp.Diff(test.Want, got); diff != "" {
+				t.Errorf("wrong diagnostics\n%s", diff)
+			}
+		})
+	}
+}